@@ -1,4 +1,4 @@
-//go:generate go run ../main.go
+//go:generate go run ..
 package example
 
 import (
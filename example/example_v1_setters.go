@@ -1,4 +1,8 @@
-// Code generated by go-struct-gen; DO NOT EDIT.
+// Code generated by go-gen-struct. DO NOT EDIT.
+// Source: example_v1.go
+// gen-struct output: v8
+// gen-struct version: (devel)
+// gen-struct checksum: sha256:15473582711d57675e212f0b77f79e435eb1eef8b55889b6aa507c169b8c8cc2
 
 package example
 
@@ -13,3 +17,12 @@ func (s *example) SetCreatedAt(v time.Time) {
 func (s *example) SetUpdatedAt(v time.Time) {
 	s.UpdatedAt = v
 }
+
+// EnsureCreatedAt sets CreatedAt only when it is still zero, so saving an
+// existing example again does not overwrite its creation time.
+func (s *example) EnsureCreatedAt(t time.Time) {
+	if !s.CreatedAt.IsZero() {
+		return
+	}
+	s.CreatedAt = t
+}
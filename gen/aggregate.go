@@ -0,0 +1,363 @@
+package gen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"golang.org/x/mod/modfile"
+)
+
+// registryFileName -registryのディレクトリに生成する登録簿のファイル
+const registryFileName = "zz_generated_registry.go"
+
+var registryDir = commandLine.String("registry", "", "collect the structs annotated with //gen:register in all packages into a registry package in this `dir` (name to factory, fields and JSON decoder)")
+
+// renderRegister //gen:registerの引数を確かめる。登録簿はパッケージをまたいで集めてから生成するので、ここでは何も出力しない
+func renderRegister(r *renderer, targets []*directiveTarget) error {
+	for _, target := range targets {
+		structName := target.s.name()
+		for _, arg := range target.d.args {
+			if arg.key != "name" || arg.value == "" {
+				return fmt.Errorf("%s: unknown //gen:register argument %s", structName, arg.key)
+			}
+		}
+		if !ast.IsExported(structName) {
+			return fmt.Errorf("%s: //gen:register requires an exported struct", structName)
+		}
+	}
+	return nil
+}
+
+// registryEntry 登録簿に載せる構造体
+type registryEntry struct {
+	Name      string // 登録する名前。name=で指定しなければ<パッケージ名>.<型名>
+	Type      string // 登録簿のパッケージから参照する型の名前
+	Fields    []registryField
+	pos       token.Position
+	pkgName   string
+	importDir string
+}
+
+type registryField struct {
+	Name string
+	Type string // ソースに書かれた型
+	JSON string // JSONのキー
+}
+
+// generateRegistry filesの中から//gen:registerのついた構造体を集め、dirのパッケージに名前から型を引く登録簿を生成する。
+// イベントの種類の名前からデコードする型を選ぶような、プラグイン形式の振り分けに使う
+func generateRegistry(dir string, files []string, version int) (*generatedFile, error) {
+	var entries []*registryEntry
+	var sources []string
+	for _, file := range files {
+		found, err := registeredStructs(file)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) > 0 {
+			entries = append(entries, found...)
+			sources = append(sources, file)
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b *registryEntry) int { return strings.Compare(a.Name, b.Name) })
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Name == entries[i-1].Name {
+			return nil, fmt.Errorf("%s: %s is already registered at %s", entries[i].pos, strconv.Quote(entries[i].Name), entries[i-1].pos)
+		}
+	}
+	packageName, err := registryPackageName(dir)
+	if err != nil {
+		return nil, err
+	}
+	// 登録簿と同じパッケージの構造体はimportせずに参照する。生成する宣言やimportと同じ名前のパッケージは別名にする
+	var imports []templateImport
+	used := map[string]bool{"fmt": true, "json": true, "reflect": true, "Entry": true, "Field": true, "Lookup": true, "Entries": true, "NameOf": true, "Decode": true}
+	aliases := make(map[string]string) // key: ディレクトリ
+	for _, e := range entries {
+		if e.importDir == dir {
+			continue
+		}
+		alias, ok := aliases[e.importDir]
+		if !ok {
+			importPath, err := dirImportPath(e.importDir)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", e.pos, err)
+			}
+			alias = e.pkgName
+			for n := 2; used[alias]; n++ {
+				alias = e.pkgName + strconv.Itoa(n)
+			}
+			used[alias] = true
+			aliases[e.importDir] = alias
+			imp := templateImport{Path: importPath}
+			if alias != e.pkgName {
+				imp.Alias = alias
+			}
+			imports = append(imports, imp)
+		}
+		e.Type = alias + "." + e.Type
+	}
+	imports = append(imports, templateImport{Path: "encoding/json"}, templateImport{Path: "fmt"}, templateImport{Path: "reflect"})
+	tmpl, err := template.New("registry").Parse(registryTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, entries); err != nil {
+		return nil, err
+	}
+	// 登録簿は複数のパッケージから作るので、ソースは登録簿のディレクトリからの相対パスで書く
+	names := make([]string, 0, len(sources))
+	for _, source := range sources {
+		name := source
+		if rel, err := filepath.Rel(dir, source); err == nil {
+			name = filepath.ToSlash(rel)
+		}
+		names = append(names, name)
+	}
+	src, err := generatedSource(version, packageName, imports, body.Bytes(), sourceHeader{Source: strings.Join(names, ", ")})
+	if err != nil {
+		return nil, err
+	}
+	return &generatedFile{source: strings.Join(sources, ", "), path: filepath.Join(dir, registryFileName), src: src}, nil
+}
+
+// registeredStructs fileの//gen:registerのついた構造体
+func registeredStructs(file string) ([]*registryEntry, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(content, []byte(directivePrefix+"register")) {
+		return nil, nil
+	}
+	targets, err := parseTargetStructs(nil, file, content)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*registryEntry
+	for _, s := range targets.structs {
+		d := s.directive("register")
+		if d == nil {
+			continue
+		}
+		pos := targets.fileSet.Position(s.spec.Pos())
+		// テストやビルド制約のあるファイルの型は、登録簿のパッケージからいつも参照できるとは限らない
+		if strings.HasSuffix(file, "_test.go") || buildConstraint(targets.file, file) != nil {
+			return nil, fmt.Errorf("%s: cannot register %s from a test file or a file with build constraints", pos, s.name())
+		}
+		if targets.packageName == "main" {
+			return nil, fmt.Errorf("%s: cannot register %s from package main, which cannot be imported", pos, s.name())
+		}
+		// renderRegisterと同じく、他のパッケージから参照できない型と、型引数なしでは使えない型は載せない
+		if !ast.IsExported(s.name()) {
+			return nil, fmt.Errorf("%s: %s: //gen:register requires an exported struct", pos, s.name())
+		}
+		if s.spec.TypeParams != nil {
+			return nil, fmt.Errorf("%s: %s: //gen:register does not support structs with type parameters", pos, s.name())
+		}
+		e := &registryEntry{
+			Name:      targets.packageName + "." + s.name(),
+			Type:      s.name(),
+			pos:       pos,
+			pkgName:   targets.packageName,
+			importDir: targets.path,
+		}
+		if name, ok := d.arg("name"); ok {
+			e.Name = name
+		}
+		for _, field := range s.structType().Fields.List {
+			names := field.Names
+			if names == nil {
+				names = []*ast.Ident{ast.NewIdent(embeddedFieldName(field.Type))}
+			}
+			for _, name := range names {
+				if !ast.IsExported(name.Name) {
+					continue
+				}
+				f := registryField{Name: name.Name, Type: getFiledTypeString(field.Type), JSON: name.Name}
+				if field.Tag != nil {
+					tag, _ := strconv.Unquote(field.Tag.Value)
+					key, _, _ := strings.Cut(reflect.StructTag(tag).Get("json"), ",")
+					if key == "-" {
+						continue
+					}
+					if key != "" {
+						f.JSON = key
+					}
+				}
+				e.Fields = append(e.Fields, f)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// embeddedFieldName 埋め込んだフィールドの名前（*pkg.Base ならBase）
+func embeddedFieldName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedFieldName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.IndexExpr:
+		return embeddedFieldName(t.X)
+	case *ast.IndexListExpr:
+		return embeddedFieldName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// registryPackageName 登録簿のパッケージ名。ディレクトリに他のファイルがあればそのパッケージ名、なければディレクトリ名
+func registryPackageName(dir string) (string, error) {
+	files, err := listGoFiles(dir, false)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	for _, file := range files {
+		if filepath.Base(file) == registryFileName || strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.PackageClauseOnly)
+		if err != nil {
+			return "", err
+		}
+		return f.Name.Name, nil
+	}
+	name := filepath.Base(dir)
+	if !token.IsIdentifier(name) {
+		return "", fmt.Errorf("-registry: cannot use %q as a package name; add a .go file with the package clause to %s", name, dir)
+	}
+	return name, nil
+}
+
+// dirImportPath go.modのモジュールのパスから、dirのパッケージのimport path
+func dirImportPath(dir string) (string, error) {
+	goMod, err := findGoMod(dir)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(goMod)
+	if err != nil {
+		return "", err
+	}
+	module := modfile.ModulePath(data)
+	if module == "" {
+		return "", fmt.Errorf("no module path in %s", goMod)
+	}
+	rel, err := filepath.Rel(filepath.Dir(goMod), dir)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return module, nil
+	}
+	return module + "/" + filepath.ToSlash(rel), nil
+}
+
+const registryTemplate = `
+// Entry is a struct registered with //gen:register.
+type Entry struct {
+	// Name is the name given with name=, or <package>.<Type>.
+	Name string
+	// Type is the struct type (not a pointer).
+	Type reflect.Type
+	// Fields lists the exported fields in declaration order.
+	Fields []Field
+	// New returns a pointer to a new zero value of the struct.
+	New func() any
+	// Decode unmarshals JSON into a new value of the struct and returns the pointer.
+	Decode func(data []byte) (any, error)
+}
+
+// Field is an exported field of a registered struct.
+type Field struct {
+	Name string
+	// Type is the field type as written in the source.
+	Type string
+	// JSON is the key of the field in JSON.
+	JSON string
+}
+
+var entries = []*Entry{
+{{- range .}}
+	{
+		Name: {{printf "%q" .Name}},
+		Type: reflect.TypeOf((*{{.Type}})(nil)).Elem(),
+		Fields: []Field{
+		{{- range .Fields}}
+			{Name: {{printf "%q" .Name}}, Type: {{printf "%q" .Type}}, JSON: {{printf "%q" .JSON}}},
+		{{- end}}
+		},
+		New: func() any { return new({{.Type}}) },
+		Decode: func(data []byte) (any, error) {
+			v := new({{.Type}})
+			if err := json.Unmarshal(data, v); err != nil {
+				return nil, err
+			}
+			return v, nil
+		},
+	},
+{{- end}}
+}
+
+var (
+	byName = make(map[string]*Entry, len(entries))
+	byType = make(map[reflect.Type]*Entry, len(entries))
+)
+
+func init() {
+	for _, e := range entries {
+		byName[e.Name] = e
+		byType[e.Type] = e
+	}
+}
+
+// Lookup returns the entry registered under name.
+func Lookup(name string) (*Entry, bool) {
+	e, ok := byName[name]
+	return e, ok
+}
+
+// Entries returns all entries sorted by name.
+func Entries() []*Entry {
+	return append([]*Entry(nil), entries...)
+}
+
+// NameOf returns the registered name of v, a registered struct or a pointer to one.
+func NameOf(v any) (string, bool) {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	e, ok := byType[t]
+	if !ok {
+		return "", false
+	}
+	return e.Name, true
+}
+
+// Decode unmarshals JSON into a new value of the struct registered under name.
+func Decode(name string, data []byte) (any, error) {
+	e, ok := byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown registered type %q", name)
+	}
+	return e.Decode(data)
+}
+`
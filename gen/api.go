@@ -0,0 +1,289 @@
+package gen
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	apiBaseline = commandLine.String("api", "", "compare the exported API of the generated code with this `file` and fail if declarations were removed or changed")
+	updateAPI   = commandLine.Bool("update-api", false, "write the exported API of the generated code to the -api file instead of comparing")
+)
+
+// apiDecl 生成したコードの、エクスポートされた宣言1つ
+type apiDecl struct {
+	// key パッケージのディレクトリと宣言の名前（models: method (*User) SetName）。変わったかを比べる単位
+	key string
+	// sig 型やシグネチャ（(string) *User）。引数の名前は含めない
+	sig string
+}
+
+// String 基準のファイルの1行。関数とメソッドはシグネチャを名前に続けて書く
+func (d apiDecl) String() string {
+	switch {
+	case d.sig == "":
+		return d.key
+	case strings.HasPrefix(d.sig, "("):
+		return d.key + d.sig
+	}
+	return d.key + " " + d.sig
+}
+
+// apiChange 基準のファイルから削除したか、シグネチャを変えた宣言
+type apiChange struct {
+	old apiDecl
+	new *apiDecl // 削除したならnil
+}
+
+// generatedAPI 生成したファイル（テストを除く）のエクスポートされた宣言を、パッケージのディレクトリ、宣言の順に返す
+func generatedAPI(root string, generated []*generatedFile) ([]apiDecl, error) {
+	var decls []apiDecl
+	for _, g := range generated {
+		if strings.HasSuffix(g.path, "_test.go") {
+			continue
+		}
+		pkg, err := filepath.Rel(root, g.dir())
+		if err != nil {
+			pkg = g.dir()
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), g.path, g.src, 0)
+		if err != nil {
+			return nil, err
+		}
+		decls = append(decls, fileAPI(filepath.ToSlash(pkg), file)...)
+	}
+	sort.SliceStable(decls, func(i, j int) bool {
+		return decls[i].key < decls[j].key
+	})
+	return decls, nil
+}
+
+func fileAPI(pkg string, file *ast.File) []apiDecl {
+	var decls []apiDecl
+	add := func(key, sig string) {
+		decls = append(decls, apiDecl{key: pkg + ": " + key, sig: sig})
+	}
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if !decl.Name.IsExported() {
+				continue
+			}
+			if decl.Recv == nil {
+				add("func "+decl.Name.Name, apiSignature(decl.Type))
+				continue
+			}
+			// エクスポートされていない型のメソッドは外から呼べない
+			recv := receiverTypeName(decl)
+			if !ast.IsExported(recv) {
+				continue
+			}
+			// 型引数は名前を変えても同じなので書かない
+			if _, ok := decl.Recv.List[0].Type.(*ast.StarExpr); ok {
+				recv = "*" + recv
+			}
+			add(fmt.Sprintf("method (%s) %s", recv, decl.Name.Name), apiSignature(decl.Type))
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if !spec.Name.IsExported() {
+						continue
+					}
+					name := spec.Name.Name
+					switch t := spec.Type.(type) {
+					case *ast.StructType:
+						add("type "+name, "struct")
+						for _, field := range t.Fields.List {
+							for _, n := range field.Names {
+								if n.IsExported() {
+									add("field "+name+"."+n.Name, getFiledTypeString(field.Type))
+								}
+							}
+							if len(field.Names) == 0 {
+								add("embedded "+name+"."+embeddedTypeName(field.Type), getFiledTypeString(field.Type))
+							}
+						}
+					case *ast.InterfaceType:
+						add("type "+name, "interface")
+						for _, method := range t.Methods.List {
+							if fn, ok := method.Type.(*ast.FuncType); ok && len(method.Names) > 0 {
+								add("method "+name+"."+method.Names[0].Name, apiSignature(fn))
+							} else if len(method.Names) == 0 {
+								add("embedded "+name+"."+embeddedTypeName(method.Type), getFiledTypeString(method.Type))
+							}
+						}
+					default:
+						if spec.Assign.IsValid() {
+							add("type "+name, "= "+getFiledTypeString(spec.Type))
+						} else {
+							add("type "+name, getFiledTypeString(spec.Type))
+						}
+					}
+				case *ast.ValueSpec:
+					kind := decl.Tok.String()
+					for _, n := range spec.Names {
+						if !n.IsExported() {
+							continue
+						}
+						typ := ""
+						if spec.Type != nil {
+							typ = getFiledTypeString(spec.Type)
+						}
+						add(kind+" "+n.Name, typ)
+					}
+				}
+			}
+		}
+	}
+	return decls
+}
+
+// apiSignature 引数の名前を除いたシグネチャ（(string, int) error）
+func apiSignature(fn *ast.FuncType) string {
+	list := func(fields *ast.FieldList) []string {
+		var types []string
+		if fields == nil {
+			return nil
+		}
+		for _, field := range fields.List {
+			typ := getFiledTypeString(field.Type)
+			for range max(len(field.Names), 1) {
+				types = append(types, typ)
+			}
+		}
+		return types
+	}
+	sig := "(" + strings.Join(list(fn.Params), ", ") + ")"
+	switch results := list(fn.Results); len(results) {
+	case 0:
+	case 1:
+		sig += " " + results[0]
+	default:
+		sig += " (" + strings.Join(results, ", ") + ")"
+	}
+	return sig
+}
+
+// readAPIBaseline 1行に1つの宣言を書いた基準のファイルを読む。#で始まる行は読み飛ばす
+func readAPIBaseline(path string) ([]apiDecl, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var decls []apiDecl
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		decls = append(decls, parseAPILine(line))
+	}
+	return decls, scanner.Err()
+}
+
+// parseAPILine String()で書いた行をkeyとsigに分ける。keyは「パッケージ: 種類 名前」
+func parseAPILine(line string) apiDecl {
+	pkg, rest, _ := strings.Cut(line, ": ")
+	kind, rest, _ := strings.Cut(rest, " ")
+	prefix := pkg + ": " + kind + " "
+	if kind == "method" && strings.HasPrefix(rest, "(") {
+		// レシーバ（(*User)）には空白がない
+		recv, after, _ := strings.Cut(rest, " ")
+		prefix, rest = prefix+recv+" ", after
+	}
+	sep := " "
+	if kind == "func" || kind == "method" {
+		sep = "("
+	}
+	i := strings.Index(rest, sep)
+	if i < 0 {
+		return apiDecl{key: prefix + rest}
+	}
+	return apiDecl{key: prefix + rest[:i], sig: strings.TrimSpace(rest[i:])}
+}
+
+func writeAPIBaseline(path string, decls []apiDecl) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Exported API of the code generated by %s. Update with -update-api.\n", programName())
+	for _, d := range decls {
+		b.WriteString(d.String() + "\n")
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// diffAPI 基準から削除したか変えた宣言と、追加した宣言の数を返す
+func diffAPI(baseline, current []apiDecl) (changes []apiChange, added int) {
+	byKey := make(map[string]apiDecl, len(current))
+	for _, d := range current {
+		byKey[d.key] = d
+	}
+	seen := make(map[string]bool, len(baseline))
+	for _, old := range baseline {
+		seen[old.key] = true
+		d, ok := byKey[old.key]
+		switch {
+		case !ok:
+			changes = append(changes, apiChange{old: old})
+		case d.sig != old.sig:
+			changes = append(changes, apiChange{old: old, new: &d})
+		}
+	}
+	for _, d := range current {
+		if !seen[d.key] {
+			added++
+		}
+	}
+	return changes, added
+}
+
+func printAPIChanges(w io.Writer, changes []apiChange) {
+	for _, c := range changes {
+		if c.new == nil {
+			fmt.Fprintf(w, "removed: %s\n", c.old)
+			continue
+		}
+		fmt.Fprintf(w, "changed: %s\n    was: %s\n", c.new, c.old)
+	}
+}
+
+// checkGeneratedAPI -apiの基準のファイルと生成したコードの宣言を比べる。
+// -update-apiか基準のファイルがなければ書き、宣言を削除したか変えていればエラーを返す
+func checkGeneratedAPI(path, root string, generated []*generatedFile, update bool) error {
+	current, err := generatedAPI(root, generated)
+	if err != nil {
+		return err
+	}
+	baseline, err := readAPIBaseline(path)
+	if update || errors.Is(err, fs.ErrNotExist) {
+		if err := writeAPIBaseline(path, current); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "recorded %d generated declarations in %s\n", len(current), path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	changes, added := diffAPI(baseline, current)
+	if len(changes) > 0 {
+		printAPIChanges(os.Stderr, changes)
+		return fmt.Errorf("%d generated declarations were removed or changed since %s; rerun with -update-api if this is intended", len(changes), path)
+	}
+	if added > 0 {
+		fmt.Fprintf(os.Stderr, "%d generated declarations added since %s; record them with -update-api\n", added, path)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+)
+
+// autoID gen:"autoid"のフィールドに、NewXやビルダーのBuild()で識別子を入れる
+type autoID struct {
+	StructName string
+	FieldName  string
+	FieldType  string
+	Interface  string // ExampleIDGenerator。UUIDv7、ULID、snowflakeなどの実装を差し込む
+	Var        string // ExampleIDs。利用者が起動時に設定する
+	Func       string // newExampleID。Varが設定されていなければpanicする
+	Now        string // CreatedAtがtime.Timeなら、作成日時も設定するための時刻の式
+}
+
+// newAutoID gen:"autoid"のフィールドがなければnilを返す。生成器とそれを呼ぶ関数はファイルに1度だけ宣言する
+func newAutoID(r *renderer, s *targetStruct) (*autoID, error) {
+	structName := s.name()
+	var a *autoID
+	for _, field := range s.structType().Fields.List {
+		if !parseGenTag(field).has("autoid") {
+			continue
+		}
+		if a != nil || len(field.Names) != 1 {
+			return nil, fmt.Errorf("%s: gen:\"autoid\" can be used on only one field", structName)
+		}
+		switch t := field.Type.(type) {
+		case *ast.MapType, *ast.FuncType:
+			return nil, fmt.Errorf("%s: gen:\"autoid\" field of type %s is not comparable", structName, getFiledTypeString(field.Type))
+		case *ast.ArrayType:
+			if t.Len == nil {
+				return nil, fmt.Errorf("%s: gen:\"autoid\" field of type %s is not comparable", structName, getFiledTypeString(field.Type))
+			}
+		}
+		fieldName := field.Names[0].Name
+		name := exportedName(structName) + exportedName(fieldName)
+		a = &autoID{
+			StructName: structName,
+			FieldName:  fieldName,
+			FieldType:  r.typeString(field.Type),
+			Interface:  name + "Generator",
+			Var:        name + "s",
+			Func:       "new" + name,
+		}
+		if !ast.IsExported(structName) {
+			a.Interface, a.Var = unexportedName(a.Interface), unexportedName(a.Var)
+		}
+		a.Interface, a.Var, a.Func = r.ident(a.Interface), r.ident(a.Var), r.ident(a.Func)
+	}
+	if a == nil {
+		return nil, nil
+	}
+	if s.spec.TypeParams != nil {
+		return nil, fmt.Errorf("%s: gen:\"autoid\" is not supported on structs with type parameters", structName)
+	}
+	if qualifier := timeFieldQualifier(s.structType(), "CreatedAt", r.importsMap); qualifier != "" {
+		a.Now = touchNow(r, s, qualifier)
+	}
+	// //gen:constructorと//gen:builderの両方で使う場合も宣言は1つにする
+	if !r.autoIDs[structName] {
+		r.autoIDs[structName] = true
+		if err := r.execute("autoid", autoIDTemplate, a); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+const autoIDTemplate = `
+// {{.Interface}} creates the {{.FieldName}} of new {{.StructName}} values,
+// for example from a UUIDv7, ULID or snowflake source.
+type {{.Interface}} interface {
+	NewID() {{.FieldType}}
+}
+
+// {{.Var}} fills the {{.FieldName}} of {{.StructName}} values created by the generated
+// constructor and builder. Set it once at startup.
+var {{.Var}} {{.Interface}}
+
+func {{.Func}}() {{.FieldType}} {
+	if {{.Var}} == nil {
+		panic("{{.StructName}}: {{.Var}} is not set")
+	}
+	return {{.Var}}.NewID()
+}
+`
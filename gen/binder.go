@@ -0,0 +1,212 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// binderRouters //gen:binder router=...ごとのパスパラメータの取り出し方
+var binderRouters = map[string]string{
+	"std":     "",
+	"chi":     "github.com/go-chi/chi/v5",
+	"gorilla": "github.com/gorilla/mux",
+}
+
+// binderSources フィールドの値を取り出す場所を表すタグ
+var binderSources = []string{"path", "query", "header"}
+
+// binder //gen:binderで生成するDecodeXRequest
+type binder struct {
+	StructName string
+	FuncName   string
+	HTTP       string // net/httpを参照している名前
+	Errors     string
+	Fmt        string
+	JSON       string   // 本文をデコードする場合のencoding/jsonを参照している名前
+	IO         string   // 本文をデコードする場合のioを参照している名前
+	Setup      []string // パスパラメータやクエリを取り出す準備
+	Fields     []string // フィールドごとに値を取り出して変換するコード
+}
+
+// newBinder path/query/headerタグのついたフィールドを取り出すコードを組み立てる。
+// それ以外でjsonタグのついたフィールドがあればJSONの本文からデコードする
+func newBinder(r *renderer, target *directiveTarget) (*binder, error) {
+	structName := target.s.name()
+	router, _ := target.d.arg("router")
+	if router == "" {
+		router = "std"
+	}
+	routerPath, ok := binderRouters[router]
+	if !ok {
+		return nil, fmt.Errorf("%s: //gen:binder router must be std, chi or gorilla, got %q", structName, router)
+	}
+	b := &binder{
+		StructName: structName,
+		FuncName:   "Decode" + exportedName(structName) + "Request",
+		HTTP:       r.importName("net/http"),
+		Errors:     r.importName("errors"),
+		Fmt:        r.importName("fmt"),
+	}
+	if !ast.IsExported(structName) {
+		b.FuncName = unexportedName(b.FuncName)
+	}
+	b.FuncName = r.ident(b.FuncName)
+	var hasBody, hasQuery, hasVars bool
+	for _, field := range target.s.structType().Fields.List {
+		tag := structTag(field)
+		source, key := "", ""
+		for _, s := range binderSources {
+			if v, ok := tag.Lookup(s); ok {
+				source, key = s, v
+				break
+			}
+		}
+		if source == "" {
+			if _, ok := tag.Lookup("json"); ok {
+				hasBody = true
+			}
+			continue
+		}
+		var raw string
+		switch source {
+		case "path":
+			switch router {
+			case "std":
+				raw = fmt.Sprintf("r.PathValue(%q)", key)
+			case "chi":
+				raw = fmt.Sprintf("%s.URLParam(r, %q)", r.importName(routerPath), key)
+			case "gorilla":
+				raw = fmt.Sprintf("vars[%q]", key)
+				hasVars = true
+			}
+		case "query":
+			raw = fmt.Sprintf("query.Get(%q)", key)
+			hasQuery = true
+		case "header":
+			raw = fmt.Sprintf("r.Header.Get(%q)", key)
+		}
+		required := parseGenTag(field).has("required")
+		for _, name := range field.Names {
+			// 複数指定できるクエリは[]stringでそのまま受け取る
+			if source == "query" && getFiledTypeString(field.Type) == "[]string" {
+				b.Fields = append(b.Fields, fmt.Sprintf("v.%s = query[%q]", name.Name, key))
+				continue
+			}
+			assign, err := binderAssign(r, field.Type, "v."+name.Name, fmt.Sprintf("%s %q", source, key), b.Fmt)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", structName, name.Name, err)
+			}
+			code := fmt.Sprintf("if raw := %s; raw != \"\" {\n%s\n}", raw, assign)
+			if required {
+				code += fmt.Sprintf(" else {\nerrs = append(errs, %s.Errorf(\"%s %%q is required\", %q))\n}", b.Fmt, source, key)
+			}
+			b.Fields = append(b.Fields, code)
+		}
+	}
+	if hasVars {
+		b.Setup = append(b.Setup, fmt.Sprintf("vars := %s.Vars(r)", r.importName(routerPath)))
+	}
+	if hasQuery {
+		b.Setup = append(b.Setup, "query := r.URL.Query()")
+	}
+	if hasBody {
+		b.JSON = r.importName("encoding/json")
+		b.IO = r.importName("io")
+	}
+	return b, nil
+}
+
+// binderAssign 文字列rawをフィールドの型に変換して代入するコード。失敗したらerrsに追加する
+func binderAssign(r *renderer, expr ast.Expr, dst, source, fmtName string) (string, error) {
+	typ := getFiledTypeString(expr)
+	fail := fmt.Sprintf("errs = append(errs, %s.Errorf(\"%s: %%w\", err))", fmtName, strings.ReplaceAll(source, `"`, `\"`))
+	parse := func(call, conv string) string {
+		value := "x"
+		if conv != "" {
+			value = conv + "(x)"
+		}
+		return fmt.Sprintf("if x, err := %s; err != nil {\n%s\n} else {\n%s = %s\n}", call, fail, dst, value)
+	}
+	switch typ {
+	case "string":
+		return fmt.Sprintf("%s = raw", dst), nil
+	case "bool":
+		return parse(r.importName("strconv")+".ParseBool(raw)", ""), nil
+	case "int", "int8", "int16", "int32", "int64":
+		return parse(fmt.Sprintf("%s.ParseInt(raw, 10, %d)", r.importName("strconv"), integerBits[typ]), typ), nil
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		return parse(fmt.Sprintf("%s.ParseUint(raw, 10, %d)", r.importName("strconv"), integerBits[typ]), typ), nil
+	case "float32", "float64":
+		return parse(fmt.Sprintf("%s.ParseFloat(raw, %s)", r.importName("strconv"), strings.TrimPrefix(typ, "float")), typ), nil
+	}
+	// time.Time, time.DurationはソースでのtimeパッケージのimportをRFC3339とDurationの書式で解釈する
+	if sel, ok := expr.(*ast.SelectorExpr); ok {
+		if ident, ok := sel.X.(*ast.Ident); ok {
+			if imp, ok := r.importsMap[ident.Name]; ok && imp.pkg == "time" {
+				imp.used = true
+				switch sel.Sel.Name {
+				case "Time":
+					return parse(fmt.Sprintf("%s.Parse(%s.RFC3339, raw)", ident.Name, ident.Name), ""), nil
+				case "Duration":
+					return parse(fmt.Sprintf("%s.ParseDuration(raw)", ident.Name), ""), nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("cannot decode request values into %s", typ)
+}
+
+// structTag フィールドのタグ。なければ空
+func structTag(field *ast.Field) reflect.StructTag {
+	if field.Tag == nil {
+		return ""
+	}
+	raw, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return ""
+	}
+	return reflect.StructTag(raw)
+}
+
+func renderBinder(r *renderer, targets []*directiveTarget) error {
+	binders := make([]*binder, 0, len(targets))
+	for _, target := range targets {
+		b, err := newBinder(r, target)
+		if err != nil {
+			return err
+		}
+		binders = append(binders, b)
+	}
+	return r.execute("binder", binderTemplate, binders)
+}
+
+const binderTemplate = `
+{{range .}}
+// {{.FuncName}} decodes the JSON body, path parameters, query parameters and
+// headers of r into a {{.StructName}}. All problems are reported together.
+func {{.FuncName}}(r *{{.HTTP}}.Request) (*{{.StructName}}, error) {
+	v := &{{.StructName}}{}
+	var errs []error
+	{{- if .JSON}}
+	if r.Body != nil && r.ContentLength != 0 {
+		if err := {{.JSON}}.NewDecoder(r.Body).Decode(v); err != nil && !{{.Errors}}.Is(err, {{.IO}}.EOF) {
+			errs = append(errs, {{.Fmt}}.Errorf("body: %w", err))
+		}
+	}
+	{{- end}}
+	{{- range .Setup}}
+	{{.}}
+	{{- end}}
+	{{- range .Fields}}
+	{{.}}
+	{{- end}}
+	if err := {{.Errors}}.Join(errs...); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+{{end}}
+`
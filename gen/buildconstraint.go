@@ -0,0 +1,83 @@
+package gen
+
+import (
+	"go/ast"
+	"go/build/constraint"
+	"path/filepath"
+	"strings"
+)
+
+// knownOS, knownArch ファイル名の_linuxや_amd64をビルド制約とみなすGOOSとGOARCH（go/buildと同じ）
+var knownOS = []string{
+	"aix", "android", "darwin", "dragonfly", "freebsd", "hurd", "illumos", "ios", "js",
+	"linux", "nacl", "netbsd", "openbsd", "plan9", "solaris", "wasip1", "windows", "zos",
+}
+
+var knownArch = []string{
+	"386", "amd64", "amd64p32", "arm", "armbe", "arm64", "arm64be", "loong64", "mips", "mipsle",
+	"mips64", "mips64le", "mips64p32", "mips64p32le", "ppc", "ppc64", "ppc64le", "riscv", "riscv64",
+	"s390", "s390x", "sparc", "sparc64", "wasm",
+}
+
+// buildConstraint ソースファイルの//go:buildとファイル名（_linux.goなど）のビルド制約を合わせた式。なければnil。
+// 生成ファイルの名前には接尾辞がつき、ファイル名の制約は効かなくなるので//go:buildに書き直す
+func buildConstraint(file *ast.File, filename string) constraint.Expr {
+	var expr constraint.Expr
+	for _, group := range file.Comments {
+		// ビルド制約はpackage句より前にしか書けない
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if !constraint.IsGoBuild(c.Text) {
+				continue
+			}
+			if x, err := constraint.Parse(c.Text); err == nil {
+				expr = andConstraint(expr, x)
+			}
+		}
+	}
+	goos, goarch := filenameConstraint(filename)
+	if goos != "" {
+		expr = andConstraint(expr, &constraint.TagExpr{Tag: goos})
+	}
+	if goarch != "" {
+		expr = andConstraint(expr, &constraint.TagExpr{Tag: goarch})
+	}
+	return expr
+}
+
+func andConstraint(x, y constraint.Expr) constraint.Expr {
+	if x == nil {
+		return y
+	}
+	return &constraint.AndExpr{X: x, Y: y}
+}
+
+// filenameConstraint name_GOOS_GOARCH.go、name_GOOS.go、name_GOARCH.goの形のファイル名のGOOSとGOARCH。
+// go/buildと同じく_test.goの_testは除き、最初の要素（name）は制約とみなさない
+func filenameConstraint(filename string) (goos, goarch string) {
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(filename), ".go"), "_test")
+	parts := strings.Split(name, "_")
+	n := len(parts)
+	if n >= 3 && containsTargetField(parts[n-2], knownOS...) && containsTargetField(parts[n-1], knownArch...) {
+		return parts[n-2], parts[n-1]
+	}
+	if n >= 2 {
+		if containsTargetField(parts[n-1], knownOS...) {
+			return parts[n-1], ""
+		}
+		if containsTargetField(parts[n-1], knownArch...) {
+			return "", parts[n-1]
+		}
+	}
+	return "", ""
+}
+
+// goBuildLine 生成ファイルに書く//go:buildの行。制約がなければ空
+func goBuildLine(expr constraint.Expr) string {
+	if expr == nil {
+		return ""
+	}
+	return "//go:build " + expr.String()
+}
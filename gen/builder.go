@@ -0,0 +1,231 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// maxRequiredFields 必須フィールドはuint64のビットマスクで管理する
+const maxRequiredFields = 64
+
+// builder //gen:builderで生成するビルダー
+type builder struct {
+	StructName string
+	TypeName   string // ExampleBuilderのようなビルダーの型名
+	NewName    string // ビルダーのコンストラクタの名前
+	Fields     []*builderField
+	Required   []*builderField // gen:"required"のついたフィールド
+	Fmt        string          // 必須フィールドがある場合にfmtパッケージを参照している名前
+	Strings    string          // 必須フィールドがある場合にstringsパッケージを参照している名前
+	AutoID     *autoID         // gen:"autoid"のフィールドがあれば、Build()で設定されていない識別子を入れる
+	// Copy ToBuilderとBuildで1つずつコピーするフィールド（埋め込みを含む）。
+	// コピーしてはいけないフィールドがなければnilで、構造体ごとコピーする
+	Copy []string
+}
+
+type builderField struct {
+	FieldName  string
+	MethodName string
+	FieldType  string
+	Required   bool
+	Bit        int // 必須フィールドの場合、設定済みかを表すビット
+}
+
+// newBuilder 構造体のフィールドごとにWithXを持つビルダーを作る。
+// gen:"required"のフィールドはWithXが呼ばれたかをビットマスクで覚え、Build()で確認する
+func newBuilder(r *renderer, target *directiveTarget) (*builder, error) {
+	s := target.s
+	structName := s.name()
+	requiredArg, err := requiredFieldsArg(target)
+	if err != nil {
+		return nil, err
+	}
+	b := &builder{
+		StructName: structName,
+		TypeName:   structName + "Builder",
+		NewName:    "New" + structName + "Builder",
+	}
+	if !ast.IsExported(structName) {
+		b.NewName = "new" + exportedName(structName) + "Builder"
+	}
+	b.TypeName, b.NewName = r.ident(b.TypeName), r.ident(b.NewName)
+	var copied []string
+	skipped := false
+	for _, field := range s.structType().Fields.List {
+		// ロックはコピーできず、遅延初期化した値と//gen:derivedのキャッシュはコピーすると他のフィールドと食い違う
+		if isSyncType(field.Type, r.importsMap) || parseGenTag(field).has("lazy") || isDerivedCache(structName, field.Type) {
+			skipped = true
+			continue
+		}
+		if field.Names == nil {
+			copied = append(copied, embeddedFieldName(field.Type))
+		}
+		for _, name := range field.Names {
+			copied = append(copied, name.Name)
+			required := parseGenTag(field).has("required") || containsTargetField(name.Name, requiredArg...)
+			f := &builderField{
+				FieldName:  name.Name,
+				MethodName: "With" + exportedName(name.Name),
+				FieldType:  r.typeString(field.Type),
+				Required:   required,
+			}
+			if required {
+				f.Bit = len(b.Required)
+				b.Required = append(b.Required, f)
+			}
+			b.Fields = append(b.Fields, f)
+		}
+	}
+	if skipped {
+		b.Copy = copied
+	}
+	if len(b.Required) > maxRequiredFields {
+		return nil, fmt.Errorf("%s: //gen:builder supports at most %d required fields, got %d", structName, maxRequiredFields, len(b.Required))
+	}
+	if len(b.Required) > 0 {
+		b.Fmt = r.importName("fmt")
+		b.Strings = r.importName("strings")
+	}
+	if b.AutoID, err = newAutoID(r, s); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// isSyncType 型がsyncかsync/atomicの型か。コピーするとgo vetのcopylocksに引っかかる
+func isSyncType(expr ast.Expr, importsMap map[string]*usedImport) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	imp, ok := importsMap[x.Name]
+	return ok && (imp.pkg == "sync" || imp.pkg == "sync/atomic")
+}
+
+// isDerivedCache 型が//gen:derivedのキャッシュの型か
+func isDerivedCache(structName string, expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == derivedCacheType(structName)
+}
+
+// requiredFieldsArg ディレクティブのrequired=A,Bで指定された必須フィールド。
+// タグを書けない（書きたくない）構造体でgen:"required"の代わりに使う
+func requiredFieldsArg(target *directiveTarget) ([]string, error) {
+	v, ok := target.d.arg("required")
+	if !ok {
+		return nil, nil
+	}
+	names := strings.Split(v, ",")
+	for _, name := range names {
+		if !hasField(target.s.structType(), name) {
+			return nil, fmt.Errorf("%s: %s%s required field %s does not exist", target.s.name(), directivePrefix, target.d.name, name)
+		}
+	}
+	return names, nil
+}
+
+// renderBuilder ビルダーと、今の値を読み込んだビルダーを返すToBuilderを生成する
+func renderBuilder(r *renderer, targets []*directiveTarget) error {
+	builders := make([]*builder, 0, len(targets))
+	for _, target := range targets {
+		b, err := newBuilder(r, target)
+		if err != nil {
+			return err
+		}
+		builders = append(builders, b)
+	}
+	return r.execute("builder", builderTemplate, builders)
+}
+
+const builderTemplate = `
+{{define "value"}}
+	{{- if .Copy}}
+	v := &{{.StructName}}{}
+	{{- range .Copy}}
+	v.{{.}} = b.v.{{.}}
+	{{- end}}
+	{{- else}}
+	v := b.v
+	{{- end}}
+{{- end}}
+{{define "autoid"}}
+	{{- with .AutoID}}
+	if v.{{.FieldName}} == *new({{.FieldType}}) {
+		v.{{.FieldName}} = {{.Func}}()
+	}
+	{{- if .Now}}
+	if v.CreatedAt.IsZero() {
+		v.CreatedAt = {{.Now}}
+	}
+	{{- end}}
+	{{- end}}
+{{- end}}
+{{range .}}
+{{- $b := .}}
+// {{.TypeName}} builds a {{.StructName}} field by field.
+type {{.TypeName}} struct {
+	v {{.StructName}}
+	{{- if .Required}}
+	set uint64 // bit i is set once the i-th required field has been given
+	{{- end}}
+}
+
+func {{.NewName}}() *{{.TypeName}} {
+	return &{{.TypeName}}{}
+}
+
+// ToBuilder returns a builder preloaded with the current values of s.
+// Map and slice fields are shared with s until they are replaced.
+{{- if .Copy}}
+// Locks, lazily initialized fields and cached derived values are not copied.
+func (s *{{.StructName}}) ToBuilder() *{{.TypeName}} {
+	b := &{{.TypeName}}{ {{- if .Required}}set: 1<<{{len .Required}} - 1{{end -}} }
+	{{- range .Copy}}
+	b.v.{{.}} = s.{{.}}
+	{{- end}}
+	return b
+}
+{{- else}}
+func (s *{{.StructName}}) ToBuilder() *{{.TypeName}} {
+	return &{{.TypeName}}{v: *s{{if .Required}}, set: 1<<{{len .Required}} - 1{{end}}}
+}
+{{- end}}
+{{range .Fields}}
+func (b *{{$b.TypeName}}) {{.MethodName}}(v {{.FieldType}}) *{{$b.TypeName}} {
+	b.v.{{.FieldName}} = v
+	{{- if .Required}}
+	b.set |= 1 << {{.Bit}}
+	{{- end}}
+	return b
+}
+{{end}}
+{{- if .Required}}
+// Build returns an error listing the required fields that were not given.
+func (b *{{.TypeName}}) Build() (*{{.StructName}}, error) {
+	var missing []string
+	{{- range .Required}}
+	if b.set&(1<<{{.Bit}}) == 0 {
+		missing = append(missing, "{{.FieldName}}")
+	}
+	{{- end}}
+	if len(missing) > 0 {
+		return nil, {{.Fmt}}.Errorf("{{.StructName}}: missing required fields: %s", {{.Strings}}.Join(missing, ", "))
+	}
+	{{- template "value" .}}
+	{{- template "autoid" .}}
+	return {{if not .Copy}}&{{end}}v, nil
+}
+{{- else}}
+func (b *{{.TypeName}}) Build() *{{.StructName}} {
+	{{- template "value" .}}
+	{{- template "autoid" .}}
+	return {{if not .Copy}}&{{end}}v
+}
+{{- end}}
+{{end}}
+`
@@ -0,0 +1,225 @@
+package gen
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// canonical //gen:canonicalで生成するCanonicalBytes
+type canonical struct {
+	StructName string
+	Fields     []*canonicalField
+	Bytes      string
+	JSON       string
+}
+
+type canonicalField struct {
+	Key       string // 書き込むキー（"key":の形のGoの文字列リテラル）
+	FieldName string
+	Time      string // time.Timeの場合にtimeパッケージを参照している名前
+	name      string
+}
+
+// newCanonical 対象のフィールド（fields=の指定がなければエクスポートされた全フィールド）をキーの順に並べる
+func newCanonical(r *renderer, target *directiveTarget) (*canonical, error) {
+	structName := target.s.name()
+	structType := target.s.structType()
+	var selected []string
+	if v, ok := target.d.arg("fields"); ok {
+		selected = strings.Split(v, ",")
+		for _, name := range selected {
+			if !hasField(structType, name) {
+				return nil, fmt.Errorf("%s: //gen:canonical field %s does not exist", structName, name)
+			}
+		}
+	}
+	c := &canonical{
+		StructName: structName,
+		Bytes:      r.importName("bytes"),
+		JSON:       r.importName("encoding/json"),
+	}
+	for _, field := range structType.Fields.List {
+		// jsonタグの名前があればキーに使う
+		jsonName, _, _ := strings.Cut(structTag(field).Get("json"), ",")
+		for _, name := range field.Names {
+			if selected != nil && !containsTargetField(name.Name, selected...) {
+				continue
+			}
+			if selected == nil && (!name.IsExported() || jsonName == "-") {
+				continue
+			}
+			key := name.Name
+			if jsonName != "" && jsonName != "-" && len(field.Names) == 1 {
+				key = jsonName
+			}
+			quoted, _ := json.Marshal(key)
+			f := &canonicalField{
+				Key:       strconv.Quote(string(quoted) + ":"),
+				FieldName: name.Name,
+				Time:      timeFieldQualifier(structType, name.Name, r.importsMap),
+				name:      key,
+			}
+			if f.Time != "" {
+				r.importsMap[f.Time].used = true
+			}
+			c.Fields = append(c.Fields, f)
+		}
+	}
+	if len(c.Fields) == 0 {
+		return nil, fmt.Errorf("%s: //gen:canonical has no fields to encode", structName)
+	}
+	// キーの順に並べてフィールドの宣言順に依存しないようにする
+	sort.Slice(c.Fields, func(i, j int) bool {
+		return c.Fields[i].name < c.Fields[j].name
+	})
+	return c, nil
+}
+
+func renderCanonical(r *renderer, targets []*directiveTarget) error {
+	canonicals := make([]*canonical, 0, len(targets))
+	for _, target := range targets {
+		c, err := newCanonical(r, target)
+		if err != nil {
+			return err
+		}
+		canonicals = append(canonicals, c)
+	}
+	if err := r.execute("canonical", canonicalTemplate, canonicals); err != nil {
+		return err
+	}
+	if !r.t.benchmarks {
+		return nil
+	}
+	tr := r.testFile()
+	benchmarks := make([]*codecBenchmark, 0, len(canonicals))
+	for _, c := range canonicals {
+		benchmarks = append(benchmarks, &codecBenchmark{
+			StructName: c.StructName,
+			Name:       exportedName(c.StructName) + "CanonicalBytes",
+			Encode:     "_ = s.CanonicalBytes()",
+			Testing:    tr.importName("testing"),
+			JSON:       tr.importName("encoding/json"),
+		})
+	}
+	return tr.execute("canonical_bench", codecBenchmarkTemplate, benchmarks)
+}
+
+// codecBenchmark 生成したエンコードかデコードと、encoding/jsonのリフレクションによるものを比べるベンチマーク。
+// 比べる側は構造体をメソッドのない型に変換して、生成したMarshalJSONやUnmarshalJSONを呼ばないようにする
+type codecBenchmark struct {
+	StructName string
+	Name       string // Benchmark<Name>とBenchmark<Name>EncodingJSONになる
+	Encode     string // sをエンコードする文。空ならUnmarshalJSONでデコードする
+	Testing    string
+	JSON       string
+}
+
+const codecBenchmarkTemplate = `
+{{range .}}
+{{- if .Encode}}
+func Benchmark{{.Name}}(b *{{.Testing}}.B) {
+	s := &{{.StructName}}{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		{{.Encode}}
+	}
+}
+
+// Benchmark{{.Name}}EncodingJSON encodes the same value with encoding/json for comparison.
+// plain has the fields of {{.StructName}} but none of its methods, so encoding/json uses reflection.
+func Benchmark{{.Name}}EncodingJSON(b *{{.Testing}}.B) {
+	type plain {{.StructName}}
+	s := &plain{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = {{.JSON}}.Marshal(s)
+	}
+}
+{{- else}}
+func Benchmark{{.Name}}(b *{{.Testing}}.B) {
+	data, err := (&{{.StructName}}{}).MarshalJSON()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var s {{.StructName}}
+		if err := s.UnmarshalJSON(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Benchmark{{.Name}}EncodingJSON decodes with encoding/json for comparison.
+// plain has the fields of {{.StructName}} but none of its methods, so encoding/json uses reflection.
+func Benchmark{{.Name}}EncodingJSON(b *{{.Testing}}.B) {
+	type plain {{.StructName}}
+	data, err := {{.JSON}}.Marshal(&plain{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var s plain
+		if err := {{.JSON}}.Unmarshal(data, &s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+{{- end}}
+{{end}}
+`
+
+// methodBenchmark 生成したメソッドを呼ぶベンチマーク。EqualやDeepCopyのように、encoding/jsonのような比べる相手はない
+type methodBenchmark struct {
+	StructName string
+	Name       string // Benchmark<Name>になる
+	Setup      string // ループの前に実行する文。なければ空
+	Call       string // sについて呼ぶ文
+	Testing    string
+}
+
+const methodBenchmarkTemplate = `
+{{range .}}
+func Benchmark{{.Name}}(b *{{.Testing}}.B) {
+	s := &{{.StructName}}{}
+	{{- if .Setup}}
+	{{.Setup}}
+	{{- end}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		{{.Call}}
+	}
+}
+{{end}}
+`
+
+const canonicalTemplate = `
+{{range .}}
+{{- $c := .}}
+// CanonicalBytes returns a deterministic JSON encoding of s with sorted keys and
+// times in UTC RFC 3339 with nanoseconds, suitable for signing.
+func (s *{{recv .StructName}}) CanonicalBytes() []byte {
+	var buf {{.Bytes}}.Buffer
+	var data []byte
+	buf.WriteByte('{')
+	{{- range $i, $f := .Fields}}
+	{{- if $i}}
+	buf.WriteByte(',')
+	{{- end}}
+	buf.WriteString({{.Key}})
+	{{- if .Time}}
+	data, _ = {{$c.JSON}}.Marshal(s.{{.FieldName}}.UTC().Format({{.Time}}.RFC3339Nano))
+	{{- else}}
+	data, _ = {{$c.JSON}}.Marshal(s.{{.FieldName}})
+	{{- end}}
+	buf.Write(data)
+	{{- end}}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+{{end}}
+`
@@ -0,0 +1,76 @@
+package gen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// toolVersionPrefix 生成したファイルのヘッダーの、生成したツールのバージョンの行（出力形式v2以降）
+const toolVersionPrefix = "// gen-struct version: "
+
+// withoutToolVersion ツールのバージョンと、それを含めて計算したハッシュの行を除いた内容。
+// 同じ内容を生成する別のバージョンのツールで生成したファイルは、最新として扱う
+func withoutToolVersion(src []byte) []byte {
+	var buf bytes.Buffer
+	for _, line := range bytes.SplitAfter(src, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte(toolVersionPrefix)) || bytes.HasPrefix(line, []byte(checksumPrefix)) {
+			continue
+		}
+		buf.Write(line)
+	}
+	return buf.Bytes()
+}
+
+// outOfDate 生成した内容と違うファイル
+type outOfDate struct {
+	path string
+	diff string
+}
+
+// checkOutOfDate 書き込む代わりに、生成した内容とディスク上のファイルを比べる（-check、-diff）。
+// 上書きする範囲（gen:override）は書き込むときと同じように残してから比べ、消すファイルは空と比べる
+func checkOutOfDate(generated []*generatedFile, removed []string) ([]*outOfDate, error) {
+	var diffs []*outOfDate
+	for _, g := range generated {
+		current, err := os.ReadFile(g.path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		want := g.src
+		aName := g.path
+		if current == nil {
+			aName = os.DevNull
+		} else if want, err = mergeOverrides(current, g.src, false); err != nil {
+			return nil, fmt.Errorf("%s: %w", g.path, err)
+		}
+		if current != nil && bytes.Equal(withoutToolVersion(current), withoutToolVersion(want)) {
+			continue
+		}
+		diffs = append(diffs, &outOfDate{path: g.path, diff: unifiedDiff(aName, g.path+" (generated)", current, want)})
+	}
+	for _, path := range removed {
+		current, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, &outOfDate{path: path, diff: unifiedDiff(path, os.DevNull, current, nil)})
+	}
+	return diffs, nil
+}
+
+// printOutOfDate 違うファイルを表示する。showDiff（-diff）なら差分も表示する
+func printOutOfDate(w io.Writer, diffs []*outOfDate, showDiff bool) {
+	for _, d := range diffs {
+		if showDiff {
+			fmt.Fprint(w, d.diff)
+			continue
+		}
+		fmt.Fprintf(w, "%s is out of date\n", d.path)
+	}
+}
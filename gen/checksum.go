@@ -0,0 +1,97 @@
+package gen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// checksumPrefix 生成したファイルのヘッダーの、内容のハッシュを記録する行（出力形式v8以降）
+const checksumPrefix = "// gen-struct checksum: sha256:"
+
+// checksumPlaceholder 整形してからハッシュを計算するまでの仮の値
+var checksumPlaceholder = strings.Repeat("0", sha256.Size*2)
+
+// contentChecksum ハッシュの行と上書きする範囲（gen:override）を除いた内容のハッシュ。ハッシュの行がなければfalseを返す
+func contentChecksum(src []byte) (sum, recorded string, ok bool) {
+	start := bytes.Index(src, []byte(checksumPrefix))
+	if start < 0 || (start > 0 && src[start-1] != '\n') {
+		return "", "", false
+	}
+	end := bytes.IndexByte(src[start:], '\n')
+	if end < 0 {
+		return "", "", false
+	}
+	end += start + 1
+	// 目印が壊れていれば範囲を除かずに計算し、手で編集されたものとして扱う
+	spans, _ := overrideSpans(src[end:])
+	h := sha256.New()
+	h.Write(src[:start])
+	last := end
+	for _, span := range spans {
+		h.Write(src[last : end+span[0]])
+		last = end + span[1]
+	}
+	h.Write(src[last:])
+	recorded = strings.TrimSpace(string(src[start+len(checksumPrefix) : end]))
+	return hex.EncodeToString(h.Sum(nil)), recorded, true
+}
+
+// withChecksum 記録したハッシュ（整形した直後は仮の値）を内容のハッシュに置き換える
+func withChecksum(src []byte) []byte {
+	sum, recorded, ok := contentChecksum(src)
+	if !ok || sum == recorded {
+		return src
+	}
+	return bytes.Replace(src, []byte(checksumPrefix+recorded), []byte(checksumPrefix+sum), 1)
+}
+
+// handEdited 生成したファイルが、記録したハッシュと合わない（生成した後に手で編集された）か。
+// ハッシュを記録していない古い形式のファイルは分からないのでfalseを返す
+func handEdited(src []byte) bool {
+	sum, recorded, ok := contentChecksum(src)
+	return ok && sum != recorded
+}
+
+// editedError 手で編集された生成ファイルを上書きしたり削除したりしないときのエラー。
+// 上書きする場合は失われる変更が分かるように、今の内容からの差分をつける
+type editedError struct {
+	path string
+	diff string
+}
+
+func (e *editedError) Error() string {
+	msg := fmt.Sprintf("%s: generated file was edited by hand; move the changes to the source and rerun with -force to overwrite", e.path)
+	if e.diff != "" {
+		msg += "\n" + strings.TrimSuffix(e.diff, "\n")
+	}
+	return msg
+}
+
+// checkUnedited pathにある生成したファイルが上書きする範囲の外で手で編集されていればエラーを返す。
+// dataが空でなければ上書きする内容（範囲を残す前）として差分をつける。force（-force）なら確認しない
+func checkUnedited(path string, data []byte, force bool) error {
+	if force {
+		return nil
+	}
+	current, err := os.ReadFile(path)
+	if err != nil || !handEdited(current) {
+		return nil
+	}
+	if data == nil {
+		return &editedError{path: path}
+	}
+	// 初めて上書きする範囲で囲んだときは、範囲を生成した宣言に戻せば記録したハッシュと合う
+	if restored, ok := withoutOverrides(current, data); ok && !handEdited(restored) {
+		return nil
+	}
+	// 上書きする範囲は残るので、差分は範囲を残した内容と比べる
+	merged, err := mergeOverrides(current, data, true)
+	if err != nil {
+		merged = data
+	}
+	return &editedError{path: path, diff: unifiedDiff(path+" (edited)", path+" (generated)", current, merged)}
+}
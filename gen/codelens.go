@@ -0,0 +1,112 @@
+package gen
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// generateCommand コードレンズから実行するコマンド名
+const generateCommand = "gen-struct.generate"
+
+// LSPのCodeLensと同じ形
+type codeLens struct {
+	Range   lspRange    `json:"range"`
+	Command *lspCommand `json:"command"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspCommand struct {
+	Title     string `json:"title"`
+	Command   string `json:"command"`
+	Arguments []any  `json:"arguments,omitempty"`
+}
+
+// codeLenses ディレクティブのついた構造体ごとに「Generate setters」のようなコードレンズを返す
+func codeLenses(filename string) ([]codeLens, error) {
+	// 編集中で構文エラーがあっても解析できた構造体にはレンズを出す
+	targets, err := searchTargetStructs(filename)
+	if targets == nil {
+		return nil, err
+	}
+	uri := pathToURI(filename)
+	lenses := make([]codeLens, 0, len(targets.structs))
+	for _, s := range targets.structs {
+		start := targets.fileSet.Position(s.spec.Name.Pos())
+		end := targets.fileSet.Position(s.spec.Name.End())
+		// LSPの行・列は0始まり
+		r := lspRange{
+			Start: lspPosition{Line: start.Line - 1, Character: start.Column - 1},
+			End:   lspPosition{Line: end.Line - 1, Character: end.Column - 1},
+		}
+		lenses = append(lenses, codeLens{
+			Range: r,
+			Command: &lspCommand{
+				Title:     "Generate " + strings.Join(s.directiveNames(), ", "),
+				Command:   generateCommand,
+				Arguments: []any{uri, r.Start.Line},
+			},
+		})
+	}
+	return lenses, nil
+}
+
+// executeGenerateCommand コードレンズのコマンドを実行する。
+// 出力はファイル単位なので、対象の構造体を含むファイルだけを再生成する
+func executeGenerateCommand(arguments []json.RawMessage, version int) (*generateResult, error) {
+	var params textDocumentPositionParams
+	if len(arguments) != 2 {
+		return nil, errors.New("gen-struct.generate: expected [uri, line] arguments")
+	}
+	if err := json.Unmarshal(arguments[0], &params.TextDocument.URI); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(arguments[1], &params.Position.Line); err != nil {
+		return nil, err
+	}
+	filename, err := uriToPath(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	target, err := searchTargetStructAt(filename, params.Position.Line+1)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, errors.New("gen-struct.generate: no annotated struct at the given line")
+	}
+	return generateFile(params, version)
+}
+
+// runCodeLens codelens <file>...でgoplsと同じ形のコードレンズをJSONで出力する
+func runCodeLens(args []string) error {
+	if len(args) == 0 {
+		return errors.New("codelens: specify one or more .go files")
+	}
+	lenses := []codeLens{}
+	for _, arg := range args {
+		filename, err := filepath.Abs(arg)
+		if err != nil {
+			return err
+		}
+		l, err := codeLenses(filename)
+		if err != nil {
+			return err
+		}
+		lenses = append(lenses, l...)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(lenses)
+}
@@ -0,0 +1,360 @@
+package gen
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFileName カレントディレクトリからgo.modのあるディレクトリまで探す設定ファイル
+const configFileName = ".gogenstruct.yaml"
+
+// featureFlagsEnv 設定ファイルのフラグを上書きする環境変数。a,-bのように-をつけると無効にする
+const featureFlagsEnv = "GOGENSTRUCT_FLAGS"
+
+// config .gogenstruct.yamlの内容
+//
+//	flags: [stable]
+//	generators:
+//	  pii: experimental
+//	packages:
+//	  ./internal/billing/...:
+//	    flags: [experimental]
+//	budget: 2000
+//	fields: ["*"]
+//	suffix: _gen
+type config struct {
+	dir string // 設定ファイルのあるディレクトリ。packagesのパスの基準
+	// base 設定ファイルを探し始めたディレクトリ。これより下の設定ファイルは生成するときにディレクトリごとに重ねる
+	base string
+	// files 重ねて読んだ設定ファイル。上のディレクトリから順に並ぶ
+	files []string
+
+	// Flags 全てのパッケージで有効なフラグ
+	Flags []string `yaml:"flags"`
+	// Generators コード生成の名前と、それを有効にするフラグ。ここにないコード生成は常に有効
+	Generators map[string]string `yaml:"generators"`
+	// Packages パッケージのディレクトリ（./a/...で配下も含む）ごとに追加で有効にするフラグ
+	Packages map[string]packageConfig `yaml:"packages"`
+	// Budget 1つの構造体に生成してよい行数。省略すると2000行、0で警告しない
+	Budget *int `yaml:"budget"`
+
+	// 以下はコマンドラインのフラグと同じ。フラグを指定すればそちらを優先する
+	Dir       string   `yaml:"dir"`
+	Fields    []string `yaml:"fields"`
+	Suffix    string   `yaml:"suffix"`
+	Recursive *bool    `yaml:"recursive"`
+	OutputDir string   `yaml:"output_dir"`
+	// Overlay ソースのディレクトリ構成を写して出力し、go build -overlay用のoverlay.jsonを書くディレクトリ
+	Overlay string `yaml:"overlay"`
+	// Schemas 構造体の定義を読むYAMLかJSONのファイル
+	Schemas []string `yaml:"schemas"`
+	// Templates //gen:customのテンプレート（<名前>.tmpl）を読むディレクトリ
+	Templates []string `yaml:"templates"`
+	// PackageFile パッケージごとに1ファイルにまとめるときのファイル名（zz_generated_setters.goなど）
+	PackageFile string `yaml:"package_file"`
+	Compat      string `yaml:"compat"`
+
+	RoundTripTests  bool `yaml:"roundtrip_tests"`
+	Benchmarks      bool `yaml:"benchmarks"`
+	ValidationTests bool `yaml:"validation_tests"`
+	Examples        bool `yaml:"examples"`
+	Chain           bool `yaml:"chain"`
+	Prune           bool `yaml:"prune"`
+	// Jobs 並行して処理するファイルの数。0ならGOMAXPROCS
+	Jobs int `yaml:"jobs"`
+	// Prefix 生成するトップレベルの型や関数の名前の接頭辞（Genなど）
+	Prefix string `yaml:"prefix"`
+	// Split コード生成ごとに<file>_<コード生成の名前>.goへ分けて出力する
+	Split bool `yaml:"split"`
+	// Outputs コード生成ごとの出力先の接尾辞（builder: _builder）。ここにないコード生成は元のファイルに出力する
+	Outputs map[string]string `yaml:"outputs"`
+	// Registry //gen:registerのついた構造体を集めた登録簿を生成するディレクトリ
+	Registry string `yaml:"registry"`
+}
+
+type packageConfig struct {
+	Flags []string `yaml:"flags"`
+}
+
+// loadConfig dirから親ディレクトリへ向かって設定ファイルを探し、上のディレクトリの設定ファイルから順に重ねて読む。
+// go.modのあるディレクトリより上は見ない。見つからなければ空の設定を返す
+func loadConfig(dir string) (*config, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	base := dir
+	var paths []string
+	for {
+		path := filepath.Join(dir, configFileName)
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		parent := filepath.Dir(dir)
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil || parent == dir {
+			break
+		}
+		dir = parent
+	}
+	c := &config{dir: dir}
+	for i, path := range slices.Backward(paths) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if i == len(paths)-1 {
+			c, err = parseConfig(path, data)
+		} else {
+			c, err = c.layer(path, data)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.base = base
+	return c, nil
+}
+
+func parseConfig(path string, data []byte) (*config, error) {
+	c := &config{dir: filepath.Dir(path), files: []string{path}}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, c.check(path)
+}
+
+// topLevelConfigKeys 出力するファイルの名前や場所など、実行全体で1つに決まる項目。
+// 下のディレクトリの設定ファイルで変えると、以前生成したファイルを見分けられなくなる
+var topLevelConfigKeys = []string{"dir", "recursive", "suffix", "output_dir", "overlay", "schemas", "package_file", "compat", "prune", "jobs", "split", "outputs", "registry"}
+
+// layer 下のディレクトリの設定ファイル（path）をcに重ねた設定を返す。
+// 書かれた項目だけを上書きし、generatorsとpackagesはキーごとに上書きする
+func (c *config) layer(path string, data []byte) (*config, error) {
+	var keys map[string]any
+	if err := yaml.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, key := range topLevelConfigKeys {
+		if _, ok := keys[key]; ok {
+			return nil, fmt.Errorf("%s: %s can only be set in the top-level %s", path, key, configFileName)
+		}
+	}
+	layered := c.rebase(filepath.Dir(path))
+	if err := yaml.Unmarshal(data, layered); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	layered.files = append(slices.Clip(c.files), path)
+	return layered, layered.check(path)
+}
+
+// rebase dirに置いた設定ファイルから読んだように、パスをdirからのパスに直した設定のコピー
+func (c *config) rebase(dir string) *config {
+	r := *c
+	r.dir = dir
+	r.Dir, r.OutputDir, r.Overlay, r.Registry = c.path(c.Dir), c.path(c.OutputDir), c.path(c.Overlay), c.path(c.Registry)
+	r.Schemas = make([]string, 0, len(c.Schemas))
+	for _, path := range c.Schemas {
+		r.Schemas = append(r.Schemas, c.path(path))
+	}
+	r.Templates = make([]string, 0, len(c.Templates))
+	for _, path := range c.Templates {
+		r.Templates = append(r.Templates, c.path(path))
+	}
+	r.Generators = maps.Clone(c.Generators)
+	// dirより上のパッケージのパターンは、dirの配下に一致するものだけをdirからのパターンにして残す
+	r.Packages = make(map[string]packageConfig, len(c.Packages))
+	for pattern, p := range c.Packages {
+		prefix, recursive := strings.CutSuffix(strings.TrimSuffix(filepath.ToSlash(pattern), "/"), "/...")
+		target := c.path(filepath.FromSlash(prefix))
+		rel, err := filepath.Rel(dir, target)
+		switch {
+		case err != nil:
+		case filepath.IsLocal(rel):
+			if recursive {
+				r.Packages["./"+filepath.ToSlash(rel)+"/..."] = p
+			} else {
+				r.Packages["./"+filepath.ToSlash(rel)] = p
+			}
+		case recursive && withinAny(dir, []string{target}):
+			r.Packages["./..."] = p
+		case rel == ".":
+			r.Packages["."] = p
+		}
+	}
+	return &r
+}
+
+// check 設定ファイルに書かれたコード生成の名前を確かめる
+func (c *config) check(path string) error {
+	for name := range c.Generators {
+		if lookupGenerator(name) == nil {
+			return fmt.Errorf("%s: unknown generator %q in generators", path, name)
+		}
+	}
+	for name := range c.Outputs {
+		if lookupGenerator(name) == nil {
+			return fmt.Errorf("%s: unknown generator %q in outputs", path, name)
+		}
+	}
+	return nil
+}
+
+// path 設定ファイルに書かれたパスを、設定ファイルのディレクトリからのパスにする
+func (c *config) path(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(c.dir, p)
+}
+
+// enabledFlags パッケージのディレクトリで有効なフラグ。環境変数の指定が設定ファイルより優先される
+func (c *config) enabledFlags(pkgDir string) map[string]bool {
+	enabled := make(map[string]bool)
+	for _, f := range c.Flags {
+		enabled[f] = true
+	}
+	rel, err := filepath.Rel(c.dir, pkgDir)
+	if err == nil {
+		rel = "./" + filepath.ToSlash(rel)
+		for pattern, p := range c.Packages {
+			if !matchPackagePattern(pattern, rel) {
+				continue
+			}
+			for _, f := range p.Flags {
+				enabled[f] = true
+			}
+		}
+	}
+	for _, f := range strings.Split(os.Getenv(featureFlagsEnv), ",") {
+		f = strings.TrimSpace(f)
+		if name, off := strings.CutPrefix(f, "-"); off {
+			enabled[name] = false
+		} else if f != "" {
+			enabled[f] = true
+		}
+	}
+	return enabled
+}
+
+// matchPackagePattern ./internal/billingは同じディレクトリだけ、./internal/...は配下も含めて一致させる
+func matchPackagePattern(pattern, rel string) bool {
+	pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+	rel = strings.TrimSuffix(rel, "/.")
+	if prefix, ok := strings.CutSuffix(pattern, "/..."); ok {
+		return rel == prefix || strings.HasPrefix(rel, prefix+"/")
+	}
+	return rel == pattern
+}
+
+// disabledGenerators パッケージのディレクトリでフラグが無効なコード生成の名前と、そのフラグ
+func (c *config) disabledGenerators(pkgDir string) map[string]string {
+	if len(c.Generators) == 0 {
+		return nil
+	}
+	enabled := c.enabledFlags(pkgDir)
+	disabled := make(map[string]string)
+	for name, flag := range c.Generators {
+		if !enabled[flag] {
+			disabled[name] = flag
+		}
+	}
+	return disabled
+}
+
+// applyConfig フラグが無効なコード生成を対象から外し、外したディレクティブについての警告を返す
+func (t *targetStructs) applyConfig(c *config) []*diagnostic {
+	t.disabled = c.disabledGenerators(t.path)
+	var skipped []*diagnostic
+	for _, s := range t.structs {
+		for _, d := range s.directives {
+			if flag, ok := t.disabled[d.name]; ok {
+				skipped = append(skipped, newDiagnostic(diagDisabled, t.fileSet.Position(s.spec.Pos()), directivePrefix+d.name, s.name(), flag))
+			}
+		}
+	}
+	return skipped
+}
+
+// dirOptions 設定ファイルを探し始めたディレクトリより下の、設定ファイルを重ねたディレクトリごとのオプション。
+// 並行して生成するファイルで共有する
+type dirOptions struct {
+	mu       sync.Mutex
+	root     *generateOptions
+	setFlags map[string]bool
+	byDir    map[string]dirOptionsEntry
+}
+
+type dirOptionsEntry struct {
+	opts *generateOptions
+	err  error
+}
+
+// forDir dirのソースファイルを生成するときのオプション。dirと、設定ファイルを探し始めたディレクトリとの間に
+// 設定ファイルがあれば重ねる。出力するファイルの名前や場所などは重ねずにoのものを使う
+func (o *generateOptions) forDir(dir string) (*generateOptions, error) {
+	if o.dirs == nil {
+		return o, nil
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	o.dirs.mu.Lock()
+	defer o.dirs.mu.Unlock()
+	return o.dirs.lookup(dir)
+}
+
+func (d *dirOptions) lookup(dir string) (*generateOptions, error) {
+	if rel, err := filepath.Rel(d.root.config.base, dir); err != nil || rel == "." || !filepath.IsLocal(rel) {
+		return d.root, nil
+	}
+	if e, ok := d.byDir[dir]; ok {
+		return e.opts, e.err
+	}
+	opts, err := d.lookup(filepath.Dir(dir))
+	if err == nil {
+		path := filepath.Join(dir, configFileName)
+		var data []byte
+		if data, err = os.ReadFile(path); err == nil {
+			opts, err = opts.withConfig(path, data, d.setFlags)
+		} else if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+	}
+	d.byDir[dir] = dirOptionsEntry{opts, err}
+	return opts, err
+}
+
+// withConfig 設定ファイル（path）を重ねたオプション。フラグで指定した項目はフラグを優先する
+func (o *generateOptions) withConfig(path string, data []byte, setFlags map[string]bool) (*generateOptions, error) {
+	cfg, err := o.config.layer(path, data)
+	if err != nil {
+		return nil, err
+	}
+	layered, err := newGenerateOptions(cfg, setFlags)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	opts := *o
+	opts.config = cfg
+	opts.fields = layered.fields
+	opts.roundTripTests = layered.roundTripTests
+	opts.benchmarks = layered.benchmarks
+	opts.validationTests = layered.validationTests
+	opts.examples = layered.examples
+	opts.chain = layered.chain
+	opts.prefix = layered.prefix
+	opts.templates = layered.templates
+	return &opts, nil
+}
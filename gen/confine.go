@@ -0,0 +1,97 @@
+package gen
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var allowOutside = commandLine.Bool("allow-outside", false, "allow writing generated files outside the module (or go.work workspace) root")
+
+// writeRoots 生成したファイルを書き込めるディレクトリ。
+// dirのモジュールのルート（go.workのワークスペースにあればそのルート）と、-overlayのディレクトリ
+func (o *generateOptions) writeRoots(dir string) []string {
+	roots := []string{workspaceRoot(dir)}
+	if o.overlay != "" {
+		roots = append(roots, o.overlay)
+	}
+	return roots
+}
+
+// workspaceRoot dirを含むgo.workのディレクトリ、なければgo.modのディレクトリ。どちらもなければdir
+func workspaceRoot(dir string) string {
+	root := overlayRoot(dir)
+	if os.Getenv("GOWORK") == "off" {
+		return root
+	}
+	for d := root; ; {
+		if _, err := os.Stat(filepath.Join(d, "go.work")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return root
+		}
+		d = parent
+	}
+}
+
+// checkOutputRoots 生成したファイルの出力先が、シンボリックリンクをたどってもrootsのどれかの中にあるか確かめる。
+// 出力先の設定を間違えて、関係のないファイルを上書きしないようにする
+func checkOutputRoots(generated []*generatedFile, roots []string) error {
+	realRoots := make([]string, 0, len(roots))
+	for _, root := range roots {
+		real, err := realPath(root)
+		if err != nil {
+			return err
+		}
+		realRoots = append(realRoots, real)
+	}
+	var errs []error
+	for _, g := range generated {
+		real, err := realPath(g.path)
+		if err != nil {
+			return err
+		}
+		if !withinAny(real, realRoots) {
+			errs = append(errs, fmt.Errorf("%s: refusing to write outside %s (generated from %s); use -allow-outside to write it anyway", g.path, strings.Join(roots, ", "), g.source))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// realPath 絶対パスにし、シンボリックリンクを解決したパス。まだないファイルやディレクトリは、あるところまで解決してつなげる
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var rest []string
+	for dir := abs; ; {
+		real, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(append([]string{real}, rest...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return abs, nil
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+		dir = parent
+	}
+}
+
+func withinAny(path string, roots []string) bool {
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, path); err == nil && (rel == "." || filepath.IsLocal(rel)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package gen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 出力先は、まだないディレクトリでもシンボリックリンクをたどっても、ルートの中にあるときだけ書き込める
+func TestCheckOutputRoots(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	writeTree(t, dir, map[string]string{"root/go.mod": "module example.com/m\n", "root/m/model.go": "package m\n", "outside/x.go": "package x\n"})
+	for link, target := range map[string]string{filepath.Join(root, "escape"): outside, filepath.Join(root, "inner"): filepath.Join(root, "m"), filepath.Join(dir, "alias"): root} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skip(err)
+		}
+	}
+	tests := []struct {
+		name    string
+		path    string
+		roots   []string
+		wantErr bool
+	}{
+		{"inside", filepath.Join(root, "m", "model_setters.go"), []string{root}, false},
+		{"new directory", filepath.Join(root, "gen", "new", "model_setters.go"), []string{root}, false},
+		{"outside", filepath.Join(outside, "model_setters.go"), []string{root}, true},
+		{"parent", filepath.Join(root, "..", "outside", "model_setters.go"), []string{root}, true},
+		{"symlink escaping the root", filepath.Join(root, "escape", "model_setters.go"), []string{root}, true},
+		{"symlink inside the root", filepath.Join(root, "inner", "model_setters.go"), []string{root}, false},
+		{"root through a symlink", filepath.Join(root, "m", "model_setters.go"), []string{filepath.Join(dir, "alias")}, false},
+		{"second root", filepath.Join(outside, "model_setters.go"), []string{root, outside}, false},
+	}
+	for _, tt := range tests {
+		err := checkOutputRoots([]*generatedFile{{source: filepath.Join(root, "m", "model.go"), path: tt.path}}, tt.roots)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkOutputRoots(%s) = %v, want error %v", tt.name, tt.path, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// generatedMarker 生成したファイルの先頭の行。まとめる前の古い出力を見分けるのに使う
+const generatedMarker = "// Code generated by go-gen-struct. DO NOT EDIT."
+
+// legacyGeneratedMarker 出力形式v6までの先頭の行
+const legacyGeneratedMarker = "// Code generated by go-struct-gen; DO NOT EDIT."
+
+// outputKinds 生成するファイルの種類ごとの接尾辞。長いものから比べる
+var outputKinds = []string{"_example_test.go", "_test.go", ".go"}
+
+// outputKind 生成したファイルの種類（outputKindsのどれか）
+func outputKind(path string) string {
+	for _, kind := range outputKinds {
+		if strings.HasSuffix(path, kind) {
+			return kind
+		}
+	}
+	return ""
+}
+
+// consolidatePackageFiles 同じディレクトリへの出力を、種類ごとにnameの1ファイル（テストはname_test.go）にまとめる。
+// まとめる前の出力先に以前生成したファイルが残っていれば、宣言が重複するのでstaleとして返す。
+// versionはまとめたファイルの出力先から出力形式を決める（テストのファイルは本体のファイルに合わせる）
+func consolidatePackageFiles(generated []*generatedFile, name string, version func(path string) int) (merged []*generatedFile, stale []string, err error) {
+	type group struct {
+		path  string
+		files []*generatedFile
+	}
+	var groups []*group
+	byPath := make(map[string]*group)
+	for _, g := range generated {
+		kind := outputKind(g.path)
+		path := filepath.Join(g.dir(), strings.TrimSuffix(name, ".go")+kind)
+		grp, ok := byPath[path]
+		if !ok {
+			grp = &group{path: path}
+			byPath[path] = grp
+			groups = append(groups, grp)
+		}
+		grp.files = append(grp.files, g)
+		if g.path != path && isGeneratedFile(g.path) {
+			stale = append(stale, g.path)
+		}
+	}
+	for _, grp := range groups {
+		g, err := mergeGeneratedFiles(grp.path, grp.files, version(filepath.Join(filepath.Dir(grp.path), strings.TrimSuffix(name, ".go")+".go")))
+		if err != nil {
+			return nil, nil, err
+		}
+		merged = append(merged, g)
+	}
+	return merged, stale, nil
+}
+
+// isGeneratedFile このツールが生成したファイルがpathにあるか
+// 巨大なファイルもあるので、先頭の行の分だけ読む
+func isGeneratedFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, max(len(generatedMarker), len(legacyGeneratedMarker)))
+	n, _ := io.ReadFull(f, head)
+	return isGeneratedSource(head[:n])
+}
+
+// mergeGeneratedFiles 生成したファイルの本文をつなげ、importをまとめて1つのファイルにする
+func mergeGeneratedFiles(path string, files []*generatedFile, version int) (*generatedFile, error) {
+	var packageName string
+	var imports []templateImport
+	names := make(map[string]string) // key: 参照する名前, value: import path
+	var body bytes.Buffer
+	sources := make([]string, 0, len(files))
+	var buildLine string
+	for i, g := range files {
+		fileSet := token.NewFileSet()
+		file, err := parser.ParseFile(fileSet, g.path, g.src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if packageName != "" && file.Name.Name != packageName {
+			return nil, fmt.Errorf("%s: cannot merge package %s into package %s", path, file.Name.Name, packageName)
+		}
+		packageName = file.Name.Name
+		// ビルド制約の違うファイルをまとめると、どちらかのプラットフォームでビルドできなくなる
+		line := goBuildLine(buildConstraint(file, ""))
+		if i > 0 && line != buildLine {
+			return nil, fmt.Errorf("%s: cannot merge %s and %s because their build constraints differ; generate one file per source", path, files[0].source, g.source)
+		}
+		buildLine = line
+		for _, spec := range file.Imports {
+			importPath, _ := strconv.Unquote(spec.Path.Value)
+			imp := templateImport{Path: importPath}
+			name := importNames.resolve(g.dir(), []string{importPath})[importPath]
+			if spec.Name != nil {
+				imp.Alias, name = spec.Name.Name, spec.Name.Name
+			}
+			if other, ok := names[name]; ok {
+				if other != importPath {
+					return nil, fmt.Errorf("%s: imports %q and %q are both referred to as %q; use -import-name or generate one file per source", path, other, importPath, name)
+				}
+				continue
+			}
+			names[name] = importPath
+			imports = append(imports, imp)
+		}
+		// importの後（なければpackage句の後）から本文にする
+		end := file.Name.End()
+		for _, decl := range file.Decls {
+			if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+				end = gen.End()
+			}
+		}
+		body.Write(g.src[fileSet.Position(end).Offset:])
+		sources = append(sources, g.source)
+	}
+	sourceNames := make([]string, len(sources))
+	for i, source := range sources {
+		sourceNames[i] = filepath.Base(source)
+	}
+	src, err := generatedSource(version, packageName, imports, body.Bytes(), sourceHeader{
+		Source:          strings.Join(sourceNames, ", "),
+		BuildConstraint: buildLine,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &generatedFile{source: strings.Join(sources, ", "), path: path, src: src}, nil
+}
@@ -0,0 +1,200 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+	"unicode"
+)
+
+// constructor //gen:constructorで生成するNewX。必須フィールドを引数の順に受け取る
+type constructor struct {
+	StructName string
+	Name       string
+	Params     []*constructorParam
+	EnsureNow  string // EnsureCreatedAtで作成日時を設定する場合の時刻の式
+	AutoID     *autoID
+	// //gen:constructor validateの場合、ゼロ値の引数をエラーにして(*X, error)を返す
+	Validate   bool
+	Invariants bool // validateで//gen:invariantsがあれば、最後にinvariants()も確認する
+	Fmt        string
+	Strings    string
+}
+
+type constructorParam struct {
+	Name      string // 引数名
+	FieldName string
+	FieldType string
+	IsZero    string // validateの場合の、引数がゼロ値のときにtrueになる式
+}
+
+// newConstructor gen:"required"のついたフィールド（required=A,Bで指定したフィールド）を宣言順に引数にする
+func newConstructor(r *renderer, target *directiveTarget) (*constructor, error) {
+	s := target.s
+	structName := s.name()
+	requiredArg, err := requiredFieldsArg(target)
+	if err != nil {
+		return nil, err
+	}
+	c := &constructor{StructName: structName, Name: "New" + structName}
+	if !ast.IsExported(structName) {
+		c.Name = "new" + exportedName(structName)
+	}
+	c.Name = r.ident(c.Name)
+	if _, ok := target.d.arg("validate"); ok {
+		c.Validate = true
+		c.Invariants = r.invariants[structName] != ""
+	}
+	for _, field := range s.structType().Fields.List {
+		for _, name := range field.Names {
+			if !parseGenTag(field).has("required") && !containsTargetField(name.Name, requiredArg...) {
+				continue
+			}
+			p := &constructorParam{
+				Name:      paramName(r, name.Name),
+				FieldName: name.Name,
+				FieldType: r.typeString(field.Type),
+			}
+			if c.Validate {
+				p.IsZero = zeroCheck(r, p.Name, field.Type)
+			}
+			c.Params = append(c.Params, p)
+		}
+	}
+	if c.Validate && len(c.Params) > 0 {
+		c.Fmt = r.importName("fmt")
+		c.Strings = r.importName("strings")
+	}
+	// 作成日時は引数で受け取らなければEnsureCreatedAtで設定する。
+	// 作った直後に不変条件を確認すると失敗しうるので、//gen:invariantsのある構造体では使わない
+	if e := newEnsureCreatedAt(r, s); e != nil && r.invariants[structName] == "" && !containsConstructorParam(c.Params, "CreatedAt") {
+		c.EnsureNow = touchNow(r, s, e.Time)
+	}
+	a, err := newAutoID(r, s)
+	if err != nil {
+		return nil, err
+	}
+	if a != nil {
+		if containsConstructorParam(c.Params, a.FieldName) {
+			return nil, fmt.Errorf("%s: gen:\"autoid\" field %s cannot also be required", structName, a.FieldName)
+		}
+		// EnsureCreatedAtがなくても、識別子と同じところで作成日時を設定する
+		if containsConstructorParam(c.Params, "CreatedAt") {
+			a.Now = ""
+		}
+		c.AutoID = a
+	}
+	return c, nil
+}
+
+// zeroCheck 引数がゼロ値のときにtrueになる式。time.TimeはIsZero()、nilになる型はnilと比べる
+func zeroCheck(r *renderer, name string, expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr, *ast.MapType, *ast.FuncType, *ast.ChanType, *ast.InterfaceType:
+		return name + " == nil"
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return name + " == nil"
+		}
+	case *ast.SelectorExpr:
+		if x, ok := t.X.(*ast.Ident); ok && t.Sel.Name == "Time" {
+			if imp, ok := r.importsMap[x.Name]; ok && imp.pkg == "time" {
+				return name + ".IsZero()"
+			}
+		}
+	}
+	return name + " == *new(" + getFiledTypeString(expr) + ")"
+}
+
+func containsConstructorParam(params []*constructorParam, fieldName string) bool {
+	for _, p := range params {
+		if p.FieldName == fieldName {
+			return true
+		}
+	}
+	return false
+}
+
+// paramName フィールド名から引数名を作る（ID → id, URLPath → urlPath）。
+// 予約語やパッケージ名とぶつかる場合は_をつける
+func paramName(r *renderer, fieldName string) string {
+	runes := []rune(fieldName)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	// 頭字語に続く単語の先頭の大文字は残す
+	if upper > 1 && upper < len(runes) {
+		upper--
+	}
+	name := strings.ToLower(string(runes[:upper])) + string(runes[upper:])
+	if _, ok := r.importsMap[name]; ok || token.IsKeyword(name) {
+		name += "_"
+	}
+	return name
+}
+
+func renderConstructor(r *renderer, targets []*directiveTarget) error {
+	constructors := make([]*constructor, 0, len(targets))
+	for _, target := range targets {
+		c, err := newConstructor(r, target)
+		if err != nil {
+			return err
+		}
+		constructors = append(constructors, c)
+	}
+	return r.execute("constructor", constructorTemplate, constructors)
+}
+
+const constructorTemplate = `
+{{range .}}
+{{- if .Validate}}
+// {{.Name}} returns an error when a required field is given its zero value.
+{{- end}}
+func {{.Name}}{{typeParams .StructName}}({{range $i, $p := .Params}}{{if $i}}, {{end}}{{.Name}} {{.FieldType}}{{end}}) {{if .Validate}}(*{{recv .StructName}}, error){{else}}*{{recv .StructName}}{{end}} {
+	{{- if and .Validate .Params}}
+	var missing []string
+	{{- range .Params}}
+	if {{.IsZero}} {
+		missing = append(missing, "{{.FieldName}}")
+	}
+	{{- end}}
+	if len(missing) > 0 {
+		return nil, {{.Fmt}}.Errorf("{{.StructName}}: missing required fields: %s", {{.Strings}}.Join(missing, ", "))
+	}
+	{{- end}}
+	{{- if or .EnsureNow .AutoID .Validate}}
+	s := &{{recv .StructName}}{
+		{{- range .Params}}
+		{{.FieldName}}: {{.Name}},
+		{{- end}}
+	}
+	{{- with .AutoID}}
+	s.{{.FieldName}} = {{.Func}}()
+	{{- end}}
+	{{- if .EnsureNow}}
+	s.EnsureCreatedAt({{.EnsureNow}})
+	{{- else if and .AutoID .AutoID.Now}}
+	s.CreatedAt = {{.AutoID.Now}}
+	{{- end}}
+	{{- if .Invariants}}
+	if err := s.invariants(); err != nil {
+		return nil, err
+	}
+	{{- end}}
+	{{- if .Validate}}
+	return s, nil
+	{{- else}}
+	return s
+	{{- end}}
+	{{- else}}
+	return &{{recv .StructName}}{
+		{{- range .Params}}
+		{{.FieldName}}: {{.Name}},
+		{{- end}}
+	}
+	{{- end}}
+}
+{{end}}
+`
@@ -0,0 +1,123 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+var (
+	coverageIgnore  = commandLine.String("coverage-ignore", "", "add this `comment` (e.g. //coverage:ignore) above every generated function so coverage tools can exclude it")
+	coverageExclude = commandLine.String("coverage-exclude", "", "write the import paths of the generated files to this `file`, one per line, to filter a coverage profile (grep -v -F -f file cover.out)")
+)
+
+// checkCoverageMarker -coverage-ignoreの値が1行の//コメントか確かめる
+func checkCoverageMarker(marker string) error {
+	if !strings.HasPrefix(marker, "//") || strings.ContainsAny(marker, "\r\n") {
+		return fmt.Errorf("invalid -coverage-ignore %q: must be a single // comment", marker)
+	}
+	return nil
+}
+
+// markCoverageIgnored 生成したファイル（テストを除く）の全ての関数とメソッドの直前にmarkerの行を入れ、ハッシュを計算し直す。
+// ドキュメントコメントの最後の行になるので、//coverage:ignoreのような空白のないものはgodocに表示されない
+func markCoverageIgnored(generated []*generatedFile, marker string) error {
+	for _, g := range generated {
+		if strings.HasSuffix(g.path, "_test.go") {
+			continue
+		}
+		src, err := insertCoverageMarker(g.path, g.src, marker)
+		if err != nil {
+			return err
+		}
+		g.src = withChecksum(src)
+	}
+	return nil
+}
+
+func insertCoverageMarker(path string, src []byte, marker string) ([]byte, error) {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, path, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	// funcの行の先頭に入れる。前の行が既にmarkerなら入れない
+	var offsets []int
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		offset := fileSet.Position(fn.Pos()).Offset
+		offset = bytes.LastIndexByte(src[:offset], '\n') + 1
+		if prev := bytes.LastIndexByte(src[:max(offset-1, 0)], '\n') + 1; string(bytes.TrimSpace(src[prev:offset])) == marker {
+			continue
+		}
+		offsets = append(offsets, offset)
+	}
+	var b bytes.Buffer
+	last := 0
+	for _, offset := range offsets {
+		b.Write(src[last:offset])
+		b.WriteString(marker + "\n")
+		last = offset
+	}
+	b.Write(src[last:])
+	return b.Bytes(), nil
+}
+
+// writeCoverageExclude カバレッジのプロファイルに書かれる形（<モジュールのパス>/<ディレクトリ>/<ファイル名>）で
+// 生成したファイル（テストを除く）をpathに書く。-overlayならソースのディレクトリにあるものとして書く
+func writeCoverageExclude(path string, opts *generateOptions, dir string, generated []*generatedFile) error {
+	goMod, err := findGoMod(dir)
+	if err != nil {
+		return fmt.Errorf("-coverage-exclude: %w", err)
+	}
+	data, err := os.ReadFile(goMod)
+	if err != nil {
+		return err
+	}
+	module := modfile.ModulePath(data)
+	if module == "" {
+		return fmt.Errorf("-coverage-exclude: no module path in %s", goMod)
+	}
+	root := filepath.Dir(goMod)
+	var lines []string
+	for _, g := range generated {
+		if strings.HasSuffix(g.path, "_test.go") {
+			continue
+		}
+		file, err := filepath.Abs(g.path)
+		if err != nil {
+			return err
+		}
+		if opts.overlay != "" {
+			if rel, err := filepath.Rel(opts.overlay, file); err == nil {
+				file = filepath.Join(opts.overlayRoot, rel)
+			}
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil || !filepath.IsLocal(rel) {
+			// モジュールの外（-output-dirなど）のファイルはプロファイルに現れない
+			continue
+		}
+		lines = append(lines, module+"/"+filepath.ToSlash(rel))
+	}
+	sort.Strings(lines)
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(line + "\n")
+	}
+	if current, err := os.ReadFile(path); err == nil && string(current) == b.String() {
+		return nil
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
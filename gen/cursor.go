@@ -0,0 +1,250 @@
+package gen
+
+import (
+	"go/ast"
+	"go/parser"
+	"strconv"
+)
+
+// cursor //gen:cursorで生成するキーセットページネーションのカーソル
+type cursor struct {
+	StructName    string
+	TypeName      string // ExampleCursor
+	UnmarshalName string // UnmarshalExampleCursor
+	Keys          []*pageKey
+	Sign          bool // HMAC-SHA256で署名する
+	Base64        string
+	JSON          string
+	Errors        string
+	HMAC          string
+	SHA256        string
+	Strings       string
+}
+
+func newCursor(r *renderer, target *directiveTarget) (*cursor, error) {
+	structName := target.s.name()
+	keys, err := cursorKeys(r, target)
+	if err != nil {
+		return nil, err
+	}
+	_, sign := target.d.arg("sign")
+	c := &cursor{
+		StructName:    structName,
+		TypeName:      structName + "Cursor",
+		UnmarshalName: cursorUnmarshalName(r, structName),
+		Keys:          keys,
+		Sign:          sign,
+		Base64:        r.importName("encoding/base64"),
+		JSON:          r.importName("encoding/json"),
+		Errors:        r.importName("errors"),
+	}
+	c.TypeName = r.ident(c.TypeName)
+	if sign {
+		c.HMAC = r.importName("crypto/hmac")
+		c.SHA256 = r.importName("crypto/sha256")
+		c.Strings = r.importName("strings")
+	}
+	return c, nil
+}
+
+// cursorUnmarshalName //gen:cursorで生成するUnmarshalXCursorの名前
+func cursorUnmarshalName(r *renderer, structName string) string {
+	if !ast.IsExported(structName) {
+		return r.ident("unmarshal" + exportedName(structName) + "Cursor")
+	}
+	return r.ident("Unmarshal" + structName + "Cursor")
+}
+
+func renderCursor(r *renderer, targets []*directiveTarget) error {
+	cursors := make([]*cursor, 0, len(targets))
+	for _, target := range targets {
+		c, err := newCursor(r, target)
+		if err != nil {
+			return err
+		}
+		cursors = append(cursors, c)
+	}
+	if err := r.execute("cursor", cursorTemplate, cursors); err != nil {
+		return err
+	}
+	if !r.t.roundTripTests {
+		return nil
+	}
+	return renderCursorTests(r, cursors)
+}
+
+// cursorTest MarshalしたカーソルをUnmarshalすると元に戻るかのテスト
+type cursorTest struct {
+	*cursor
+	TestName string
+	Params   []*cursorTestParam
+	Testing  string
+	Quick    string
+	Reflect  string
+}
+
+// cursorTestParam testing/quickで生成する値。time.Timeはint64のナノ秒から作る
+type cursorTestParam struct {
+	Name  string
+	Type  string
+	Value string // キーに入れる値の式
+	Time  bool
+}
+
+func renderCursorTests(r *renderer, cursors []*cursor) error {
+	tr := r.testFile()
+	tests := make([]*cursorTest, 0, len(cursors))
+	for _, c := range cursors {
+		test := &cursorTest{
+			cursor:   c,
+			TestName: "Test" + exportedName(c.TypeName) + "RoundTrip",
+			Testing:  tr.importName("testing"),
+			Quick:    tr.importName("testing/quick"),
+		}
+		for i, k := range c.Keys {
+			p := &cursorTestParam{Name: "k" + strconv.Itoa(i), Type: k.FieldType, Time: k.Time != ""}
+			p.Value = p.Name
+			if p.Time {
+				p.Type = "int64"
+				p.Value = tr.importName("time") + ".Unix(0, " + p.Name + ").UTC()"
+			} else {
+				test.Reflect = tr.importName("reflect")
+				shareTypeImports(r, tr, k.FieldType)
+			}
+			test.Params = append(test.Params, p)
+		}
+		tests = append(tests, test)
+	}
+	return tr.execute("cursor_test", cursorTestTemplate, tests)
+}
+
+// shareTypeImports 生成コードの型が他のパッケージの型を含む場合、テストのファイルでも同じ名前でimportする
+func shareTypeImports(r, tr *renderer, typ string) {
+	expr, err := parser.ParseExpr(typ)
+	if err != nil {
+		return
+	}
+	ast.Inspect(expr, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); ok {
+			if imp, ok := r.importsMap[ident.Name]; ok {
+				tr.importsMap[ident.Name] = &usedImport{pkg: imp.pkg, alias: imp.alias, used: true}
+			}
+		}
+		return true
+	})
+}
+
+const cursorTestTemplate = `
+{{range .}}
+{{- $c := .}}
+func {{.TestName}}(t *{{.Testing}}.T) {
+	{{- if .Sign}}
+	key := []byte("round-trip-test-key")
+	{{- end}}
+	f := func({{range $i, $p := .Params}}{{if $i}}, {{end}}{{.Name}} {{.Type}}{{end}}) bool {
+		c := {{.TypeName}}{
+			{{- range $i, $k := .Keys}}
+			{{.FieldName}}: {{(index $c.Params $i).Value}},
+			{{- end}}
+		}
+		got, err := {{.UnmarshalName}}(c.Marshal({{if .Sign}}key{{end}}){{if .Sign}}, key{{end}})
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		{{- range $i, $k := .Keys}}
+		{{- if (index $c.Params $i).Time}}
+		if !got.{{.FieldName}}.Equal(c.{{.FieldName}}) {
+			return false
+		}
+		{{- else}}
+		if !{{$c.Reflect}}.DeepEqual(got.{{.FieldName}}, c.{{.FieldName}}) {
+			return false
+		}
+		{{- end}}
+		{{- end}}
+		return true
+	}
+	if err := {{.Quick}}.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+{{end}}
+`
+
+const cursorTemplate = `
+{{range .}}
+// {{.TypeName}} is the keyset pagination position of a {{.StructName}}.
+type {{.TypeName}} struct {
+	{{- range .Keys}}
+	{{.FieldName}} {{.FieldType}}
+	{{- end}}
+}
+
+func (s *{{.StructName}}) Cursor() {{.TypeName}} {
+	return {{.TypeName}}{
+		{{- range .Keys}}
+		{{.FieldName}}: s.{{.FieldName}},
+		{{- end}}
+	}
+}
+{{if .Sign}}
+// Marshal encodes the cursor as opaque base64 signed with HMAC-SHA256 using key.
+func (c {{.TypeName}}) Marshal(key []byte) string {
+	data, _ := {{.JSON}}.Marshal(c)
+	mac := {{.HMAC}}.New({{.SHA256}}.New, key)
+	mac.Write(data)
+	return {{.Base64}}.RawURLEncoding.EncodeToString(data) + "." + {{.Base64}}.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// {{.UnmarshalName}} decodes a cursor produced by Marshal and verifies its signature.
+func {{.UnmarshalName}}(s string, key []byte) ({{.TypeName}}, error) {
+	var c {{.TypeName}}
+	payload, signature, ok := {{.Strings}}.Cut(s, ".")
+	if !ok {
+		return c, {{.Errors}}.New("invalid {{.StructName}} cursor")
+	}
+	data, err := {{.Base64}}.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return c, {{.Errors}}.New("invalid {{.StructName}} cursor")
+	}
+	sum, err := {{.Base64}}.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return c, {{.Errors}}.New("invalid {{.StructName}} cursor")
+	}
+	mac := {{.HMAC}}.New({{.SHA256}}.New, key)
+	mac.Write(data)
+	if !{{.HMAC}}.Equal(sum, mac.Sum(nil)) {
+		return c, {{.Errors}}.New("invalid {{.StructName}} cursor signature")
+	}
+	if err := {{.JSON}}.Unmarshal(data, &c); err != nil {
+		return c, {{.Errors}}.New("invalid {{.StructName}} cursor")
+	}
+	return c, nil
+}
+{{- else}}
+// Marshal encodes the cursor as opaque base64.
+func (c {{.TypeName}}) Marshal() string {
+	data, _ := {{.JSON}}.Marshal(c)
+	return {{.Base64}}.RawURLEncoding.EncodeToString(data)
+}
+
+// {{.UnmarshalName}} decodes a cursor produced by Marshal.
+func {{.UnmarshalName}}(s string) ({{.TypeName}}, error) {
+	var c {{.TypeName}}
+	data, err := {{.Base64}}.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, {{.Errors}}.New("invalid {{.StructName}} cursor")
+	}
+	if err := {{.JSON}}.Unmarshal(data, &c); err != nil {
+		return c, {{.Errors}}.New("invalid {{.StructName}} cursor")
+	}
+	return c, nil
+}
+{{- end}}
+{{end}}
+`
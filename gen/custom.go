@@ -0,0 +1,101 @@
+package gen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// customTemplateExt -templateのディレクトリから読むテンプレートの拡張子
+const customTemplateExt = ".tmpl"
+
+// loadCustomTemplates dirsの*.tmplを、拡張子を除いたファイル名で//gen:customから参照できるテンプレートとして読む
+func loadCustomTemplates(dirs []string) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template)
+	paths := make(map[string]string) // key: テンプレートの名前, value: ファイル
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("-template: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != customTemplateExt {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			name := strings.TrimSuffix(entry.Name(), customTemplateExt)
+			if other, ok := paths[name]; ok {
+				return nil, fmt.Errorf("-template: template %s is defined by both %s and %s", name, other, path)
+			}
+			text, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			tmpl, err := template.New(name).Funcs(templateSetFuncs(nil)).Parse(string(text))
+			if err != nil {
+				return nil, fmt.Errorf("-template: %w", err)
+			}
+			paths[name] = path
+			templates[name] = tmpl
+		}
+	}
+	return templates, nil
+}
+
+// customTemplateNames -templateで読んだテンプレートの名前
+func customTemplateNames(templates map[string]*template.Template) []string {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// renderCustom //gen:custom <テンプレート名>のついた構造体について、テンプレートを実行する。
+// 同じテンプレートを使う構造体はまとめて[]*Structとして渡す
+func renderCustom(r *renderer, targets []*directiveTarget) error {
+	imports := r.t.namedImports()
+	var names []string
+	byName := make(map[string][]*Struct)
+	for _, target := range targets {
+		name, args := "", make(map[string]string)
+		for _, arg := range target.d.args {
+			if name == "" && arg.value == "" {
+				name = arg.key
+				continue
+			}
+			args[arg.key] = arg.value
+		}
+		structName := target.s.name()
+		if name == "" {
+			return fmt.Errorf("%s: //gen:custom requires a template name", structName)
+		}
+		if _, ok := r.t.templates[name]; !ok {
+			if len(r.t.templates) == 0 {
+				return fmt.Errorf("%s: unknown template %s; pass the directory of %s%s with -template", structName, name, name, customTemplateExt)
+			}
+			return fmt.Errorf("%s: unknown template %s (known: %s)", structName, name, strings.Join(customTemplateNames(r.t.templates), ", "))
+		}
+		for _, s := range byName[name] {
+			if s.Name == structName {
+				return fmt.Errorf("%s: //gen:custom %s is specified more than once", structName, name)
+			}
+		}
+		if _, ok := byName[name]; !ok {
+			names = append(names, name)
+		}
+		s := newStruct(r.t, target.s, imports)
+		s.Args = args
+		byName[name] = append(byName[name], s)
+	}
+	for _, name := range names {
+		if err := executeTemplate(&r.body, r.t.templates[name], r, byName[name]); err != nil {
+			return fmt.Errorf("template %s: %w", name, err)
+		}
+	}
+	return nil
+}
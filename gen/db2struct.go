@@ -0,0 +1,221 @@
+package gen
+
+import (
+	"bytes"
+	"database/sql"
+	"flag"
+	"fmt"
+	"go/token"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// dbColumn INFORMATION_SCHEMA.COLUMNSの1行
+type dbColumn struct {
+	table    string
+	name     string
+	dataType string
+	nullable bool
+}
+
+// dbGoTypes INFORMATION_SCHEMAのdata_type（小文字）からGoの型への対応。
+// numericとdecimalは精度を落とさないようにstringにする
+var dbGoTypes = map[string]string{
+	"boolean": "bool", "bool": "bool", "bit": "bool",
+	"tinyint": "int8", "smallint": "int16", "mediumint": "int32", "integer": "int32", "int": "int32", "bigint": "int64",
+	"real": "float32", "float": "float32", "double precision": "float64", "double": "float64",
+	"numeric": "string", "decimal": "string",
+	"character varying": "string", "varchar": "string", "character": "string", "char": "string",
+	"text": "string", "tinytext": "string", "mediumtext": "string", "longtext": "string",
+	"uuid": "string", "json": "string", "jsonb": "string", "enum": "string", "set": "string",
+	"bytea": "[]byte", "blob": "[]byte", "tinyblob": "[]byte", "mediumblob": "[]byte", "longblob": "[]byte", "binary": "[]byte", "varbinary": "[]byte",
+	"date": "time.Time", "datetime": "time.Time", "timestamp": "time.Time",
+	"timestamp without time zone": "time.Time", "timestamp with time zone": "time.Time",
+}
+
+// dbColumnsQuery 対象のスキーマのカラムをテーブル、カラムの順に読むクエリ。
+// スキーマを指定しなければ接続しているスキーマ（MySQLではデータベース）を読む
+func dbColumnsQuery(driverName, dbSchema string) (string, []any, error) {
+	const query = "SELECT table_name, column_name, data_type, is_nullable FROM information_schema.columns WHERE table_schema = %s ORDER BY table_name, ordinal_position"
+	switch driverName {
+	case "postgres", "pgx":
+		if dbSchema == "" {
+			return fmt.Sprintf(query, "current_schema()"), nil, nil
+		}
+		return fmt.Sprintf(query, "$1"), []any{dbSchema}, nil
+	case "mysql":
+		if dbSchema == "" {
+			return fmt.Sprintf(query, "DATABASE()"), nil, nil
+		}
+		return fmt.Sprintf(query, "?"), []any{dbSchema}, nil
+	}
+	return "", nil, fmt.Errorf("db2struct: unsupported driver %q (postgres, pgx or mysql)", driverName)
+}
+
+func readDBColumns(db *sql.DB, driverName, dbSchema string) ([]*dbColumn, error) {
+	query, args, err := dbColumnsQuery(driverName, dbSchema)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []*dbColumn
+	for rows.Next() {
+		c := &dbColumn{}
+		var nullable string
+		if err := rows.Scan(&c.table, &c.name, &c.dataType, &nullable); err != nil {
+			return nil, err
+		}
+		c.nullable = strings.EqualFold(nullable, "YES")
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// singularTableName テーブル名を構造体の名前にするときの単数形（users→user、categories→category）
+func singularTableName(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies") && len(name) > 3:
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"), strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		return strings.TrimSuffix(name, "es")
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss"):
+		return strings.TrimSuffix(name, "s")
+	}
+	return name
+}
+
+// dbSchemaDocument カラムからスキーマのファイル（-schemaで読む形）を作る。
+// 構造体には//gen:table name=<テーブル>とdirectivesをつけ、timestampsならCreatedAtとUpdatedAtがなければ足す
+func dbSchemaDocument(columns []*dbColumn, pkg string, tables, directives []string, timestamps bool) (*schemaDocument, error) {
+	doc := &schemaDocument{Package: pkg}
+	byTable := make(map[string]*schemaStruct)
+	for _, c := range columns {
+		if len(tables) > 0 && !slices.Contains(tables, c.table) {
+			continue
+		}
+		s, ok := byTable[c.table]
+		if !ok {
+			name := protoDomainFieldName(singularTableName(c.table))
+			if !token.IsIdentifier(name) {
+				return nil, fmt.Errorf("db2struct: table %s cannot be a struct name", c.table)
+			}
+			s = &schemaStruct{
+				Name:       name,
+				Doc:        fmt.Sprintf("%s is a row of the %s table.", name, c.table),
+				Directives: append([]string{"table name=" + c.table}, directives...),
+			}
+			byTable[c.table] = s
+			doc.Structs = append(doc.Structs, s)
+		}
+		name := protoDomainFieldName(c.name)
+		if !token.IsIdentifier(name) {
+			return nil, fmt.Errorf("db2struct: column %s.%s cannot be a field name", c.table, c.name)
+		}
+		typ, ok := dbGoTypes[strings.ToLower(c.dataType)]
+		if !ok {
+			// timestamp(6)やtime with time zoneなど
+			switch dataType := strings.ToLower(c.dataType); {
+			case strings.HasPrefix(dataType, "timestamp"), strings.HasPrefix(dataType, "time"):
+				typ = "time.Time"
+			default:
+				return nil, fmt.Errorf("db2struct: column %s.%s has unsupported type %s", c.table, c.name, c.dataType)
+			}
+		}
+		if c.nullable && typ != "[]byte" {
+			typ = "*" + typ
+		}
+		s.Fields = append(s.Fields, &schemaField{Name: name, Type: typ, Tags: map[string]string{"db": c.name, "json": c.name}})
+	}
+	for _, table := range tables {
+		if _, ok := byTable[table]; !ok {
+			return nil, fmt.Errorf("db2struct: table %s not found", table)
+		}
+	}
+	if len(doc.Structs) == 0 {
+		return nil, fmt.Errorf("db2struct: no tables found")
+	}
+	if timestamps {
+		for _, s := range doc.Structs {
+			for _, name := range targetFields {
+				if !slices.ContainsFunc(s.Fields, func(f *schemaField) bool { return f.Name == name }) {
+					s.Fields = append(s.Fields, &schemaField{Name: name, Type: "time.Time", Tags: map[string]string{"db": "-"}})
+				}
+			}
+		}
+	}
+	return doc, nil
+}
+
+// runDB2Struct データベースのINFORMATION_SCHEMAからテーブルごとの構造体を書いたスキーマのファイルを出力する。
+// 構造体とメソッドは出力したファイルを-schemaで読んで生成する
+func runDB2Struct(args []string) error {
+	flags := flag.NewFlagSet("db2struct", flag.ExitOnError)
+	driverName := flags.String("driver", "postgres", "database/sql driver name (postgres, pgx or mysql)")
+	dsn := flags.String("dsn", "", "data source name of the database")
+	dbSchema := flags.String("db-schema", "", "schema (database for mysql) to read; defaults to the current one")
+	tablesFlag := flags.String("tables", "", "comma separated tables to generate; defaults to all")
+	pkg := flags.String("package", "models", "package name of the generated structs")
+	directivesFlag := flags.String("directives", "setters,sqlmap", "comma separated directives (without //gen:) added to every struct besides table")
+	timestamps := flags.Bool("timestamps", true, `add CreatedAt and UpdatedAt (db:"-") to tables without those columns`)
+	out := flags.String("out", "db.schema.yaml", "schema file to write; generate the structs with -schema")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *dsn == "" {
+		return fmt.Errorf("db2struct: -dsn is required")
+	}
+	if !token.IsIdentifier(*pkg) {
+		return fmt.Errorf("db2struct: invalid package name %q", *pkg)
+	}
+	if err := checkSchemaPath(*out); err != nil {
+		return err
+	}
+	var tables, directives []string
+	if *tablesFlag != "" {
+		tables = strings.Split(*tablesFlag, ",")
+	}
+	if *directivesFlag != "" {
+		directives = strings.Split(*directivesFlag, ",")
+	}
+	for _, d := range directives {
+		if _, err := parseDirective(directivePrefix + d); err != nil {
+			return fmt.Errorf("db2struct: -directives: %w", err)
+		}
+	}
+	// このツールはドライバを含まないので、ドライバをimportしてgen.Mainを呼ぶコマンドから実行する
+	if !slices.Contains(sql.Drivers(), *driverName) {
+		return fmt.Errorf("db2struct: database driver %q is not linked into %s; build a command that imports the driver and calls gen.Main()", *driverName, programName())
+	}
+	db, err := sql.Open(*driverName, *dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	columns, err := readDBColumns(db, *driverName, *dbSchema)
+	if err != nil {
+		return fmt.Errorf("db2struct: %w", err)
+	}
+	doc, err := dbSchemaDocument(columns, *pkg, tables, directives, *timestamps)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Code generated by go-gen-struct db2struct. DO NOT EDIT.\n# Generate the structs with: %s -schema=%s\n", programName(), *out)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d structs to %s\n", len(doc.Structs), *out)
+	return nil
+}
@@ -0,0 +1,293 @@
+package gen
+
+import (
+	"fmt"
+	"go/types"
+	"strconv"
+)
+
+// deepCopy //gen:deepcopyで生成するDeepCopy
+type deepCopy struct {
+	StructName string
+	Stmts      []string // *out = *sの後に、共有してはいけない値を複製する文
+}
+
+// deepCopier 型情報からフィールドを複製する文を組み立てる
+type deepCopier struct {
+	r         *renderer
+	pkg       *types.Package
+	copied    map[string]bool       // //gen:deepcopyでDeepCopyを生成する構造体
+	expanding map[*types.Named]bool // 展開中の構造体。自身を参照する構造体を見つける
+	vars      int                   // ループ変数の名前が重ならないように数える
+	needs     map[types.Type]bool   // needsCopyの結果のキャッシュ
+}
+
+// hasDeepCopy DeepCopyを呼べる型か。同じパッケージの//gen:deepcopyの構造体は、まだ生成していなくても呼べる
+func (c *deepCopier) hasDeepCopy(t types.Type) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return false
+	}
+	if named.Obj().Pkg() == c.pkg && c.copied[named.Obj().Name()] {
+		return true
+	}
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(named), true, named.Obj().Pkg(), "DeepCopy")
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	return sig.Params().Len() == 0 && sig.Results().Len() == 1 && types.Identical(sig.Results().At(0).Type(), types.NewPointer(named))
+}
+
+// needsCopy 代入だけでは値を共有してしまう型か。
+// 他のパッケージの構造体はDeepCopyがなければ値として扱う（time.TimeのLocationなどは共有してよい）
+func (c *deepCopier) needsCopy(t types.Type) bool {
+	if need, ok := c.needs[t]; ok {
+		return need
+	}
+	c.needs[t] = false // 自身を参照する構造体で止まるように先に入れておく
+	need := false
+	if c.hasDeepCopy(t) {
+		need = true
+	} else {
+		switch u := t.Underlying().(type) {
+		case *types.Pointer, *types.Slice, *types.Map:
+			need = true
+		case *types.Array:
+			need = c.needsCopy(u.Elem())
+		case *types.Struct:
+			// 別名（type Stamp = time.Time）は元の型のパッケージで決める
+			if named, ok := types.Unalias(t).(*types.Named); !ok || named.Obj().Pkg() == c.pkg {
+				for i := 0; i < u.NumFields(); i++ {
+					if c.needsCopy(u.Field(i).Type()) {
+						need = true
+					}
+				}
+			}
+		}
+	}
+	c.needs[t] = need
+	return need
+}
+
+func (c *deepCopier) typeString(t types.Type) string {
+	return qualifiedTypeString(c.r, c.pkg, t)
+}
+
+// qualifiedTypeString 生成するファイルで参照できる型の文字列。他のパッケージの型はimportして修飾する
+func qualifiedTypeString(r *renderer, pkg *types.Package, t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		return r.importName(p.Path())
+	})
+}
+
+// lookupNamedStruct 型検査したパッケージから構造体の型を探す
+func lookupNamedStruct(pkg *types.Package, structName string) (*types.Named, *types.Struct, error) {
+	obj, ok := pkg.Scope().Lookup(structName).(*types.TypeName)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: cannot find the type of the struct", structName)
+	}
+	named, ok := obj.Type().(*types.Named)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: is not a defined type", structName)
+	}
+	st, ok := named.Underlying().(*types.Struct)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: is not a struct type", structName)
+	}
+	return named, st, nil
+}
+
+// newDeepCopier pkgの構造体を複製する文を組み立てる。同じファイルの//gen:deepcopyの構造体はDeepCopyで複製する
+func newDeepCopier(r *renderer, pkg *types.Package) *deepCopier {
+	c := &deepCopier{
+		r:         r,
+		pkg:       pkg,
+		copied:    make(map[string]bool),
+		expanding: make(map[*types.Named]bool),
+		needs:     make(map[types.Type]bool),
+	}
+	for _, target := range r.t.directiveTargets("deepcopy") {
+		c.copied[target.s.name()] = true
+	}
+	return c
+}
+
+// structCopyStmts 構造体structNameのsrcをそのまま代入したdstのうち、フィールドが共有している値を複製する文を返す
+func (c *deepCopier) structCopyStmts(structName, dst, src string) ([]string, error) {
+	named, st, err := lookupNamedStruct(c.pkg, structName)
+	if err != nil {
+		return nil, err
+	}
+	c.vars = 0
+	c.expanding[named] = true
+	defer delete(c.expanding, named)
+	var stmts []string
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		inner, err := c.copyStmts(dst+"."+f.Name(), src+"."+f.Name(), f.Type())
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", structName, f.Name(), err)
+		}
+		stmts = append(stmts, inner...)
+	}
+	return stmts, nil
+}
+
+func (c *deepCopier) newVar(prefix string) string {
+	c.vars++
+	return prefix + strconv.Itoa(c.vars)
+}
+
+// copyStmts srcをそのまま代入したdstのうち、共有している値を複製する文を返す
+func (c *deepCopier) copyStmts(dst, src string, t types.Type) ([]string, error) {
+	if !c.needsCopy(t) {
+		return nil, nil
+	}
+	if c.hasDeepCopy(t) {
+		return []string{fmt.Sprintf("%s = *%s.DeepCopy()", dst, src)}, nil
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Pointer:
+		if c.hasDeepCopy(u.Elem()) {
+			return []string{fmt.Sprintf("%s = %s.DeepCopy()", dst, src)}, nil
+		}
+		v := c.newVar("p")
+		// 構造体のフィールドはポインタのまま参照できる
+		elemDst, elemSrc := "(*"+v+")", "(*"+src+")"
+		if _, ok := u.Elem().Underlying().(*types.Struct); ok {
+			elemDst, elemSrc = v, src
+		}
+		inner, err := c.copyStmts(elemDst, elemSrc, u.Elem())
+		if err != nil {
+			return nil, err
+		}
+		stmts := []string{
+			fmt.Sprintf("if %s != nil {", src),
+			fmt.Sprintf("%s := new(%s)", v, c.typeString(u.Elem())),
+			fmt.Sprintf("*%s = *%s", v, src),
+		}
+		stmts = append(stmts, inner...)
+		return append(stmts, fmt.Sprintf("%s = %s", dst, v), "}"), nil
+	case *types.Slice:
+		i := c.newVar("i")
+		inner, err := c.copyStmts(dst+"["+i+"]", src+"["+i+"]", u.Elem())
+		if err != nil {
+			return nil, err
+		}
+		stmts := []string{
+			fmt.Sprintf("if %s != nil {", src),
+			fmt.Sprintf("%s = make(%s, len(%s))", dst, c.typeString(t), src),
+			fmt.Sprintf("copy(%s, %s)", dst, src),
+		}
+		if inner != nil {
+			stmts = append(stmts, fmt.Sprintf("for %s := range %s {", i, src))
+			stmts = append(stmts, inner...)
+			stmts = append(stmts, "}")
+		}
+		return append(stmts, "}"), nil
+	case *types.Map:
+		// mapの要素はアドレスをとれないので、複製する値を変数に入れてから格納する
+		k, v, e := c.newVar("k"), c.newVar("v"), c.newVar("e")
+		inner, err := c.copyStmts(e, v, u.Elem())
+		if err != nil {
+			return nil, err
+		}
+		stmts := []string{
+			fmt.Sprintf("if %s != nil {", src),
+			fmt.Sprintf("%s = make(%s, len(%s))", dst, c.typeString(t), src),
+			fmt.Sprintf("for %s, %s := range %s {", k, v, src),
+		}
+		if inner == nil {
+			return append(stmts, fmt.Sprintf("%s[%s] = %s", dst, k, v), "}", "}"), nil
+		}
+		stmts = append(stmts, fmt.Sprintf("%s := %s", e, v))
+		stmts = append(stmts, inner...)
+		return append(stmts, fmt.Sprintf("%s[%s] = %s", dst, k, e), "}", "}"), nil
+	case *types.Array:
+		i := c.newVar("i")
+		inner, err := c.copyStmts(dst+"["+i+"]", src+"["+i+"]", u.Elem())
+		if err != nil {
+			return nil, err
+		}
+		stmts := []string{fmt.Sprintf("for %s := range %s {", i, src)}
+		stmts = append(stmts, inner...)
+		return append(stmts, "}"), nil
+	case *types.Struct:
+		if named, ok := types.Unalias(t).(*types.Named); ok {
+			if c.expanding[named] {
+				return nil, fmt.Errorf("%s refers to itself; add //gen:deepcopy to %s", named.Obj().Name(), named.Obj().Name())
+			}
+			c.expanding[named] = true
+			defer delete(c.expanding, named)
+		}
+		var stmts []string
+		for i := 0; i < u.NumFields(); i++ {
+			f := u.Field(i)
+			inner, err := c.copyStmts(dst+"."+f.Name(), src+"."+f.Name(), f.Type())
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, inner...)
+		}
+		return stmts, nil
+	}
+	return nil, nil
+}
+
+// renderDeepCopy //gen:deepcopyのついた構造体に、ポインタ、slice、mapを共有しないコピーを返すDeepCopyを生成する。
+// フィールドの型はgo/packagesで型検査して調べる。interface、関数、channelは複製できないのでそのまま共有する
+func renderDeepCopy(r *renderer, targets []*directiveTarget) error {
+	pkg, err := r.t.loadTypes()
+	if err != nil {
+		return err
+	}
+	c := newDeepCopier(r, pkg)
+	copies := make([]*deepCopy, 0, len(targets))
+	for _, target := range targets {
+		stmts, err := c.structCopyStmts(target.s.name(), "out", "s")
+		if err != nil {
+			return err
+		}
+		copies = append(copies, &deepCopy{StructName: target.s.name(), Stmts: stmts})
+	}
+	if err := r.execute("deepcopy", deepCopyTemplate, copies); err != nil {
+		return err
+	}
+	if !r.t.benchmarks {
+		return nil
+	}
+	tr := r.testFile()
+	benchmarks := make([]*methodBenchmark, 0, len(copies))
+	for _, c := range copies {
+		benchmarks = append(benchmarks, &methodBenchmark{
+			StructName: c.StructName,
+			Name:       exportedName(c.StructName) + "DeepCopy",
+			Call:       "_ = s.DeepCopy()",
+			Testing:    tr.importName("testing"),
+		})
+	}
+	return tr.execute("deepcopy_bench", methodBenchmarkTemplate, benchmarks)
+}
+
+const deepCopyTemplate = `
+{{range .}}
+// DeepCopy returns a copy of s that shares no pointers, slices or maps with it.
+// Interfaces, functions and channels are shared.
+func (s *{{.StructName}}) DeepCopy() *{{.StructName}} {
+	if s == nil {
+		return nil
+	}
+	out := new({{.StructName}})
+	*out = *s
+	{{- range .Stmts}}
+	{{.}}
+	{{- end}}
+	return out
+}
+{{end}}
+`
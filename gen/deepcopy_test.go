@@ -0,0 +1,65 @@
+package gen
+
+import (
+	"strings"
+	"testing"
+)
+
+// 他のパッケージの構造体の別名は、元の型と同じく展開せずに値として複製する
+func TestDeepCopyAlias(t *testing.T) {
+	_, generated := generateModule(t, map[string]string{
+		"m/model.go": `package m
+
+import "time"
+
+type Stamp = time.Time
+
+type Tags = []string
+
+//gen:deepcopy
+type Model struct {
+	At    Stamp
+	AtPtr *Stamp
+	Tags  Tags
+	Count *int
+}
+`,
+	})
+	src := generated["m/model_setters.go"]
+	if strings.Contains(src, ".loc") {
+		t.Errorf("DeepCopy expands the fields of time.Time:\n%s", src)
+	}
+	for _, want := range []string{"out.Tags = make(Tags, len(s.Tags))", "p1 := new(Stamp)", "p3 := new(int)"} {
+		if !strings.Contains(src, want) {
+			t.Errorf("DeepCopy does not contain %q:\n%s", want, src)
+		}
+	}
+}
+
+// time.Timeとその別名は値のまま複製し、それらへのポインタは指す先を複製する
+func TestDeepCopyFieldKinds(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		want  []string
+	}{
+		{"time", "At time.Time", []string{"*out = *s\n\treturn out"}},
+		{"alias", "At Stamp", []string{"*out = *s\n\treturn out"}},
+		{"pointer", "At *time.Time", []string{"p1 := new(time.Time)", "*p1 = *s.At", "out.At = p1"}},
+		{"alias pointer", "At *Stamp", []string{"p1 := new(Stamp)", "*p1 = *s.At", "out.At = p1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, generated := generateModule(t, map[string]string{"m/model.go": fieldModel("//gen:deepcopy", tt.field)})
+			src := generated["m/model_setters.go"]
+			if strings.Contains(src, ".loc") || strings.Contains(src, ".wall") {
+				t.Errorf("DeepCopy expands the fields of time.Time:\n%s", src)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(src, want) {
+					t.Errorf("DeepCopy does not contain %q:\n%s", want, src)
+				}
+			}
+		})
+	}
+}
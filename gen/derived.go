@@ -0,0 +1,254 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// derivedField //gen:derived Age=computeAge(BirthDate)で指定した、計算結果をキャッシュするgetter
+type derivedField struct {
+	StructName string
+	Name       string   // getterの名前
+	Compute    string   // 値を計算するメソッド
+	Type       string   // 計算するメソッドの戻り値の型
+	Inputs     []string // 変更されたらキャッシュを捨てるフィールド。空なら全フィールド
+	CacheField string   // キャッシュを持つフィールド
+	Value      string   // キャッシュ用の型の中のフィールド名
+}
+
+// derivedCache 構造体ごとのキャッシュ用の型
+type derivedCache struct {
+	TypeName string
+	Fields   []*derivedField
+	Setters  []*setter // 入力のフィールドでsetterが他で生成されないもの
+}
+
+// derivedCacheType キャッシュを持つ型の名前。構造体にこの型のフィールドを用意してもらう
+func derivedCacheType(structName string) string {
+	return unexportedName(structName) + "Derived"
+}
+
+// unexportedName 先頭を小文字にした名前
+func unexportedName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
+
+// parseDerivedFields ディレクティブの引数をderivedFieldにする
+func parseDerivedFields(r *renderer, target *directiveTarget) ([]*derivedField, error) {
+	structName := target.s.name()
+	cacheType := derivedCacheType(structName)
+	cacheField := ""
+	for _, field := range target.s.structType().Fields.List {
+		if ident, ok := field.Type.(*ast.Ident); ok && ident.Name == cacheType && len(field.Names) == 1 {
+			cacheField = field.Names[0].Name
+		}
+	}
+	if cacheField == "" {
+		return nil, fmt.Errorf("%s: //gen:derived requires a field of type %s to hold the cached values", structName, cacheType)
+	}
+	var fields []*derivedField
+	for _, arg := range target.d.args {
+		compute, inputs, _ := strings.Cut(arg.value, "(")
+		if arg.value == "" || (inputs != "" && !strings.HasSuffix(inputs, ")")) {
+			return nil, fmt.Errorf("%s: invalid //gen:derived %s (want Name=method or Name=method(Field,...))", structName, arg.key)
+		}
+		resultType, err := methodResultType(r, target.s, compute)
+		if err != nil {
+			return nil, err
+		}
+		f := &derivedField{
+			StructName: structName,
+			Name:       arg.key,
+			Compute:    compute,
+			Type:       resultType,
+			CacheField: cacheField,
+			Value:      unexportedName(arg.key),
+		}
+		for _, input := range strings.Split(strings.TrimSuffix(inputs, ")"), ",") {
+			if input = strings.TrimSpace(input); input == "" {
+				continue
+			}
+			if !hasField(target.s.structType(), input) {
+				return nil, fmt.Errorf("%s: //gen:derived %s depends on unknown field %s", structName, arg.key, input)
+			}
+			f.Inputs = append(f.Inputs, input)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// methodResultType ソースファイルにある構造体のメソッドの戻り値の型を返す
+func methodResultType(r *renderer, s *targetStruct, methodName string) (string, error) {
+	for _, decl := range r.t.file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || fn.Name.Name != methodName || receiverTypeName(fn) != s.name() {
+			continue
+		}
+		if fn.Type.Results == nil || len(fn.Type.Results.List) != 1 || len(fn.Type.Results.List[0].Names) > 1 {
+			return "", fmt.Errorf("%s.%s: derived value methods must return exactly one value", s.name(), methodName)
+		}
+		resultType, err := typeString(fn.Type.Results.List[0].Type)
+		if err != nil {
+			return "", fmt.Errorf("%s.%s: %w", s.name(), methodName, err)
+		}
+		markUsedImports(fn.Type.Results.List[0].Type, r.importsMap)
+		return resultType, nil
+	}
+	return "", fmt.Errorf("%s: method %s for //gen:derived must be declared in the same file", s.name(), methodName)
+}
+
+// receiverTypeName メソッドのレシーバーの型名
+func receiverTypeName(fn *ast.FuncDecl) string {
+	if len(fn.Recv.List) == 0 {
+		return ""
+	}
+	expr := fn.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// prepareDerived 入力のフィールドを変更するメソッドにキャッシュを捨てる処理を登録する
+func prepareDerived(r *renderer, targets []*directiveTarget) error {
+	for _, target := range targets {
+		fields, err := parseDerivedFields(r, target)
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			stmt := fmt.Sprintf("s.%s.%sOK = false", f.CacheField, f.Value)
+			if len(f.Inputs) == 0 {
+				r.addHook(f.StructName, "*", stmt)
+			}
+			for _, input := range f.Inputs {
+				r.addHook(f.StructName, input, stmt)
+			}
+		}
+	}
+	return nil
+}
+
+// renderDerived キャッシュ用の型とgetter、他で生成されない入力のフィールドのsetterを生成する
+func renderDerived(r *renderer, targets []*directiveTarget) error {
+	caches := make(map[string]*derivedCache)
+	var order []string
+	for _, target := range targets {
+		fields, err := parseDerivedFields(r, target)
+		if err != nil {
+			return err
+		}
+		structName := target.s.name()
+		c, ok := caches[structName]
+		if !ok {
+			c = &derivedCache{TypeName: derivedCacheType(structName)}
+			caches[structName] = c
+			order = append(order, structName)
+		}
+		c.Fields = append(c.Fields, fields...)
+		for _, f := range fields {
+			for _, input := range f.Inputs {
+				if hasGeneratedSetter(r, target.s, input) || containsSetter(c.Setters, input) {
+					continue
+				}
+				c.Setters = append(c.Setters, newHookedSetter(r, target.s, input))
+			}
+		}
+	}
+	data := make([]*derivedCache, 0, len(order))
+	for _, name := range order {
+		c := caches[name]
+		if err := markChainSetters(r, c.Setters); err != nil {
+			return err
+		}
+		sort.SliceStable(c.Setters, func(i, j int) bool {
+			return c.Setters[i].FieldName < c.Setters[j].FieldName
+		})
+		data = append(data, c)
+	}
+	return r.execute("derived", derivedTemplate, data)
+}
+
+// hasGeneratedSetter //gen:settersでSetXが生成されるフィールドか
+func hasGeneratedSetter(r *renderer, s *targetStruct, fieldName string) bool {
+	if s.directive("setters") == nil {
+		return false
+	}
+	field := findField(s.structType(), fieldName)
+	if field == nil {
+		return false
+	}
+	tag := parseGenTag(field)
+	if tag.has("append") {
+		return false
+	}
+	return r.isSetterField(s, fieldName) || tag.list("recompute") != nil
+}
+
+func containsSetter(setters []*setter, fieldName string) bool {
+	for _, s := range setters {
+		if s.FieldName == fieldName {
+			return true
+		}
+	}
+	return false
+}
+
+// newHookedSetter フックを呼ぶsetterを作る
+func newHookedSetter(r *renderer, s *targetStruct, fieldName string) *setter {
+	for _, field := range s.structType().Fields.List {
+		for _, name := range field.Names {
+			if name.Name != fieldName {
+				continue
+			}
+			return &setter{
+				StructName: s.name(),
+				FieldName:  fieldName,
+				FieldType:  r.typeString(field.Type),
+				Hooks:      r.fieldHooks(s.name(), fieldName),
+			}
+		}
+	}
+	return nil
+}
+
+const derivedTemplate = `
+{{range .}}
+type {{.TypeName}} struct {
+	{{- range .Fields}}
+	{{.Value}}   {{.Type}}
+	{{.Value}}OK bool
+	{{- end}}
+}
+{{range .Fields}}
+func (s *{{.StructName}}) {{.Name}}() {{.Type}} {
+	if !s.{{.CacheField}}.{{.Value}}OK {
+		s.{{.CacheField}}.{{.Value}} = s.{{.Compute}}()
+		s.{{.CacheField}}.{{.Value}}OK = true
+	}
+	return s.{{.CacheField}}.{{.Value}}
+}
+{{end}}
+{{- range .Setters}}
+func (s *{{.StructName}}) {{.MethodName}}(v {{.FieldType}}){{if .Chain}} *{{.StructName}}{{else}}{{errorResult .StructName}}{{end}} {
+	s.{{.FieldName}} = v
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+	{{- finish .StructName}}
+	{{- if .Chain}}
+	return s
+	{{- end}}
+}
+{{end}}
+{{end}}
+`
@@ -0,0 +1,157 @@
+package gen
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"os"
+	"strings"
+)
+
+var (
+	diagFormat = commandLine.String("diag-format", "text", "format of warnings and errors about source files: text, or json for one object per line")
+	diagLang   = commandLine.String("diag-lang", "", "language of warnings and errors about source files (en, ja); defaults to $GEN_STRUCT_LANG, then en")
+)
+
+// 診断のコード。同じ問題には言語や出力形式に関わらず同じコードをつけるので、番号は変えない
+const (
+	diagSyntax           = "GS1001" // 構文エラー
+	diagInvalidDirective = "GS1002" // ディレクティブを解釈できない
+	diagSyntaxSkipped    = "GS1003" // 構文エラーのある構造体を生成しない
+	diagFieldTypeSkipped = "GS1004" // 型を書けないフィールドのある構造体を生成しない
+	diagUnresolvedTypes  = "GS1005" // フィールドの型を解決できない
+	diagDisabled         = "GS1006" // 設定のフラグで無効なディレクティブ
+	diagTimestampsOnly   = "GS1007" // timestampsサブコマンドが生成しないディレクティブ
+	diagBudget           = "GS1008" // 生成した行数が予算を超えた
+	diagGenerateFailed   = "GS2001" // ファイルの生成に失敗した
+)
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// diagMessages 言語ごとの診断のメッセージ。引数はコードごとに決まっていて、どの言語でも同じ順に渡す
+var diagMessages = map[string]map[string]string{
+	"en": {
+		diagSyntax:           "%s",
+		diagInvalidDirective: "%v",
+		diagSyntaxSkipped:    "skipped %s because of syntax errors",
+		diagFieldTypeSkipped: "skipped %s: %v",
+		diagUnresolvedTypes:  "cannot resolve field types: %v",
+		diagDisabled:         "skipped %s on %s because flag %q is off",
+		diagTimestampsOnly:   "skipped %s on %s because timestamps only generates %s",
+		diagBudget:           "%d lines generated for %s exceed the budget of %d (split the struct or drop directives)",
+		diagGenerateFailed:   "%v",
+	},
+	"ja": {
+		diagSyntax:           "構文エラー: %s",
+		diagInvalidDirective: "ディレクティブを解釈できません: %v",
+		diagSyntaxSkipped:    "構文エラーがあるため%sを生成しません",
+		diagFieldTypeSkipped: "%sを生成しません: %v",
+		diagUnresolvedTypes:  "フィールドの型を解決できません: %v",
+		diagDisabled:         "%[2]sの%[1]sはフラグ%[3]qが無効なため生成しません",
+		diagTimestampsOnly:   "timestampsは%[3]sだけを生成するため、%[2]sの%[1]sを生成しません",
+		diagBudget:           "%[2]sに生成した%[1]d行が予算の%[3]d行を超えています（構造体を分けるかディレクティブを減らしてください）",
+		diagGenerateFailed:   "生成に失敗しました: %v",
+	},
+}
+
+// diagSeverities 各コードの重大度。errorのあったファイルは生成に失敗したものとして数える
+var diagSeverities = map[string]string{
+	diagSyntax: severityError,
+	// 綴りを間違えたディレクティブの構造体は丸ごと生成しないので、警告だけでは気づけない
+	diagInvalidDirective: severityError,
+	diagGenerateFailed:   severityError,
+}
+
+// diagnostic ソースファイルについての警告やエラー。-diag-formatに従ってテキストかJSONで出力する
+type diagnostic struct {
+	code string
+	pos  token.Position // ファイルだけ分かる場合は行と列が0
+	args []any
+}
+
+func newDiagnostic(code string, pos token.Position, args ...any) *diagnostic {
+	return &diagnostic{code: code, pos: pos, args: args}
+}
+
+func (d *diagnostic) severity() string {
+	if s, ok := diagSeverities[d.code]; ok {
+		return s
+	}
+	return severityWarning
+}
+
+// message langのメッセージ。カタログにない言語なら英語にする
+func (d *diagnostic) message(lang string) string {
+	format, ok := diagMessages[lang][d.code]
+	if !ok {
+		format = diagMessages["en"][d.code]
+	}
+	return fmt.Sprintf(format, d.args...)
+}
+
+// text 位置: メッセージの形。メッセージがすでにファイル名から始まっていれば位置は重ねない
+func (d *diagnostic) text(lang string) string {
+	msg := d.message(lang)
+	if d.pos.Filename == "" || strings.HasPrefix(msg, d.pos.Filename) {
+		return msg
+	}
+	return d.pos.String() + ": " + msg
+}
+
+func (d *diagnostic) String() string {
+	return d.text("en")
+}
+
+// diagnosticJSON -diag-format=jsonで1行に書くオブジェクト
+type diagnosticJSON struct {
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (d *diagnostic) json(lang string) []byte {
+	data, _ := json.Marshal(&diagnosticJSON{
+		Code:     d.code,
+		Severity: d.severity(),
+		File:     d.pos.Filename,
+		Line:     d.pos.Line,
+		Column:   d.pos.Column,
+		Message:  d.message(lang),
+	})
+	return data
+}
+
+// diagOptions 診断の出力形式と言語
+type diagOptions struct {
+	json bool
+	lang string
+}
+
+// newDiagOptions -diag-formatと-diag-langを確かめる。言語の指定がなければ$GEN_STRUCT_LANGを使う
+func newDiagOptions(format, lang string) (diagOptions, error) {
+	var o diagOptions
+	switch format {
+	case "text":
+	case "json":
+		o.json = true
+	default:
+		return o, fmt.Errorf("invalid -diag-format %q (want text or json)", format)
+	}
+	if lang == "" {
+		lang = os.Getenv("GEN_STRUCT_LANG")
+	}
+	if lang == "" {
+		lang = "en"
+	}
+	if _, ok := diagMessages[lang]; !ok {
+		return o, fmt.Errorf("unsupported diagnostic language %q", lang)
+	}
+	o.lang = lang
+	return o, nil
+}
@@ -0,0 +1,29 @@
+package gen
+
+import (
+	"strings"
+	"testing"
+)
+
+// 知らないディレクティブのついた構造体は生成せず、ファイルの生成に失敗したものとして数える
+func TestUnknownDirectiveFails(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":     "module example.com/m\n\ngo 1.23\n",
+		"m/model.go": "package m\n\n//gen:encrypted\ntype Secret struct {\n\tKey string\n}\n",
+		"m/other.go": modelSource("m"),
+	})
+	g, err := generateTree(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.out.failures != 1 {
+		t.Errorf("failures = %d, want 1", g.out.failures)
+	}
+	if !strings.Contains(g.logs.String(), "unknown directive //gen:encrypted") {
+		t.Errorf("logs do not mention the unknown directive:\n%s", g.logs)
+	}
+	if len(g.generated) != 1 || !strings.HasSuffix(g.generated[0].path, "other_setters.go") {
+		t.Errorf("generated %d files, want only other_setters.go", len(g.generated))
+	}
+}
@@ -0,0 +1,120 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"strconv"
+	"strings"
+)
+
+const directivePrefix = "//gen:"
+
+// directive 構造体につけた//gen:<name> key=value ...のコメント
+type directive struct {
+	name string
+	args []directiveArg
+}
+
+// directiveArg ディレクティブの引数。key=valueの形でなければvalueは空
+type directiveArg struct {
+	key   string
+	value string
+}
+
+// parseDirective //gen:fsm field=Status transitions="a->b"のようなコメントを解釈する。
+// 値に空白を含める場合はGoの文字列リテラルと同じようにダブルクォートで囲む
+func parseDirective(text string) (*directive, error) {
+	rest, ok := strings.CutPrefix(text, directivePrefix)
+	if !ok {
+		return nil, fmt.Errorf("not a directive: %q", text)
+	}
+	name, rest, _ := strings.Cut(rest, " ")
+	d := &directive{name: name}
+	for {
+		rest = strings.TrimLeft(rest, " \t")
+		if rest == "" {
+			return d, nil
+		}
+		end := strings.IndexAny(rest, "= \t")
+		if end < 0 || rest[end] != '=' {
+			if end < 0 {
+				end = len(rest)
+			}
+			d.args = append(d.args, directiveArg{key: rest[:end]})
+			rest = rest[end:]
+			continue
+		}
+		key := rest[:end]
+		rest = rest[end+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			quoted, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid quoted value for %s: %w", text, key, err)
+			}
+			value, _ = strconv.Unquote(quoted)
+			rest = rest[len(quoted):]
+		} else {
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			value, rest = rest[:end], rest[end:]
+		}
+		d.args = append(d.args, directiveArg{key: key, value: value})
+	}
+}
+
+// parseDirectives ドキュメントコメントから//gen:で始まるディレクティブを全て読む
+func parseDirectives(doc *ast.CommentGroup) ([]*directive, error) {
+	if doc == nil {
+		return nil, nil
+	}
+	var directives []*directive
+	for _, comment := range doc.List {
+		if !strings.HasPrefix(comment.Text, directivePrefix) {
+			continue
+		}
+		d, err := parseDirective(comment.Text)
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, d)
+	}
+	return directives, nil
+}
+
+// arg key=valueの引数の値を返す
+func (d *directive) arg(key string) (string, bool) {
+	for _, a := range d.args {
+		if a.key == key {
+			return a.value, true
+		}
+	}
+	return "", false
+}
+
+// argMap 引数のkeyと値。key=valueの形でなければ値は空
+func (d *directive) argMap() map[string]string {
+	args := make(map[string]string, len(d.args))
+	for _, a := range d.args {
+		args[a.key] = a.value
+	}
+	return args
+}
+
+// String //gen:を除いたディレクティブ（fsm field=Status）。空白を含む値はダブルクォートで囲む
+func (d *directive) String() string {
+	parts := []string{d.name}
+	for _, a := range d.args {
+		switch {
+		case a.value == "":
+			parts = append(parts, a.key)
+		case strings.ContainsAny(a.value, " \t\""):
+			parts = append(parts, a.key+"="+strconv.Quote(a.value))
+		default:
+			parts = append(parts, a.key+"="+a.value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,140 @@
+package gen
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// runDoc ディレクティブのついた構造体ごとにフィールドと生成されるメソッドの表を出力する
+func runDoc(args []string) error {
+	flags := flag.NewFlagSet("doc", flag.ExitOnError)
+	dir := flags.String("dir", ".", "directory to document")
+	format := flags.String("format", "markdown", "output format (markdown)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != "markdown" {
+		return fmt.Errorf("doc: unsupported format %q", *format)
+	}
+	version, err := parseOutputVersion(*compat)
+	if err != nil {
+		return err
+	}
+	files, err := listGoFiles(*dir, true)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		targets, err := searchTargetStructs(file)
+		if err != nil {
+			return err
+		}
+		if len(targets.structs) == 0 {
+			continue
+		}
+		// 生成されるメソッドは実際に生成したコードから拾う
+		src, err := targets.render(targetFields, version)
+		if err != nil {
+			return err
+		}
+		methods, err := generatedMethods(src)
+		if err != nil {
+			return err
+		}
+		for _, s := range targets.structs {
+			writeStructDoc(os.Stdout, targets, s, methods[s.name()])
+		}
+	}
+	return nil
+}
+
+// generatedMethods 生成したコードのメソッドをレシーバーの型ごとに返す
+func generatedMethods(src []byte) (map[string][]string, error) {
+	methods := make(map[string][]string)
+	if src == nil {
+		return methods, nil
+	}
+	node, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, decl := range node.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || !fn.Name.IsExported() {
+			continue
+		}
+		recv := receiverTypeName(fn)
+		methods[recv] = append(methods[recv], fn.Name.Name)
+	}
+	for _, names := range methods {
+		sort.Strings(names)
+	}
+	return methods, nil
+}
+
+// writeStructDoc 構造体1つ分のMarkdownを書く
+func writeStructDoc(w io.Writer, t *targetStructs, s *targetStruct, methods []string) {
+	fmt.Fprintf(w, "## %s.%s\n\n", t.packageName, s.name())
+	fmt.Fprintf(w, "Source: `%s`  \n", filepath.ToSlash(filepath.Join(t.path, t.filename)))
+	fmt.Fprintf(w, "Directives: %s\n\n", strings.Join(s.directiveNames(), ", "))
+	if text := commentText(s.doc); text != "" {
+		fmt.Fprintf(w, "%s\n\n", text)
+	}
+	fmt.Fprintln(w, "| Field | Type | Tags | Description |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- |")
+	for _, field := range s.structType().Fields.List {
+		typ := nodeString(t.fileSet, field.Type)
+		tag := ""
+		if field.Tag != nil {
+			tag = "`" + strings.Trim(field.Tag.Value, "`") + "`"
+		}
+		doc := commentText(field.Doc)
+		if doc == "" {
+			doc = commentText(field.Comment)
+		}
+		names := make([]string, 0, len(field.Names))
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		// 埋め込みフィールドは型名をフィールド名として扱う
+		if len(names) == 0 {
+			names = append(names, typ+" (embedded)")
+		}
+		for _, name := range names {
+			fmt.Fprintf(w, "| %s | `%s` | %s | %s |\n", markdownCell(name), markdownCell(typ), markdownCell(tag), markdownCell(doc))
+		}
+	}
+	fmt.Fprintln(w)
+	if len(methods) > 0 {
+		fmt.Fprintf(w, "Generated methods: `%s`\n\n", strings.Join(methods, "`, `"))
+	}
+}
+
+// commentText コメントを1行にする。//gen:などのディレクティブは含まない
+func commentText(doc *ast.CommentGroup) string {
+	return strings.Join(strings.Fields(doc.Text()), " ")
+}
+
+// nodeString 型などのノードをソースでの表記のまま返す
+func nodeString(fileSet *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fileSet, node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// markdownCell 表のセルを壊す|と改行をエスケープする
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
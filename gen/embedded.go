@@ -0,0 +1,266 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"strconv"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// embeddedStructLoader 埋め込まれた他のパッケージの構造体の型情報を読む。結果はパッケージのファイルが変わるまでキャッシュする
+type embeddedStructLoader struct {
+	mu   sync.Mutex                  // pkgsを守る。パッケージを読んでいる間は持たない
+	pkgs map[string]*embeddedPackage // key: import path
+}
+
+type embeddedPackage struct {
+	// mu 同じパッケージを並行して読まないよう、読んで確かめる間は持つ
+	mu    sync.Mutex
+	types *types.Package
+	files []string
+	// fingerprint 読んだときのfilesのサイズと更新日時
+	fingerprint string
+}
+
+var embeddedStructs = &embeddedStructLoader{pkgs: make(map[string]*embeddedPackage)}
+
+// lookup dirのモジュールの文脈でimport pathのパッケージを読み、名前の構造体を返す
+func (l *embeddedStructLoader) lookup(dir, importPath, name string) (*types.Struct, error) {
+	l.mu.Lock()
+	cached, ok := l.pkgs[importPath]
+	if !ok {
+		cached = &embeddedPackage{}
+		l.pkgs[importPath] = cached
+	}
+	l.mu.Unlock()
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+	if cached.types == nil || filesFingerprint(cached.files) != cached.fingerprint {
+		// export dataはGoのバージョンによって読めないことがあるので、ソースから型検査する
+		cfg := &packages.Config{Mode: loadMode, Dir: dir}
+		loaded, err := packages.Load(cfg, importPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(loaded) != 1 || len(loaded[0].Errors) > 0 || loaded[0].Types == nil {
+			if len(loaded) == 1 && len(loaded[0].Errors) > 0 {
+				return nil, fmt.Errorf("cannot load package %s: %v", importPath, loaded[0].Errors[0])
+			}
+			return nil, fmt.Errorf("cannot load package %s", importPath)
+		}
+		cached.types, cached.files = loaded[0].Types, loaded[0].GoFiles
+		cached.fingerprint = filesFingerprint(cached.files)
+	}
+	pkg := cached.types
+	obj, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+	if !ok {
+		return nil, fmt.Errorf("%s.%s is not a type", importPath, name)
+	}
+	st, ok := obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		return nil, nil
+	}
+	return st, nil
+}
+
+// localStruct 同じパッケージで宣言された構造体と、そのファイルのimport（名前からimport path）
+type localStruct struct {
+	structType *ast.StructType
+	imports    map[string]string
+}
+
+// localStructs パッケージのディレクトリで宣言された構造体を名前で返す。生成されたファイルとテストは読まない
+func localStructs(fsys fs.FS, dir, packageName string) (map[string]*localStruct, error) {
+	sources, err := packageSources(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	structs := make(map[string]*localStruct)
+	for _, source := range sources {
+		file, err := parser.ParseFile(token.NewFileSet(), source.path, source.src, 0)
+		if err != nil || file.Name.Name != packageName || ast.IsGenerated(file) {
+			continue
+		}
+		paths := make([]string, 0, len(file.Imports))
+		for _, imp := range file.Imports {
+			importPath, _ := strconv.Unquote(imp.Path.Value)
+			paths = append(paths, importPath)
+		}
+		names := importNames.resolveFS(fsys, dir, paths)
+		imports := make(map[string]string)
+		for i, imp := range file.Imports {
+			name := names[paths[i]]
+			if imp.Name != nil {
+				name = imp.Name.Name
+			}
+			imports[name] = paths[i]
+		}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				spec := spec.(*ast.TypeSpec)
+				if st, ok := spec.Type.(*ast.StructType); ok && spec.TypeParams == nil {
+					structs[spec.Name.Name] = &localStruct{structType: st, imports: imports}
+				}
+			}
+		}
+	}
+	return structs, nil
+}
+
+// fieldType 宣言したファイルのimportで書かれたフィールドの型を、生成するファイルのimportで書き直す
+func (l *localStruct) fieldType(r *renderer, expr ast.Expr) string {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				if importPath, ok := l.imports[ident.Name]; ok {
+					ident.Name = r.importName(importPath)
+				}
+			}
+			return false
+		}
+		return true
+	})
+	return getFiledTypeString(expr)
+}
+
+// followsLocalEmbedding //gen:setters embeddedで同じパッケージの構造体の埋め込みをたどるか
+func followsLocalEmbedding(s *targetStruct) bool {
+	d := s.directive("setters")
+	if d == nil {
+		return false
+	}
+	_, ok := d.arg("embedded")
+	return ok
+}
+
+// localEmbeddedSetters 埋め込まれた同じパッケージの構造体から昇格したフィールドのsetter。
+// 昇格したフィールドの名前を数えるためにpromotedを更新する
+func localEmbeddedSetters(r *renderer, s *targetStruct, field *ast.Field, embedded *localStruct, pointer bool, promoted map[string]int) []*setter {
+	structName := s.name()
+	ident := field.Type
+	if star, ok := ident.(*ast.StarExpr); ok {
+		ident = star.X
+	}
+	typeName := ident.(*ast.Ident).Name
+	var setters []*setter
+	for _, f := range embedded.structType.Fields.List {
+		for _, name := range f.Names {
+			promoted[name.Name]++
+			if findField(s.structType(), name.Name) != nil || !r.isSetterField(s, name.Name) {
+				continue
+			}
+			set := &setter{
+				StructName: structName,
+				FieldName:  name.Name,
+				FieldType:  embedded.fieldType(r, f.Type),
+				Embedded:   typeName,
+				Hooks:      r.fieldHooks(structName, name.Name),
+			}
+			if pointer {
+				set.EmbeddedType = typeName
+			}
+			setters = append(setters, set)
+		}
+	}
+	return setters
+}
+
+// embeddedSetters 埋め込まれた他のパッケージの構造体（gorm.Modelなど）から昇格したフィールドのsetterを、
+// 外側の構造体に生成する。//gen:setters embeddedでは同じパッケージの構造体の埋め込みもたどる。
+// 外側のフィールドや複数の埋め込みで名前がぶつかるフィールドは昇格しないので対象外
+func embeddedSetters(r *renderer, s *targetStruct) ([]*setter, error) {
+	structName := s.name()
+	structType := s.structType()
+	var setters []*setter
+	promoted := make(map[string]int)
+	var locals map[string]*localStruct
+	for _, field := range structType.Fields.List {
+		if len(field.Names) > 0 {
+			continue
+		}
+		typ, pointer := field.Type, false
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ, pointer = star.X, true
+		}
+		if ident, ok := typ.(*ast.Ident); ok {
+			if !followsLocalEmbedding(s) || ident.Name == timestampsMixin {
+				continue
+			}
+			if locals == nil {
+				var err error
+				if locals, err = localStructs(r.t.fsys, r.t.path, r.t.packageName); err != nil {
+					return nil, fmt.Errorf("%s: embedded %s: %w", structName, ident.Name, err)
+				}
+			}
+			if embedded, ok := locals[ident.Name]; ok {
+				setters = append(setters, localEmbeddedSetters(r, s, field, embedded, pointer, promoted)...)
+			}
+			continue
+		}
+		sel, ok := typ.(*ast.SelectorExpr)
+		if !ok {
+			continue
+		}
+		pkgIdent, ok := sel.X.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		imp, ok := r.importsMap[pkgIdent.Name]
+		if !ok {
+			continue
+		}
+		// ParseFSで読んだパッケージからは他のパッケージを読めない
+		if r.t.fsys != nil {
+			return nil, fmt.Errorf("%s: embedded %s: cannot load package %s outside the parsed file system", structName, nodeString(r.t.fileSet, field.Type), imp.pkg)
+		}
+		st, err := embeddedStructs.lookup(r.t.path, imp.pkg, sel.Sel.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: embedded %s: %w", structName, nodeString(r.t.fileSet, field.Type), err)
+		}
+		if st == nil {
+			continue
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			f := st.Field(i)
+			if !f.Exported() || f.Embedded() {
+				continue
+			}
+			promoted[f.Name()]++
+			if findField(structType, f.Name()) != nil || !r.isSetterField(s, f.Name()) {
+				continue
+			}
+			set := &setter{
+				StructName: structName,
+				FieldName:  f.Name(),
+				FieldType: types.TypeString(f.Type(), func(p *types.Package) string {
+					return r.importName(p.Path())
+				}),
+				Embedded: sel.Sel.Name,
+				Hooks:    r.fieldHooks(structName, f.Name()),
+			}
+			if pointer {
+				imp.used = true
+				set.EmbeddedType = pkgIdent.Name + "." + sel.Sel.Name
+			}
+			setters = append(setters, set)
+		}
+	}
+	// 同じ深さに同名のフィールドが複数あると曖昧になり昇格しない
+	unique := setters[:0]
+	for _, set := range setters {
+		if promoted[set.FieldName] == 1 {
+			unique = append(unique, set)
+		}
+	}
+	return unique, nil
+}
@@ -0,0 +1,55 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+)
+
+// encryptedStruct gen:"encrypted"のついたフィールドをまとめて暗号化・復号するメソッド
+type encryptedStruct struct {
+	StructName string
+	Fields     []*encryptedField
+	Context    string // contextを参照している名前
+	Fmt        string
+	Base64     string // stringのフィールドがある場合にencoding/base64を参照している名前
+}
+
+type encryptedField struct {
+	FieldName string
+	IsString  bool // stringは暗号文をbase64で持つ。それ以外は[]byte
+}
+
+// newEncryptedStruct 構造体にgen:"encrypted"のフィールドがなければnilを返す
+func newEncryptedStruct(r *renderer, s *targetStruct) (*encryptedStruct, error) {
+	e := &encryptedStruct{StructName: s.name()}
+	for _, field := range s.structType().Fields.List {
+		if !parseGenTag(field).has("encrypted") {
+			continue
+		}
+		// stringか[]byteだけを扱う
+		isString, supported := false, false
+		switch t := field.Type.(type) {
+		case *ast.Ident:
+			isString = t.Name == "string"
+			supported = isString
+		case *ast.ArrayType:
+			elt, ok := t.Elt.(*ast.Ident)
+			supported = t.Len == nil && ok && elt.Name == "byte"
+		}
+		if !supported {
+			return nil, fmt.Errorf("%s: gen:\"encrypted\" is only supported on string and []byte fields", s.name())
+		}
+		for _, name := range field.Names {
+			e.Fields = append(e.Fields, &encryptedField{FieldName: name.Name, IsString: isString})
+		}
+		if isString {
+			e.Base64 = r.importName("encoding/base64")
+		}
+	}
+	if len(e.Fields) == 0 {
+		return nil, nil
+	}
+	e.Context = r.importName("context")
+	e.Fmt = r.importName("fmt")
+	return e, nil
+}
@@ -0,0 +1,425 @@
+package gen
+
+import (
+	"fmt"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// equality //gen:equalで生成するEqualとHash
+type equality struct {
+	StructName string
+	Conds      []string // &&でつなぐ条件
+	Hash       bool
+	HashStmts  []string // hに書き込む文
+	FNV        string
+}
+
+// equaler 型情報からフィールドを比較する式とハッシュを計算する文を組み立てる
+type equaler struct {
+	r         *renderer
+	pkg       *types.Package
+	compared  map[string]bool       // //gen:equalでEqualを生成する構造体
+	hashed    map[string]bool       // //gen:equal hashでHashも生成する構造体
+	expanding map[*types.Named]bool // 展開中の構造体。自身を参照する構造体を見つける
+	vars      int
+}
+
+func (e *equaler) newVar(prefix string) string {
+	e.vars++
+	return prefix + strconv.Itoa(e.vars)
+}
+
+// equalMethod 型のEqualメソッドの引数がポインタか。Equalがなければok=false。
+// time.TimeのEqual(u Time)と、//gen:equalで生成するEqual(other *T)を扱う
+func (e *equaler) equalMethod(t types.Type) (pointer, ok bool) {
+	named, isNamed := types.Unalias(t).(*types.Named)
+	if !isNamed {
+		return false, false
+	}
+	if named.Obj().Pkg() == e.pkg && e.compared[named.Obj().Name()] {
+		return true, true
+	}
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(named), true, named.Obj().Pkg(), "Equal")
+	fn, isFunc := obj.(*types.Func)
+	if !isFunc {
+		return false, false
+	}
+	sig := fn.Type().(*types.Signature)
+	if sig.Params().Len() != 1 || sig.Results().Len() != 1 || !types.Identical(sig.Results().At(0).Type(), types.Typ[types.Bool]) {
+		return false, false
+	}
+	switch param := sig.Params().At(0).Type(); {
+	case types.Identical(param, named):
+		return false, true
+	case types.Identical(param, types.NewPointer(named)):
+		return true, true
+	}
+	return false, false
+}
+
+// hashMethod 型がHash() uint64を持つか
+func (e *equaler) hashMethod(t types.Type) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return false
+	}
+	if named.Obj().Pkg() == e.pkg && e.hashed[named.Obj().Name()] {
+		return true
+	}
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(named), true, named.Obj().Pkg(), "Hash")
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	return sig.Params().Len() == 0 && sig.Results().Len() == 1 && types.Identical(sig.Results().At(0).Type(), types.Typ[types.Uint64])
+}
+
+// plain ==で比較してよい型か。Equalを持つ型やポインタ（指す先を比べる）を含む型は式を組み立てる
+func (e *equaler) plain(t types.Type) bool {
+	if _, ok := e.equalMethod(t); ok {
+		return false
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic, *types.Interface, *types.Chan:
+		return true
+	case *types.Array:
+		return e.plain(u.Elem())
+	case *types.Struct:
+		if named, ok := types.Unalias(t).(*types.Named); ok && named.Obj().Pkg() != e.pkg {
+			return types.Comparable(t)
+		}
+		for i := 0; i < u.NumFields(); i++ {
+			if !e.plain(u.Field(i).Type()) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// opaque 中身を比べられない他のパッケージの構造体か。ポインタで持っていれば同じものを指しているかで比べる
+func (e *equaler) opaque(t types.Type) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok || named.Obj().Pkg() == e.pkg {
+		return false
+	}
+	if _, ok := e.equalMethod(t); ok {
+		return false
+	}
+	_, isStruct := t.Underlying().(*types.Struct)
+	return isStruct && !types.Comparable(t)
+}
+
+// expandsFields フィールドごとに比べる構造体か。ポインタのままフィールドを参照できる
+func (e *equaler) expandsFields(t types.Type) bool {
+	if _, ok := e.equalMethod(t); ok {
+		return false
+	}
+	if named, ok := types.Unalias(t).(*types.Named); ok && named.Obj().Pkg() != e.pkg {
+		return false
+	}
+	_, ok := t.Underlying().(*types.Struct)
+	return ok
+}
+
+// equalExpr aとbが等しいときにtrueになる式。関数は比較できないので空を返す
+func (e *equaler) equalExpr(a, b string, t types.Type) (string, error) {
+	if pointer, ok := e.equalMethod(t); ok {
+		if pointer {
+			return fmt.Sprintf("%s.Equal(&%s)", a, b), nil
+		}
+		return fmt.Sprintf("%s.Equal(%s)", a, b), nil
+	}
+	if _, ok := t.Underlying().(*types.Signature); ok {
+		return "", nil
+	}
+	if e.plain(t) {
+		return a + " == " + b, nil
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Pointer:
+		if pointer, ok := e.equalMethod(u.Elem()); ok && pointer {
+			return fmt.Sprintf("%s.Equal(%s)", a, b), nil
+		}
+		if e.opaque(u.Elem()) {
+			return a + " == " + b, nil
+		}
+		elemA, elemB := "(*"+a+")", "(*"+b+")"
+		if e.expandsFields(u.Elem()) {
+			elemA, elemB = a, b
+		}
+		inner, err := e.equalExpr(elemA, elemB, u.Elem())
+		if err != nil || inner == "" {
+			return inner, err
+		}
+		return fmt.Sprintf("(%s == %s || %s != nil && %s != nil && %s)", a, b, a, b, inner), nil
+	case *types.Slice:
+		return e.equalFunc("slices", a, b, u.Elem())
+	case *types.Map:
+		return e.equalFunc("maps", a, b, u.Elem())
+	case *types.Array:
+		return e.equalFunc("slices", a+"[:]", b+"[:]", u.Elem())
+	case *types.Struct:
+		named, ok := types.Unalias(t).(*types.Named)
+		if ok && named.Obj().Pkg() != e.pkg {
+			return "", fmt.Errorf("%s is not comparable; give it an Equal method", types.TypeString(t, nil))
+		}
+		if ok {
+			if e.expanding[named] {
+				return "", fmt.Errorf("%s refers to itself; add //gen:equal to %s", named.Obj().Name(), named.Obj().Name())
+			}
+			e.expanding[named] = true
+			defer delete(e.expanding, named)
+		}
+		var conds []string
+		for i := 0; i < u.NumFields(); i++ {
+			f := u.Field(i)
+			cond, err := e.equalExpr(a+"."+f.Name(), b+"."+f.Name(), f.Type())
+			if err != nil {
+				return "", err
+			}
+			if cond != "" {
+				conds = append(conds, cond)
+			}
+		}
+		if len(conds) == 0 {
+			return "true", nil
+		}
+		return "(" + strings.Join(conds, " && ") + ")", nil
+	}
+	return "", fmt.Errorf("cannot compare %s", types.TypeString(t, nil))
+}
+
+// equalFunc slices.Equal, maps.Equalか、要素を比べる関数を渡すEqualFuncで比べる式
+func (e *equaler) equalFunc(pkg, a, b string, elem types.Type) (string, error) {
+	name := e.r.importName(pkg)
+	if e.plain(elem) {
+		return fmt.Sprintf("%s.Equal(%s, %s)", name, a, b), nil
+	}
+	x, y := e.newVar("x"), e.newVar("y")
+	inner, err := e.equalExpr(x, y, elem)
+	if err != nil {
+		return "", err
+	}
+	if inner == "" {
+		inner = "true"
+	}
+	elemType := qualifiedTypeString(e.r, e.pkg, elem)
+	return fmt.Sprintf("%s.EqualFunc(%s, %s, func(%s, %s %s) bool { return %s })", name, a, b, x, y, elemType, inner), nil
+}
+
+// hashStmts Equalで等しい値が同じハッシュになるように、値をhに書き込む文
+func (e *equaler) hashStmts(h, v string, t types.Type) ([]string, error) {
+	fmtName := e.r.importName("fmt")
+	write := func(format, arg string) string {
+		return fmt.Sprintf("%s.Fprintf(%s, %q, %s)", fmtName, h, format, arg)
+	}
+	if e.hashMethod(t) {
+		return []string{write("%d;", v+".Hash()")}, nil
+	}
+	if isTimeType(t) {
+		// Equalは時刻だけを比べるので、タイムゾーンによらない値にする
+		return []string{write("%d;", v+".UnixNano()")}, nil
+	}
+	if _, ok := e.equalMethod(t); ok {
+		return nil, fmt.Errorf("%s has Equal but no Hash() uint64", types.TypeString(t, nil))
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		if u.Info()&types.IsString != 0 {
+			return []string{write("%q;", v)}, nil
+		}
+		return []string{write("%v;", v)}, nil
+	case *types.Signature:
+		return nil, nil
+	case *types.Interface:
+		return []string{write("%v;", v)}, nil
+	case *types.Chan:
+		return []string{write("%p;", v)}, nil
+	case *types.Pointer:
+		if e.hashMethod(u.Elem()) {
+			return []string{fmt.Sprintf("if %s != nil {", v), write("%d;", v+".Hash()"), "}"}, nil
+		}
+		if e.opaque(u.Elem()) {
+			return []string{write("%p;", v)}, nil
+		}
+		elem := "(*" + v + ")"
+		if e.expandsFields(u.Elem()) {
+			elem = v
+		}
+		inner, err := e.hashStmts(h, elem, u.Elem())
+		if err != nil {
+			return nil, err
+		}
+		stmts := []string{fmt.Sprintf("if %s == nil {", v), fmt.Sprintf("%s.Fprint(%s, \"nil;\")", fmtName, h), "} else {"}
+		stmts = append(stmts, inner...)
+		return append(stmts, "}"), nil
+	case *types.Slice, *types.Array:
+		elem := u.(interface{ Elem() types.Type }).Elem()
+		x := e.newVar("x")
+		inner, err := e.hashStmts(h, x, elem)
+		if err != nil {
+			return nil, err
+		}
+		stmts := []string{write("%d;", "len("+v+")"), fmt.Sprintf("for _, %s := range %s {", x, v)}
+		stmts = append(stmts, inner...)
+		return append(stmts, "}"), nil
+	case *types.Map:
+		// mapの順序によらないように、要素ごとのハッシュの和を書き込む
+		sum, k, x, eh := e.newVar("sum"), e.newVar("k"), e.newVar("x"), e.newVar("h")
+		keyStmts, err := e.hashStmts(eh, k, u.Key())
+		if err != nil {
+			return nil, err
+		}
+		valueStmts, err := e.hashStmts(eh, x, u.Elem())
+		if err != nil {
+			return nil, err
+		}
+		stmts := []string{
+			fmt.Sprintf("var %s uint64", sum),
+			fmt.Sprintf("for %s, %s := range %s {", k, x, v),
+			fmt.Sprintf("%s := %s.New64a()", eh, e.r.importName("hash/fnv")),
+		}
+		stmts = append(stmts, keyStmts...)
+		stmts = append(stmts, valueStmts...)
+		stmts = append(stmts, fmt.Sprintf("%s += %s.Sum64()", sum, eh), "}")
+		return append(stmts, write("%d;", sum)), nil
+	case *types.Struct:
+		if named, ok := types.Unalias(t).(*types.Named); ok && named.Obj().Pkg() != e.pkg {
+			// 他のパッケージの構造体は==で比べるので、表示した値が同じになる
+			return []string{write("%v;", v)}, nil
+		}
+		var stmts []string
+		for i := 0; i < u.NumFields(); i++ {
+			f := u.Field(i)
+			inner, err := e.hashStmts(h, v+"."+f.Name(), f.Type())
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, inner...)
+		}
+		return stmts, nil
+	}
+	return nil, fmt.Errorf("cannot hash %s", types.TypeString(t, nil))
+}
+
+// renderEqual //gen:equalのついた構造体に、フィールドを比べるEqualを生成する。hashを指定するとHashも生成する。
+// フィールドの型はgo/packagesで型検査して調べる
+func renderEqual(r *renderer, targets []*directiveTarget) error {
+	pkg, err := r.t.loadTypes()
+	if err != nil {
+		return err
+	}
+	e := &equaler{
+		r:         r,
+		pkg:       pkg,
+		compared:  make(map[string]bool),
+		hashed:    make(map[string]bool),
+		expanding: make(map[*types.Named]bool),
+	}
+	for _, target := range targets {
+		for _, arg := range target.d.args {
+			if arg.key != "hash" || arg.value != "" {
+				return fmt.Errorf("%s: unknown //gen:equal option %s", target.s.name(), arg.key)
+			}
+		}
+		e.compared[target.s.name()] = true
+		if _, ok := target.d.arg("hash"); ok {
+			e.hashed[target.s.name()] = true
+		}
+	}
+	all := make([]*equality, 0, len(targets))
+	for _, target := range targets {
+		structName := target.s.name()
+		named, st, err := lookupNamedStruct(pkg, structName)
+		if err != nil {
+			return err
+		}
+		e.vars = 0
+		e.expanding[named] = true
+		eq := &equality{StructName: structName, Hash: e.hashed[structName]}
+		for i := 0; i < st.NumFields(); i++ {
+			f := st.Field(i)
+			cond, err := e.equalExpr("s."+f.Name(), "other."+f.Name(), f.Type())
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", structName, f.Name(), err)
+			}
+			if cond != "" {
+				eq.Conds = append(eq.Conds, cond)
+			}
+			if eq.Hash {
+				stmts, err := e.hashStmts("h", "s."+f.Name(), f.Type())
+				if err != nil {
+					return fmt.Errorf("%s.%s: %w", structName, f.Name(), err)
+				}
+				eq.HashStmts = append(eq.HashStmts, stmts...)
+			}
+		}
+		if eq.Hash {
+			eq.FNV = r.importName("hash/fnv")
+		}
+		delete(e.expanding, named)
+		all = append(all, eq)
+	}
+	if err := r.execute("equal", equalTemplate, all); err != nil {
+		return err
+	}
+	if !r.t.benchmarks {
+		return nil
+	}
+	tr := r.testFile()
+	var benchmarks []*methodBenchmark
+	for _, eq := range all {
+		benchmarks = append(benchmarks, &methodBenchmark{
+			StructName: eq.StructName,
+			Name:       exportedName(eq.StructName) + "Equal",
+			Setup:      "other := &" + eq.StructName + "{}",
+			Call:       "_ = s.Equal(other)",
+			Testing:    tr.importName("testing"),
+		})
+		if eq.Hash {
+			benchmarks = append(benchmarks, &methodBenchmark{
+				StructName: eq.StructName,
+				Name:       exportedName(eq.StructName) + "Hash",
+				Call:       "_ = s.Hash()",
+				Testing:    tr.importName("testing"),
+			})
+		}
+	}
+	return tr.execute("equal_bench", methodBenchmarkTemplate, benchmarks)
+}
+
+const equalTemplate = `
+{{range .}}
+// Equal reports whether s and other hold equal values. Pointers are compared by
+// the values they point to, time.Time with Equal and function fields are ignored.
+func (s *{{.StructName}}) Equal(other *{{.StructName}}) bool {
+	if s == nil || other == nil {
+		return s == other
+	}
+	{{- if .Conds}}
+	return {{range $i, $c := .Conds}}{{if $i}} &&
+		{{end}}{{$c}}{{end}}
+	{{- else}}
+	return true
+	{{- end}}
+}
+{{if .Hash}}
+// Hash returns a hash of s that is the same for values reported equal by Equal.
+func (s *{{.StructName}}) Hash() uint64 {
+	if s == nil {
+		return 0
+	}
+	h := {{.FNV}}.New64a()
+	{{- range .HashStmts}}
+	{{.}}
+	{{- end}}
+	return h.Sum64()
+}
+{{end}}
+{{- end}}
+`
@@ -0,0 +1,84 @@
+package gen
+
+import (
+	"strings"
+	"testing"
+)
+
+// 別名のtime.TimeもEqualで比べ、HashではUnixNanoを書き込む
+func TestEqualAlias(t *testing.T) {
+	_, generated := generateModule(t, map[string]string{
+		"m/model.go": `package m
+
+import "time"
+
+type Stamp = time.Time
+
+//gen:equal hash
+type Model struct {
+	At    Stamp
+	AtPtr *Stamp
+	Count *int
+}
+`,
+	})
+	src := generated["m/model_setters.go"]
+	for _, want := range []string{
+		"s.At.Equal(other.At)",
+		"(*s.AtPtr).Equal((*other.AtPtr))",
+		`fmt.Fprintf(h, "%d;", s.At.UnixNano())`,
+		"(s.Count == other.Count || s.Count != nil && other.Count != nil && (*s.Count) == (*other.Count))",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, src)
+		}
+	}
+}
+
+// -benchmarksでは、Equal、Hash、DeepCopyのベンチマークも生成する
+func TestEqualDeepCopyBenchmarks(t *testing.T) {
+	dir, generated := generateModule(t, map[string]string{
+		".gogenstruct.yaml": "benchmarks: true\n",
+		"m/model.go": `package m
+
+//gen:equal hash
+//gen:deepcopy
+type Model struct {
+	Tags []string
+	Ref  *int
+}
+`,
+	})
+	src := generated["m/model_setters_test.go"]
+	for _, want := range []string{"func BenchmarkModelEqual(", "func BenchmarkModelHash(", "func BenchmarkModelDeepCopy("} {
+		if !strings.Contains(src, want) {
+			t.Errorf("benchmarks do not contain %q:\n%s", want, src)
+		}
+	}
+	goTest(t, dir, "-run=^$", "-bench=.", "-benchtime=1x", "./...")
+}
+
+// time.Time、その別名、それらへのポインタのフィールドをEqualではEqualで比べ、HashではUnixNanoを書き込む
+func TestEqualFieldKinds(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		want  []string
+	}{
+		{"time", "At time.Time", []string{"s.At.Equal(other.At)", `fmt.Fprintf(h, "%d;", s.At.UnixNano())`}},
+		{"alias", "At Stamp", []string{"s.At.Equal(other.At)", `fmt.Fprintf(h, "%d;", s.At.UnixNano())`}},
+		{"pointer", "At *time.Time", []string{"(s.At == other.At || s.At != nil && other.At != nil && (*s.At).Equal((*other.At)))", `fmt.Fprintf(h, "%d;", (*s.At).UnixNano())`}},
+		{"alias pointer", "At *Stamp", []string{"(s.At == other.At || s.At != nil && other.At != nil && (*s.At).Equal((*other.At)))", `fmt.Fprintf(h, "%d;", (*s.At).UnixNano())`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, generated := generateModule(t, map[string]string{"m/model.go": fieldModel("//gen:equal hash", tt.field)})
+			src := generated["m/model_setters.go"]
+			for _, want := range tt.want {
+				if !strings.Contains(src, want) {
+					t.Errorf("generated code does not contain %q:\n%s", want, src)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package gen
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// table //gen:tableのついた構造体に対応するテーブル
+type table struct {
+	structName string
+	name       string
+	columns    []*column
+}
+
+type column struct {
+	fieldName string
+	name      string
+	typ       string
+	nullable  bool
+	pk        bool
+}
+
+// dbmlTypes Goの型からdbdiagram.io (DBML)の型への対応
+var dbmlTypes = map[string]string{
+	"string": "varchar", "bool": "boolean",
+	"int": "bigint", "int64": "bigint", "uint": "bigint", "uint64": "bigint",
+	"int32": "int", "uint32": "int", "int16": "smallint", "uint16": "smallint", "int8": "smallint", "uint8": "smallint",
+	"float32": "real", "float64": "double",
+	"[]byte": "bytea", "time.Time": "timestamp",
+}
+
+// runERD //gen:tableのついた構造体のdbタグからER図（DBML）を出力する。
+// XxxIDという名前のフィールドはXxx構造体のテーブルへの外部キーとみなす
+func runERD(args []string) error {
+	flags := flag.NewFlagSet("erd", flag.ExitOnError)
+	dir := flags.String("dir", ".", "directory to analyze")
+	format := flags.String("format", "dbml", "output format (dbml)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != "dbml" {
+		return fmt.Errorf("erd: unsupported format %q", *format)
+	}
+	tables, err := loadTables(*dir)
+	if err != nil {
+		return err
+	}
+	writeDBML(os.Stdout, tables)
+	return nil
+}
+
+// loadTables ディレクトリ以下の//gen:tableのついた構造体をテーブルにする
+func loadTables(dir string) ([]*table, error) {
+	files, err := listGoFiles(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	var tables []*table
+	for _, file := range files {
+		targets, err := searchTargetStructs(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range targets.structs {
+			d := s.directive("table")
+			if d == nil {
+				continue
+			}
+			tables = append(tables, newTable(targets, s, d))
+		}
+	}
+	return tables, nil
+}
+
+func newTable(t *targetStructs, s *targetStruct, d *directive) *table {
+	tbl := &table{structName: s.name(), name: snakeCase(s.name())}
+	if name, ok := d.arg("name"); ok && name != "" {
+		tbl.name = name
+	}
+	for _, field := range s.structType().Fields.List {
+		name, ok := dbColumnName(field)
+		if !ok {
+			continue
+		}
+		typ := nodeString(t.fileSet, field.Type)
+		c := &column{typ: typ}
+		if star, ok := field.Type.(*ast.StarExpr); ok {
+			c.nullable = true
+			c.typ = nodeString(t.fileSet, star.X)
+		}
+		if dbml, ok := dbmlTypes[c.typ]; ok {
+			c.typ = dbml
+		}
+		for _, fieldName := range field.Names {
+			c := *c
+			c.fieldName = fieldName.Name
+			c.name = name
+			c.pk = name == "id"
+			tbl.columns = append(tbl.columns, &c)
+		}
+	}
+	return tbl
+}
+
+// dbColumnName db:"name"タグのカラム名。タグがないか"-"なら対象外
+func dbColumnName(field *ast.Field) (string, bool) {
+	if field.Tag == nil || len(field.Names) == 0 {
+		return "", false
+	}
+	raw, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return "", false
+	}
+	value, ok := reflect.StructTag(raw).Lookup("db")
+	name, _, _ := strings.Cut(value, ",")
+	if !ok || name == "" || name == "-" {
+		return "", false
+	}
+	return name, true
+}
+
+// writeDBML テーブルと、XxxIDから推測した参照をDBMLで書く
+func writeDBML(w io.Writer, tables []*table) {
+	byStruct := make(map[string]*table, len(tables))
+	for _, tbl := range tables {
+		byStruct[tbl.structName] = tbl
+	}
+	var refs []string
+	for _, tbl := range tables {
+		fmt.Fprintf(w, "Table %s {\n", tbl.name)
+		for _, c := range tbl.columns {
+			var settings []string
+			if c.pk {
+				settings = append(settings, "pk")
+			}
+			if c.nullable {
+				settings = append(settings, "null")
+			} else {
+				settings = append(settings, "not null")
+			}
+			typ := c.typ
+			// 対応のない型（time.Durationや[]stringなど）はそのまま引用符で囲む
+			if strings.ContainsAny(typ, " .[]*") {
+				typ = strconv.Quote(typ)
+			}
+			fmt.Fprintf(w, "  %s %s [%s]\n", c.name, typ, strings.Join(settings, ", "))
+			target, ok := strings.CutSuffix(c.fieldName, "ID")
+			if !ok || target == "" || c.pk {
+				continue
+			}
+			if ref := byStruct[target]; ref != nil {
+				if pk := ref.primaryKey(); pk != nil {
+					refs = append(refs, fmt.Sprintf("Ref: %s.%s > %s.%s", tbl.name, c.name, ref.name, pk.name))
+				}
+			}
+		}
+		fmt.Fprintln(w, "}")
+		fmt.Fprintln(w)
+	}
+	for _, ref := range refs {
+		fmt.Fprintln(w, ref)
+	}
+}
+
+func (t *table) primaryKey() *column {
+	for _, c := range t.columns {
+		if c.pk {
+			return c
+		}
+	}
+	return nil
+}
+
+// snakeCase UserAccount → user_account, HTTPLog → http_log
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// 単語の区切り: 小文字の後、または頭字語の最後の文字の前
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
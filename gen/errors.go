@@ -0,0 +1,138 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// domainErrors //gen:errors NotFound,Conflictで生成する構造体ごとのエラー
+type domainErrors struct {
+	StructName string
+	Kinds      []*domainError
+	Keys       []*domainErrorKey
+	Errors     string // errorsパッケージの名前
+	Fmt        string
+}
+
+// domainError ErrExampleNotFoundと、キーの値を持つExampleNotFoundError
+type domainError struct {
+	Kind     string // NotFound
+	Sentinel string // ErrExampleNotFound
+	TypeName string // ExampleNotFoundError
+	Message  string // example not found
+}
+
+// domainErrorKey エラーに持たせる、対象を特定するフィールド
+type domainErrorKey struct {
+	FieldName string
+	FieldType string
+}
+
+// newDomainErrors 引数の種類ごとのエラーを作る。キーはkey=で指定し、省略するとIDフィールドがあればそれを使う
+func newDomainErrors(r *renderer, target *directiveTarget) (*domainErrors, error) {
+	structName := target.s.name()
+	structType := target.s.structType()
+	e := &domainErrors{StructName: structName}
+	exported := ast.IsExported(structName)
+	base := strings.ReplaceAll(snakeCase(exportedName(structName)), "_", " ")
+	for _, arg := range target.d.args {
+		if arg.key == "key" {
+			continue
+		}
+		if arg.value != "" {
+			return nil, fmt.Errorf("%s: unknown //gen:errors option %s", structName, arg.key)
+		}
+		for _, kind := range strings.Split(arg.key, ",") {
+			kind = exportedName(strings.TrimSpace(kind))
+			if !token.IsIdentifier(kind) {
+				return nil, fmt.Errorf("%s: //gen:errors kind %q is not an identifier", structName, kind)
+			}
+			de := &domainError{
+				Kind:     kind,
+				Sentinel: "Err" + exportedName(structName) + kind,
+				TypeName: exportedName(structName) + kind + "Error",
+				Message:  base + " " + strings.ReplaceAll(snakeCase(kind), "_", " "),
+			}
+			if !exported {
+				de.Sentinel = unexportedName(de.Sentinel)
+				de.TypeName = unexportedName(de.TypeName)
+			}
+			de.Sentinel, de.TypeName = r.ident(de.Sentinel), r.ident(de.TypeName)
+			e.Kinds = append(e.Kinds, de)
+		}
+	}
+	if len(e.Kinds) == 0 {
+		return nil, fmt.Errorf("%s: //gen:errors requires comma separated kinds such as NotFound,Conflict", structName)
+	}
+	var keys []string
+	// key=とすればキーを持たせない
+	if v, ok := target.d.arg("key"); ok {
+		if v != "" {
+			keys = strings.Split(v, ",")
+		}
+	} else if findField(structType, "ID") != nil {
+		keys = []string{"ID"}
+	}
+	for _, key := range keys {
+		field := findField(structType, key)
+		if field == nil {
+			return nil, fmt.Errorf("%s: //gen:errors key %s does not exist", structName, key)
+		}
+		e.Keys = append(e.Keys, &domainErrorKey{FieldName: key, FieldType: r.typeString(field.Type)})
+	}
+	return e, nil
+}
+
+// renderErrors //gen:errorsのついた構造体に、errors.Isで判定できる番兵と、キーを持つエラー型を生成する
+func renderErrors(r *renderer, targets []*directiveTarget) error {
+	all := make([]*domainErrors, 0, len(targets))
+	for _, target := range targets {
+		e, err := newDomainErrors(r, target)
+		if err != nil {
+			return err
+		}
+		e.Errors = r.importName("errors")
+		if len(e.Keys) > 0 {
+			e.Fmt = r.importName("fmt")
+		}
+		all = append(all, e)
+	}
+	return r.execute("errors", errorsTemplate, all)
+}
+
+const errorsTemplate = `
+{{range .}}
+{{- $e := .}}
+{{- range .Kinds}}
+// {{.Sentinel}} matches every {{.TypeName}} with errors.Is.
+var {{.Sentinel}} = {{$e.Errors}}.New("{{.Message}}")
+
+// {{.TypeName}} is the "{{.Message}}" error{{if $e.Keys}} carrying the key of the {{$e.StructName}}{{end}}.
+// Retrieve it with errors.As.
+{{- if $e.Keys}}
+type {{.TypeName}} struct {
+	{{- range $e.Keys}}
+	{{.FieldName}} {{.FieldType}}
+	{{- end}}
+}
+{{- else}}
+type {{.TypeName}} struct{}
+{{- end}}
+
+func (e *{{.TypeName}}) Error() string {
+	{{- if $e.Keys}}
+	return {{$e.Fmt}}.Sprintf("{{.Message}}:{{range $e.Keys}} {{.FieldName}}=%v{{end}}"{{range $e.Keys}}, e.{{.FieldName}}{{end}})
+	{{- else}}
+	return "{{.Message}}"
+	{{- end}}
+}
+
+// Is reports whether target is {{.Sentinel}}.
+func (e *{{.TypeName}}) Is(target error) bool {
+	return target == {{.Sentinel}}
+}
+{{end}}
+{{- end}}
+`
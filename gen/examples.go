@@ -0,0 +1,101 @@
+package gen
+
+import (
+	"go/ast"
+	"strings"
+)
+
+// setterExample godocに表示するSetXのExample。値を設定して、フィールドの値を出力する
+type setterExample struct {
+	StructName string
+	Method     string
+	Args       []string // 順に呼ぶ引数。EnsureCreatedAtは2回呼んで最初の値が残ることを示す
+	Print      string   // 出力する式
+	Output     string
+	Fmt        string
+}
+
+// exampleValue 型の値を作る式と、出力する式（%sはフィールド）、出力。Exampleにできない型ならok=false
+func exampleValue(r, er *renderer, fieldType string) (value, print, output string, ok bool) {
+	switch fieldType {
+	case "string":
+		return `"example"`, "%s", "example", true
+	case "int", "int64", "int32":
+		return "42", "%s", "42", true
+	case "bool":
+		return "true", "%s", "true", true
+	}
+	if qualifier, ok := strings.CutSuffix(fieldType, ".Time"); ok {
+		if imp, ok := r.importsMap[qualifier]; ok && imp.pkg == "time" {
+			time := er.importName("time")
+			return time + ".Date(2024, 1, 2, 3, 4, 5, 0, " + time + ".UTC)", `%s.Format("2006-01-02")`, "2024-01-02", true
+		}
+	}
+	return "", "", "", false
+}
+
+// renderSetterExamples 生成したSetXとEnsureCreatedAtのExampleを_example_test.goに生成する。
+// pkg.go.devに表示できるのはエクスポートされた構造体のメソッドだけで、
+// 不変条件を確認する構造体はゼロ値から作ると失敗しうるので対象外
+func renderSetterExamples(r *renderer, setters []*setter, ensures []*ensureCreatedAt) error {
+	er := r.exampleFile()
+	documented := func(structName string) bool {
+		s := r.t.lookup(structName)
+		return ast.IsExported(structName) && r.invariants[structName] == "" && (s == nil || s.spec.TypeParams == nil)
+	}
+	var examples []*setterExample
+	for _, set := range setters {
+		if !documented(set.StructName) || !ast.IsExported(set.FieldName) || !ast.IsExported(set.MethodName()) {
+			continue
+		}
+		value, print, output, ok := exampleValue(r, er, set.FieldType)
+		if !ok {
+			continue
+		}
+		examples = append(examples, &setterExample{
+			StructName: set.StructName,
+			Method:     set.MethodName(),
+			Args:       []string{value},
+			Print:      strings.Replace(print, "%s", "s."+set.FieldName, 1),
+			Output:     output,
+		})
+	}
+	for _, e := range ensures {
+		if !documented(e.StructName) {
+			continue
+		}
+		time := er.importName("time")
+		examples = append(examples, &setterExample{
+			StructName: e.StructName,
+			Method:     "EnsureCreatedAt",
+			Args: []string{
+				time + ".Date(2024, 1, 2, 3, 4, 5, 0, " + time + ".UTC)",
+				time + ".Date(2025, 6, 7, 8, 9, 10, 0, " + time + ".UTC)",
+			},
+			Print:  `s.CreatedAt.Format("2006-01-02")`,
+			Output: "2024-01-02",
+		})
+	}
+	if len(examples) == 0 {
+		return nil
+	}
+	fmt := er.importName("fmt")
+	for _, e := range examples {
+		e.Fmt = fmt
+	}
+	return er.execute("setter_examples", setterExampleTemplate, examples)
+}
+
+const setterExampleTemplate = `
+{{range .}}
+{{- $e := .}}
+func Example{{.StructName}}_{{.Method}}() {
+	s := &{{.StructName}}{}
+	{{- range .Args}}
+	s.{{$e.Method}}({{.}})
+	{{- end}}
+	{{.Fmt}}.Println({{.Print}})
+	// Output: {{.Output}}
+}
+{{end}}
+`
@@ -0,0 +1,52 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// flagField gen:"flags=Read,Write"のついた整数のフィールド。各フラグを1ビットとして扱う
+type flagField struct {
+	StructName string
+	FieldName  string
+	MethodName string
+	Flags      []flagBit
+	Hooks      []string // フラグを変更した後に実行する文
+	Touch      string   // //gen:setters touchで、フラグを変更した後にUpdatedAtに入れる時刻の式
+}
+
+type flagBit struct {
+	Name string
+	Bit  int
+}
+
+// integerBits 組み込みの整数型で使えるビット数
+var integerBits = map[string]int{
+	"int": 64, "int8": 8, "int16": 16, "int32": 32, "int64": 64,
+	"uint": 64, "uint8": 8, "uint16": 16, "uint32": 32, "uint64": 64,
+	"byte": 8, "uintptr": 64,
+}
+
+func newFlagField(structName, fieldName string, expr ast.Expr, names []string) (*flagField, error) {
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return nil, fmt.Errorf("%s.%s: gen:\"flags\" is only supported on integer fields", structName, fieldName)
+	}
+	// 名前つきの型は定義を見ないと大きさがわからないので、組み込みの型だけ確認する
+	if bits, ok := integerBits[ident.Name]; ok && len(names) > bits {
+		return nil, fmt.Errorf("%s.%s: %d flags do not fit in %s", structName, fieldName, len(names), ident.Name)
+	}
+	f := &flagField{
+		StructName: structName,
+		FieldName:  fieldName,
+		MethodName: exportedName(fieldName),
+	}
+	for i, name := range names {
+		if !token.IsIdentifier(name) {
+			return nil, fmt.Errorf("%s.%s: invalid flag name %q", structName, fieldName, name)
+		}
+		f.Flags = append(f.Flags, flagBit{Name: exportedName(name), Bit: i})
+	}
+	return f, nil
+}
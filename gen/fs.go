@@ -0,0 +1,111 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// sourceFile パッケージのディレクトリの.goファイル
+type sourceFile struct {
+	name string
+	path string
+	src  []byte
+}
+
+// packageSources dirの.goファイル（テストを除く）を名前の順に読む。
+// fsysがnilならOSのファイルシステムから、そうでなければfsys（ParseFSのメモリ上のファイルなど）から読む
+func packageSources(fsys fs.FS, dir string) ([]*sourceFile, error) {
+	var entries []fs.DirEntry
+	var err error
+	if fsys == nil {
+		entries, err = os.ReadDir(dir)
+	} else {
+		entries, err = fs.ReadDir(fsys, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []*sourceFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f := &sourceFile{name: name}
+		if fsys == nil {
+			f.path = filepath.Join(dir, name)
+			f.src, err = os.ReadFile(f.path)
+		} else {
+			f.path = path.Join(dir, name)
+			f.src, err = fs.ReadFile(fsys, f.path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// isGeneratedSource このツールが生成したファイルの内容か
+func isGeneratedSource(src []byte) bool {
+	return bytes.HasPrefix(src, []byte(generatedMarker)) || bytes.HasPrefix(src, []byte(legacyGeneratedMarker))
+}
+
+// loadTypes 構造体のパッケージを型検査する。ParseFSで読んだパッケージはgo/packagesを使わずにメモリ上で型検査する
+func (t *targetStructs) loadTypes() (*types.Package, error) {
+	if t.fsys == nil {
+		return resolvedTypes.load(t.path, t.packageName)
+	}
+	return checkFSPackage(t.fsys, t.path, t.packageName)
+}
+
+// checkFSPackage fsysのdirのパッケージを型検査する。
+// WebAssemblyではgoコマンドも標準ライブラリのexport dataもないので、importしたパッケージは中身のない
+// パッケージとして扱い、型エラーは無視する。importしたパッケージの型を使うフィールドの型は分からない
+func checkFSPackage(fsys fs.FS, dir, packageName string) (*types.Package, error) {
+	sources, err := packageSources(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	fileSet := token.NewFileSet()
+	var files []*ast.File
+	for _, source := range sources {
+		file, err := parser.ParseFile(fileSet, source.path, source.src, parser.SkipObjectResolution)
+		if err != nil || file.Name.Name != packageName {
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("cannot load package %s in %s", packageName, dir)
+	}
+	conf := &types.Config{
+		Importer: emptyImporter(make(map[string]*types.Package)),
+		Error:    func(error) {},
+	}
+	pkg, _ := conf.Check(dir, fileSet, files, nil)
+	return pkg, nil
+}
+
+// emptyImporter import pathから推測した名前の、中身のないパッケージを返す
+type emptyImporter map[string]*types.Package
+
+func (imp emptyImporter) Import(importPath string) (*types.Package, error) {
+	if pkg, ok := imp[importPath]; ok {
+		return pkg, nil
+	}
+	pkg := types.NewPackage(importPath, guessImportName(importPath))
+	pkg.MarkComplete()
+	imp[importPath] = pkg
+	return pkg, nil
+}
@@ -0,0 +1,178 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// fsmTransition 1つの遷移メソッド。同じメソッドで複数の状態から遷移できる
+type fsmTransition struct {
+	StructName string
+	FieldName  string
+	MethodName string
+	From       []string // 遷移元の状態（Goの式）
+	To         string   // 遷移先の状態（Goの式）
+	Fmt        string   // fmtパッケージを参照している名前
+	Touch      string   // UpdatedAtに入れる時刻の式。更新しなければ空
+	Hooks      []string // 遷移した後に実行する文
+}
+
+// renderFSM //gen:fsmのついた構造体に状態遷移メソッドを生成する
+func renderFSM(r *renderer, targets []*directiveTarget) error {
+	var transitions []*fsmTransition
+	for _, target := range targets {
+		ts, err := newFSMTransitions(r, target)
+		if err != nil {
+			return err
+		}
+		transitions = append(transitions, ts...)
+	}
+	if len(transitions) == 0 {
+		return nil
+	}
+	return r.execute("fsm", fsmTemplate, transitions)
+}
+
+// newFSMTransitions transitions="draft->published,Archive:published->archived"を遷移メソッドにまとめる。
+// メソッド名を省略した場合は遷移先の状態からTo<State>とする
+func newFSMTransitions(r *renderer, target *directiveTarget) ([]*fsmTransition, error) {
+	structName := target.s.name()
+	fieldName, ok := target.d.arg("field")
+	if !ok || fieldName == "" {
+		return nil, fmt.Errorf("%s: //gen:fsm requires field=<name>", structName)
+	}
+	if !hasField(target.s.structType(), fieldName) {
+		return nil, fmt.Errorf("%s: //gen:fsm field %s does not exist", structName, fieldName)
+	}
+	spec, _ := target.d.arg("transitions")
+	if spec == "" {
+		return nil, fmt.Errorf("%s: //gen:fsm requires transitions=\"from->to,...\"", structName)
+	}
+	// values=constの場合、状態は文字列ではなく定数の名前として扱う
+	values, _ := target.d.arg("values")
+	if values != "" && values != "const" && values != "string" {
+		return nil, fmt.Errorf("%s: //gen:fsm values must be string or const, got %q", structName, values)
+	}
+	state := func(s string) (string, error) {
+		if values == "const" {
+			if !token.IsIdentifier(s) {
+				return "", fmt.Errorf("%s: //gen:fsm state %q is not an identifier", structName, s)
+			}
+			return s, nil
+		}
+		return strconv.Quote(s), nil
+	}
+
+	var transitions []*fsmTransition
+	byMethod := make(map[string]*fsmTransition)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		methodName, edge, named := strings.Cut(item, ":")
+		if !named {
+			edge = item
+		}
+		from, to, ok := strings.Cut(edge, "->")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("%s: invalid //gen:fsm transition %q (want from->to)", structName, item)
+		}
+		if !named {
+			methodName = "To" + camelName(to)
+		}
+		if !token.IsIdentifier(methodName) {
+			return nil, fmt.Errorf("%s: invalid //gen:fsm method name %q", structName, methodName)
+		}
+		fromValue, err := state(from)
+		if err != nil {
+			return nil, err
+		}
+		toValue, err := state(to)
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := byMethod[methodName]; ok {
+			if t.To != toValue {
+				return nil, fmt.Errorf("%s: //gen:fsm method %s transitions to both %s and %s", structName, methodName, t.To, toValue)
+			}
+			if !containsTargetField(fromValue, t.From...) {
+				t.From = append(t.From, fromValue)
+			}
+			continue
+		}
+		t := &fsmTransition{
+			StructName: structName,
+			FieldName:  fieldName,
+			MethodName: methodName,
+			From:       []string{fromValue},
+			To:         toValue,
+		}
+		byMethod[methodName] = t
+		transitions = append(transitions, t)
+	}
+
+	fmtName := r.importName("fmt")
+	touch := ""
+	hooks := r.fieldHooks(structName, fieldName)
+	if timeName := timeFieldQualifier(target.s.structType(), "UpdatedAt", r.importsMap); timeName != "" {
+		touch = touchNow(r, target.s, timeName)
+		hooks = r.fieldHooks(structName, fieldName, "UpdatedAt")
+	}
+	for _, t := range transitions {
+		t.Fmt = fmtName
+		t.Touch = touch
+		t.Hooks = hooks
+	}
+	return transitions, nil
+}
+
+// hasField 構造体に名前のフィールドがあるか
+func hasField(structType *ast.StructType, fieldName string) bool {
+	return findField(structType, fieldName) != nil
+}
+
+// findField 名前のフィールドの宣言を探す。埋め込んだTimestampsのフィールドも探す。なければnil
+func findField(structType *ast.StructType, fieldName string) *ast.Field {
+	for _, field := range structType.Fields.List {
+		for _, name := range field.Names {
+			if name.Name == fieldName {
+				return field
+			}
+		}
+	}
+	return promotedMixinField(structType, fieldName)
+}
+
+// camelName in_reviewやin-reviewのような名前をInReviewにする
+func camelName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-' || r == ' ' || r == '.'
+	}) {
+		b.WriteString(exportedName(part))
+	}
+	return b.String()
+}
+
+const fsmTemplate = `
+{{range .}}
+func (s *{{recv .StructName}}) {{.MethodName}}() error {
+	switch s.{{.FieldName}} {
+	case {{range $i, $from := .From}}{{if $i}}, {{end}}{{$from}}{{end}}:
+	default:
+		return {{.Fmt}}.Errorf("{{.StructName}}.{{.MethodName}}: cannot transition {{.FieldName}} from %v to %v", s.{{.FieldName}}, {{.To}})
+	}
+	s.{{.FieldName}} = {{.To}}
+	{{- if .Touch}}
+	s.UpdatedAt = {{.Touch}}
+	{{- end}}
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+	{{- check .StructName}}
+	return nil
+}
+{{end}}
+`
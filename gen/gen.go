@@ -0,0 +1,409 @@
+// Package gen は go-gen-struct のコード生成を他のツールから使うためのパッケージ。
+// go-gen-struct コマンドはMainを呼ぶだけなので、コマンドと同じコードを生成する。
+//
+//	pkg, err := gen.ParsePackage("./models")
+//	if err != nil {
+//		return err
+//	}
+//	g := &gen.Generator{Package: pkg, Fields: []string{"*"}}
+//	return g.Generate(os.Stdout)
+//
+// RegisterTemplateSetでテンプレートのコード生成を追加すると、//gen:<名前>のディレクティブで使える。
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Package ParsePackageで読んだ、ディレクティブのついた構造体を宣言しているパッケージ
+type Package struct {
+	Dir  string
+	Name string
+	// Structs ディレクティブのついた構造体。ファイルの順、宣言の順に並べる
+	Structs []*Struct
+	// Warnings 生成しない構造体についてのメッセージ（知らないディレクティブ、構文エラーなど）
+	Warnings []string
+	files    []*targetStructs
+	fsys     fs.FS // ParseFSで読んだときのファイルシステム
+}
+
+// Struct ディレクティブのついた構造体。テンプレートのコード生成にも渡す
+type Struct struct {
+	Name string
+	// File 構造体を宣言しているファイル
+	File string
+	// TypeParams 型パラメータのリスト（[K comparable, V any]）、TypeArgs レシーバに書く型引数（[K, V]）。なければ空
+	TypeParams string
+	TypeArgs   string
+	Directives []*Directive
+	// Args テンプレートを選んだディレクティブの引数（//gen:custom auditならaudit以外）。key=valueの形でなければ値は空
+	Args   map[string]string
+	Fields []*Field
+	// Imports 構造体を宣言しているファイルのimport
+	Imports []*Import
+}
+
+// Directive 構造体についている//gen:のディレクティブ
+type Directive struct {
+	Name string
+	// Args 引数。key=valueの形でなければ値は空
+	Args map[string]string
+}
+
+// Has 引数keyがあるか
+func (d *Directive) Has(key string) bool {
+	_, ok := d.Args[key]
+	return ok
+}
+
+// Field 構造体のフィールド。a, b intのようにまとめて宣言したフィールドは1つずつにする
+type Field struct {
+	// Name 埋め込んだフィールドは型の名前
+	Name string
+	// Type ソースに書いた型（uuid.UUID、*Address）
+	Type     string
+	Tag      reflect.StructTag
+	Embedded bool
+	Doc      string
+}
+
+// Import ソースファイルのimport
+type Import struct {
+	// Name 型で参照する名前（別名があれば別名）
+	Name string
+	Path string
+}
+
+// Directive 名前でディレクティブを探す。なければnil
+func (s *Struct) Directive(name string) *Directive {
+	for _, d := range s.Directives {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// ParsePackage dirの.goファイル（テストと生成したファイルを除く）からディレクティブのついた構造体を読む。
+// サブディレクトリは読まない
+func ParsePackage(dir string) (*Package, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := listGoFiles(dir, false)
+	if err != nil {
+		return nil, err
+	}
+	p := &Package{Dir: dir}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") || isGeneratedFile(file) {
+			continue
+		}
+		if err := p.addFile(file, nil); err != nil {
+			return nil, err
+		}
+	}
+	if p.Name == "" {
+		return nil, fmt.Errorf("%s: no Go files", dir)
+	}
+	return p, nil
+}
+
+// ParseFS fsysのdirの.goファイル（テストと生成したファイルを除く）からディレクティブのついた構造体を読む。
+// パッケージの他のファイルもfsysから読み、go/packagesもgoコマンドも使わないので、
+// WebAssemblyのようにディスクのない環境でもメモリ上のファイル（fstest.MapFSなど）から生成できる。
+// importしたパッケージの型は調べないので、他のパッケージの構造体の埋め込みなどは生成できないことがある
+func ParseFS(fsys fs.FS, dir string) (*Package, error) {
+	sources, err := packageSources(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	p := &Package{Dir: dir, fsys: fsys}
+	for _, source := range sources {
+		if isGeneratedSource(source.src) {
+			continue
+		}
+		if err := p.addFile(source.path, source.src); err != nil {
+			return nil, err
+		}
+	}
+	if p.Name == "" {
+		return nil, fmt.Errorf("%s: no Go files", dir)
+	}
+	return p, nil
+}
+
+// ParseFile filenameのソースからディレクティブのついた構造体を読む。srcがnilならファイルを読む。
+// テンプレートのテストで、ソースに書いた構造体をStructにするのにも使える
+func ParseFile(filename string, src []byte) (*Package, error) {
+	p := &Package{Dir: filepath.Dir(filename)}
+	if err := p.addFile(filename, src); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Package) addFile(filename string, src []byte) error {
+	t, err := parseTargetStructs(p.fsys, filename, src)
+	if err != nil {
+		return err
+	}
+	if p.Name == "" {
+		p.Name = t.packageName
+	} else if t.packageName != p.Name {
+		return fmt.Errorf("%s: package %s, expected %s", filename, t.packageName, p.Name)
+	}
+	for _, warning := range t.warnings {
+		p.Warnings = append(p.Warnings, warning.String())
+	}
+	if len(t.structs) == 0 {
+		return nil
+	}
+	p.files = append(p.files, t)
+	imports := t.namedImports()
+	for _, s := range t.structs {
+		p.Structs = append(p.Structs, newStruct(t, s, imports))
+	}
+	return nil
+}
+
+// namedImports ソースファイルのimportと、型で参照する名前。ブランクimportとドットimportは除く
+func (t *targetStructs) namedImports() []*Import {
+	paths := make([]string, 0, len(t.imports))
+	for _, imp := range t.imports {
+		paths = append(paths, imp.path)
+	}
+	names := importNames.resolveFS(t.fsys, t.path, paths)
+	imports := make([]*Import, 0, len(t.imports))
+	for _, imp := range t.imports {
+		if imp.alias == "_" || imp.alias == "." {
+			continue
+		}
+		name := names[imp.path]
+		if imp.alias != "" {
+			name = imp.alias
+		}
+		imports = append(imports, &Import{Name: name, Path: imp.path})
+	}
+	return imports
+}
+
+func newStruct(t *targetStructs, s *targetStruct, imports []*Import) *Struct {
+	st := &Struct{
+		Name:       s.name(),
+		File:       filepath.Join(t.path, t.filename),
+		TypeParams: s.typeParams(),
+		TypeArgs:   s.typeArgs(),
+		Imports:    imports,
+	}
+	for _, d := range s.directives {
+		st.Directives = append(st.Directives, &Directive{Name: d.name, Args: d.argMap()})
+	}
+	for _, field := range s.structType().Fields.List {
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			if raw, err := strconv.Unquote(field.Tag.Value); err == nil {
+				tag = reflect.StructTag(raw)
+			}
+		}
+		typ := types.ExprString(field.Type)
+		doc := strings.TrimSpace(field.Doc.Text())
+		if len(field.Names) == 0 {
+			st.Fields = append(st.Fields, &Field{Name: embeddedTypeName(field.Type), Type: typ, Tag: tag, Embedded: true, Doc: doc})
+			continue
+		}
+		for _, name := range field.Names {
+			st.Fields = append(st.Fields, &Field{Name: name.Name, Type: typ, Tag: tag, Doc: doc})
+		}
+	}
+	return st
+}
+
+// embeddedTypeName 埋め込んだフィールドの名前。*pkg.Base[T]ならBase
+func embeddedTypeName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.SelectorExpr:
+			return e.Sel.Name
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return types.ExprString(expr)
+		}
+	}
+}
+
+// Generator パッケージのコードを生成する。ゼロ値のオプションはコマンドの既定値と同じ
+type Generator struct {
+	Package *Package
+	// Fields //gen:settersでSetXを生成するフィールド。nilならCreatedAtとUpdatedAt、*ならエクスポートされた全てのフィールド
+	Fields []string
+	// Prefix 生成するトップレベルの型や関数の名前の接頭辞
+	Prefix string
+	// Chain 生成するSetXがレシーバを返す
+	Chain bool
+	// Version 出力形式のバージョン。0なら最新
+	Version int
+}
+
+// Generate パッケージの生成したコードを1つのファイルにまとめてwに書く。生成するものがなければ何も書かない
+func (g *Generator) Generate(w io.Writer) error {
+	fields := g.Fields
+	if fields == nil {
+		fields = targetFields
+	}
+	version := g.Version
+	if version == 0 {
+		version = outputVersion
+	}
+	if version < 1 || version > outputVersion {
+		return fmt.Errorf("unsupported output version %d (latest is %d)", version, outputVersion)
+	}
+	var generated []*generatedFile
+	for _, t := range g.Package.files {
+		t.prefix = g.Prefix
+		t.chain = g.Chain
+		src, err := t.render(fields, version)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Join(t.path, t.filename), err)
+		}
+		if src != nil {
+			generated = append(generated, &generatedFile{source: filepath.Join(t.path, t.filename), path: t.outputPath(), src: src})
+		}
+	}
+	if len(generated) == 0 {
+		return nil
+	}
+	merged, err := mergeGeneratedFiles(filepath.Join(g.Package.Dir, "zz_generated.go"), generated, version)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(merged.src)
+	return err
+}
+
+// TemplateSet //gen:<Name>のついた構造体についてTemplateを実行するコード生成
+type TemplateSet struct {
+	Name    string
+	Summary string
+	// Template text/templateのテンプレート。データは//gen:<Name>のついた構造体の[]*Struct。
+	// 関数importName "path"はimportを追加して参照する名前を、ident "Name"は-prefixをつけた名前を返す
+	Template string
+	// After このテンプレートより先に呼ぶコード生成の名前（builderなど）。生成するファイルでもその後に書く
+	After []string
+}
+
+// RegisterTemplateSet テンプレートのコード生成を追加する。ParsePackageより前に呼ぶ
+func RegisterTemplateSet(set *TemplateSet) error {
+	if !token.IsIdentifier(set.Name) {
+		return fmt.Errorf("template set name %q is not an identifier", set.Name)
+	}
+	if lookupGenerator(set.Name) != nil {
+		return fmt.Errorf("%s%s is already registered", directivePrefix, set.Name)
+	}
+	after := make([]string, 0, len(set.After))
+	for _, name := range set.After {
+		g := lookupGenerator(name)
+		if g == nil {
+			return fmt.Errorf("%s%s: unknown generator %q in After", directivePrefix, set.Name, name)
+		}
+		after = append(after, g.name)
+	}
+	tmpl, err := template.New(set.Name).Funcs(templateSetFuncs(nil)).Parse(set.Template)
+	if err != nil {
+		return err
+	}
+	summary := set.Summary
+	if summary == "" {
+		summary = "generate code from the " + set.Name + " template"
+	}
+	registerGenerator(&generator{
+		name:    set.Name,
+		generic: true,
+		summary: summary,
+		after:   after,
+		render: func(r *renderer, targets []*directiveTarget) error {
+			return renderTemplateSet(r, tmpl, targets)
+		},
+	})
+	return nil
+}
+
+// templateSetFuncs テンプレートのコード生成で使える関数。rがnilなら解析のためだけに使う
+func templateSetFuncs(r *renderer) template.FuncMap {
+	return template.FuncMap{
+		"importName": func(path string) string {
+			if r == nil {
+				return ""
+			}
+			return r.importName(path)
+		},
+		"ident": func(name string) string {
+			if r == nil {
+				return name
+			}
+			return r.ident(name)
+		},
+	}
+}
+
+func renderTemplateSet(r *renderer, tmpl *template.Template, targets []*directiveTarget) error {
+	imports := r.t.namedImports()
+	structs := make([]*Struct, 0, len(targets))
+	for _, target := range targets {
+		if slices.ContainsFunc(structs, func(s *Struct) bool { return s.Name == target.s.name() }) {
+			continue
+		}
+		s := newStruct(r.t, target.s, imports)
+		s.Args = target.d.argMap()
+		structs = append(structs, s)
+	}
+	if err := executeTemplate(&r.body, tmpl, r, structs); err != nil {
+		return fmt.Errorf("template %s: %w", tmpl.Name(), err)
+	}
+	return nil
+}
+
+// RenderTemplate テンプレートをstructsについて実行し、packageNameのファイルとしてimportをつけて整形したソースを返す。
+// //gen:customやTemplateSetと同じ関数を使えるが、ツールのバージョンなどのヘッダーは書かない
+func RenderTemplate(packageName, text string, structs []*Struct) ([]byte, error) {
+	tmpl, err := template.New("template").Funcs(templateSetFuncs(nil)).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newRenderer(&targetStructs{packageName: packageName, path: ".", filename: "template.go"}, nil, outputVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err := executeTemplate(&r.body, tmpl, r, structs); err != nil {
+		return nil, err
+	}
+	src, err := r.source()
+	if err != nil {
+		return nil, err
+	}
+	// ヘッダーのコメントはpackage句より前にある
+	if i := bytes.Index(src, []byte("\npackage ")); i >= 0 {
+		src = src[i+1:]
+	}
+	return src, nil
+}
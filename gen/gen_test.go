@@ -0,0 +1,85 @@
+package gen
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// generateModule filesにgo.modを足したモジュールを一時ディレクトリに書いて生成し、書き込む。
+// 生成したファイルを含めてパッケージが型検査を通ることを確かめ、ディレクトリと生成したファイルの中身（key: /区切りの相対パス）を返す
+func generateModule(t *testing.T, files map[string]string) (string, map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	files["go.mod"] = "module example.com/m\n\ngo 1.23\n"
+	writeTree(t, dir, files)
+	g, err := generateTree(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.out.failures > 0 {
+		t.Fatalf("generation failed:\n%s", g.logs)
+	}
+	if _, _, errs := g.write(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	generated := make(map[string]string, len(g.generated))
+	for _, file := range g.generated {
+		rel, err := filepath.Rel(dir, file.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		generated[filepath.ToSlash(rel)] = string(file.src)
+	}
+	typeCheck(t, dir, generated)
+	return dir, generated
+}
+
+// typeCheck dir配下のパッケージをテストのファイルも含めて型検査する。エラーがあれば生成したファイルとともに失敗にする
+func typeCheck(t *testing.T, dir string, generated map[string]string) {
+	t.Helper()
+	pkgs, err := packages.Load(&packages.Config{Mode: loadMode, Dir: dir, Tests: true}, "./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, e := range pkg.Errors {
+			errs = append(errs, e.Error())
+		}
+	})
+	if len(errs) == 0 {
+		return
+	}
+	var b strings.Builder
+	for name, src := range generated {
+		b.WriteString("--- " + name + "\n" + src)
+	}
+	t.Fatalf("generated code does not compile:\n%s\n%s", strings.Join(errs, "\n"), b.String())
+}
+
+// goTest dirのモジュールでgo testを実行する
+func goTest(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping go test of generated code in short mode")
+	}
+	cmd := exec.Command("go", append([]string{"test"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go test %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+// fieldModel directiveをつけ、fieldだけを持つModelのパッケージmのソース。
+// fieldにはtime.Timeと、その別名のStampを使える
+func fieldModel(directive, field string) string {
+	return "package m\n\nimport \"time\"\n\ntype Stamp = time.Time\n\n" + directive + "\ntype Model struct {\n\t" + field + "\n}\n"
+}
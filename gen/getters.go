@@ -0,0 +1,94 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// getter //gen:gettersで生成するフィールドの値を返すメソッド
+type getter struct {
+	StructName string
+	FieldName  string
+	FieldType  string
+	Name       string
+	Atomic     string // gen:"cas=atomic"の場合にsync/atomicを参照している名前
+	AtomicType string // LoadInt64などの関数名の型の部分
+}
+
+// newGetters 非公開のフィールド（allなら全てのフィールド）のgetterを作る。gen:"getter"とgen:"nogetter"で個別に選べる。
+// nameはName()、エクスポートされたNameは同名のメソッドを定義できないのでGetName()にする
+func newGetters(r *renderer, target *directiveTarget) ([]*getter, error) {
+	structName := target.s.name()
+	structType := target.s.structType()
+	_, all := target.d.arg("all")
+	prefix, _ := target.d.arg("prefix")
+	var getters []*getter
+	for _, field := range structType.Fields.List {
+		// 追記専用のsliceのコピーを返すgetterと、遅延初期化するgetterは//gen:settersで生成する
+		if parseGenTag(field).has("append") || parseGenTag(field).has("lazy") {
+			continue
+		}
+		// gen:"lazy"のclientOnceのようなsync.Onceはコピーして返せない
+		if isSyncOnce(field.Type, r.importsMap) {
+			continue
+		}
+		// //gen:derivedのキャッシュは公開しない
+		if ident, ok := field.Type.(*ast.Ident); ok && ident.Name == derivedCacheType(structName) {
+			continue
+		}
+		selected, tagged := parseGenTag(field).selects("getter")
+		for _, name := range field.Names {
+			fieldName := name.Name
+			if fieldName == "_" || (tagged && !selected) || (!tagged && ast.IsExported(fieldName) && !all) {
+				continue
+			}
+			methodName := prefix + exportedName(fieldName)
+			if methodName == fieldName {
+				methodName = "Get" + methodName
+			}
+			if !token.IsIdentifier(methodName) {
+				return nil, fmt.Errorf("%s: //gen:getters prefix %q makes an invalid method name %s", structName, prefix, methodName)
+			}
+			if hasField(structType, methodName) {
+				return nil, fmt.Errorf("%s: //gen:getters cannot generate %s() for %s because a field of that name exists", structName, methodName, fieldName)
+			}
+			g := &getter{
+				StructName: structName,
+				FieldName:  fieldName,
+				FieldType:  r.typeString(field.Type),
+				Name:       methodName,
+			}
+			g.Atomic, g.AtomicType = atomicAccess(r, field)
+			getters = append(getters, g)
+		}
+	}
+	return getters, nil
+}
+
+func renderGetters(r *renderer, targets []*directiveTarget) error {
+	var getters []*getter
+	for _, target := range targets {
+		g, err := newGetters(r, target)
+		if err != nil {
+			return err
+		}
+		getters = append(getters, g...)
+	}
+	if len(getters) == 0 {
+		return nil
+	}
+	return r.execute("getters", gettersTemplate, getters)
+}
+
+const gettersTemplate = `
+{{range .}}
+func (s *{{recv .StructName}}) {{.Name}}() {{.FieldType}} {
+	{{- if .Atomic}}
+	return {{.Atomic}}.Load{{.AtomicType}}(&s.{{.FieldName}})
+	{{- else}}
+	return s.{{.FieldName}}
+	{{- end}}
+}
+{{end}}
+`
@@ -0,0 +1,192 @@
+package gen
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// programName 補完やヘルプに表示するコマンド名
+func programName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// printUsage 引数なしで実行したときのフラグとサブコマンド、ディレクティブの一覧
+func printUsage() {
+	out := commandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags]\n       %s <command> [args]\n\nFlags:\n", programName(), programName())
+	commandLine.PrintDefaults()
+	fmt.Fprintln(out, "\nCommands:")
+	for _, cmd := range subcommands {
+		fmt.Fprintf(out, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(out, "\nDirectives:")
+	for _, g := range generators {
+		fmt.Fprintf(out, "  %-16s %s\n", g.directive(), g.summary)
+	}
+	fmt.Fprintf(out, "\nRun '%s help <topic>' for details on a command or directive.\n", programName())
+}
+
+// runHelp help <topic>でサブコマンドまたはディレクティブの説明を表示する
+func runHelp(args []string) error {
+	if len(args) == 0 {
+		commandLine.SetOutput(os.Stdout)
+		printUsage()
+		return nil
+	}
+	topic := args[0]
+	if g := lookupGenerator(topic); g != nil {
+		return writeGeneratorHelp(os.Stdout, g)
+	}
+	if cmd := lookupSubcommand(topic); cmd != nil {
+		fmt.Printf("%s %s: %s\n\n", programName(), cmd.name, cmd.summary)
+		// フラグの説明は各サブコマンドのFlagSetに任せる
+		return cmd.run([]string{"-h"})
+	}
+	return fmt.Errorf("help: unknown topic %q", topic)
+}
+
+const generatorHelpTemplate = `{{.Directive}}: {{.Summary}}
+
+{{.Doc}}
+{{- if .Args}}
+
+Arguments:
+{{- range .Args}}
+  {{printf "%-16s" .Name}} {{.Doc}}
+{{- end}}
+{{- end}}
+{{- if .Tags}}
+
+Struct tags:
+{{- range .Tags}}
+  {{printf "%-16s" .Name}} {{.Doc}}
+{{- end}}
+{{- end}}
+`
+
+type optionHelp struct {
+	Name string
+	Doc  string
+}
+
+func writeGeneratorHelp(w io.Writer, g *generator) error {
+	tmpl, err := template.New("help").Parse(generatorHelpTemplate)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, map[string]any{
+		"Directive": g.directive(),
+		"Summary":   g.summary,
+		"Doc":       g.doc,
+		"Args":      optionHelps(g.args),
+		"Tags":      optionHelps(g.tags),
+	})
+}
+
+func optionHelps(options []generatorOption) []optionHelp {
+	helps := make([]optionHelp, 0, len(options))
+	for _, o := range options {
+		helps = append(helps, optionHelp{Name: o.name, Doc: o.doc})
+	}
+	return helps
+}
+
+// runCompletion completion <shell>でシェル補完のスクリプトを出力する
+func runCompletion(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("completion: specify one of %s", strings.Join(completionShells(), ", "))
+	}
+	script, ok := completionTemplates[args[0]]
+	if !ok {
+		return fmt.Errorf("completion: unsupported shell %q (supported: %s)", args[0], strings.Join(completionShells(), ", "))
+	}
+	tmpl, err := template.New("completion").Parse(script)
+	if err != nil {
+		return err
+	}
+	var commands []optionHelp
+	for _, cmd := range subcommands {
+		commands = append(commands, optionHelp{Name: cmd.name, Doc: cmd.summary})
+	}
+	var topics []string
+	for _, cmd := range subcommands {
+		topics = append(topics, cmd.name)
+	}
+	for _, g := range generators {
+		topics = append(topics, g.name)
+	}
+	var flags []string
+	commandLine.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, "-"+f.Name)
+	})
+	program := programName()
+	return tmpl.Execute(os.Stdout, map[string]any{
+		"Program":  program,
+		"FuncName": "_" + strings.NewReplacer("-", "_", ".", "_").Replace(program),
+		"Commands": commands,
+		"Topics":   strings.Join(topics, " "),
+		"Flags":    strings.Join(flags, " "),
+		"Shells":   strings.Join(completionShells(), " "),
+	})
+}
+
+func completionShells() []string {
+	return []string{"bash", "zsh", "fish"}
+}
+
+var completionTemplates = map[string]string{
+	"bash": `# bash completion for {{.Program}}
+{{.FuncName}}() {
+	local cur="${COMP_WORDS[COMP_CWORD]}"
+	if [ "$COMP_CWORD" -eq 1 ]; then
+		COMPREPLY=($(compgen -W "{{range .Commands}}{{.Name}} {{end}}{{.Flags}}" -- "$cur"))
+		return
+	fi
+	case "${COMP_WORDS[1]}" in
+	help)
+		COMPREPLY=($(compgen -W "{{.Topics}}" -- "$cur"))
+		;;
+	completion)
+		COMPREPLY=($(compgen -W "{{.Shells}}" -- "$cur"))
+		;;
+	esac
+}
+complete -F {{.FuncName}} {{.Program}}
+`,
+	"zsh": `#compdef {{.Program}}
+{{.FuncName}}() {
+	local -a commands
+	commands=(
+{{- range .Commands}}
+		'{{.Name}}:{{.Doc}}'
+{{- end}}
+	)
+	if (( CURRENT == 2 )); then
+		_describe 'command' commands
+		compadd -- {{.Flags}}
+		return
+	fi
+	case "${words[2]}" in
+	help)
+		compadd -- {{.Topics}}
+		;;
+	completion)
+		compadd -- {{.Shells}}
+		;;
+	esac
+}
+compdef {{.FuncName}} {{.Program}}
+`,
+	"fish": `# fish completion for {{.Program}}
+{{- range .Commands}}
+complete -c {{$.Program}} -f -n '__fish_use_subcommand' -a '{{.Name}}' -d '{{.Doc}}'
+{{- end}}
+complete -c {{.Program}} -f -n '__fish_seen_subcommand_from help' -a '{{.Topics}}'
+complete -c {{.Program}} -f -n '__fish_seen_subcommand_from completion' -a '{{.Shells}}'
+`,
+}
@@ -0,0 +1,128 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// i18nBundle NameEN, NameJAのような言語ごとのフィールドの組
+type i18nBundle struct {
+	StructName string
+	Name       string // 言語の接尾辞を除いたフィールド名
+	Langs      []*i18nLang
+	Strings    string
+	Hooks      []string
+	Touch      string // //gen:setters touchの構造体で、SetXがUpdatedAtに入れる時刻の式
+}
+
+type i18nLang struct {
+	Code      string // 接尾辞の言語コード（EN）
+	FieldName string
+}
+
+// newI18nBundles langs=EN,JAの接尾辞を持つstringのフィールドを、接尾辞を除いた名前ごとにまとめる
+func newI18nBundles(r *renderer, target *directiveTarget) ([]*i18nBundle, error) {
+	structName := target.s.name()
+	langs, _ := target.d.arg("langs")
+	if langs == "" {
+		return nil, fmt.Errorf("%s: //gen:i18n requires langs=EN,JA,...", structName)
+	}
+	var bundles []*i18nBundle
+	byName := make(map[string]*i18nBundle)
+	for _, field := range target.s.structType().Fields.List {
+		ident, ok := field.Type.(*ast.Ident)
+		if !ok || ident.Name != "string" {
+			continue
+		}
+		for _, name := range field.Names {
+			for _, code := range strings.Split(langs, ",") {
+				base, ok := strings.CutSuffix(name.Name, code)
+				if !ok || base == "" {
+					continue
+				}
+				b, ok := byName[base]
+				if !ok {
+					b = &i18nBundle{StructName: structName, Name: base}
+					byName[base] = b
+					bundles = append(bundles, b)
+				}
+				b.Langs = append(b.Langs, &i18nLang{Code: code, FieldName: name.Name})
+				break
+			}
+		}
+	}
+	// 組になっていない（言語が1つしかない）ものは対象外
+	var paired []*i18nBundle
+	for _, b := range bundles {
+		if len(b.Langs) < 2 {
+			continue
+		}
+		if hasField(target.s.structType(), b.Name) {
+			return nil, fmt.Errorf("%s: //gen:i18n cannot generate %s() because a field of that name exists", structName, b.Name)
+		}
+		b.Strings = r.importName("strings")
+		var fieldNames []string
+		for _, l := range b.Langs {
+			fieldNames = append(fieldNames, l.FieldName)
+		}
+		if b.Touch = setterTouch(r, target.s); b.Touch != "" {
+			fieldNames = append(fieldNames, "UpdatedAt")
+		}
+		b.Hooks = r.fieldHooks(structName, fieldNames...)
+		paired = append(paired, b)
+	}
+	return paired, nil
+}
+
+func renderI18n(r *renderer, targets []*directiveTarget) error {
+	var bundles []*i18nBundle
+	for _, target := range targets {
+		b, err := newI18nBundles(r, target)
+		if err != nil {
+			return err
+		}
+		bundles = append(bundles, b...)
+	}
+	if len(bundles) == 0 {
+		return nil
+	}
+	return r.execute("i18n", i18nTemplate, bundles)
+}
+
+const i18nTemplate = `
+{{range .}}
+{{- $b := .}}
+// {{.Name}} returns the value for lang (case-insensitive, e.g. "{{(index .Langs 0).Code}}"),
+// falling back to {{(index .Langs 0).Code}} for unknown languages.
+func (s *{{recv .StructName}}) {{.Name}}(lang string) string {
+	switch {
+	{{- range .Langs}}
+	case {{$b.Strings}}.EqualFold(lang, "{{.Code}}"):
+		return s.{{.FieldName}}
+	{{- end}}
+	}
+	return s.{{(index .Langs 0).FieldName}}
+}
+
+// Set{{.Name}} sets the value for lang and reports whether lang is supported.
+func (s *{{recv .StructName}}) Set{{.Name}}(lang, value string) bool {
+	switch {
+	{{- range .Langs}}
+	case {{$b.Strings}}.EqualFold(lang, "{{.Code}}"):
+		s.{{.FieldName}} = value
+	{{- end}}
+	default:
+		return false
+	}
+	{{- if .Touch}}
+	s.UpdatedAt = {{.Touch}}
+	{{- end}}
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+	{{- checkPanic .StructName}}
+	return true
+}
+{{end}}
+`
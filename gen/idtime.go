@@ -0,0 +1,123 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// idTimeType 作成日時を含む識別子の型と、そこから時刻を取り出す方法
+type idTimeType struct {
+	pkg       string // import path
+	name      string // 型名
+	kind      string // ドキュメントに書く名前
+	extract   string // %[1]sが型のパッケージ名、%[2]sが値になる、time.Timeを返す式
+	precision string // 識別子に含まれる時刻の精度（timeパッケージの定数名）
+}
+
+// idTimeTypes 時刻を取り出せる識別子の型
+var idTimeTypes = []*idTimeType{
+	{pkg: "github.com/oklog/ulid/v2", name: "ULID", kind: "ULID", extract: "%[1]s.Time(%[2]s.Time())", precision: "Millisecond"},
+	{pkg: "github.com/oklog/ulid", name: "ULID", kind: "ULID", extract: "%[1]s.Time(%[2]s.Time())", precision: "Millisecond"},
+	{pkg: "github.com/segmentio/ksuid", name: "KSUID", kind: "KSUID", extract: "%[2]s.Time()", precision: "Second"},
+}
+
+// idTime //gen:idtimeで生成する、識別子から作成日時を取り出すメソッド
+type idTime struct {
+	StructName string
+	FieldName  string
+	Kind       string
+	Extract    string
+	Precision  string
+	Validate   bool // CreatedAtがtime.Timeなら、識別子の時刻と一致するかを確認するメソッドも生成する
+	Time       string
+	Fmt        string
+}
+
+// lookupIDTimeType フィールドの型が時刻を含む識別子の型なら、その型とパッケージを参照している名前を返す
+func lookupIDTimeType(r *renderer, expr ast.Expr) (*idTimeType, string) {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return nil, ""
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return nil, ""
+	}
+	imp, ok := r.importsMap[x.Name]
+	if !ok {
+		return nil, ""
+	}
+	for _, t := range idTimeTypes {
+		if t.pkg == imp.pkg && t.name == sel.Sel.Name {
+			return t, x.Name
+		}
+	}
+	return nil, ""
+}
+
+func newIDTime(r *renderer, target *directiveTarget) (*idTime, error) {
+	structName := target.s.name()
+	fieldName := "ID"
+	if v, ok := target.d.arg("field"); ok {
+		fieldName = v
+	}
+	field := findField(target.s.structType(), fieldName)
+	if field == nil {
+		return nil, fmt.Errorf("%s: //gen:idtime field %s does not exist", structName, fieldName)
+	}
+	t, qualifier := lookupIDTimeType(r, field.Type)
+	if t == nil {
+		kinds := make([]string, 0, len(idTimeTypes))
+		for _, t := range idTimeTypes {
+			kinds = append(kinds, t.pkg+"."+t.name)
+		}
+		return nil, fmt.Errorf("%s: //gen:idtime field %s must be one of %s", structName, fieldName, strings.Join(kinds, ", "))
+	}
+	r.importsMap[qualifier].used = true
+	i := &idTime{
+		StructName: structName,
+		FieldName:  fieldName,
+		Kind:       t.kind,
+		Extract:    fmt.Sprintf(t.extract, qualifier, "s."+fieldName),
+		Precision:  t.precision,
+		Time:       r.importName("time"),
+	}
+	if timeFieldQualifier(target.s.structType(), "CreatedAt", r.importsMap) != "" {
+		i.Validate = true
+		i.Fmt = r.importName("fmt")
+	}
+	return i, nil
+}
+
+// renderIDTime ULIDやKSUIDの識別子から作成日時を取り出すCreatedAtFromIDと、CreatedAtと一致するかを確認するValidateCreatedAtIDを生成する
+func renderIDTime(r *renderer, targets []*directiveTarget) error {
+	all := make([]*idTime, 0, len(targets))
+	for _, target := range targets {
+		i, err := newIDTime(r, target)
+		if err != nil {
+			return err
+		}
+		all = append(all, i)
+	}
+	return r.execute("idtime", idTimeTemplate, all)
+}
+
+const idTimeTemplate = `
+{{range .}}
+// CreatedAtFromID returns the creation time encoded in the {{.Kind}} {{.FieldName}}.
+func (s *{{.StructName}}) CreatedAtFromID() {{.Time}}.Time {
+	return {{.Extract}}
+}
+{{if .Validate}}
+// ValidateCreatedAtID returns an error when CreatedAt, truncated to {{.Time}}.{{.Precision}}
+// like the {{.Kind}}, differs from the time encoded in {{.FieldName}}.
+func (s *{{.StructName}}) ValidateCreatedAtID() error {
+	if fromID := s.CreatedAtFromID(); !s.CreatedAt.Truncate({{.Time}}.{{.Precision}}).Equal(fromID) {
+		return {{.Fmt}}.Errorf("{{.StructName}}: CreatedAt %s does not match %s encoded in {{.FieldName}}", s.CreatedAt, fromID)
+	}
+	return nil
+}
+{{end}}
+{{- end}}
+`
@@ -0,0 +1,172 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var reportBuildImpact = commandLine.Bool("build-impact", false, "time go build of the packages whose generated code changed, before and after writing it")
+
+// buildImpact 生成の前後で、変更のあるパッケージのgo buildにかかる時間を測る。
+// 依存パッケージを一時的なGOCACHEにビルドしておき、対象のパッケージだけがコンパイルされるようにする
+type buildImpact struct {
+	cache  string
+	pkgs   []string // ./a/bのような作業ディレクトリからの相対パス
+	before map[string]buildTiming
+	after  map[string]buildTiming
+}
+
+type buildTiming struct {
+	elapsed time.Duration
+	err     error
+}
+
+// changedPackageDirs 生成したコードがディスク上のファイルと違うパッケージのディレクトリ
+func changedPackageDirs(generated []*generatedFile) []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, g := range generated {
+		if current, err := os.ReadFile(g.path); err == nil && bytes.Equal(current, g.src) {
+			continue
+		}
+		if dir := g.dir(); !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// newBuildImpact 依存パッケージをビルドしてから、生成前の対象パッケージのビルド時間を測る
+func newBuildImpact(wd string, dirs []string) (*buildImpact, error) {
+	b := &buildImpact{before: make(map[string]buildTiming), after: make(map[string]buildTiming)}
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(wd, dir)
+		if err != nil {
+			return nil, err
+		}
+		if rel == "." {
+			b.pkgs = append(b.pkgs, ".")
+			continue
+		}
+		b.pkgs = append(b.pkgs, "./"+filepath.ToSlash(rel))
+	}
+	if len(b.pkgs) == 0 {
+		return b, nil
+	}
+	cache, err := os.MkdirTemp("", "gen-struct-build-impact")
+	if err != nil {
+		return nil, err
+	}
+	b.cache = cache
+	if err := b.warm(); err != nil {
+		b.close()
+		return nil, err
+	}
+	b.measure(b.before)
+	return b, nil
+}
+
+// warm 対象のパッケージ以外の依存をキャッシュにビルドしておく
+func (b *buildImpact) warm() error {
+	targets, err := b.goList(append([]string{"-f", "{{.ImportPath}}"}, b.pkgs...)...)
+	if err != nil {
+		return err
+	}
+	deps, err := b.goList(append([]string{"-deps", "-f", "{{.ImportPath}}"}, b.pkgs...)...)
+	if err != nil {
+		return err
+	}
+	var warm []string
+	for _, dep := range deps {
+		if !containsTargetField(dep, targets...) {
+			warm = append(warm, dep)
+		}
+	}
+	if len(warm) == 0 {
+		return nil
+	}
+	if out, err := b.goCommand(append([]string{"build"}, warm...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("building dependencies: %w\n%s", err, out)
+	}
+	return nil
+}
+
+func (b *buildImpact) goList(args ...string) ([]string, error) {
+	out, err := b.goCommand(append([]string{"list"}, args...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %w", err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+func (b *buildImpact) goCommand(args ...string) *exec.Cmd {
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(os.Environ(), "GOCACHE="+b.cache)
+	return cmd
+}
+
+// measure パッケージを1つずつビルドして時間を記録する
+func (b *buildImpact) measure(timings map[string]buildTiming) {
+	for _, pkg := range b.pkgs {
+		start := time.Now()
+		out, err := b.goCommand("build", pkg).CombinedOutput()
+		if err != nil {
+			err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+		}
+		timings[pkg] = buildTiming{elapsed: time.Since(start), err: err}
+	}
+}
+
+// finish 生成後のビルド時間を測って差分を出力する
+func (b *buildImpact) finish(w io.Writer) error {
+	if len(b.pkgs) == 0 {
+		_, err := fmt.Fprintln(w, "build impact: no package has changed generated code")
+		return err
+	}
+	defer b.close()
+	b.measure(b.after)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tBEFORE\tAFTER\tDELTA")
+	var total time.Duration
+	for _, pkg := range b.pkgs {
+		before, after := b.before[pkg], b.after[pkg]
+		if before.err != nil || after.err != nil {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t-\n", pkg, before.String(), after.String())
+			continue
+		}
+		delta := after.elapsed - before.elapsed
+		total += delta
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%+.2fs\n", pkg, before.String(), after.String(), delta.Seconds())
+	}
+	fmt.Fprintf(tw, "total\t\t\t%+.2fs\n", total.Seconds())
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, pkg := range b.pkgs {
+		if err := b.after[pkg].err; err != nil {
+			fmt.Fprintf(w, "%s: build failed after generation: %v\n", pkg, err)
+		}
+	}
+	return nil
+}
+
+func (t buildTiming) String() string {
+	if t.err != nil {
+		return "failed"
+	}
+	return fmt.Sprintf("%.2fs", t.elapsed.Seconds())
+}
+
+func (b *buildImpact) close() {
+	os.RemoveAll(b.cache)
+}
@@ -0,0 +1,130 @@
+package gen
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// importNameResolver import pathから実際のパッケージ名を解決する。
+// ディレクトリ名とパッケージ名が違うもの（github.com/goccy/go-yaml → yamlなど）があるので、
+// go/packagesでパッケージを読んで調べ、結果はキャッシュする
+type importNameResolver struct {
+	mu        sync.Mutex
+	names     map[string]string // key: import path, value: パッケージ名
+	overrides map[string]string // -import-nameで指定されたもの。解決より優先する
+}
+
+func newImportNameResolver() *importNameResolver {
+	return &importNameResolver{
+		names:     make(map[string]string),
+		overrides: make(map[string]string),
+	}
+}
+
+var importNames = newImportNameResolver()
+
+// setOverride -import-name path=nameの値を登録する
+func (r *importNameResolver) setOverride(value string) error {
+	importPath, name, ok := strings.Cut(value, "=")
+	if !ok || importPath == "" || name == "" {
+		return fmt.Errorf("invalid -import-name %q (want path=name)", value)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.overrides[importPath] = name
+	return nil
+}
+
+// resolve dirのモジュールの文脈でimport pathのパッケージ名を解決する
+func (r *importNameResolver) resolve(dir string, importPaths []string) map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unresolved []string
+	for _, importPath := range importPaths {
+		if _, ok := r.overrides[importPath]; ok {
+			continue
+		}
+		if _, ok := r.names[importPath]; !ok {
+			unresolved = append(unresolved, importPath)
+		}
+	}
+	if len(unresolved) > 0 {
+		cfg := &packages.Config{Mode: packages.NeedName, Dir: dir}
+		// 読めないパッケージがあってもエラーにはせず、パスから推測する
+		pkgs, _ := packages.Load(cfg, unresolved...)
+		for _, pkg := range pkgs {
+			if pkg.Name != "" && len(pkg.Errors) == 0 {
+				r.names[pkg.PkgPath] = pkg.Name
+			}
+		}
+		for _, importPath := range unresolved {
+			if _, ok := r.names[importPath]; !ok {
+				r.names[importPath] = guessImportName(importPath)
+			}
+		}
+	}
+	names := make(map[string]string, len(importPaths))
+	for _, importPath := range importPaths {
+		if name, ok := r.overrides[importPath]; ok {
+			names[importPath] = name
+			continue
+		}
+		names[importPath] = r.names[importPath]
+	}
+	return names
+}
+
+// resolveFS fsysがnilならresolveと同じ。そうでなければ（ParseFSで読んだパッケージ）go/packagesで読めないので、
+// -import-nameの指定がなければimport pathから推測する
+func (r *importNameResolver) resolveFS(fsys fs.FS, dir string, importPaths []string) map[string]string {
+	if fsys == nil {
+		return r.resolve(dir, importPaths)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make(map[string]string, len(importPaths))
+	for _, importPath := range importPaths {
+		if name, ok := r.overrides[importPath]; ok {
+			names[importPath] = name
+			continue
+		}
+		// 生成したファイルをまとめるときにgo/packagesで読み直さないよう、解決済みとして記録する
+		if _, ok := r.names[importPath]; !ok {
+			r.names[importPath] = guessImportName(importPath)
+		}
+		names[importPath] = r.names[importPath]
+	}
+	return names
+}
+
+// guessImportName パッケージを読めなかったときにimport pathからパッケージ名を推測する。
+// goimportsと同じく、メジャーバージョンの要素や.v3のような接尾辞、go-の接頭辞を取り除く
+func guessImportName(importPath string) string {
+	base := path.Base(importPath)
+	if isMajorVersionSuffix(base) {
+		base = path.Base(path.Dir(importPath))
+	}
+	if i := strings.Index(base, ".v"); i > 0 {
+		base = base[:i]
+	}
+	base = strings.TrimPrefix(base, "go-")
+	base = strings.TrimSuffix(base, "-go")
+	return strings.NewReplacer("-", "", ".", "").Replace(base)
+}
+
+func isMajorVersionSuffix(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	for _, c := range s[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package gen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var indexCache = commandLine.Bool("index-cache", true, "remember which source files had no //gen: directives and skip reading them while they are unchanged")
+
+// directiveIndexVersion 索引のファイルの形式。形を変えたら上げる
+const directiveIndexVersion = 2
+
+// indexMtimeSlack 更新日時がこれより新しいファイルは記録しない。
+// 記録した直後に同じ時刻のまま書き換えられると、変更に気づけない
+const indexMtimeSlack = 2 * time.Second
+
+// directiveIndex 前回ディレクティブのなかったファイルの索引。
+// サイズと更新日時が変わっていなければ、ファイルを読まずに生成の対象から外す。
+// 更新日時が秒より細かく記録されていないファイルは、同じ秒のうちの書き換えを見分けられないので内容のハッシュも比べる
+type directiveIndex struct {
+	path string // 索引を保存するファイル
+	mu   sync.Mutex
+	// files key: ソースファイルの絶対パス
+	files map[string]indexEntry
+	// seen 今回見たファイル。削除されたファイルの分は保存しない
+	seen map[string]indexEntry
+}
+
+type indexEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+	SHA256  string `json:"sha256"` // 記録したときの内容のハッシュ
+}
+
+// coarseModTime 更新日時が秒より細かく記録されていないか。
+// 精度の粗いファイルシステムや、更新日時を秒単位で戻すアーカイブの展開では、サイズと更新日時だけでは変更を見逃す
+func coarseModTime(t time.Time) bool {
+	return t.Nanosecond() == 0
+}
+
+// contentHash ファイルの内容のハッシュ
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+type indexFile struct {
+	Version int                   `json:"version"`
+	Files   map[string]indexEntry `json:"files"`
+}
+
+// loadDirectiveIndex dirの索引をユーザーのキャッシュディレクトリから読む。
+// 読めなければ空の索引にし、キャッシュディレクトリがなければnilを返す
+func loadDirectiveIndex(dir string) *directiveIndex {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(dir))
+	x := &directiveIndex{
+		path:  filepath.Join(cacheDir, "go-gen-struct", "index", hex.EncodeToString(sum[:8])+".json"),
+		files: make(map[string]indexEntry),
+		seen:  make(map[string]indexEntry),
+	}
+	data, err := os.ReadFile(x.path)
+	if err != nil {
+		return x
+	}
+	var f indexFile
+	// 壊れているか形式が古ければ作り直す
+	if json.Unmarshal(data, &f) == nil && f.Version == directiveIndexVersion && f.Files != nil {
+		x.files = f.Files
+	}
+	return x
+}
+
+// unannotated 前回ディレクティブがなく、それから変わっていないファイルか
+func (x *directiveIndex) unannotated(file string) bool {
+	if x == nil {
+		return false
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return false
+	}
+	x.mu.Lock()
+	cached, ok := x.files[file]
+	x.mu.Unlock()
+	if !ok || cached.Size != info.Size() || cached.ModTime != info.ModTime().UnixNano() {
+		return false
+	}
+	if coarseModTime(info.ModTime()) {
+		content, err := os.ReadFile(file)
+		if err != nil || contentHash(content) != cached.SHA256 {
+			return false
+		}
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.seen[file] = cached
+	return true
+}
+
+// recordUnannotated 読んだ結果ディレクティブがなかったファイルを、読んだ内容のハッシュとともに記録する
+func (x *directiveIndex) recordUnannotated(file string, content []byte) {
+	if x == nil {
+		return
+	}
+	info, err := os.Stat(file)
+	// 読んでから書き換えられていれば、記録する更新日時と内容が合わない
+	if err != nil || info.Size() != int64(len(content)) || time.Since(info.ModTime()) < indexMtimeSlack {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.seen[file] = indexEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano(), SHA256: contentHash(content)}
+}
+
+// save 今回見たファイルの分だけ保存する。変わっていなければ書かない
+func (x *directiveIndex) save() error {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if maps.Equal(x.files, x.seen) {
+		return nil
+	}
+	data, err := json.Marshal(&indexFile{Version: directiveIndexVersion, Files: x.seen})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(x.path), 0o755); err != nil {
+		return err
+	}
+	// 並行して実行した他のプロセスが途中まで書いたファイルを読まないよう、書いてから置き換える
+	tmp, err := os.CreateTemp(filepath.Dir(x.path), "index-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), x.path)
+}
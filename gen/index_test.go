@@ -0,0 +1,36 @@
+package gen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 更新日時が秒単位のファイルは、同じサイズで書き換えて更新日時を戻しても索引から外れる
+func TestDirectiveIndexCoarseModTime(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "model.go")
+	before := []byte("package p\n\ntype A struct{}\n")
+	after := []byte("package p\n\ntype B struct{}\n")
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	write := func(content []byte) {
+		t.Helper()
+		if err := os.WriteFile(file, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(before)
+	x := &directiveIndex{files: make(map[string]indexEntry), seen: make(map[string]indexEntry)}
+	x.recordUnannotated(file, before)
+	x.files, x.seen = x.seen, make(map[string]indexEntry)
+	if !x.unannotated(file) {
+		t.Fatal("unchanged file is not skipped")
+	}
+	write(after)
+	if x.unannotated(file) {
+		t.Error("file rewritten with the same size and modification time is skipped")
+	}
+}
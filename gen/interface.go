@@ -0,0 +1,223 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// interfaceGenerators //gen:interfaceが既定でメソッドを集めるコード生成
+var interfaceGenerators = []string{"setters", "getters"}
+
+// generatedMethod これまでのコード生成が生成した、構造体のエクスポートされたメソッド
+type generatedMethod struct {
+	generator string
+	recv      string // レシーバの型名
+	name      string
+	typ       *ast.FuncType
+	signature string // SetName(v string)
+}
+
+// recordMethods コード生成generatorが本文に追加したsrcのメソッドを記録する。
+// //gen:interfaceは登録されている最後のコード生成なので、他のコード生成が全て記録した後に呼ばれる
+func (r *renderer) recordMethods(generator string, src []byte) {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, "", append([]byte("package p\n"), src...), 0)
+	if err != nil {
+		// 生成したコードの誤りは整形するときに報告される
+		return
+	}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || !fn.Name.IsExported() {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := printer.Fprint(&buf, fileSet, fn.Type); err != nil {
+			continue
+		}
+		r.methods = append(r.methods, &generatedMethod{
+			generator: generator,
+			recv:      receiverTypeName(fn),
+			name:      fn.Name.Name,
+			typ:       fn.Type,
+			signature: fn.Name.Name + strings.TrimPrefix(buf.String(), "func"),
+		})
+	}
+}
+
+// accessorInterface //gen:interfaceで生成するインターフェース
+type accessorInterface struct {
+	StructName string
+	Name       string
+	Methods    []string
+}
+
+func newAccessorInterface(r *renderer, target *directiveTarget) (*accessorInterface, error) {
+	structName := target.s.name()
+	i := &accessorInterface{StructName: structName}
+	generatorNames := interfaceGenerators
+	handwritten := false
+	for _, arg := range target.d.args {
+		switch {
+		case arg.key == "methods" && arg.value == "":
+			handwritten = true
+		case arg.key == "all" && arg.value == "":
+			generatorNames = nil
+		case arg.value == "" && token.IsIdentifier(arg.key) && i.Name == "":
+			i.Name = arg.key
+		default:
+			return nil, fmt.Errorf("%s: unknown //gen:interface argument %s", structName, arg.key)
+		}
+	}
+	if i.Name == "" {
+		i.Name = exportedName(structName) + "Accessor"
+		if !ast.IsExported(structName) {
+			i.Name = unexportedName(i.Name)
+		}
+		i.Name = r.ident(i.Name)
+	}
+	seen := make(map[string]bool)
+	for _, m := range r.methods {
+		if m.recv != structName || generatorNames != nil && !containsTargetField(m.generator, generatorNames...) || seen[m.name] {
+			continue
+		}
+		seen[m.name] = true
+		markUsedImports(m.typ, r.importsMap)
+		i.Methods = append(i.Methods, m.signature)
+	}
+	if handwritten {
+		methods, err := handwrittenMethods(r, structName)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range methods {
+			if !seen[m.name] {
+				seen[m.name] = true
+				i.Methods = append(i.Methods, m.signature)
+			}
+		}
+	}
+	if len(i.Methods) == 0 {
+		return nil, fmt.Errorf("%s: //gen:interface found no generated setters or getters; add methods or all", structName)
+	}
+	sort.Strings(i.Methods)
+	return i, nil
+}
+
+// handwrittenMethods 生成したファイル以外で宣言された、構造体のエクスポートされたメソッド。
+// 型は型情報から生成するファイルのimportで書き直す
+func handwrittenMethods(r *renderer, structName string) ([]*generatedMethod, error) {
+	names, err := declaredMethodNames(r.t.fsys, r.t.path, r.t.packageName, structName)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	pkg, err := r.t.loadTypes()
+	if err != nil {
+		return nil, err
+	}
+	named, _, err := lookupNamedStruct(pkg, structName)
+	if err != nil {
+		return nil, err
+	}
+	var methods []*generatedMethod
+	for i := range named.NumMethods() {
+		fn := named.Method(i)
+		if !names[fn.Name()] {
+			continue
+		}
+		sig := fn.Type().(*types.Signature)
+		methods = append(methods, &generatedMethod{
+			recv:      structName,
+			name:      fn.Name(),
+			signature: fn.Name() + signatureString(r, pkg, sig),
+		})
+	}
+	return methods, nil
+}
+
+// signatureString func(a int) errorのfuncを除いた部分
+func signatureString(r *renderer, pkg *types.Package, sig *types.Signature) string {
+	tuple := func(t *types.Tuple, variadic bool) string {
+		parts := make([]string, t.Len())
+		for i := range t.Len() {
+			v := t.At(i)
+			typ := qualifiedTypeString(r, pkg, v.Type())
+			if variadic && i == t.Len()-1 {
+				typ = "..." + qualifiedTypeString(r, pkg, v.Type().(*types.Slice).Elem())
+			}
+			parts[i] = strings.TrimSpace(v.Name() + " " + typ)
+		}
+		return strings.Join(parts, ", ")
+	}
+	s := "(" + tuple(sig.Params(), sig.Variadic()) + ")"
+	switch results := sig.Results(); {
+	case results.Len() == 1 && results.At(0).Name() == "":
+		s += " " + tuple(results, false)
+	case results.Len() > 0:
+		s += " (" + tuple(results, false) + ")"
+	}
+	return s
+}
+
+// declaredMethodNames パッケージの生成したファイルとテスト以外で宣言された、構造体のエクスポートされたメソッドの名前
+func declaredMethodNames(fsys fs.FS, dir, packageName, structName string) (map[string]bool, error) {
+	sources, err := packageSources(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, source := range sources {
+		file, err := parser.ParseFile(token.NewFileSet(), source.path, source.src, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil || file.Name.Name != packageName || ast.IsGenerated(file) {
+			continue
+		}
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv != nil && fn.Name.IsExported() && receiverTypeName(fn) == structName {
+				names[fn.Name.Name] = true
+			}
+		}
+	}
+	return names, nil
+}
+
+// renderInterface 構造体の生成したsetterとgetter（methodsなら手で書いたメソッドも）を集めたインターフェースを生成する
+func renderInterface(r *renderer, targets []*directiveTarget) error {
+	all := make([]*accessorInterface, 0, len(targets))
+	seen := make(map[string]string)
+	for _, target := range targets {
+		i, err := newAccessorInterface(r, target)
+		if err != nil {
+			return err
+		}
+		if other, ok := seen[i.Name]; ok {
+			return fmt.Errorf("%s: //gen:interface %s is also generated for %s", i.StructName, i.Name, other)
+		}
+		seen[i.Name] = i.StructName
+		all = append(all, i)
+	}
+	return r.execute("interface", interfaceTemplate, all)
+}
+
+const interfaceTemplate = `
+{{range .}}
+// {{.Name}} is implemented by *{{.StructName}}. Use it to mock {{.StructName}} in tests.
+type {{.Name}} interface {
+{{- range .Methods}}
+	{{.}}
+{{- end}}
+}
+
+var _ {{.Name}} = (*{{.StructName}})(nil)
+{{- end}}
+`
@@ -0,0 +1,20 @@
+package gen
+
+import "fmt"
+
+// prepareInvariants //gen:invariantsのついた構造体で、生成するメソッドの最後にinvariants()を呼ぶようにする。
+// mode=panic（デフォルト）ならシグネチャを変えずにpanicし、mode=errorなら戻り値のないメソッドもerrorを返す
+func prepareInvariants(r *renderer, targets []*directiveTarget) error {
+	for _, target := range targets {
+		mode, _ := target.d.arg("mode")
+		switch mode {
+		case "":
+			mode = "panic"
+		case "panic", "error":
+		default:
+			return fmt.Errorf("%s: //gen:invariants mode must be panic or error, got %q", target.s.name(), mode)
+		}
+		r.invariants[target.s.name()] = mode
+	}
+	return nil
+}
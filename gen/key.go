@@ -0,0 +1,59 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+)
+
+// compositeKey gen:"key"のついた複数のフィールドからなる複合キー
+type compositeKey struct {
+	StructName string
+	KeyName    string // ExampleKey
+	MapName    string // ExampleKeyMap
+	NewMap     string // NewExampleKeyMap
+	Fields     []*keyField
+}
+
+type keyField struct {
+	FieldName string
+	FieldType string
+}
+
+// newCompositeKey gen:"key"のフィールドが2つ以上あれば複合キーを作る。1つ以下ならnilを返す
+func newCompositeKey(r *renderer, s *targetStruct) (*compositeKey, error) {
+	structName := s.name()
+	k := &compositeKey{StructName: structName}
+	for _, field := range s.structType().Fields.List {
+		if !parseGenTag(field).has("key") {
+			continue
+		}
+		// mapのキーにするので比較できない型は使えない
+		switch t := field.Type.(type) {
+		case *ast.MapType, *ast.FuncType:
+			return nil, fmt.Errorf("%s: gen:\"key\" field of type %s is not comparable", structName, getFiledTypeString(field.Type))
+		case *ast.ArrayType:
+			if t.Len == nil {
+				return nil, fmt.Errorf("%s: gen:\"key\" field of type %s is not comparable", structName, getFiledTypeString(field.Type))
+			}
+		}
+		for _, name := range field.Names {
+			k.Fields = append(k.Fields, &keyField{FieldName: name.Name, FieldType: r.typeString(field.Type)})
+		}
+	}
+	if len(k.Fields) < 2 {
+		return nil, nil
+	}
+	if s.spec.TypeParams != nil {
+		return nil, fmt.Errorf("%s: gen:\"key\" is not supported on structs with type parameters", structName)
+	}
+	if hasField(s.structType(), "Key") {
+		return nil, fmt.Errorf("%s: gen:\"key\" generates Key(), which conflicts with the field Key", structName)
+	}
+	name := exportedName(structName)
+	k.KeyName, k.MapName, k.NewMap = name+"Key", name+"KeyMap", "New"+name+"KeyMap"
+	if !ast.IsExported(structName) {
+		k.KeyName, k.MapName, k.NewMap = unexportedName(k.KeyName), unexportedName(k.MapName), unexportedName(k.NewMap)
+	}
+	k.KeyName, k.MapName, k.NewMap = r.ident(k.KeyName), r.ident(k.MapName), r.ident(k.NewMap)
+	return k, nil
+}
@@ -0,0 +1,60 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// lazyField gen:"lazy=initClient"のついたフィールドを、最初に参照したときに一度だけ初期化するgetter
+type lazyField struct {
+	StructName  string
+	FieldName   string
+	FieldType   string
+	MethodName  string // client → Client。エクスポートされたフィールドはGetClient
+	Once        string // sync.Onceのフィールド（clientOnce）
+	Initializer string // 初期化するメソッド。func (s *T) initClient() *Client
+}
+
+// newLazyField gen:"lazy=..."のフィールドのgetterを作る。
+// 構造体にフィールドを足すことはできないので、sync.OnceのclientOnceフィールドは利用者が宣言する
+func newLazyField(r *renderer, s *targetStruct, field *ast.Field, fieldName, initializer string) (*lazyField, error) {
+	structName := s.name()
+	structType := s.structType()
+	if !token.IsIdentifier(initializer) {
+		return nil, fmt.Errorf("%s.%s: gen:\"lazy\" requires the initializer method such as gen:\"lazy=init%s\"", structName, fieldName, exportedName(fieldName))
+	}
+	l := &lazyField{
+		StructName:  structName,
+		FieldName:   fieldName,
+		FieldType:   r.typeString(field.Type),
+		MethodName:  exportedName(fieldName),
+		Once:        fieldName + "Once",
+		Initializer: initializer,
+	}
+	if l.MethodName == fieldName {
+		l.MethodName = "Get" + l.MethodName
+	}
+	if hasField(structType, l.MethodName) {
+		return nil, fmt.Errorf("%s.%s: gen:\"lazy\" cannot generate %s() because a field of that name exists", structName, fieldName, l.MethodName)
+	}
+	once := findField(structType, l.Once)
+	if once == nil || !isSyncOnce(once.Type, r.importsMap) {
+		return nil, fmt.Errorf("%s.%s: gen:\"lazy\" requires a field %s sync.Once", structName, fieldName, l.Once)
+	}
+	return l, nil
+}
+
+// isSyncOnce 型がsync.Onceか
+func isSyncOnce(expr ast.Expr, importsMap map[string]*usedImport) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Once" {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	imp, ok := importsMap[x.Name]
+	return ok && imp.pkg == "sync"
+}
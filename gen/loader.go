@@ -0,0 +1,180 @@
+package gen
+
+import (
+	"go/ast"
+	"go/types"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+const loadMode = packages.NeedName |
+	packages.NeedFiles |
+	packages.NeedSyntax |
+	packages.NeedImports |
+	packages.NeedDeps |
+	packages.NeedTypes |
+	packages.NeedTypesInfo
+
+// loadPackages dir配下の全パッケージを型情報つきで読み込む
+func loadPackages(dir string) ([]*packages.Package, error) {
+	cfg := &packages.Config{
+		Mode: loadMode,
+		Dir:  dir,
+	}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		// 型エラーがあっても解析できた範囲は使いたいのでログだけ出す
+		for _, e := range pkg.Errors {
+			log.Println(e.Error())
+		}
+	}
+	return pkgs, nil
+}
+
+// annotatedStruct ディレクティブがついた構造体とその型情報
+type annotatedStruct struct {
+	pkg       *packages.Package
+	spec      *ast.TypeSpec
+	obj       *types.TypeName
+	directive *directive
+}
+
+// findAnnotatedStructs パッケージ内でdirectiveがついた構造体を探す
+func findAnnotatedStructs(pkg *packages.Package, directive string) []*annotatedStruct {
+	var structs []*annotatedStruct
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			annotated, _ := annotatedStructs(decl)
+			for _, s := range annotated {
+				d := s.directive(strings.TrimPrefix(directive, directivePrefix))
+				if d == nil {
+					continue
+				}
+				obj, ok := pkg.TypesInfo.Defs[s.spec.Name].(*types.TypeName)
+				if !ok {
+					continue
+				}
+				structs = append(structs, &annotatedStruct{pkg: pkg, spec: s.spec, obj: obj, directive: d})
+			}
+		}
+	}
+	return structs
+}
+
+// structFields 構造体のフィールド一覧（型情報）を返す
+func (a *annotatedStruct) structFields() []*types.Var {
+	st, ok := a.obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		return nil
+	}
+	fields := make([]*types.Var, 0, st.NumFields())
+	for i := 0; i < st.NumFields(); i++ {
+		fields = append(fields, st.Field(i))
+	}
+	return fields
+}
+
+// fieldTag フィールドのgen:"..."タグ
+func (a *annotatedStruct) fieldTag(field *types.Var) genTag {
+	st, ok := a.obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		return genTag{}
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		if st.Field(i) == field {
+			return parseStructTag(st.Tag(i))
+		}
+	}
+	return genTag{}
+}
+
+// isSetterField //gen:settersでSetXが生成されるフィールドか。fieldsはsetterFieldsで決めたパッケージの-fields
+func (a *annotatedStruct) isSetterField(field *types.Var, fields []string) bool {
+	return setterFieldSelected(a.fieldTag(field), field.Name(), fields, a.directive)
+}
+
+// setterFieldResolver 生成と同じく設定ファイルを重ねて、パッケージごとにSetXを生成するフィールドを決める
+type setterFieldResolver struct {
+	opts   *generateOptions
+	fields []string // -fieldsで指定されていれば、設定ファイルより優先する
+}
+
+// newSetterFieldResolver dirから設定ファイルを探す。fieldsは-fieldsの値で、空なら設定ファイルに従う
+func newSetterFieldResolver(dir, fields string) (*setterFieldResolver, error) {
+	cfg, err := loadConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := newGenerateOptions(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	x := &setterFieldResolver{opts: opts}
+	if fields != "" {
+		x.fields = strings.Split(fields, ",")
+	}
+	return x, nil
+}
+
+// setterFields pkgの//gen:settersでSetXを生成するフィールド
+func (x *setterFieldResolver) setterFields(pkg *packages.Package) ([]string, error) {
+	if x.fields != nil {
+		return x.fields, nil
+	}
+	if len(pkg.GoFiles) == 0 {
+		return x.opts.fields, nil
+	}
+	opts, err := x.opts.forDir(filepath.Dir(pkg.GoFiles[0]))
+	if err != nil {
+		return nil, err
+	}
+	return opts.fields, nil
+}
+
+// setterName フィールドのSetXの名前。//gen:setters unexportedならsetX
+func (a *annotatedStruct) setterName(field *types.Var) string {
+	_, unexported := a.directive.arg("unexported")
+	return a.fieldTag(field).setterName(field.Name(), unexported)
+}
+
+// method 構造体のポインタ型から名前でメソッドを探す
+func (a *annotatedStruct) method(name string) *types.Func {
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(a.obj.Type()), true, a.obj.Pkg(), name)
+	fn, _ := obj.(*types.Func)
+	return fn
+}
+
+// namedObject ポインタを外した名前付き型の定義を返す
+func namedObject(t types.Type) *types.TypeName {
+	if ptr, ok := types.Unalias(t).(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return nil
+	}
+	return named.Origin().Obj()
+}
+
+// selectedField exprがフィールドの参照であればそのフィールドを返す
+func selectedField(info *types.Info, expr ast.Expr) *types.Var {
+	sel, ok := ast.Unparen(expr).(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	selection, ok := info.Selections[sel]
+	if !ok || selection.Kind() != types.FieldVal {
+		return nil
+	}
+	field, ok := selection.Obj().(*types.Var)
+	if !ok {
+		return nil
+	}
+	return field.Origin()
+}
@@ -0,0 +1,46 @@
+package gen
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// statsやusagesがSetXの対象とするフィールドは、設定ファイルを重ねた生成の結果と一致する
+func TestSetterFieldsMatchGenerate(t *testing.T) {
+	dir, generated := generateModule(t, map[string]string{
+		".gogenstruct.yaml":   "fields: [Name]\n",
+		"a/model.go":          "package a\n\n//gen:setters\ntype Model struct {\n\tName  string\n\tEmail string\n\tCreatedAt int\n}\n",
+		"b/.gogenstruct.yaml": "fields: ['*']\n",
+		"b/model.go":          "package b\n\n//gen:setters\ntype Model struct {\n\tName  string\n\tEmail string\n\tNote  string `gen:\"nosetter\"`\n}\n",
+	})
+	resolver, err := newSetterFieldResolver(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgs, err := loadPackages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkg := range pkgs {
+		fields, err := resolver.setterFields(pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := generated[pkg.Name+"/model_setters.go"]
+		for _, s := range findAnnotatedStructs(pkg, settersDirective) {
+			for _, field := range s.structFields() {
+				want := strings.Contains(src, ") Set"+field.Name()+"(")
+				if got := s.isSetterField(field, fields); got != want {
+					t.Errorf("%s.%s: isSetterField = %v, generated SetX = %v (fields %v)", pkg.Name, field.Name(), got, want, fields)
+				}
+			}
+		}
+	}
+	if resolver, err = newSetterFieldResolver(dir, "Email"); err != nil {
+		t.Fatal(err)
+	}
+	if fields, _ := resolver.setterFields(pkgs[0]); !slices.Equal(fields, []string{"Email"}) {
+		t.Errorf("-fields=Email resolves to %v", fields)
+	}
+}
@@ -0,0 +1,153 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// defaultStructBudget 1つの構造体に生成してよい行数。超えると警告する
+const defaultStructBudget = 2000
+
+var reportLOC = commandLine.Bool("loc", false, "print the number of generated lines per package")
+
+// structBudget 設定ファイルのbudget。0以下なら警告しない
+func (c *config) structBudget() int {
+	if c == nil || c.Budget == nil {
+		return defaultStructBudget
+	}
+	return *c.Budget
+}
+
+// countLines 生成したコードの行数
+func countLines(src []byte) int {
+	return bytes.Count(src, []byte("\n"))
+}
+
+// structLines 生成したコードの行数を構造体ごとに数える。
+// メソッドはレシーバの型、関数や型（NewX, XBuilderなど）は名前に含まれる構造体に数え、ヘッダーやimportはどれにも数えない
+func structLines(src []byte, structNames []string) map[string]int {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, "", src, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+	// 名前の長いものから比べて、ExampleとExampleItemのような場合にExampleItemに数える
+	names := append([]string(nil), structNames...)
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	owner := func(name string) string {
+		for _, s := range names {
+			if strings.Contains(name, s) || strings.Contains(name, exportedName(s)) {
+				return s
+			}
+		}
+		return ""
+	}
+
+	lines := make(map[string]int)
+	for _, decl := range file.Decls {
+		var name string
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			name = decl.Name.Name
+			if decl.Recv != nil {
+				name = receiverTypeName(decl)
+			}
+		case *ast.GenDecl:
+			if decl.Tok == token.IMPORT {
+				continue
+			}
+			if len(decl.Specs) == 0 {
+				continue
+			}
+			switch spec := decl.Specs[0].(type) {
+			case *ast.TypeSpec:
+				name = spec.Name.Name
+			case *ast.ValueSpec:
+				name = spec.Names[0].Name
+			}
+		}
+		s := owner(name)
+		if s == "" {
+			continue
+		}
+		start := decl.Pos()
+		if doc := declDoc(decl); doc != nil {
+			start = doc.Pos()
+		}
+		lines[s] += fileSet.Position(decl.End()).Line - fileSet.Position(start).Line + 1
+	}
+	return lines
+}
+
+func declDoc(decl ast.Decl) *ast.CommentGroup {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		return decl.Doc
+	case *ast.GenDecl:
+		return decl.Doc
+	}
+	return nil
+}
+
+// budgetWarnings 生成した行数がbudgetを超えた構造体についての警告。コード生成ごとにファイルを分けた場合は合計する
+func (t *targetStructs) budgetWarnings(srcs [][]byte, budget int) []*diagnostic {
+	if budget <= 0 {
+		return nil
+	}
+	names := make([]string, 0, len(t.structs))
+	for _, s := range t.structs {
+		names = append(names, s.name())
+	}
+	lines := make(map[string]int)
+	for _, src := range srcs {
+		for name, n := range structLines(src, names) {
+			lines[name] += n
+		}
+	}
+	var warnings []*diagnostic
+	for _, name := range names {
+		if n := lines[name]; n > budget {
+			warnings = append(warnings, newDiagnostic(diagBudget, token.Position{Filename: t.outputPath()}, n, name, budget))
+		}
+	}
+	return warnings
+}
+
+// printLOCReport 生成した行数をパッケージ（出力先のディレクトリ）ごとに出力する
+func printLOCReport(w io.Writer, generated []*generatedFile) error {
+	type packageLOC struct {
+		files int
+		lines int
+	}
+	byDir := make(map[string]*packageLOC)
+	var dirs []string
+	for _, g := range generated {
+		dir := g.dir()
+		p, ok := byDir[dir]
+		if !ok {
+			p = &packageLOC{}
+			byDir[dir] = p
+			dirs = append(dirs, dir)
+		}
+		p.files++
+		p.lines += countLines(g.src)
+	}
+	sort.Strings(dirs)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "FILES\tLINES\tPACKAGE\t")
+	total := 0
+	for _, dir := range dirs {
+		p := byDir[dir]
+		total += p.lines
+		fmt.Fprintf(tw, "%d\t%d\t%s\t\n", p.files, p.lines, dir)
+	}
+	fmt.Fprintf(tw, "%d\t%d\t%s\t\n", len(generated), total, "total")
+	return tw.Flush()
+}
@@ -0,0 +1,302 @@
+package gen
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// JSON-RPC 2.0のメッセージ。LSPと同じくContent-Lengthヘッダーで区切る
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+// textDocumentPositionParams LSPのTextDocumentPositionParamsと同じ形（行・列は0始まり）
+type textDocumentPositionParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position struct {
+		Line      int `json:"line"`
+		Character int `json:"character"`
+	} `json:"position"`
+}
+
+type executeCommandParams struct {
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments"`
+}
+
+// previewResult カーソル位置の構造体に対して生成されるコード
+type previewResult struct {
+	URI     string `json:"uri"`
+	Struct  string `json:"struct"`
+	Content string `json:"content"`
+}
+
+type generateResult struct {
+	URI     string `json:"uri"`
+	Written bool   `json:"written"`
+}
+
+// runLSP 標準入出力でJSON-RPCを受け付け、エディタ拡張からの問い合わせに答える
+//
+//	genStruct/preview:  カーソル位置の構造体に対して生成されるコードを返す
+//	genStruct/generate: カーソル位置のファイルだけを再生成する
+func runLSP(args []string) error {
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	compat := flags.String("compat", "", "emit an older output version (e.g. v1) instead of the latest")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	version, err := parseOutputVersion(*compat)
+	if err != nil {
+		return err
+	}
+	return serveRPC(os.Stdin, os.Stdout, version)
+}
+
+func serveRPC(in io.Reader, out io.Writer, version int) error {
+	reader := textproto.NewReader(bufio.NewReader(in))
+	for {
+		req, err := readRPCMessage(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		result, rpcErr := handleRPC(req, version)
+		// IDのないものは通知なので返事をしない
+		if req.ID == nil {
+			continue
+		}
+		// 成功時はresultを、失敗時はerrorだけを返す
+		resp := map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result}
+		if rpcErr != nil {
+			delete(resp, "result")
+			resp["error"] = rpcErr
+		}
+		if err := writeRPCMessage(out, resp); err != nil {
+			return err
+		}
+	}
+}
+
+func handleRPC(req *rpcMessage, version int) (any, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"codeLensProvider":       map[string]any{},
+				"executeCommandProvider": map[string]any{"commands": []string{generateCommand}},
+			},
+			"serverInfo": map[string]string{"name": "go-gen-struct", "version": toolVersion()},
+		}, nil
+	case "initialized", "shutdown":
+		return nil, nil
+	case "genStruct/preview":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		result, err := previewAt(params, version)
+		if err != nil {
+			return nil, &rpcError{Code: rpcInternalError, Message: err.Error()}
+		}
+		return result, nil
+	case "genStruct/generate":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		result, err := generateFile(params, version)
+		if err != nil {
+			return nil, &rpcError{Code: rpcInternalError, Message: err.Error()}
+		}
+		return result, nil
+	case "textDocument/codeLens":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		filename, err := uriToPath(params.TextDocument.URI)
+		if err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		lenses, err := codeLenses(filename)
+		if err != nil {
+			return nil, &rpcError{Code: rpcInternalError, Message: err.Error()}
+		}
+		return lenses, nil
+	case "workspace/executeCommand":
+		var params executeCommandParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		if params.Command != generateCommand {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("unknown command: %s", params.Command)}
+		}
+		result, err := executeGenerateCommand(params.Arguments, version)
+		if err != nil {
+			return nil, &rpcError{Code: rpcInternalError, Message: err.Error()}
+		}
+		return result, nil
+	default:
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("method not found: %s", req.Method)}
+	}
+}
+
+// previewAt カーソル位置の構造体について生成されるコードを返す。対象外ならnil
+func previewAt(params textDocumentPositionParams, version int) (*previewResult, error) {
+	filename, err := uriToPath(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	narrowed, err := searchTargetStructAt(filename, params.Position.Line+1)
+	if err != nil || narrowed == nil {
+		return nil, err
+	}
+	opts, err := applyConfigAt(narrowed)
+	if err != nil {
+		return nil, err
+	}
+	src, err := narrowed.render(opts.fields, version)
+	if err != nil || src == nil {
+		return nil, err
+	}
+	return &previewResult{
+		URI:     pathToURI(narrowed.outputPath()),
+		Struct:  narrowed.structs[0].name(),
+		Content: string(src),
+	}, nil
+}
+
+// applyConfigAt ファイルのディレクトリから設定を探して、フラグが無効なコード生成を外し、
+// 対象のフィールドや出力先の設定を返す
+func applyConfigAt(targets *targetStructs) (*generateOptions, error) {
+	cfg, err := loadConfig(targets.path)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := newGenerateOptions(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	targets.applyConfig(cfg)
+	targets.outputDir = opts.outputDirFor(targets.path)
+	targets.suffix = opts.suffix
+	targets.templates = opts.templates
+	return opts, nil
+}
+
+// generateFile ドキュメントのファイルだけを再生成する
+func generateFile(params textDocumentPositionParams, version int) (*generateResult, error) {
+	filename, err := uriToPath(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := searchTargetStructs(filename)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := applyConfigAt(targets)
+	if err != nil {
+		return nil, err
+	}
+	src, err := targets.render(opts.fields, version)
+	if err != nil {
+		return nil, err
+	}
+	result := &generateResult{URI: pathToURI(targets.outputPath())}
+	if src == nil {
+		return result, nil
+	}
+	if err := os.WriteFile(targets.outputPath(), src, 0644); err != nil {
+		return nil, err
+	}
+	result.Written = true
+	return result, nil
+}
+
+func readRPCMessage(reader *textproto.Reader) (*rpcMessage, error) {
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %w", err)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader.R, body); err != nil {
+		return nil, err
+	}
+	msg := &rpcMessage{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func writeRPCMessage(w io.Writer, msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+func uriToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported uri scheme: %q", u.Scheme)
+	}
+	p := u.Path
+	// Windowsではfile:///C:/dir/a.goのようにドライブレターの前に/がつく
+	if len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+		p = p[1:]
+	}
+	return filepath.FromSlash(p), nil
+}
+
+func pathToURI(path string) string {
+	p := filepath.ToSlash(path)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
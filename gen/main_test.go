@@ -0,0 +1,68 @@
+package gen
+
+import (
+	"strings"
+	"testing"
+)
+
+// -compatを指定しなければ以前生成したファイルの出力形式を引き継ぎ、v1のヘッダーには出力形式を書かない
+func TestGenerateKeepsRecordedVersion(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":     "module example.com/m\n\ngo 1.23\n",
+		"m/model.go": modelSource("m"),
+	})
+	generate := func(version int) string {
+		t.Helper()
+		g, err := generateTree(dir, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, errs := g.write(); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		if len(g.generated) != 1 {
+			t.Fatalf("generated %d files, want 1", len(g.generated))
+		}
+		return string(g.generated[0].src)
+	}
+	tests := []struct {
+		version int
+		header  string
+	}{
+		{1, legacyGeneratedMarker + "\n\npackage m\n"},
+		{0, legacyGeneratedMarker + "\n\npackage m\n"},
+		{3, legacyGeneratedMarker + "\n// gen-struct output: v3\n"},
+		{0, legacyGeneratedMarker + "\n// gen-struct output: v3\n"},
+		{outputVersion, generatedMarker + "\n"},
+		{0, generatedMarker + "\n"},
+	}
+	for _, tt := range tests {
+		if src := generate(tt.version); !strings.HasPrefix(src, tt.header) {
+			t.Errorf("version %d: header does not start with %q:\n%s", tt.version, tt.header, src)
+		}
+	}
+}
+
+// 設定ファイルのcompatを指定すれば、記録した出力形式より優先する
+func TestGenerateCompatOverridesRecordedVersion(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":     "module example.com/m\n\ngo 1.23\n",
+		"m/model.go": modelSource("m"),
+	})
+	g, err := generateTree(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, errs := g.write(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	writeTree(t, dir, map[string]string{".gogenstruct.yaml": "compat: latest\n"})
+	if g, err = generateTree(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	if version := generatedOutputVersion(g.generated[0].src); version != outputVersion {
+		t.Errorf("output version = %d, want %d", version, outputVersion)
+	}
+}
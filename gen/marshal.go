@@ -0,0 +1,580 @@
+package gen
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// marshalTimeFormats gen:"time=unix"で指定できるtime.Timeの形式。既定はencoding/jsonと同じRFC 3339
+var marshalTimeFormats = []string{"rfc3339", "unix", "unixmilli"}
+
+// marshalCases //gen:marshal case=snakeで、jsonタグのないフィールドのキーにする名前の形
+var marshalCases = []string{"snake", "camel"}
+
+// marshaler //gen:marshalで生成するMarshalJSONとUnmarshalJSON
+type marshaler struct {
+	StructName string
+	Fields     []*marshalField
+	YAML       string // //gen:marshal yamlならgopkg.in/yaml.v3を参照している名前
+	JSON       string
+	Strconv    string
+	Time       string
+	NeedsData  bool // json.Marshalでエンコードするフィールドがある
+	Omits      bool // 省略するフィールドがあり、区切りのカンマを実行時に決める
+	equal      bool // //gen:equalのEqualもある。往復のテストで比べるのに使う
+}
+
+// marshalField エンコードするフィールド
+type marshalField struct {
+	FieldName  string
+	Key        string   // "name":のGoの文字列リテラル
+	Name       string   // キー
+	Omit       string   // omitemptyやomitzeroで省略する条件。省略しなければ空
+	Append     []string // bufにエンコードした値を追加する文
+	WireType   string   // デコードに使う構造体のフィールドの型（キーがなければnilになるポインタ）
+	Decode     string   // w.Xがnilでなければフィールドに入れる文
+	YAMLType   string   // MarshalYAMLで返す構造体のフィールドの型
+	YAMLSet    []string // wにYAMLの値を入れる文
+	YAMLOmit   bool
+	typ        types.Type
+	timeFormat string
+}
+
+// marshalBuilder 型情報からフィールドのエンコードとデコードを組み立てる
+type marshalBuilder struct {
+	r   *renderer
+	pkg *types.Package
+	m   *marshaler
+}
+
+// isTimeType time.Timeか
+func isTimeType(t types.Type) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "time" && named.Obj().Name() == "Time"
+}
+
+// hasMethod 型かそのポインタがnameのメソッドを持つか
+func hasMethod(t types.Type, name string) bool {
+	if _, ok := t.Underlying().(*types.Interface); ok {
+		return false
+	}
+	var pkg *types.Package
+	if named, ok := types.Unalias(t).(*types.Named); ok {
+		pkg = named.Obj().Pkg()
+	}
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), true, pkg, name)
+	_, ok := obj.(*types.Func)
+	return ok
+}
+
+// customEncoding 型が自分でエンコードするか。encoding/jsonと同じくjson.Marshalに任せる
+func customEncoding(t types.Type) bool {
+	return hasMethod(t, "MarshalJSON") || hasMethod(t, "MarshalText")
+}
+
+// omitCond omitempty、omitzeroで省略する条件。encoding/jsonと違い、omitemptyでもゼロのtime.Timeは省略する
+func (b *marshalBuilder) omitCond(v string, t types.Type, omitEmpty, omitZero bool) (string, error) {
+	if isTimeType(t) && (omitEmpty || omitZero) {
+		return v + ".IsZero()", nil
+	}
+	if omitZero {
+		if hasMethod(t, "IsZero") {
+			return v + ".IsZero()", nil
+		}
+		switch t.Underlying().(type) {
+		case *types.Slice, *types.Map, *types.Pointer, *types.Interface, *types.Chan, *types.Signature:
+			return v + " == nil", nil
+		}
+		if !types.Comparable(t) {
+			return "", fmt.Errorf("omitzero needs a comparable type or an IsZero method")
+		}
+		return v + " == *new(" + qualifiedTypeString(b.r, b.pkg, t) + ")", nil
+	}
+	if !omitEmpty {
+		return "", nil
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsString != 0:
+			return v + ` == ""`, nil
+		case u.Info()&types.IsBoolean != 0:
+			return "!" + v, nil
+		case u.Info()&types.IsNumeric != 0:
+			return v + " == 0", nil
+		}
+	case *types.Slice, *types.Map, *types.Array:
+		return "len(" + v + ") == 0", nil
+	case *types.Pointer, *types.Interface:
+		return v + " == nil", nil
+	}
+	// encoding/jsonと同じく構造体はomitemptyでも省略しない
+	return "", nil
+}
+
+// appendStmts vの値をbufに追加する文
+func (b *marshalBuilder) appendStmts(v string, t types.Type, timeFormat string) []string {
+	if isTimeType(t) {
+		switch timeFormat {
+		case "unix":
+			return []string{fmt.Sprintf("buf = %s.AppendInt(buf, %s.Unix(), 10)", b.strconv(), v)}
+		case "unixmilli":
+			return []string{fmt.Sprintf("buf = %s.AppendInt(buf, %s.UnixMilli(), 10)", b.strconv(), v)}
+		}
+		return []string{
+			"buf = append(buf, '\"')",
+			fmt.Sprintf("buf = %s.AppendFormat(buf, %s.RFC3339Nano)", v, b.time()),
+			"buf = append(buf, '\"')",
+		}
+	}
+	if basic, ok := t.Underlying().(*types.Basic); ok && !customEncoding(t) {
+		// 数値と真偽値はreflectを通さずに直接書き込む。文字列のエスケープと浮動小数点数の形式はencoding/jsonに任せる
+		switch {
+		case basic.Info()&types.IsBoolean != 0:
+			return []string{fmt.Sprintf("buf = %s.AppendBool(buf, bool(%s))", b.strconv(), v)}
+		case basic.Info()&types.IsInteger != 0 && basic.Info()&types.IsUnsigned != 0:
+			return []string{fmt.Sprintf("buf = %s.AppendUint(buf, uint64(%s), 10)", b.strconv(), v)}
+		case basic.Info()&types.IsInteger != 0:
+			return []string{fmt.Sprintf("buf = %s.AppendInt(buf, int64(%s), 10)", b.strconv(), v)}
+		}
+	}
+	b.m.NeedsData = true
+	return []string{
+		fmt.Sprintf("if data, err = %s.Marshal(&%s); err != nil {", b.m.JSON, v),
+		"\treturn nil, err",
+		"}",
+		"buf = append(buf, data...)",
+	}
+}
+
+func (b *marshalBuilder) strconv() string {
+	if b.m.Strconv == "" {
+		b.m.Strconv = b.r.importName("strconv")
+	}
+	return b.m.Strconv
+}
+
+func (b *marshalBuilder) time() string {
+	if b.m.Time == "" {
+		b.m.Time = b.r.importName("time")
+	}
+	return b.m.Time
+}
+
+// marshalKey jsonタグの名前。なければcase=の指定に合わせてフィールド名から作る
+func marshalKey(fieldName, jsonName, nameCase string) string {
+	if jsonName != "" {
+		return jsonName
+	}
+	switch nameCase {
+	case "snake":
+		return snakeCase(fieldName)
+	case "camel":
+		return unexportedName(fieldName)
+	}
+	return fieldName
+}
+
+func newMarshaler(r *renderer, pkg *types.Package, target *directiveTarget) (*marshaler, error) {
+	structName := target.s.name()
+	nameCase, _ := target.d.arg("case")
+	if nameCase != "" && !containsTargetField(nameCase, marshalCases...) {
+		return nil, fmt.Errorf("%s: //gen:marshal case must be one of %s, got %q", structName, strings.Join(marshalCases, ", "), nameCase)
+	}
+	_, st, err := lookupNamedStruct(pkg, structName)
+	if err != nil {
+		return nil, err
+	}
+	m := &marshaler{StructName: structName, JSON: r.importName("encoding/json")}
+	if _, disabled := r.t.disabled["equal"]; !disabled && target.s.directive("equal") != nil {
+		m.equal = true
+	}
+	if _, ok := target.d.arg("yaml"); ok {
+		m.YAML = r.importName("gopkg.in/yaml.v3")
+	}
+	b := &marshalBuilder{r: r, pkg: pkg, m: m}
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		tag := reflect.StructTag(st.Tag(i))
+		jsonTag := tag.Get("json")
+		if jsonTag == "-" || !f.Exported() {
+			continue
+		}
+		if f.Embedded() {
+			return nil, fmt.Errorf("%s: //gen:marshal does not flatten the embedded field %s", structName, f.Name())
+		}
+		jsonName, opts, _ := strings.Cut(jsonTag, ",")
+		var omitEmpty, omitZero bool
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "omitempty":
+				omitEmpty = true
+			case "omitzero":
+				omitZero = true
+			case "string":
+				return nil, fmt.Errorf("%s.%s: //gen:marshal does not support the json string option", structName, f.Name())
+			}
+		}
+		timeFormat := parseStructTag(string(tag))["time"]
+		if timeFormat != "" {
+			if !isTimeType(f.Type()) {
+				return nil, fmt.Errorf("%s.%s: gen:\"time=%s\" is only for time.Time fields", structName, f.Name(), timeFormat)
+			}
+			if !containsTargetField(timeFormat, marshalTimeFormats...) {
+				return nil, fmt.Errorf("%s.%s: gen:\"time\" must be one of %s, got %q", structName, f.Name(), strings.Join(marshalTimeFormats, ", "), timeFormat)
+			}
+		}
+		name := marshalKey(f.Name(), jsonName, nameCase)
+		quoted, _ := json.Marshal(name)
+		v := "s." + f.Name()
+		omit, err := b.omitCond(v, f.Type(), omitEmpty, omitZero)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", structName, f.Name(), err)
+		}
+		field := &marshalField{
+			FieldName:  f.Name(),
+			Key:        strconv.Quote(string(quoted) + ":"),
+			Name:       name,
+			Omit:       omit,
+			Append:     b.appendStmts(v, f.Type(), timeFormat),
+			typ:        f.Type(),
+			timeFormat: timeFormat,
+		}
+		typeString := qualifiedTypeString(r, pkg, f.Type())
+		switch timeFormat {
+		case "unix", "unixmilli":
+			fromEpoch := "Unix(*w." + f.Name() + ", 0)"
+			toEpoch := v + ".Unix()"
+			if timeFormat == "unixmilli" {
+				fromEpoch, toEpoch = "UnixMilli(*w."+f.Name()+")", v+".UnixMilli()"
+			}
+			field.WireType = "*int64"
+			field.Decode = fmt.Sprintf("%s = %s.%s.UTC()", v, b.time(), fromEpoch)
+			field.YAMLType = "int64"
+			field.YAMLSet = []string{fmt.Sprintf("w.%s = %s", f.Name(), toEpoch)}
+			if omit != "" {
+				// ゼロのtime.TimeのUnix()は0にならないので、省略するならポインタにする
+				field.YAMLType = "*int64"
+				field.YAMLSet = []string{
+					"if !(" + omit + ") {",
+					fmt.Sprintf("\tepoch := %s", toEpoch),
+					fmt.Sprintf("\tw.%s = &epoch", f.Name()),
+					"}",
+				}
+			}
+		default:
+			field.WireType = "*" + typeString
+			field.Decode = fmt.Sprintf("%s = *w.%s", v, f.Name())
+			field.YAMLType = typeString
+			field.YAMLSet = []string{fmt.Sprintf("w.%s = %s", f.Name(), v)}
+		}
+		field.YAMLOmit = omit != ""
+		if omit != "" {
+			m.Omits = true
+		}
+		m.Fields = append(m.Fields, field)
+	}
+	if len(m.Fields) == 0 {
+		return nil, fmt.Errorf("%s: //gen:marshal has no exported fields to encode", structName)
+	}
+	return m, nil
+}
+
+// renderMarshal reflectを使わずにエンコードするMarshalJSONと、タグの指定を反映するUnmarshalJSONを生成する
+func renderMarshal(r *renderer, targets []*directiveTarget) error {
+	pkg, err := r.t.loadTypes()
+	if err != nil {
+		return err
+	}
+	all := make([]*marshaler, 0, len(targets))
+	for _, target := range targets {
+		m, err := newMarshaler(r, pkg, target)
+		if err != nil {
+			return err
+		}
+		all = append(all, m)
+	}
+	if err := r.execute("marshal", marshalTemplate, all); err != nil {
+		return err
+	}
+	if r.t.roundTripTests {
+		if err := renderMarshalTests(r, pkg, all); err != nil {
+			return err
+		}
+	}
+	if !r.t.benchmarks {
+		return nil
+	}
+	tr := r.testFile()
+	benchmarks := make([]*codecBenchmark, 0, 2*len(all))
+	for _, m := range all {
+		name := exportedName(m.StructName)
+		benchmarks = append(benchmarks, &codecBenchmark{
+			StructName: m.StructName,
+			Name:       name + "MarshalJSON",
+			Encode:     "_, _ = s.MarshalJSON()",
+			Testing:    tr.importName("testing"),
+			JSON:       tr.importName("encoding/json"),
+		}, &codecBenchmark{
+			StructName: m.StructName,
+			Name:       name + "UnmarshalJSON",
+			Testing:    tr.importName("testing"),
+			JSON:       tr.importName("encoding/json"),
+		})
+	}
+	return tr.execute("marshal_bench", codecBenchmarkTemplate, benchmarks)
+}
+
+// marshalTest MarshalJSONしたものをUnmarshalJSONすると元に戻るかのテスト
+type marshalTest struct {
+	StructName string
+	TestName   string
+	Params     []*marshalTestParam
+	Equal      bool // Equalで比べる。なければもう一度エンコードしてバイト列を比べる
+	Testing    string
+	Quick      string
+	Bytes      string
+}
+
+// marshalTestParam testing/quickで生成してフィールドに入れる値。time.Timeはint64のナノ秒から作る
+type marshalTestParam struct {
+	Name      string
+	Type      string
+	FieldName string
+	Value     string
+}
+
+// renderMarshalTests //gen:marshalの構造体について、testing/quickで値を作ってMarshalJSON→UnmarshalJSONで元に戻るかのテストを生成する。
+// testing/quickで作れない型や、自分でエンコードする型のフィールドはゼロ値のままにする
+func renderMarshalTests(r *renderer, pkg *types.Package, all []*marshaler) error {
+	tr := r.testFile()
+	tests := make([]*marshalTest, 0, len(all))
+	for _, m := range all {
+		test := &marshalTest{
+			StructName: m.StructName,
+			TestName:   "Test" + exportedName(m.StructName) + "JSONRoundTrip",
+			Equal:      m.equal,
+			Testing:    tr.importName("testing"),
+			Quick:      tr.importName("testing/quick"),
+		}
+		if !m.equal {
+			test.Bytes = tr.importName("bytes")
+		}
+		for _, f := range m.Fields {
+			p := &marshalTestParam{Name: "v" + strconv.Itoa(len(test.Params)), FieldName: f.FieldName}
+			switch {
+			case isTimeType(f.typ):
+				// 形式の精度に合わせて切り捨て、範囲はUnix(0, n)で表せる年に収める
+				timeName := tr.importName("time")
+				p.Type = "int64"
+				p.Value = timeName + ".Unix(0, " + p.Name + ").UTC()"
+				switch f.timeFormat {
+				case "unix":
+					p.Value += ".Truncate(" + timeName + ".Second)"
+				case "unixmilli":
+					p.Value += ".Truncate(" + timeName + ".Millisecond)"
+				}
+			case quickJSONType(f.typ, make(map[types.Type]bool)):
+				p.Type = qualifiedTypeString(tr, pkg, f.typ)
+				p.Value = p.Name
+			default:
+				continue
+			}
+			test.Params = append(test.Params, p)
+		}
+		tests = append(tests, test)
+	}
+	return tr.execute("marshal_test", marshalTestTemplate, tests)
+}
+
+// quickJSONType testing/quickで値を作れて、encoding/jsonで往復すると同じ値に戻る型か。
+// 自分でエンコードする型、複素数、文字列か整数以外がキーのmap、エクスポートしていないフィールドのある構造体は除く
+func quickJSONType(t types.Type, seen map[types.Type]bool) bool {
+	if customEncoding(t) || isTimeType(t) {
+		return false
+	}
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	defer delete(seen, t)
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return u.Info()&(types.IsBoolean|types.IsInteger|types.IsFloat|types.IsString) != 0 && u.Kind() != types.UnsafePointer
+	case *types.Pointer:
+		return quickJSONType(u.Elem(), seen)
+	case *types.Slice:
+		return quickJSONType(u.Elem(), seen)
+	case *types.Array:
+		return quickJSONType(u.Elem(), seen)
+	case *types.Map:
+		key, ok := u.Key().Underlying().(*types.Basic)
+		if !ok || key.Info()&(types.IsString|types.IsInteger) == 0 || customEncoding(u.Key()) {
+			return false
+		}
+		return quickJSONType(u.Elem(), seen)
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			f := u.Field(i)
+			tag := reflect.StructTag(u.Tag(i))
+			if !f.Exported() || f.Embedded() || strings.Contains(tag.Get("json"), ",string") || !quickJSONType(f.Type(), seen) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+const marshalTestTemplate = `
+{{range .}}
+func {{.TestName}}(t *{{.Testing}}.T) {
+	f := func({{range $i, $p := .Params}}{{if $i}}, {{end}}{{.Name}} {{.Type}}{{end}}) bool {
+		in := {{.StructName}}{
+			{{- range .Params}}
+			{{.FieldName}}: {{.Value}},
+			{{- end}}
+		}
+		data, err := in.MarshalJSON()
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		var out {{.StructName}}
+		if err := out.UnmarshalJSON(data); err != nil {
+			t.Log(err)
+			return false
+		}
+		{{- if .Equal}}
+		if !out.Equal(&in) {
+			t.Logf("%s decoded to %+v", data, out)
+			return false
+		}
+		{{- else}}
+		again, err := out.MarshalJSON()
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		if !{{.Bytes}}.Equal(again, data) {
+			t.Logf("%s decoded and encoded again as %s", data, again)
+			return false
+		}
+		{{- end}}
+		return true
+	}
+	if err := {{.Quick}}.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+{{end}}
+`
+
+const marshalTemplate = `
+{{range .}}
+{{- $m := .}}
+// MarshalJSON encodes s without reflection for numbers, booleans and times.
+func (s {{.StructName}}) MarshalJSON() ([]byte, error) {
+	{{- if .NeedsData}}
+	var data []byte
+	var err error
+	{{- end}}
+	buf := make([]byte, 0, {{len .Fields}}*32)
+	buf = append(buf, '{')
+	{{- if not .Omits}}
+	{{- range $i, $f := .Fields}}
+	{{- if $i}}
+	buf = append(buf, ',')
+	{{- end}}
+	buf = append(buf, {{.Key}}...)
+	{{- range .Append}}
+	{{.}}
+	{{- end}}
+	{{- end}}
+	{{- else}}
+	sep := false
+	{{- range .Fields}}
+	{{- if .Omit}}
+	if !({{.Omit}}) {
+	{{- else}}
+	{
+	{{- end}}
+		if sep {
+			buf = append(buf, ',')
+		}
+		sep = true
+		buf = append(buf, {{.Key}}...)
+		{{- range .Append}}
+		{{.}}
+		{{- end}}
+	}
+	{{- end}}
+	{{- end}}
+	buf = append(buf, '}')
+	return buf, nil
+}
+
+// UnmarshalJSON decodes the keys written by MarshalJSON. Missing keys leave the fields unchanged.
+func (s *{{.StructName}}) UnmarshalJSON(data []byte) error {
+	var w struct {
+		{{- range .Fields}}
+		{{.FieldName}} {{.WireType}} ` + "`json:\"{{.Name}}\"`" + `
+		{{- end}}
+	}
+	if err := {{.JSON}}.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	{{- range .Fields}}
+	if w.{{.FieldName}} != nil {
+		{{.Decode}}
+	}
+	{{- end}}
+	return nil
+}
+{{- if .YAML}}
+
+// MarshalYAML returns the fields of s with the same keys and time formats as MarshalJSON.
+func (s {{.StructName}}) MarshalYAML() (any, error) {
+	var w struct {
+		{{- range .Fields}}
+		{{.FieldName}} {{.YAMLType}} ` + "`yaml:\"{{.Name}}{{if .YAMLOmit}},omitempty{{end}}\"`" + `
+		{{- end}}
+	}
+	{{- range .Fields}}
+	{{- if and .YAMLOmit (eq (len .YAMLSet) 1)}}
+	if !({{.Omit}}) {
+		{{index .YAMLSet 0}}
+	}
+	{{- else}}
+	{{- range .YAMLSet}}
+	{{.}}
+	{{- end}}
+	{{- end}}
+	{{- end}}
+	return w, nil
+}
+
+// UnmarshalYAML decodes the keys written by MarshalYAML. Missing keys leave the fields unchanged.
+func (s *{{.StructName}}) UnmarshalYAML(value *{{.YAML}}.Node) error {
+	var w struct {
+		{{- range .Fields}}
+		{{.FieldName}} {{.WireType}} ` + "`yaml:\"{{.Name}}\"`" + `
+		{{- end}}
+	}
+	if err := value.Decode(&w); err != nil {
+		return err
+	}
+	{{- range .Fields}}
+	if w.{{.FieldName}} != nil {
+		{{.Decode}}
+	}
+	{{- end}}
+	return nil
+}
+{{- end}}
+{{end}}
+`
@@ -0,0 +1,143 @@
+package gen
+
+import (
+	"strings"
+	"testing"
+)
+
+// 別名のtime.Timeもencoding/jsonを通さずに時刻の形式でエンコードする
+func TestMarshalAlias(t *testing.T) {
+	_, generated := generateModule(t, map[string]string{
+		"m/model.go": `package m
+
+import "time"
+
+type Stamp = time.Time
+
+//gen:marshal
+type Model struct {
+	At      Stamp ` + "`json:\"at\"`" + `
+	Created Stamp ` + "`json:\"created\" gen:\"time=unix\"`" + `
+}
+`,
+	})
+	src := generated["m/model_setters.go"]
+	for _, want := range []string{"s.At.AppendFormat(buf, time.RFC3339Nano)", "s.Created.Unix()"} {
+		if !strings.Contains(src, want) {
+			t.Errorf("MarshalJSON does not contain %q:\n%s", want, src)
+		}
+	}
+}
+
+// -benchmarksでは、MarshalJSONとUnmarshalJSONのベンチマークを生成し、比べるencoding/jsonには生成したメソッドのない型を渡す
+func TestMarshalBenchmarks(t *testing.T) {
+	dir, generated := generateModule(t, map[string]string{
+		".gogenstruct.yaml": "benchmarks: true\n",
+		"m/model.go": `package m
+
+import "time"
+
+//gen:marshal
+//gen:canonical
+type Model struct {
+	ID      int64     ` + "`json:\"id\"`" + `
+	Created time.Time ` + "`json:\"created\" gen:\"time=unix\"`" + `
+}
+`,
+	})
+	src := generated["m/model_setters_test.go"]
+	for _, want := range []string{
+		"func BenchmarkModelMarshalJSON(",
+		"func BenchmarkModelMarshalJSONEncodingJSON(",
+		"func BenchmarkModelUnmarshalJSON(",
+		"func BenchmarkModelUnmarshalJSONEncodingJSON(",
+		"func BenchmarkModelCanonicalBytesEncodingJSON(",
+		"type plain Model",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("benchmarks do not contain %q:\n%s", want, src)
+		}
+	}
+	goTest(t, dir, "-run=^$", "-bench=.", "-benchtime=1x", "./...")
+}
+
+// -roundtrip-testsでは、//gen:marshalの構造体にもMarshalJSON→UnmarshalJSONで元に戻るかのテストを生成する。
+// Equalがあればそれで比べ、なければもう一度エンコードして比べる
+func TestMarshalRoundTripTests(t *testing.T) {
+	dir, generated := generateModule(t, map[string]string{
+		".gogenstruct.yaml": "roundtrip_tests: true\n",
+		"m/model.go": `package m
+
+import "time"
+
+type Stamp = time.Time
+
+type Address struct {
+	City string ` + "`json:\"city\"`" + `
+	Zip  *int   ` + "`json:\"zip,omitempty\"`" + `
+}
+
+//gen:marshal case=snake
+//gen:equal
+type Model struct {
+	ID       int64             ` + "`json:\"id\"`" + `
+	Name     string            ` + "`json:\"name,omitempty\"`" + `
+	Score    float64
+	Ratio    float32
+	Tags     []string
+	Attrs    map[string]int
+	Ref      *uint16
+	Home     Address
+	At       Stamp
+	Created  time.Time         ` + "`gen:\"time=unix\"`" + `
+	Updated  time.Time         ` + "`json:\"updated,omitempty\" gen:\"time=unixmilli\"`" + `
+	Any      any
+	internal int
+}
+
+//gen:marshal
+type Plain struct {
+	Name string
+	At   time.Time
+	Ch   chan int ` + "`json:\"-\"`" + `
+}
+`,
+	})
+	src := generated["m/model_setters_test.go"]
+	for _, want := range []string{"func TestModelJSONRoundTrip(", "if !out.Equal(&in) {", "func TestPlainJSONRoundTrip(", "bytes.Equal(again, data)"} {
+		if !strings.Contains(src, want) {
+			t.Errorf("round-trip tests do not contain %q:\n%s", want, src)
+		}
+	}
+	goTest(t, dir, "./...")
+}
+
+// time.Timeとその別名は時刻の形式でエンコードし、それらへのポインタはencoding/jsonに任せる。
+// どれも生成したMarshalJSON→UnmarshalJSONで元に戻る
+func TestMarshalFieldKinds(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		want  []string
+	}{
+		{"time", "At time.Time", []string{"s.At.AppendFormat(buf, time.RFC3339Nano)", "At *time.Time `json:\"At\"`"}},
+		{"alias", "At Stamp", []string{"s.At.AppendFormat(buf, time.RFC3339Nano)", "At *Stamp `json:\"At\"`"}},
+		{"pointer", "At *time.Time", []string{"json.Marshal(&s.At)", "At **time.Time `json:\"At\"`"}},
+		{"alias pointer", "At *Stamp", []string{"json.Marshal(&s.At)", "At **Stamp `json:\"At\"`"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, generated := generateModule(t, map[string]string{
+				".gogenstruct.yaml": "roundtrip_tests: true\n",
+				"m/model.go":        fieldModel("//gen:marshal", tt.field),
+			})
+			src := generated["m/model_setters.go"]
+			for _, want := range tt.want {
+				if !strings.Contains(src, want) {
+					t.Errorf("generated code does not contain %q:\n%s", want, src)
+				}
+			}
+			goTest(t, dir, "./...")
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package gen
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// legacyToolName 出力形式v6までのヘッダーに書いていた、このツールの以前の名前
+const legacyToolName = "go-struct-gen"
+
+// migrateStep migrateで行う変更1つ
+type migrateStep struct {
+	// kind create, update, remove, rewrite
+	kind string
+	path string
+	note string
+}
+
+// runMigrate 以前の出力形式やファイル名で生成したファイルを今の設定の形にそろえる。
+// 今の設定で生成し直し、生成しなくなった古いファイルを消し、//go:generateの行を今の実行方法に書き換える
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dirFlag := flags.String("dir", ".", "directory to migrate, including subdirectories")
+	dryRun := flags.Bool("dry-run", false, "print the changes instead of making them")
+	force := flags.Bool("force", false, "overwrite or delete generated files even if they were edited by hand")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	dir, err := filepath.Abs(*dirFlag)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(dir)
+	if err != nil {
+		return err
+	}
+	// 記録した出力形式を引き継がず、設定ファイルのcompatか最新の形式にそろえる
+	version, err := parseOutputVersion(cfg.Compat)
+	if err != nil {
+		return err
+	}
+	g, err := generateTree(dir, version)
+	if err != nil {
+		return err
+	}
+	for _, line := range logLines(g.logs) {
+		fmt.Fprintln(os.Stderr, line)
+	}
+	// 生成に失敗したファイルの古い出力は、生成しなくなったものと区別できない
+	if g.out.failures > 0 {
+		return fmt.Errorf("migrate: %d source files failed to generate; fix them before migrating", g.out.failures)
+	}
+	g.out.force = *force
+	steps, err := migrationPlan(dir, g)
+	if err != nil {
+		return err
+	}
+	rewrites, err := goGenerateRewrites(dir)
+	if err != nil {
+		return err
+	}
+	for path := range rewrites {
+		steps = append(steps, &migrateStep{kind: "rewrite", path: path, note: "//go:generate"})
+	}
+	if len(steps) == 0 {
+		fmt.Println("Nothing to migrate.")
+		return nil
+	}
+	printMigrationPlan(os.Stdout, dir, steps)
+	if *dryRun {
+		return nil
+	}
+	var errs int
+	for _, file := range g.generated {
+		if _, err := g.out.writeFile(file.path, file.source, file.src); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			errs++
+		}
+	}
+	for _, step := range steps {
+		switch step.kind {
+		case "remove":
+			if err := checkUnedited(step.path, nil, *force); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				errs++
+				continue
+			}
+			if err := os.Remove(step.path); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				errs++
+			}
+		case "rewrite":
+			if err := os.WriteFile(step.path, rewrites[step.path], 0o644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				errs++
+			}
+		}
+	}
+	if errs > 0 {
+		return fmt.Errorf("migrate: %d changes failed", errs)
+	}
+	return nil
+}
+
+// migrationPlan 生成したファイルの作成と更新、生成しなくなった古いファイルの削除を並べる
+func migrationPlan(dir string, g *treeGeneration) ([]*migrateStep, error) {
+	// ソースから今生成するファイル。古いファイルの移し先を示すのに使う
+	outputs := make(map[string][]string)
+	var steps []*migrateStep
+	for _, file := range g.generated {
+		for _, source := range strings.Split(file.source, ", ") {
+			outputs[source] = append(outputs[source], file.path)
+		}
+		current, err := os.ReadFile(file.path)
+		if err != nil {
+			steps = append(steps, &migrateStep{kind: "create", path: file.path})
+			continue
+		}
+		// 書き込むときと同じく、gen:overrideの範囲を残し、ツールのバージョンの行を除いて比べる
+		want, err := mergeOverrides(current, file.src, g.out.force)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.path, err)
+		}
+		if bytes.Equal(withoutToolVersion(current), withoutToolVersion(want)) {
+			continue
+		}
+		note := ""
+		if from, to := generatedOutputVersion(current), generatedOutputVersion(file.src); from != to {
+			note = fmt.Sprintf("output %s -> v%d", formatOutputVersion(from), to)
+		}
+		steps = append(steps, &migrateStep{kind: "update", path: file.path, note: note})
+	}
+	roots := []string{dir}
+	if g.opts.outputDir != "" {
+		roots = append(roots, g.opts.outputDir)
+	}
+	if g.opts.overlay != "" {
+		roots = append(roots, g.opts.overlay)
+	}
+	orphaned, err := orphanedFiles(roots, true, g.generated, g.stale)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range append(g.stale, orphaned...) {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var replaced []string
+		for _, source := range generatedSources(path, src, g.opts.suffix) {
+			replaced = append(replaced, outputs[source]...)
+		}
+		note := "no longer generated"
+		if len(replaced) > 0 {
+			sort.Strings(replaced)
+			note = "replaced by " + strings.Join(relPaths(dir, replaced), ", ")
+		}
+		steps = append(steps, &migrateStep{kind: "remove", path: path, note: note})
+	}
+	return steps, nil
+}
+
+// generatedSources 生成したファイルの生成元のソース（絶対パス）。
+// 出力形式v7以降はヘッダーのSource:から、それより前はファイル名から接尾辞を除いて推測する
+func generatedSources(path string, src []byte, suffix string) []string {
+	dir := filepath.Dir(path)
+	for _, line := range headerLines(src) {
+		if names, ok := strings.CutPrefix(line, "// Source: "); ok {
+			var sources []string
+			for _, name := range strings.Split(names, ", ") {
+				sources = append(sources, filepath.Join(dir, name))
+			}
+			return sources
+		}
+	}
+	base := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".go"), "_test")
+	base = strings.TrimSuffix(base, "_example")
+	for _, s := range []string{suffix, defaultOutputSuffix} {
+		if trimmed, ok := strings.CutSuffix(base, s); ok {
+			return []string{filepath.Join(dir, trimmed+".go")}
+		}
+	}
+	return nil
+}
+
+// generatedOutputVersion ヘッダーに記録した出力形式。記録していなければ0
+func generatedOutputVersion(src []byte) int {
+	for _, line := range headerLines(src) {
+		if v, ok := strings.CutPrefix(line, "// gen-struct output: v"); ok {
+			if version, err := strconv.Atoi(v); err == nil {
+				return version
+			}
+		}
+	}
+	return 0
+}
+
+func formatOutputVersion(version int) string {
+	if version == 0 {
+		return "unversioned"
+	}
+	return "v" + strconv.Itoa(version)
+}
+
+// headerLines package句より前のコメントの行
+func headerLines(src []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(src), "\n") {
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	return lines
+}
+
+func relPaths(dir string, paths []string) []string {
+	rel := make([]string, len(paths))
+	for i, path := range paths {
+		rel[i] = path
+		if r, err := filepath.Rel(dir, path); err == nil {
+			rel[i] = r
+		}
+	}
+	return rel
+}
+
+func printMigrationPlan(w io.Writer, dir string, steps []*migrateStep) {
+	for _, step := range steps {
+		path := relPaths(dir, []string{step.path})[0]
+		if step.note != "" {
+			fmt.Fprintf(w, "%-7s %s (%s)\n", step.kind, path, step.note)
+			continue
+		}
+		fmt.Fprintf(w, "%-7s %s\n", step.kind, path)
+	}
+}
+
+// goRunPattern //go:generateでこのツールか以前の名前のツールをgo runする部分
+var goRunPattern = regexp.MustCompile(`go run (?:github\.com/kosuke-taniguchi/(?:go-gen-struct|` + legacyToolName + `))(@\S+)?`)
+
+// goGenerateRewrites dir配下のソース（生成したファイルを除く）の//go:generateの行を、今の実行方法に書き換えた内容を返す。
+// 以前の名前（go-struct-gen）は今の名前にし、go.modでtoolとして宣言していればgo tool go-gen-structにする
+func goGenerateRewrites(dir string) (map[string][]byte, error) {
+	files, err := listGoFiles(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	tool := false
+	if goMod, err := findGoMod(dir); err == nil {
+		if data, err := os.ReadFile(goMod); err == nil {
+			if f, err := modfile.ParseLax(goMod, data, nil); err == nil {
+				tool = isToolDirective(f)
+			}
+		}
+	}
+	rewrites := make(map[string][]byte)
+	for _, file := range files {
+		if isGeneratedFile(file) {
+			continue
+		}
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Contains(src, []byte("//go:generate ")) {
+			continue
+		}
+		lines := strings.SplitAfter(string(src), "\n")
+		changed := false
+		for i, line := range lines {
+			if rewritten, ok := rewriteGoGenerate(line, tool); ok {
+				lines[i], changed = rewritten, true
+			}
+		}
+		if changed {
+			rewrites[file] = []byte(strings.Join(lines, ""))
+		}
+	}
+	return rewrites, nil
+}
+
+// rewriteGoGenerate //go:generateの行を今の実行方法にする。変えなければfalseを返す
+func rewriteGoGenerate(line string, tool bool) (string, bool) {
+	rest, ok := strings.CutPrefix(line, "//go:generate ")
+	if !ok {
+		return line, false
+	}
+	current := "go run " + modulePath
+	if tool {
+		current = "go tool " + programName()
+	}
+	rewritten := goRunPattern.ReplaceAllStringFunc(rest, func(run string) string {
+		// バージョンを固定していて、toolでなければそのバージョンのまま名前だけ変える
+		if m := goRunPattern.FindStringSubmatch(run); m[1] != "" && !tool {
+			return "go run " + modulePath + m[1]
+		}
+		return current
+	})
+	// PATHにインストールした以前の名前のコマンド
+	if name, args, _ := strings.Cut(rewritten, " "); strings.TrimSpace(name) == legacyToolName {
+		rewritten = current
+		if args != "" {
+			rewritten += " " + args
+		} else {
+			rewritten += "\n"
+		}
+	}
+	if rewritten == rest {
+		return line, false
+	}
+	return "//go:generate " + rewritten, true
+}
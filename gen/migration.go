@@ -0,0 +1,203 @@
+package gen
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tableSnapshot 前回の実行時のテーブルの形。差分からマイグレーションを作る
+type tableSnapshot struct {
+	Name    string           `json:"name"`
+	Columns []columnSnapshot `json:"columns"`
+}
+
+type columnSnapshot struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable,omitempty"`
+}
+
+// migrationFormats 対応しているマイグレーションファイルの形式
+var migrationFormats = []string{"goose", "atlas"}
+
+// runMigration //gen:tableの構造体をスナップショットと比べ、変更があればALTER TABLEのひな形を出力する。
+// 初回はスナップショットを保存するだけ
+func runMigration(args []string) error {
+	flags := flag.NewFlagSet("migration", flag.ExitOnError)
+	dir := flags.String("dir", ".", "directory to analyze")
+	snapshotPath := flags.String("snapshot", ".gen-struct-tables.json", "file recording the table shapes of the previous run")
+	outDir := flags.String("out", "migrations", "directory to write migration stubs into")
+	format := flags.String("format", "goose", "migration file format (goose, atlas)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if !containsTargetField(*format, migrationFormats...) {
+		return fmt.Errorf("migration: unsupported format %q", *format)
+	}
+	tables, err := loadTables(*dir)
+	if err != nil {
+		return err
+	}
+	current := snapshotTables(tables)
+	previous, err := readTableSnapshot(*snapshotPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Printf("no snapshot found; recorded %d tables in %s", len(current), *snapshotPath)
+		return writeTableSnapshot(*snapshotPath, current)
+	}
+	if err != nil {
+		return err
+	}
+	up, down := diffTables(previous, current)
+	if len(up) == 0 {
+		log.Println("no schema changes")
+		return nil
+	}
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(*outDir, time.Now().UTC().Format("20060102150405")+"_gen_struct.sql")
+	if err := os.WriteFile(path, []byte(migrationSQL(*format, up, down)), 0o644); err != nil {
+		return err
+	}
+	log.Printf("wrote %s; review it before applying", path)
+	return writeTableSnapshot(*snapshotPath, current)
+}
+
+func snapshotTables(tables []*table) []tableSnapshot {
+	snapshots := make([]tableSnapshot, 0, len(tables))
+	for _, t := range tables {
+		s := tableSnapshot{Name: t.name}
+		for _, c := range t.columns {
+			s.Columns = append(s.Columns, columnSnapshot{Name: c.name, Type: c.typ, Nullable: c.nullable})
+		}
+		snapshots = append(snapshots, s)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Name < snapshots[j].Name
+	})
+	return snapshots
+}
+
+func readTableSnapshot(path string) ([]tableSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []tableSnapshot
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return snapshots, nil
+}
+
+func writeTableSnapshot(path string, snapshots []tableSnapshot) error {
+	data, err := json.MarshalIndent(snapshots, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// diffTables 前回から今回への変更（up）と、それを戻す文（down）を返す
+func diffTables(previous, current []tableSnapshot) (up, down []string) {
+	prevByName := make(map[string]tableSnapshot, len(previous))
+	for _, t := range previous {
+		prevByName[t.Name] = t
+	}
+	for _, t := range current {
+		prev, ok := prevByName[t.Name]
+		delete(prevByName, t.Name)
+		if !ok {
+			up = append(up, createTableSQL(t))
+			down = append(down, fmt.Sprintf("DROP TABLE %s;", t.Name))
+			continue
+		}
+		prevColumns := make(map[string]columnSnapshot, len(prev.Columns))
+		for _, c := range prev.Columns {
+			prevColumns[c.Name] = c
+		}
+		for _, c := range t.Columns {
+			old, ok := prevColumns[c.Name]
+			delete(prevColumns, c.Name)
+			switch {
+			case !ok:
+				up = append(up, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;", t.Name, columnSQL(c)))
+				down = append(down, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", t.Name, c.Name))
+			case old.Type != c.Type:
+				up = append(up, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s;", t.Name, c.Name, c.Type))
+				down = append(down, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s;", t.Name, c.Name, old.Type))
+			}
+			if ok && old.Nullable != c.Nullable {
+				up = append(up, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s NOT NULL;", t.Name, c.Name, setOrDrop(!c.Nullable)))
+				down = append(down, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s NOT NULL;", t.Name, c.Name, setOrDrop(!old.Nullable)))
+			}
+		}
+		for _, c := range prev.Columns {
+			if _, removed := prevColumns[c.Name]; removed {
+				up = append(up, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", t.Name, c.Name))
+				down = append(down, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;", t.Name, columnSQL(c)))
+			}
+		}
+	}
+	for _, t := range previous {
+		if _, removed := prevByName[t.Name]; removed {
+			up = append(up, fmt.Sprintf("DROP TABLE %s;", t.Name))
+			down = append(down, createTableSQL(t))
+		}
+	}
+	// 戻すときは逆順に実行する
+	for i, j := 0, len(down)-1; i < j; i, j = i+1, j-1 {
+		down[i], down[j] = down[j], down[i]
+	}
+	return up, down
+}
+
+func setOrDrop(set bool) string {
+	if set {
+		return "SET"
+	}
+	return "DROP"
+}
+
+func columnSQL(c columnSnapshot) string {
+	if c.Nullable {
+		return fmt.Sprintf("%s %s", c.Name, c.Type)
+	}
+	return fmt.Sprintf("%s %s NOT NULL", c.Name, c.Type)
+}
+
+func createTableSQL(t tableSnapshot) string {
+	columns := make([]string, 0, len(t.Columns))
+	for _, c := range t.Columns {
+		columns = append(columns, "\t"+columnSQL(c))
+	}
+	return fmt.Sprintf("CREATE TABLE %s (\n%s\n);", t.Name, strings.Join(columns, ",\n"))
+}
+
+// migrationSQL マイグレーションファイルの中身。atlasの形式はupだけを書く
+func migrationSQL(format string, up, down []string) string {
+	var b strings.Builder
+	b.WriteString("-- Generated by gen-struct from //gen:table structs. Review before applying.\n")
+	if format == "goose" {
+		b.WriteString("-- +goose Up\n")
+	}
+	for _, stmt := range up {
+		b.WriteString(stmt + "\n")
+	}
+	if format == "goose" {
+		b.WriteString("\n-- +goose Down\n")
+		for _, stmt := range down {
+			b.WriteString(stmt + "\n")
+		}
+	}
+	return b.String()
+}
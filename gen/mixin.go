@@ -0,0 +1,137 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// timestampsMixin //gen:mixin timestampsで生成する、埋め込んで使う型の名前
+const timestampsMixin = "Timestamps"
+
+// timestampsMixinFields Timestampsの持つフィールド。埋め込んだ構造体ではこれらのフィールドがあるものとして扱う
+var timestampsMixinFields = []string{"CreatedAt", "UpdatedAt"}
+
+// mixinKinds 生成できるmixin
+var mixinKinds = []string{"timestamps"}
+
+// embedsTimestamps 構造体がTimestampsを埋め込んでいるか
+func embedsTimestamps(structType *ast.StructType) bool {
+	for _, field := range structType.Fields.List {
+		if len(field.Names) > 0 {
+			continue
+		}
+		typ := field.Type
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		}
+		if ident, ok := typ.(*ast.Ident); ok && ident.Name == timestampsMixin {
+			return true
+		}
+	}
+	return false
+}
+
+// promotedMixinField 埋め込んだTimestampsから昇格したフィールドの宣言。
+// 型はtimeパッケージをtimeという名前で参照する（newRendererでimportできるようにしておく）
+func promotedMixinField(structType *ast.StructType, fieldName string) *ast.Field {
+	if !containsTargetField(fieldName, timestampsMixinFields...) || !embedsTimestamps(structType) {
+		return nil
+	}
+	return &ast.Field{
+		Names: []*ast.Ident{ast.NewIdent(fieldName)},
+		Type:  &ast.SelectorExpr{X: ast.NewIdent("time"), Sel: ast.NewIdent("Time")},
+	}
+}
+
+// renderMixin //gen:mixinで指定した型を生成する。
+// 同じパッケージの複数のファイルで指定されていても、ファイル名の順で最初のファイルにだけ生成する
+func renderMixin(r *renderer, targets []*directiveTarget) error {
+	kinds := make(map[string]bool)
+	for _, target := range targets {
+		if len(target.d.args) == 0 {
+			return fmt.Errorf("%s: //gen:mixin requires a kind (%s)", target.s.name(), strings.Join(mixinKinds, ", "))
+		}
+		for _, arg := range target.d.args {
+			if !containsTargetField(arg.key, mixinKinds...) || arg.value != "" {
+				return fmt.Errorf("%s: unknown //gen:mixin %s (want one of %s)", target.s.name(), arg.key, strings.Join(mixinKinds, ", "))
+			}
+			kinds[arg.key] = true
+		}
+	}
+	if !kinds["timestamps"] {
+		return nil
+	}
+	owner, err := mixinOwnerFile(r.t.fsys, r.t.path, r.t.packageName, "timestamps")
+	if err != nil {
+		return err
+	}
+	if owner != r.t.filename {
+		return nil
+	}
+	return r.execute("mixin", timestampsMixinTemplate, r.importName("time"))
+}
+
+// mixinOwnerFile パッケージのディレクトリで//gen:mixin kindを指定しているファイルのうち、名前が最初のもの
+func mixinOwnerFile(fsys fs.FS, dir, packageName, kind string) (string, error) {
+	sources, err := packageSources(fsys, dir)
+	if err != nil {
+		return "", err
+	}
+	var owners []string
+	for _, source := range sources {
+		name := source.name
+		if !bytes.Contains(source.src, []byte(directivePrefix+"mixin")) {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), name, source.src, parser.ParseComments)
+		if err != nil || file.Name.Name != packageName {
+			continue
+		}
+		for _, decl := range file.Decls {
+			structs, _ := annotatedStructs(decl)
+			for _, s := range structs {
+				if d := s.directive("mixin"); d != nil {
+					if _, ok := d.arg(kind); ok {
+						owners = append(owners, name)
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(owners)
+	if len(owners) == 0 {
+		return "", nil
+	}
+	return owners[0], nil
+}
+
+const timestampsMixinTemplate = `
+// Timestamps is embedded in structs that record when they were created and
+// last updated. Generators treat its fields as fields of the embedding struct.
+type Timestamps struct {
+	CreatedAt {{.}}.Time
+	UpdatedAt {{.}}.Time
+}
+
+func (s *Timestamps) SetCreatedAt(v {{.}}.Time) {
+	s.CreatedAt = v
+}
+
+func (s *Timestamps) SetUpdatedAt(v {{.}}.Time) {
+	s.UpdatedAt = v
+}
+
+// Touch sets UpdatedAt to now, and CreatedAt too when it is not set yet.
+func (s *Timestamps) Touch(now {{.}}.Time) {
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = now
+	}
+	s.UpdatedAt = now
+}
+`
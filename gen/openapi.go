@@ -0,0 +1,483 @@
+package gen
+
+import (
+	"fmt"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openAPISpec OpenAPI 3のcomponents/schemasか、Swagger 2.0のdefinitions
+type openAPISpec struct {
+	Components struct {
+		Schemas openAPIProperties `yaml:"schemas"`
+	} `yaml:"components"`
+	Definitions openAPIProperties `yaml:"definitions"`
+}
+
+// openAPISchema スキーマのうち、構造体とタグを作るのに使うところ
+type openAPISchema struct {
+	Ref                  string                `yaml:"$ref"`
+	Type                 openAPIType           `yaml:"type"`
+	Format               string                `yaml:"format"`
+	Description          string                `yaml:"description"`
+	Properties           openAPIProperties     `yaml:"properties"`
+	Required             []string              `yaml:"required"`
+	Items                *openAPISchema        `yaml:"items"`
+	AdditionalProperties *openAPIAdditional    `yaml:"additionalProperties"`
+	AllOf                []*openAPISchema      `yaml:"allOf"`
+	OneOf                []*openAPISchema      `yaml:"oneOf"`
+	AnyOf                []*openAPISchema      `yaml:"anyOf"`
+	Enum                 []any                 `yaml:"enum"`
+	Nullable             bool                  `yaml:"nullable"`
+	MinLength            *int                  `yaml:"minLength"`
+	MaxLength            *int                  `yaml:"maxLength"`
+	MinItems             *int                  `yaml:"minItems"`
+	MaxItems             *int                  `yaml:"maxItems"`
+	Minimum              *float64              `yaml:"minimum"`
+	Maximum              *float64              `yaml:"maximum"`
+	ExclusiveMinimum     openAPIExclusiveLimit `yaml:"exclusiveMinimum"`
+	ExclusiveMaximum     openAPIExclusiveLimit `yaml:"exclusiveMaximum"`
+}
+
+// openAPIType typeは3.1ではtype: [string, "null"]のように配列でも書ける
+type openAPIType []string
+
+func (t *openAPIType) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*t = openAPIType{node.Value}
+		return nil
+	}
+	var types []string
+	if err := node.Decode(&types); err != nil {
+		return err
+	}
+	*t = types
+	return nil
+}
+
+// name null以外の型。なければ空
+func (t openAPIType) name() string {
+	for _, name := range t {
+		if name != "null" {
+			return name
+		}
+	}
+	return ""
+}
+
+// openAPIProperty 名前とスキーマ。propertiesやschemasは書いた順に構造体とフィールドを並べる
+type openAPIProperty struct {
+	name   string
+	schema *openAPISchema
+}
+
+type openAPIProperties []*openAPIProperty
+
+func (p *openAPIProperties) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping", node.Line)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		s := &openAPISchema{}
+		if err := node.Content[i+1].Decode(s); err != nil {
+			return err
+		}
+		*p = append(*p, &openAPIProperty{name: node.Content[i].Value, schema: s})
+	}
+	return nil
+}
+
+func (p openAPIProperties) lookup(name string) *openAPISchema {
+	for _, prop := range p {
+		if prop.name == name {
+			return prop.schema
+		}
+	}
+	return nil
+}
+
+// openAPIAdditional additionalPropertiesはtrue/falseかスキーマ
+type openAPIAdditional struct {
+	schema *openAPISchema
+}
+
+func (a *openAPIAdditional) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return nil
+	}
+	a.schema = &openAPISchema{}
+	return node.Decode(a.schema)
+}
+
+// openAPIExclusiveLimit exclusiveMinimumは3.0ではminimumを含まないかのbool、3.1では値
+type openAPIExclusiveLimit struct {
+	set   bool
+	value *float64
+}
+
+func (l *openAPIExclusiveLimit) UnmarshalYAML(node *yaml.Node) error {
+	if node.Tag == "!!bool" {
+		return node.Decode(&l.set)
+	}
+	l.set = true
+	return node.Decode(&l.value)
+}
+
+// openAPIGoName スキーマやプロパティの名前をGoの名前にする。user_id、userId、user-idはUserID
+func openAPIGoName(name string) string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+	}
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || r == '.' || r == ' ':
+			flush()
+			continue
+		case unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])):
+			flush()
+		}
+		word = append(word, r)
+	}
+	flush()
+	var b strings.Builder
+	for _, w := range words {
+		if protoInitialisms[strings.ToLower(w)] {
+			b.WriteString(strings.ToUpper(w))
+			continue
+		}
+		b.WriteString(exportedName(w))
+	}
+	return b.String()
+}
+
+// openAPIConverter OpenAPIのスキーマからスキーマのファイルの構造体を作る
+type openAPIConverter struct {
+	path       string
+	schemas    openAPIProperties
+	refPrefix  string            // #/components/schemas/
+	names      map[string]string // key: オブジェクトのスキーマ名, value: 構造体名
+	doc        *schemaDocument
+	directives []string
+	stamped    map[string]bool // key: CreatedAtとUpdatedAtを足すスキーマ名
+	declared   map[string]bool
+}
+
+// addOpenAPIStructs スキーマのopenapiのcomponents/schemasのオブジェクトごとに構造体を加える。
+// オブジェクトでないスキーマ（enumの文字列など）は参照するフィールドの型になる
+func (doc *schemaDocument) addOpenAPIStructs(schemaPath string, src []byte) error {
+	specPath := filepath.Join(filepath.Dir(schemaPath), doc.OpenAPI)
+	var spec openAPISpec
+	if err := yaml.Unmarshal(src, &spec); err != nil {
+		return fmt.Errorf("%s: %w", specPath, err)
+	}
+	c := &openAPIConverter{
+		path:      specPath,
+		schemas:   spec.Components.Schemas,
+		refPrefix: "#/components/schemas/",
+		names:     make(map[string]string),
+		doc:       doc,
+		stamped:   make(map[string]bool),
+		declared:  make(map[string]bool),
+	}
+	if len(c.schemas) == 0 {
+		c.schemas, c.refPrefix = spec.Definitions, "#/definitions/"
+	}
+	if len(c.schemas) == 0 {
+		return fmt.Errorf("%s: no components/schemas", specPath)
+	}
+	c.directives = doc.Directives
+	if c.directives == nil {
+		c.directives = []string{"setters"}
+	}
+	for _, prop := range c.schemas {
+		if c.isObject(prop.schema) {
+			c.names[prop.name] = openAPIGoName(prop.name)
+			c.stamped[prop.name] = doc.Timestamps == nil
+		}
+	}
+	if doc.Timestamps != nil {
+		for _, name := range *doc.Timestamps {
+			if _, ok := c.names[name]; !ok {
+				return fmt.Errorf("%s: timestamps: unknown object schema %s", schemaPath, name)
+			}
+			c.stamped[name] = true
+		}
+	}
+	for _, prop := range c.schemas {
+		name, ok := c.names[prop.name]
+		if !ok {
+			continue
+		}
+		doc := prop.schema.Description
+		if doc == "" {
+			doc = fmt.Sprintf("%s is generated from the OpenAPI schema %s.", name, prop.name)
+		}
+		if err := c.addStruct(name, doc, prop.schema, c.stamped[prop.name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isObject 構造体にするスキーマか
+func (c *openAPIConverter) isObject(s *openAPISchema) bool {
+	return len(s.Properties) > 0 || len(s.AllOf) > 0
+}
+
+// resolve $refの参照先のスキーマ名とスキーマ
+func (c *openAPIConverter) resolve(ref string) (string, *openAPISchema, error) {
+	name, ok := strings.CutPrefix(ref, c.refPrefix)
+	if !ok {
+		return "", nil, fmt.Errorf("%s: only local references to %s are supported, got %s", c.path, c.refPrefix, ref)
+	}
+	s := c.schemas.lookup(name)
+	if s == nil {
+		return "", nil, fmt.Errorf("%s: %s is not defined", c.path, ref)
+	}
+	return name, s, nil
+}
+
+// properties allOfで合成したものも含むプロパティと必須のプロパティ
+func (c *openAPIConverter) properties(s *openAPISchema, depth int) (openAPIProperties, []string, error) {
+	if depth > 32 {
+		return nil, nil, fmt.Errorf("%s: allOf is nested too deeply", c.path)
+	}
+	var props openAPIProperties
+	required := slices.Clone(s.Required)
+	for _, part := range s.AllOf {
+		if part.Ref != "" {
+			_, target, err := c.resolve(part.Ref)
+			if err != nil {
+				return nil, nil, err
+			}
+			part = target
+		}
+		partProps, partRequired, err := c.properties(part, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		props = append(props, partProps...)
+		required = append(required, partRequired...)
+	}
+	props = append(props, s.Properties...)
+	return props, required, nil
+}
+
+func (c *openAPIConverter) addStruct(name, doc string, s *openAPISchema, stamped bool) error {
+	if !token.IsIdentifier(name) {
+		return fmt.Errorf("%s: schema %s cannot be a struct name", c.path, name)
+	}
+	if c.declared[name] {
+		return fmt.Errorf("%s: struct %s is generated twice; rename the schema or the inline object's property", c.path, name)
+	}
+	c.declared[name] = true
+	props, required, err := c.properties(s, 0)
+	if err != nil {
+		return err
+	}
+	st := &schemaStruct{Name: name, Doc: doc, Directives: c.directives}
+	// ネストしたオブジェクトの構造体は、親の構造体の後に並べる
+	c.doc.Structs = append(c.doc.Structs, st)
+	seen := make(map[string]bool)
+	for _, prop := range props {
+		if seen[prop.name] {
+			continue
+		}
+		seen[prop.name] = true
+		fieldName := openAPIGoName(prop.name)
+		if !token.IsIdentifier(fieldName) {
+			return fmt.Errorf("%s: property %s of %s cannot be a field name", c.path, prop.name, name)
+		}
+		typ, err := c.goType(name+fieldName, prop.schema, 0)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", name, prop.name, err)
+		}
+		isRequired := slices.Contains(required, prop.name)
+		nullable := prop.schema.Nullable || slices.Contains(prop.schema.Type, "null")
+		if (!isRequired || nullable) && !strings.HasPrefix(typ, "[]") && !strings.HasPrefix(typ, "map[") && typ != "any" {
+			typ = "*" + typ
+		}
+		jsonTag := prop.name
+		if !isRequired {
+			jsonTag += ",omitempty"
+		}
+		tags := map[string]string{"json": jsonTag}
+		if rules := c.validateRules(prop.schema, typ, isRequired && !nullable); rules != "" {
+			tags["validate"] = rules
+		}
+		st.Fields = append(st.Fields, &schemaField{Name: fieldName, Type: typ, Doc: prop.schema.Description, Tags: tags})
+	}
+	if stamped {
+		for _, fieldName := range targetFields {
+			if !slices.ContainsFunc(st.Fields, func(f *schemaField) bool { return f.Name == fieldName }) {
+				st.Fields = append(st.Fields, &schemaField{Name: fieldName, Type: "time.Time", Tags: map[string]string{"json": "-"}})
+			}
+		}
+	}
+	return nil
+}
+
+// goType スキーマのGoの型。ネストしたオブジェクトはnestedNameの構造体にする
+func (c *openAPIConverter) goType(nestedName string, s *openAPISchema, depth int) (string, error) {
+	if depth > 32 {
+		return "", fmt.Errorf("type is nested too deeply")
+	}
+	if s.Ref != "" {
+		name, target, err := c.resolve(s.Ref)
+		if err != nil {
+			return "", err
+		}
+		if structName, ok := c.names[name]; ok {
+			return structName, nil
+		}
+		return c.goType(nestedName, target, depth+1)
+	}
+	if len(s.OneOf) > 0 || len(s.AnyOf) > 0 {
+		return "any", nil
+	}
+	switch s.Type.name() {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			return "time.Time", nil
+		case "byte", "binary":
+			return "[]byte", nil
+		}
+		return "string", nil
+	case "integer":
+		switch s.Format {
+		case "int32":
+			return "int32", nil
+		case "int64":
+			return "int64", nil
+		}
+		return "int", nil
+	case "number":
+		if s.Format == "float" {
+			return "float32", nil
+		}
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		if s.Items == nil {
+			return "[]any", nil
+		}
+		elem, err := c.goType(nestedName+"Item", s.Items, depth+1)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + elem, nil
+	}
+	if c.isObject(s) {
+		doc := s.Description
+		if doc == "" {
+			doc = fmt.Sprintf("%s is generated from an inline object of the OpenAPI spec.", nestedName)
+		}
+		if err := c.addStruct(nestedName, doc, s, false); err != nil {
+			return "", err
+		}
+		return nestedName, nil
+	}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.schema != nil {
+		elem, err := c.goType(nestedName+"Value", s.AdditionalProperties.schema, depth+1)
+		if err != nil {
+			return "", err
+		}
+		return "map[string]" + elem, nil
+	}
+	if s.Type.name() == "object" {
+		return "map[string]any", nil
+	}
+	return "any", nil
+}
+
+// validateRules go-playground/validatorのvalidateタグ。必須でなければomitemptyを先頭につける
+func (c *openAPIConverter) validateRules(s *openAPISchema, typ string, required bool) string {
+	if s.Ref != "" {
+		if _, target, err := c.resolve(s.Ref); err == nil && !c.isObject(target) {
+			s = target
+		} else {
+			return ""
+		}
+	}
+	var rules []string
+	number := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	limit := func(key string, v *int) {
+		if v != nil {
+			rules = append(rules, key+"="+strconv.Itoa(*v))
+		}
+	}
+	switch s.Type.name() {
+	case "string":
+		limit("min", s.MinLength)
+		limit("max", s.MaxLength)
+		switch s.Format {
+		case "email":
+			rules = append(rules, "email")
+		case "uuid":
+			rules = append(rules, "uuid")
+		case "uri", "url":
+			rules = append(rules, "url")
+		}
+	case "array":
+		limit("min", s.MinItems)
+		limit("max", s.MaxItems)
+	case "integer", "number":
+		switch {
+		case s.ExclusiveMinimum.value != nil:
+			rules = append(rules, "gt="+number(*s.ExclusiveMinimum.value))
+		case s.Minimum != nil && s.ExclusiveMinimum.set:
+			rules = append(rules, "gt="+number(*s.Minimum))
+		case s.Minimum != nil:
+			rules = append(rules, "gte="+number(*s.Minimum))
+		}
+		switch {
+		case s.ExclusiveMaximum.value != nil:
+			rules = append(rules, "lt="+number(*s.ExclusiveMaximum.value))
+		case s.Maximum != nil && s.ExclusiveMaximum.set:
+			rules = append(rules, "lt="+number(*s.Maximum))
+		case s.Maximum != nil:
+			rules = append(rules, "lte="+number(*s.Maximum))
+		}
+	}
+	if len(s.Enum) > 0 {
+		values := make([]string, 0, len(s.Enum))
+		for _, v := range s.Enum {
+			value := fmt.Sprint(v)
+			// oneofは空白で区切るので、空白を含む値は検証できない
+			if v == nil || value == "" || strings.ContainsAny(value, " \t") {
+				values = nil
+				break
+			}
+			values = append(values, value)
+		}
+		if values != nil {
+			rules = append(rules, "oneof="+strings.Join(values, " "))
+		}
+	}
+	// 数値と真偽値はゼロ値を必須の値と区別できない
+	base := strings.TrimPrefix(typ, "*")
+	if required && (base == "string" || strings.HasPrefix(base, "[]") || strings.HasPrefix(base, "map[")) {
+		return strings.Join(append([]string{"required"}, rules...), ",")
+	}
+	if len(rules) == 0 {
+		return ""
+	}
+	if !required {
+		rules = append([]string{"omitempty"}, rules...)
+	}
+	return strings.Join(rules, ",")
+}
@@ -0,0 +1,131 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// options //gen:optionsで生成するfunctional optionsのコンストラクタ
+type options struct {
+	StructName string
+	NewName    string // NewExample
+	OptionType string // ExampleOption
+	TypeArgs   string // 型パラメータのある構造体のOptionTypeにつける型引数（[T]）
+	Options    []*option
+	EnsureNow  string // EnsureCreatedAtで作成日時を設定する場合の時刻の式
+}
+
+type option struct {
+	FuncName  string // WithName
+	FieldName string
+	FieldType string
+}
+
+// newOptions フィールドごとのWithXと、それを受け取るNewXを作る。
+// 同じパッケージの構造体でWithXがぶつかる場合はprefix=Productで名前を変える
+func newOptions(r *renderer, target *directiveTarget) (*options, error) {
+	structName := target.s.name()
+	if target.s.directive("constructor") != nil {
+		return nil, fmt.Errorf("%s: //gen:options and //gen:constructor both generate New%s", structName, exportedName(structName))
+	}
+	prefix, _ := target.d.arg("prefix")
+	if prefix != "" {
+		prefix = exportedName(prefix)
+	}
+	var selected []string
+	if v, ok := target.d.arg("fields"); ok {
+		selected = strings.Split(v, ",")
+		for _, name := range selected {
+			if !hasField(target.s.structType(), name) {
+				return nil, fmt.Errorf("%s: //gen:options field %s does not exist", structName, name)
+			}
+		}
+	}
+	o := &options{
+		StructName: structName,
+		NewName:    "New" + exportedName(structName),
+		OptionType: exportedName(structName) + "Option",
+		TypeArgs:   target.s.typeArgs(),
+	}
+	exported := ast.IsExported(structName)
+	if !exported {
+		o.NewName = unexportedName(o.NewName)
+		o.OptionType = unexportedName(o.OptionType)
+	}
+	o.NewName, o.OptionType = r.ident(o.NewName), r.ident(o.OptionType)
+	for _, field := range target.s.structType().Fields.List {
+		// //gen:derivedのキャッシュは設定させない
+		if ident, ok := field.Type.(*ast.Ident); ok && ident.Name == derivedCacheType(structName) {
+			continue
+		}
+		for _, name := range field.Names {
+			if name.Name == "_" || (selected != nil && !containsTargetField(name.Name, selected...)) {
+				continue
+			}
+			funcName := "With" + prefix + exportedName(name.Name)
+			if !exported {
+				funcName = unexportedName(funcName)
+			}
+			if !token.IsIdentifier(funcName) {
+				return nil, fmt.Errorf("%s: //gen:options prefix %q makes an invalid function name %s", structName, prefix, funcName)
+			}
+			o.Options = append(o.Options, &option{
+				FuncName:  r.ident(funcName),
+				FieldName: name.Name,
+				FieldType: r.typeString(field.Type),
+			})
+		}
+	}
+	// //gen:constructorと同じく、作成日時はオプションで指定されなければEnsureCreatedAtで設定する
+	if e := newEnsureCreatedAt(r, target.s); e != nil && r.invariants[structName] == "" {
+		o.EnsureNow = touchNow(r, target.s, e.Time)
+	}
+	return o, nil
+}
+
+func renderOptions(r *renderer, targets []*directiveTarget) error {
+	all := make([]*options, 0, len(targets))
+	seen := make(map[string]string)
+	for _, target := range targets {
+		o, err := newOptions(r, target)
+		if err != nil {
+			return err
+		}
+		for _, opt := range o.Options {
+			if other, ok := seen[opt.FuncName]; ok {
+				return fmt.Errorf("%s: //gen:options %s is also generated for %s; set prefix= on one of them", o.StructName, opt.FuncName, other)
+			}
+			seen[opt.FuncName] = o.StructName
+		}
+		all = append(all, o)
+	}
+	return r.execute("options", optionsTemplate, all)
+}
+
+const optionsTemplate = `
+{{range .}}
+{{- $o := .}}
+// {{.OptionType}} sets a field of a {{.StructName}} created by {{.NewName}}.
+type {{.OptionType}}{{typeParams .StructName}} func(*{{recv .StructName}})
+
+func {{.NewName}}{{typeParams .StructName}}(opts ...{{.OptionType}}{{.TypeArgs}}) *{{recv .StructName}} {
+	s := &{{recv .StructName}}{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	{{- if .EnsureNow}}
+	s.EnsureCreatedAt({{.EnsureNow}})
+	{{- end}}
+	return s
+}
+{{range .Options}}
+func {{.FuncName}}{{typeParams $o.StructName}}(v {{.FieldType}}) {{$o.OptionType}}{{$o.TypeArgs}} {
+	return func(s *{{recv $o.StructName}}) {
+		s.{{.FieldName}} = v
+	}
+}
+{{end}}
+{{end}}
+`
@@ -0,0 +1,173 @@
+package gen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// outputCoordinator 複数のgoroutineから生成しても同じ出力先に書き込まないようにし、
+// ログをファイル単位でまとめて出す
+type outputCoordinator struct {
+	force   bool // -force。手で編集された生成ファイルも上書きする
+	mu      sync.Mutex
+	claimed map[string]string // key: 出力先, value: 生成元のファイル
+	logger  *log.Logger
+	// failures 生成に失敗したファイルの数。出力がないのが削除されたからか分からないので、1つでもあれば-pruneしない
+	failures int
+	// metrics -stats-fileに書く集計。指定がなければnil
+	metrics *runMetrics
+	// diag 診断の出力形式と言語。ゼロ値なら英語のテキスト
+	diag diagOptions
+}
+
+func newOutputCoordinator(logger *log.Logger) *outputCoordinator {
+	return &outputCoordinator{
+		claimed: make(map[string]string),
+		logger:  logger,
+	}
+}
+
+// claim 出力先を生成元のファイルで予約する。別のファイルが予約済みならエラーにする
+func (c *outputCoordinator) claim(outputPath, source string) error {
+	key, err := outputPathKey(outputPath)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if owner, ok := c.claimed[key]; ok && owner != source {
+		return fmt.Errorf("%s: output path is already written by %s", outputPath, owner)
+	}
+	c.claimed[key] = source
+	return nil
+}
+
+// writeFile 出力先を予約してから書き込む。内容が変わらなければ、更新日時を変えてビルドキャッシュを無効にしないよう書き込まない。
+// ツールを更新しただけで全ての生成ファイルが書き換わらないよう、バージョンの行は比べない
+func (c *outputCoordinator) writeFile(outputPath, source string, data []byte) (written bool, err error) {
+	if err := c.claim(outputPath, source); err != nil {
+		return false, err
+	}
+	if err := checkUnedited(outputPath, data, c.force); err != nil {
+		return false, err
+	}
+	// 手で上書きした範囲（gen:override）は生成した宣言の代わりに残す
+	if current, err := os.ReadFile(outputPath); err == nil {
+		if data, err = mergeOverrides(current, data, c.force); err != nil {
+			return false, fmt.Errorf("%s: %w", outputPath, err)
+		}
+		// -checkと同じく、ツールのバージョンとチェックサムの行だけが違うファイルは書き直さない。
+		// 手で変えたそれらの行は-forceで元に戻せるようにする
+		if bytes.Equal(current, data) || !handEdited(current) && bytes.Equal(withoutToolVersion(current), withoutToolVersion(data)) {
+			return false, nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(outputPath, data, 0644)
+}
+
+// fileLog 1ファイル分の診断。flushするまでためておき、他のファイルのログと混ざらないようにする
+type fileLog struct {
+	c           *outputCoordinator
+	file        string
+	diagnostics []*diagnostic
+	failed      bool
+}
+
+func (c *outputCoordinator) fileLog(file string) *fileLog {
+	return &fileLog{c: c, file: file}
+}
+
+// report 診断を加える。errorの診断があればファイルの生成に失敗したものとして数える
+func (l *fileLog) report(d *diagnostic) {
+	if d.severity() == severityError {
+		l.failed = true
+	}
+	l.diagnostics = append(l.diagnostics, d)
+}
+
+// Error 構文エラーは位置つきで1件ずつ出す
+func (l *fileLog) Error(err error) {
+	var syntaxErrs scanner.ErrorList
+	if errors.As(err, &syntaxErrs) {
+		for _, e := range syntaxErrs {
+			l.report(newDiagnostic(diagSyntax, e.Pos, e.Msg))
+		}
+		return
+	}
+	l.report(newDiagnostic(diagGenerateFailed, token.Position{Filename: l.file}, err))
+}
+
+func (l *fileLog) flush() {
+	l.c.mu.Lock()
+	defer l.c.mu.Unlock()
+	if l.failed {
+		l.c.failures++
+	}
+	for _, d := range l.diagnostics {
+		// JSONは行の先頭から書かないと読めないので、ログの日時をつけない
+		if l.c.diag.json {
+			l.c.logger.Writer().Write(append(d.json(l.c.diag.lang), '\n'))
+			continue
+		}
+		l.c.logger.Println(d.text(l.c.diag.lang))
+	}
+	l.diagnostics = nil
+}
+
+// outputPathKey 出力先の比較に使うキー。
+// WindowsやmacOSでは大文字小文字だけが違うパスは同じファイルになるので、どの環境でも区別せずに比較する
+func outputPathKey(outputPath string) (string, error) {
+	abs, err := filepath.Abs(outputPath)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(filepath.ToSlash(abs)), nil
+}
+
+// checkOutputCollisions 別々のソースから同じ出力先に書き込もうとしていないか、書き込む前に確認する
+func checkOutputCollisions(generated []*generatedFile) error {
+	byKey := make(map[string][]*generatedFile, len(generated))
+	var keys []string
+	for _, g := range generated {
+		key, err := outputPathKey(g.path)
+		if err != nil {
+			return err
+		}
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], g)
+	}
+	var errs []error
+	for _, key := range keys {
+		files := byKey[key]
+		if len(files) < 2 {
+			continue
+		}
+		sources := make([]string, 0, len(files))
+		caseOnly := false
+		for _, g := range files {
+			sources = append(sources, g.source)
+			if g.path != files[0].path {
+				caseOnly = true
+			}
+		}
+		if caseOnly {
+			errs = append(errs, fmt.Errorf("output path collision on case-insensitive filesystems: %s would be written by %s", files[0].path, strings.Join(sources, ", ")))
+			continue
+		}
+		errs = append(errs, fmt.Errorf("output path collision: %s would be written by %s", files[0].path, strings.Join(sources, ", ")))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,139 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeTree dirの下にfiles（key: /区切りの相対パス）を書く
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// modelSource パッケージpkgの//gen:settersのついた構造体を持つソース
+func modelSource(pkg string) string {
+	return fmt.Sprintf("package %s\n\nimport \"time\"\n\n//gen:setters\ntype Model struct {\n\tCreatedAt time.Time\n\tUpdatedAt time.Time\n}\n", pkg)
+}
+
+// 同じファイル名のソースが複数のディレクトリにあっても、並行して生成した出力はそれぞれのディレクトリに書き、
+// ログはファイルごとにまとまる
+func TestGenerateTreeDuplicateBaseNames(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"go.mod": "module example.com/dup\n\ngo 1.23\n"}
+	var pkgs []string
+	for i := range 8 {
+		pkg := fmt.Sprintf("p%d", i)
+		pkgs = append(pkgs, pkg)
+		files[pkg+"/model.go"] = modelSource(pkg)
+		files[pkg+"/sub/model.go"] = modelSource("sub")
+	}
+	// 構文エラーのファイルも同じ名前にして、ログが他のファイルと混ざらないことを確かめる
+	files["broken/model.go"] = "package broken\n\n//gen:setters\ntype Model struct {\n\tA int\n\tB chan<<- int\n}\n"
+	files["broken/sub/model.go"] = "package sub\n\n//gen:setters\ntype Model struct {\n\tA int\n\tB chan<<- int\n}\n"
+	writeTree(t, dir, files)
+
+	g, err := generateTree(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOutputCollisions(g.generated); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(g.generated), 2*len(pkgs); got != want {
+		t.Fatalf("generated %d files, want %d", got, want)
+	}
+	if g.out.failures != 2 {
+		t.Errorf("failures = %d, want 2", g.out.failures)
+	}
+	written, _, errs := g.write()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if len(written) != len(g.generated) {
+		t.Errorf("wrote %d files, want %d", len(written), len(g.generated))
+	}
+	for _, pkg := range pkgs {
+		for _, rel := range []string{pkg, pkg + "/sub"} {
+			data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel), "model_setters.go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantPackage := "package " + filepath.Base(rel) + "\n"
+			if !bytes.Contains(data, []byte(wantPackage)) {
+				t.Errorf("%s/model_setters.go does not contain %q", rel, wantPackage)
+			}
+			if !bytes.Contains(data, []byte("func (s *Model) SetCreatedAt(")) {
+				t.Errorf("%s/model_setters.go has no SetCreatedAt", rel)
+			}
+		}
+	}
+	// 1つのファイルの診断は続けて出る
+	var sources []string
+	for _, line := range logLines(g.logs) {
+		source, _, _ := strings.Cut(line, ":")
+		if len(sources) == 0 || sources[len(sources)-1] != source {
+			sources = append(sources, source)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, source := range sources {
+		if seen[source] {
+			t.Errorf("logs of %s are interleaved with other files:\n%s", source, g.logs)
+		}
+		seen[source] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("logs mention %d files, want the 2 broken ones:\n%s", len(seen), g.logs)
+	}
+}
+
+// 別々のソースから同じ出力先には書き込めず、同じ名前の別のディレクトリには並行して書き込める
+func TestOutputCoordinatorWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	c := newOutputCoordinator(log.New(&bytes.Buffer{}, "", 0))
+	var wg sync.WaitGroup
+	errs := make([]error, 16)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sub := filepath.Join(dir, fmt.Sprintf("p%d", i))
+			_, errs[i] = c.writeFile(filepath.Join(sub, "model_setters.go"), filepath.Join(sub, "model.go"), []byte(fmt.Sprintf("package p%d\n", i)))
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("p%d: %v", i, err)
+		}
+	}
+
+	output := filepath.Join(dir, "p0", "model_setters.go")
+	if _, err := c.writeFile(output, filepath.Join(dir, "p1", "model.go"), []byte("package p0\n")); err == nil {
+		t.Errorf("writing %s from another source succeeded", output)
+	}
+	// 大文字小文字だけが違うパスも同じ出力先として扱う
+	upper := filepath.Join(dir, "P0", "MODEL_SETTERS.go")
+	if err := c.claim(upper, filepath.Join(dir, "p2", "model.go")); err == nil {
+		t.Errorf("claiming %s from another source succeeded", upper)
+	}
+	// 同じソースからは何度でも書ける
+	if _, err := c.writeFile(output, filepath.Join(dir, "p0", "model.go"), []byte("package p0\n")); err != nil {
+		t.Error(err)
+	}
+}
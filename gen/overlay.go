@@ -0,0 +1,81 @@
+package gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// overlayFileName -overlayのディレクトリに書く、go build -overlayに渡すファイルの名前
+const overlayFileName = "overlay.json"
+
+// overlayRoot -overlayのディレクトリに写すディレクトリ構成の基準。go.modのあるディレクトリで、なければdir
+func overlayRoot(dir string) string {
+	if goMod, err := findGoMod(dir); err == nil {
+		return filepath.Dir(goMod)
+	}
+	return dir
+}
+
+// outputDirFor ソースのディレクトリdirの生成ファイルを出力するディレクトリ。空ならソースの隣に出力する。
+// -overlayならモジュールの中の位置を保ったまま、-overlayのディレクトリの下に出力する
+func (o *generateOptions) outputDirFor(dir string) string {
+	if o.overlay == "" {
+		return o.outputDir
+	}
+	rel, err := filepath.Rel(o.overlayRoot, dir)
+	if err != nil {
+		return o.overlay
+	}
+	return filepath.Join(o.overlay, rel)
+}
+
+// checkOverlayRoot -overlayで生成するディレクトリdirがモジュールの中にあるか。
+// 外にあるとディレクトリ構成を写せず、overlay.jsonでソースの位置に戻せない
+func (o *generateOptions) checkOverlayRoot(dir string) error {
+	if o.overlay == "" {
+		return nil
+	}
+	rel, err := filepath.Rel(o.overlayRoot, dir)
+	if err != nil || !filepath.IsLocal(rel) && rel != "." {
+		return fmt.Errorf("-overlay: %s is outside the module root %s", dir, o.overlayRoot)
+	}
+	return nil
+}
+
+// overlayConfig go build -overlayのJSON
+type overlayConfig struct {
+	Replace map[string]string
+}
+
+// writeOverlay 生成したファイルを、ソースのディレクトリにあるものとしてビルドできるoverlay.jsonを書く。
+// 読み取り専用のソースでも go build -overlay=<dir>/overlay.json でビルドできる
+func writeOverlay(opts *generateOptions, generated []*generatedFile) error {
+	cfg := overlayConfig{Replace: make(map[string]string, len(generated))}
+	for _, g := range generated {
+		path, err := filepath.Abs(g.path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(opts.overlay, path)
+		if err != nil {
+			return err
+		}
+		cfg.Replace[filepath.Join(opts.overlayRoot, rel)] = path
+	}
+	data, err := json.MarshalIndent(&cfg, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	path := filepath.Join(opts.overlay, overlayFileName)
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+	if err := os.MkdirAll(opts.overlay, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,242 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// 生成したファイルの中で、再生成しても内容を残す範囲の目印。
+// 範囲はトップレベルの宣言を1つだけ囲み、再生成ではその宣言の代わりに範囲をそのまま残す
+const (
+	overrideBegin = "// gen:override begin"
+	overrideEnd   = "// gen:override end"
+)
+
+// overrideSpans 上書きする範囲（開始の目印の行から終わりの目印の行の改行まで）のバイト位置
+func overrideSpans(src []byte) ([][2]int, error) {
+	var spans [][2]int
+	begin := -1
+	for off, line := 0, 1; off < len(src); line++ {
+		next := len(src)
+		if i := bytes.IndexByte(src[off:], '\n'); i >= 0 {
+			next = off + i + 1
+		}
+		text := strings.TrimSpace(string(src[off:next]))
+		if text != overrideBegin && text != overrideEnd {
+			off = next
+			continue
+		}
+		// 宣言の中の一部だけを残すと、どこに戻せばよいか分からない
+		if src[off] != '/' {
+			return nil, fmt.Errorf("line %d: %s must not be indented; wrap a whole top-level declaration", line, text)
+		}
+		switch {
+		case text == overrideBegin && begin >= 0:
+			return nil, fmt.Errorf("line %d: %s inside another override region", line, overrideBegin)
+		case text == overrideBegin:
+			begin = off
+		case begin < 0:
+			return nil, fmt.Errorf("line %d: %s without %s", line, overrideEnd, overrideBegin)
+		default:
+			spans = append(spans, [2]int{begin, next})
+			begin = -1
+		}
+		off = next
+	}
+	if begin >= 0 {
+		return nil, fmt.Errorf("line %d: %s without %s", bytes.Count(src[:begin], []byte("\n"))+1, overrideBegin, overrideEnd)
+	}
+	return spans, nil
+}
+
+// overrideRegion 上書きする範囲と、範囲が置き換える宣言
+type overrideRegion struct {
+	start, end int
+	key        string
+	// withDoc 宣言のドキュメントコメントも範囲に含む
+	withDoc bool
+}
+
+// overrideRegions src（今の生成したファイル）の上書きする範囲
+func overrideRegions(src []byte) ([]*overrideRegion, error) {
+	if !bytes.Contains(src, []byte(overrideBegin)) && !bytes.Contains(src, []byte(overrideEnd)) {
+		return nil, nil
+	}
+	spans, err := overrideSpans(src)
+	if err != nil || len(spans) == 0 {
+		return nil, err
+	}
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read override regions: %w", err)
+	}
+	regions := make([]*overrideRegion, 0, len(spans))
+	seen := make(map[string]bool)
+	for _, span := range spans {
+		region := &overrideRegion{start: span[0], end: span[1]}
+		for _, decl := range file.Decls {
+			if off := fileSet.Position(decl.Pos()).Offset; off < span[0] || off >= span[1] {
+				continue
+			}
+			if region.key != "" {
+				return nil, fmt.Errorf("line %d: override region must contain exactly one declaration", fileSet.Position(decl.Pos()).Line)
+			}
+			region.key = declKey(decl)
+			if doc := declDoc(decl); doc != nil {
+				region.withDoc = fileSet.Position(doc.Pos()).Offset >= span[0]
+			}
+		}
+		if region.key == "" {
+			return nil, fmt.Errorf("line %d: override region must contain exactly one declaration", bytes.Count(src[:span[0]], []byte("\n"))+1)
+		}
+		if seen[region.key] {
+			return nil, fmt.Errorf("%s is overridden more than once", region.key)
+		}
+		seen[region.key] = true
+		regions = append(regions, region)
+	}
+	return regions, nil
+}
+
+// declKey 再生成した後も同じ宣言を見つけるための名前。メソッドはExample.SetName、型などはtype ExampleKeyのようにする
+func declKey(decl ast.Decl) string {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		if decl.Recv != nil {
+			return receiverTypeName(decl) + "." + decl.Name.Name
+		}
+		return decl.Name.Name
+	case *ast.GenDecl:
+		var names []string
+		for _, spec := range decl.Specs {
+			switch spec := spec.(type) {
+			case *ast.TypeSpec:
+				names = append(names, spec.Name.Name)
+			case *ast.ValueSpec:
+				for _, name := range spec.Names {
+					names = append(names, name.Name)
+				}
+			}
+		}
+		return decl.Tok.String() + " " + strings.Join(names, ", ")
+	}
+	return ""
+}
+
+// generatedDecls 生成したファイルの宣言の位置（key: declKey）。
+// value[0]はドキュメントコメントの先頭、value[1]は宣言の先頭、value[2]は宣言の行の終わり
+func generatedDecls(src []byte) (map[string][3]int, error) {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	decls := make(map[string][3]int, len(file.Decls))
+	for _, decl := range file.Decls {
+		start := fileSet.Position(decl.Pos()).Offset
+		doc := start
+		if d := declDoc(decl); d != nil {
+			doc = fileSet.Position(d.Pos()).Offset
+		}
+		end := fileSet.Position(decl.End()).Offset
+		if end < len(src) && src[end] == '\n' {
+			end++
+		}
+		decls[declKey(decl)] = [3]int{doc, start, end}
+	}
+	return decls, nil
+}
+
+// replaceOverrides dstの宣言をregionsのsrcの範囲で置き換える。
+// 置き換える宣言がなければ、forceなら範囲を捨て、そうでなければエラーにする
+func replaceOverrides(dst, src []byte, regions []*overrideRegion, force bool) ([]byte, error) {
+	decls, err := generatedDecls(dst)
+	if err != nil {
+		return nil, err
+	}
+	type replacement struct {
+		start, end int
+		text       []byte
+	}
+	replacements := make([]replacement, 0, len(regions))
+	for _, region := range regions {
+		pos, ok := decls[region.key]
+		if !ok {
+			if force {
+				continue
+			}
+			return nil, fmt.Errorf("override region for %s no longer matches a generated declaration; remove it or rerun with -force to drop it", region.key)
+		}
+		start := pos[1]
+		if region.withDoc {
+			start = pos[0]
+		}
+		replacements = append(replacements, replacement{start: start, end: pos[2], text: src[region.start:region.end]})
+	}
+	sort.Slice(replacements, func(i, j int) bool { return replacements[i].start < replacements[j].start })
+	var buf bytes.Buffer
+	last := 0
+	for _, rep := range replacements {
+		buf.Write(dst[last:rep.start])
+		buf.Write(rep.text)
+		last = rep.end
+	}
+	buf.Write(dst[last:])
+	return buf.Bytes(), nil
+}
+
+// mergeOverrides 新しく生成した内容generatedに、今のファイルcurrentの上書きする範囲を残す。
+// 範囲の外は生成した内容のままにし、ハッシュを記録し直す
+func mergeOverrides(current, generated []byte, force bool) ([]byte, error) {
+	regions, err := overrideRegions(current)
+	if err != nil {
+		if force {
+			return generated, nil
+		}
+		return nil, err
+	}
+	if len(regions) == 0 {
+		return generated, nil
+	}
+	merged, err := replaceOverrides(generated, current, regions, force)
+	if err != nil {
+		return nil, err
+	}
+	return withChecksum(merged), nil
+}
+
+// withoutOverrides currentの上書きする範囲を、generatedで生成した宣言に戻す。
+// 初めて範囲で囲んだファイルは、ハッシュを記録したときには範囲がなかったので、戻してから確かめる
+func withoutOverrides(current, generated []byte) ([]byte, bool) {
+	regions, err := overrideRegions(current)
+	if err != nil || len(regions) == 0 {
+		return nil, false
+	}
+	decls, err := generatedDecls(generated)
+	if err != nil {
+		return nil, false
+	}
+	var buf bytes.Buffer
+	last := 0
+	for _, region := range regions {
+		pos, ok := decls[region.key]
+		if !ok {
+			return nil, false
+		}
+		buf.Write(current[last:region.start])
+		start := pos[1]
+		if region.withDoc {
+			start = pos[0]
+		}
+		buf.Write(generated[start:pos[2]])
+		last = region.end
+	}
+	buf.Write(current[last:])
+	return buf.Bytes(), true
+}
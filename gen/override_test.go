@@ -0,0 +1,82 @@
+package gen
+
+import (
+	"strings"
+	"testing"
+)
+
+// overrideGenerated 上書きする範囲を試す生成したファイル。time.Time、その別名、ポインタを受け取るセッターを持つ
+const overrideGenerated = `package m
+
+import "time"
+
+type Stamp = time.Time
+
+type Model struct {
+	At    time.Time
+	Alias Stamp
+	Ptr   *time.Time
+}
+
+// SetAt sets At.
+func (s *Model) SetAt(v time.Time) { s.At = v }
+
+// SetAlias sets Alias.
+func (s *Model) SetAlias(v Stamp) { s.Alias = v }
+
+// SetPtr sets Ptr.
+func (s *Model) SetPtr(v *time.Time) { s.Ptr = v }
+`
+
+// 上書きする範囲はトップレベルの宣言を1つだけ囲み、再生成しても残す。囲み方が違えばエラーにし、
+// 生成しなくなった宣言の範囲は-forceのときだけ捨てる
+func TestMergeOverrides(t *testing.T) {
+	region := func(decl string) string {
+		return overrideBegin + "\n" + decl + "\n" + overrideEnd + "\n"
+	}
+	setPtr := "// SetPtr sets Ptr.\nfunc (s *Model) SetPtr(v *time.Time) { s.Ptr = v }\n"
+	keptPtr := "// SetPtr sets Ptr, keeping a copy.\nfunc (s *Model) SetPtr(v *time.Time) { c := *v; s.Ptr = &c }"
+	tests := []struct {
+		name    string
+		current string
+		force   bool
+		want    string // 結果に含む内容。空ならgeneratedのまま
+		wantErr string
+	}{
+		{name: "none", current: overrideGenerated},
+		{name: "pointer setter", current: strings.Replace(overrideGenerated, setPtr, region(keptPtr), 1), want: region(keptPtr)},
+		{name: "alias setter", current: strings.Replace(overrideGenerated, "func (s *Model) SetAlias(v Stamp) { s.Alias = v }\n", region("func (s *Model) SetAlias(v Stamp) { s.Alias = v.UTC() }"), 1), want: "// SetAlias sets Alias.\n" + region("func (s *Model) SetAlias(v Stamp) { s.Alias = v.UTC() }")},
+		{name: "indented", current: strings.Replace(overrideGenerated, "\tPtr   *time.Time\n", "\t"+overrideBegin+"\n\tPtr   *time.Time\n\t"+overrideEnd+"\n", 1), wantErr: "must not be indented"},
+		{name: "nested", current: strings.Replace(overrideGenerated, setPtr, region(region(keptPtr)), 1), wantErr: "inside another override region"},
+		{name: "unterminated", current: strings.Replace(overrideGenerated, setPtr, overrideBegin+"\n"+setPtr, 1), wantErr: "without " + overrideEnd},
+		{name: "two declarations", current: strings.Replace(overrideGenerated, setPtr, region("func (s *Model) SetAt2(v time.Time) {}\n\n"+keptPtr), 1), wantErr: "exactly one declaration"},
+		{name: "stale", current: overrideGenerated + "\n" + region("func (s *Model) SetGone(v *Stamp) {}"), wantErr: "Model.SetGone no longer matches"},
+		{name: "stale forced", current: overrideGenerated + "\n" + region("func (s *Model) SetGone(v *Stamp) {}"), force: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeOverrides([]byte(tt.current), []byte(overrideGenerated), tt.force)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("mergeOverrides() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if string(got) != overrideGenerated {
+					t.Errorf("mergeOverrides() changed the generated code:\n%s", got)
+				}
+				return
+			}
+			if !strings.Contains(string(got), tt.want) {
+				t.Errorf("mergeOverrides() does not keep %q:\n%s", tt.want, got)
+			}
+			if strings.Count(string(got), ") Set") != 3 {
+				t.Errorf("mergeOverrides() duplicates or drops a setter:\n%s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// page //gen:pageで生成するカーソルページネーションのレスポンス
+type page struct {
+	StructName string
+	TypeName   string // ExamplePage
+	NewName    string // NewExamplePage
+	Keys       []*pageKey
+	// Cursor //gen:cursorのMarshalでカーソルを作る。falseならCursorTypeを生成して同じ形式でエンコードする
+	Cursor        bool
+	Sign          bool   // //gen:cursorが署名するので、NewXPageも鍵をとる
+	CursorType    string // ExamplePageCursor
+	UnmarshalName string // NextCursorを読む関数。UnmarshalExamplePageCursorかUnmarshalExampleCursor
+	Base64        string
+	JSON          string
+	Errors        string
+}
+
+// pageKey 次のページのカーソルに使うフィールド
+type pageKey struct {
+	FieldName string
+	FieldType string
+	Time      string // time.Timeの場合にtimeパッケージを参照している名前
+}
+
+// pageKeyFields key=の指定がない場合にカーソルに使うフィールド
+var pageKeyFields = []string{"CreatedAt", "ID"}
+
+// cursorKeys ディレクティブのkey=、なければCreatedAt, IDのうち構造体にあるものをカーソルのフィールドにする
+func cursorKeys(r *renderer, target *directiveTarget) ([]*pageKey, error) {
+	structName := target.s.name()
+	structType := target.s.structType()
+	var names []string
+	if v, ok := target.d.arg("key"); ok {
+		names = strings.Split(v, ",")
+	} else {
+		for _, name := range pageKeyFields {
+			if hasField(structType, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s: %s%s needs key=Field,... when the struct has neither CreatedAt nor ID", structName, directivePrefix, target.d.name)
+	}
+	keys := make([]*pageKey, 0, len(names))
+	for _, name := range names {
+		field := findField(structType, name)
+		if field == nil {
+			return nil, fmt.Errorf("%s: %s%s key field %s does not exist", structName, directivePrefix, target.d.name, name)
+		}
+		k := &pageKey{
+			FieldName: name,
+			FieldType: r.typeString(field.Type),
+			Time:      timeFieldQualifier(structType, name, r.importsMap),
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func newPage(r *renderer, target *directiveTarget) (*page, error) {
+	structName := target.s.name()
+	p := &page{
+		StructName: structName,
+		TypeName:   structName + "Page",
+		NewName:    "New" + structName + "Page",
+	}
+	if !ast.IsExported(structName) {
+		p.NewName = "new" + exportedName(structName) + "Page"
+	}
+	p.TypeName, p.NewName = r.ident(p.TypeName), r.ident(p.NewName)
+	keys, err := cursorKeys(r, target)
+	if err != nil {
+		return nil, err
+	}
+	p.Keys = keys
+	// //gen:cursorがあれば、次のページのカーソルもそのエンコード（署名を含む）で作る
+	if d := target.s.directive("cursor"); d != nil {
+		if _, disabled := r.t.disabled["cursor"]; !disabled {
+			p.Cursor = true
+			_, p.Sign = d.arg("sign")
+			p.UnmarshalName = cursorUnmarshalName(r, structName)
+			return p, nil
+		}
+	}
+	p.CursorType, p.UnmarshalName = structName+"PageCursor", "Unmarshal"+structName+"PageCursor"
+	if !ast.IsExported(structName) {
+		p.UnmarshalName = "unmarshal" + exportedName(structName) + "PageCursor"
+	}
+	p.CursorType, p.UnmarshalName = r.ident(p.CursorType), r.ident(p.UnmarshalName)
+	p.Base64 = r.importName("encoding/base64")
+	p.JSON = r.importName("encoding/json")
+	p.Errors = r.importName("errors")
+	return p, nil
+}
+
+func renderPage(r *renderer, targets []*directiveTarget) error {
+	pages := make([]*page, 0, len(targets))
+	for _, target := range targets {
+		p, err := newPage(r, target)
+		if err != nil {
+			return err
+		}
+		pages = append(pages, p)
+	}
+	return r.execute("page", pageTemplate, pages)
+}
+
+const pageTemplate = `
+{{range .}}
+// {{.TypeName}} is one page of {{.StructName}} values for cursor pagination.
+type {{.TypeName}} struct {
+	Items      []*{{.StructName}} ` + "`json:\"items\"`" + `
+	NextCursor string ` + "`json:\"next_cursor,omitempty\"`" + `
+	Total      int ` + "`json:\"total\"`" + `
+}
+
+// {{.NewName}} builds a page from up to limit+1 items fetched in cursor order.
+// When there are more than limit items the extra one is dropped and
+// NextCursor points after the last returned item{{if .Sign}}, signed with key{{end}};
+// decode it with {{.UnmarshalName}}. Total is left for the caller.
+func {{.NewName}}(items []*{{.StructName}}, limit int{{if .Sign}}, key []byte{{end}}) *{{.TypeName}} {
+	p := &{{.TypeName}}{Items: items}
+	if limit > 0 && len(items) > limit {
+		p.Items = items[:limit]
+		p.NextCursor = items[limit-1].pageCursor({{if .Sign}}key{{end}})
+	}
+	return p
+}
+{{if .Cursor}}
+func (s *{{.StructName}}) pageCursor({{if .Sign}}key []byte{{end}}) string {
+	return s.Cursor().Marshal({{if .Sign}}key{{end}})
+}
+{{- else}}
+// {{.CursorType}} is the position after the last item of a {{.TypeName}}, encoded
+// in NextCursor as opaque base64.
+type {{.CursorType}} struct {
+	{{- range .Keys}}
+	{{.FieldName}} {{.FieldType}}
+	{{- end}}
+}
+
+// {{.UnmarshalName}} decodes the NextCursor of a {{.TypeName}}.
+func {{.UnmarshalName}}(s string) ({{.CursorType}}, error) {
+	var c {{.CursorType}}
+	data, err := {{.Base64}}.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, {{.Errors}}.New("invalid {{.StructName}} page cursor")
+	}
+	if err := {{.JSON}}.Unmarshal(data, &c); err != nil {
+		return c, {{.Errors}}.New("invalid {{.StructName}} page cursor")
+	}
+	return c, nil
+}
+
+func (s *{{.StructName}}) pageCursor() string {
+	data, _ := {{.JSON}}.Marshal({{.CursorType}}{
+		{{- range .Keys}}
+		{{.FieldName}}: s.{{.FieldName}},
+		{{- end}}
+	})
+	return {{.Base64}}.RawURLEncoding.EncodeToString(data)
+}
+{{- end}}
+{{end}}
+`
@@ -0,0 +1,60 @@
+package gen
+
+import "testing"
+
+// NextCursorは生成したデコーダーで読め、//gen:cursorがあればそのエンコード（署名を含む）で作る
+func TestPageNextCursorDecodes(t *testing.T) {
+	dir, _ := generateModule(t, map[string]string{
+		"m/model.go": `package m
+
+import "time"
+
+//gen:page
+type Plain struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+//gen:page
+//gen:cursor
+type Opaque struct {
+	ID string
+}
+
+//gen:page
+//gen:cursor sign
+type Signed struct {
+	ID string
+}
+`,
+		"m/model_test.go": `package m
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextCursor(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	plain := NewPlainPage([]*Plain{{CreatedAt: at, ID: "a,b"}, {ID: "c"}}, 1)
+	c, err := UnmarshalPlainPageCursor(plain.NextCursor)
+	if err != nil || !c.CreatedAt.Equal(at) || c.ID != "a,b" {
+		t.Errorf("UnmarshalPlainPageCursor(%q) = %+v, %v", plain.NextCursor, c, err)
+	}
+	opaque := NewOpaquePage([]*Opaque{{ID: "a"}, {ID: "b"}}, 1)
+	if c, err := UnmarshalOpaqueCursor(opaque.NextCursor); err != nil || c.ID != "a" {
+		t.Errorf("UnmarshalOpaqueCursor(%q) = %+v, %v", opaque.NextCursor, c, err)
+	}
+	key := []byte("key")
+	signed := NewSignedPage([]*Signed{{ID: "a"}, {ID: "b"}}, 1, key)
+	if c, err := UnmarshalSignedCursor(signed.NextCursor, key); err != nil || c.ID != "a" {
+		t.Errorf("UnmarshalSignedCursor(%q) = %+v, %v", signed.NextCursor, c, err)
+	}
+	if _, err := UnmarshalSignedCursor(signed.NextCursor, []byte("other")); err == nil {
+		t.Error("UnmarshalSignedCursor accepts a cursor signed with another key")
+	}
+}
+`,
+	})
+	goTest(t, dir, "./...")
+}
@@ -0,0 +1,188 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// patch //gen:patchで生成する、部分更新の構造体
+type patch struct {
+	StructName string
+	TypeName   string // ExamplePatch
+	Fields     []*patchField
+	Touch      string   // UpdatedAtに入れる時刻の式。更新しなければ空
+	Hooks      []string // いずれかのフィールドを変更した後に実行する文
+	// Changed いずれかのフィールドを変更したかを覚えておく（UpdatedAtの更新、フック、不変条件の確認がある）
+	Changed bool
+}
+
+type patchField struct {
+	FieldName string
+	FieldType string
+	Tag       string   // json:"name,omitempty"。元のフィールドがjson:"-"ならそのまま、jsonタグがなければ空
+	Hooks     []string // このフィールドを変更した後に実行する文
+}
+
+func newPatch(r *renderer, target *directiveTarget) (*patch, error) {
+	structName := target.s.name()
+	structType := target.s.structType()
+	p := &patch{StructName: structName, TypeName: exportedName(structName) + "Patch"}
+	if !ast.IsExported(structName) {
+		p.TypeName = unexportedName(p.TypeName)
+	}
+	p.TypeName = r.ident(p.TypeName)
+	var fieldNames []string
+	if value, ok := target.d.arg("fields"); ok {
+		if value == "" {
+			return nil, fmt.Errorf("%s: //gen:patch fields= requires field names", structName)
+		}
+		fieldNames = strings.Split(value, ",")
+	} else {
+		// 作成日時と更新日時は部分更新で書き換えるものではない。生成したメソッドが守っているフィールドも入れない
+		for _, field := range structType.Fields.List {
+			for _, name := range field.Names {
+				if name.IsExported() && !containsTargetField(name.Name, targetFields...) && guardedPatchField(target.s, field, name.Name) == "" {
+					fieldNames = append(fieldNames, name.Name)
+				}
+			}
+		}
+	}
+	for _, arg := range target.d.args {
+		if arg.key != "fields" {
+			return nil, fmt.Errorf("%s: unknown //gen:patch argument %s", structName, arg.key)
+		}
+	}
+	if len(fieldNames) == 0 {
+		return nil, fmt.Errorf("%s: //gen:patch found no exported fields", structName)
+	}
+	seen := make(map[string]bool)
+	for _, fieldName := range fieldNames {
+		field := findField(structType, fieldName)
+		if field == nil || len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: //gen:patch refers to unknown field %s", structName, fieldName)
+		}
+		if seen[fieldName] {
+			return nil, fmt.Errorf("%s: //gen:patch field %s is listed twice", structName, fieldName)
+		}
+		seen[fieldName] = true
+		if reason := guardedPatchField(target.s, field, fieldName); reason != "" {
+			return nil, fmt.Errorf("%s: //gen:patch cannot include %s, %s", structName, fieldName, reason)
+		}
+		f := &patchField{
+			FieldName: fieldName,
+			FieldType: r.typeString(field.Type),
+			Hooks:     r.hooks[structName+"."+fieldName],
+		}
+		switch name, _, _ := strings.Cut(structTag(field).Get("json"), ","); name {
+		case "":
+		case "-":
+			f.Tag = "`json:\"-\"`"
+		default:
+			f.Tag = fmt.Sprintf("`json:%q`", name+",omitempty")
+		}
+		p.Fields = append(p.Fields, f)
+	}
+	// 状態遷移と同じく、変更したらUpdatedAtも更新する。UpdatedAtを部分更新する場合はその値を使う
+	if !seen["UpdatedAt"] {
+		if timeName := timeFieldQualifier(structType, "UpdatedAt", r.importsMap); timeName != "" {
+			p.Touch = touchNow(r, target.s, timeName)
+			p.Hooks = r.hooks[structName+".UpdatedAt"]
+		}
+	}
+	for _, stmt := range r.fieldHooks(structName) {
+		if !containsTargetField(stmt, p.Hooks...) {
+			p.Hooks = append(p.Hooks, stmt)
+		}
+	}
+	p.Changed = p.Touch != "" || len(p.Hooks) > 0 || r.invariants[structName] != ""
+	return p, nil
+}
+
+// guardedPatchField 生成したメソッドだけが書き換えるフィールドなら、Applyで代入できない理由を返す。
+// Applyは代入するだけなので、テナントの付け替えの確認や状態遷移の確認を通らない
+func guardedPatchField(s *targetStruct, field *ast.Field, fieldName string) string {
+	tag := parseGenTag(field)
+	switch {
+	case fieldName == "ID" || tag.has("autoid"):
+		return "which identifies the struct"
+	case fieldName == tenantField:
+		return "which SetTenantID guards against moving to another tenant"
+	case tag.has("append"):
+		return "which is append-only (use AppendX)"
+	case tag["cas"] == "atomic":
+		return "which is updated with sync/atomic (use CompareAndSetX)"
+	}
+	if d := s.directive("fsm"); d != nil {
+		if state, _ := d.arg("field"); state == fieldName {
+			return "which changes only through the //gen:fsm transition methods"
+		}
+	}
+	return ""
+}
+
+// renderPatch //gen:patchのついた構造体に、ポインタのフィールドを持つXPatchとApply、ChangedFieldsを生成する
+func renderPatch(r *renderer, targets []*directiveTarget) error {
+	patches := make([]*patch, 0, len(targets))
+	for _, target := range targets {
+		p, err := newPatch(r, target)
+		if err != nil {
+			return err
+		}
+		patches = append(patches, p)
+	}
+	return r.execute("patch", patchTemplate, patches)
+}
+
+const patchTemplate = `
+{{range .}}{{$patch := .}}
+// {{.TypeName}} is a partial update of {{.StructName}} for PATCH requests.
+// Nil fields are left unchanged by Apply.
+type {{.TypeName}} struct {
+	{{- range .Fields}}
+	{{.FieldName}} *{{.FieldType}}{{if .Tag}} {{.Tag}}{{end}}
+	{{- end}}
+}
+
+// ChangedFields returns the names of the fields set in p, in declaration order.
+func (p *{{.TypeName}}) ChangedFields() []string {
+	var fields []string
+	{{- range .Fields}}
+	if p.{{.FieldName}} != nil {
+		fields = append(fields, "{{.FieldName}}")
+	}
+	{{- end}}
+	return fields
+}
+
+// Apply copies the fields set in p to s{{if .Touch}} and updates UpdatedAt if any field is set{{end}}.
+func (p *{{.TypeName}}) Apply(s *{{.StructName}}){{errorResult .StructName}} {
+	{{- if .Changed}}
+	changed := false
+	{{- end}}
+	{{- range .Fields}}
+	if p.{{.FieldName}} != nil {
+		s.{{.FieldName}} = *p.{{.FieldName}}
+		{{- if $patch.Changed}}
+		changed = true
+		{{- end}}
+		{{- range .Hooks}}
+		{{.}}
+		{{- end}}
+	}
+	{{- end}}
+	{{- if .Changed}}
+	if !changed {
+		{{earlyReturn .StructName}}
+	}
+	{{- if .Touch}}
+	s.UpdatedAt = {{.Touch}}
+	{{- end}}
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+	{{- finish .StructName}}
+	{{- end}}
+}
+{{end}}
+`
@@ -0,0 +1,126 @@
+package gen
+
+import "fmt"
+
+// piiKinds pii:"..."タグで指定できる種類。種類ごとにマスクの仕方を変える
+var piiKinds = []string{"email", "phone", "name", "address", "secret"}
+
+// piiStruct //gen:piiで生成するMasked/Anonymize
+type piiStruct struct {
+	StructName string
+	Fields     []*piiField
+	Strings    string
+	UTF8       string
+	HMAC       string
+	SHA256     string
+	Hex        string
+}
+
+type piiField struct {
+	FieldName string
+	FieldType string
+	Kind      string
+	IsString  bool
+}
+
+func newPIIStruct(r *renderer, target *directiveTarget) (*piiStruct, error) {
+	structName := target.s.name()
+	p := &piiStruct{StructName: structName}
+	for _, field := range target.s.structType().Fields.List {
+		kind, ok := structTag(field).Lookup("pii")
+		if !ok {
+			continue
+		}
+		if !containsTargetField(kind, piiKinds...) {
+			return nil, fmt.Errorf("%s: unknown pii kind %q (want one of %v)", structName, kind, piiKinds)
+		}
+		fieldType := r.typeString(field.Type)
+		for _, name := range field.Names {
+			f := &piiField{
+				FieldName: name.Name,
+				FieldType: fieldType,
+				Kind:      kind,
+				IsString:  fieldType == "string",
+			}
+			if f.IsString {
+				p.HMAC = r.importName("crypto/hmac")
+				p.SHA256 = r.importName("crypto/sha256")
+				p.Hex = r.importName("encoding/hex")
+				if kind == "email" || kind == "phone" {
+					p.Strings = r.importName("strings")
+				}
+				// 残す文字はバイトではなく文字の単位で切り出す
+				if kind == "email" {
+					p.UTF8 = r.importName("unicode/utf8")
+				}
+			}
+			p.Fields = append(p.Fields, f)
+		}
+	}
+	if len(p.Fields) == 0 {
+		return nil, fmt.Errorf("%s: //gen:pii found no fields tagged pii:\"...\"", structName)
+	}
+	return p, nil
+}
+
+func renderPII(r *renderer, targets []*directiveTarget) error {
+	structs := make([]*piiStruct, 0, len(targets))
+	for _, target := range targets {
+		p, err := newPIIStruct(r, target)
+		if err != nil {
+			return err
+		}
+		structs = append(structs, p)
+	}
+	return r.execute("pii", piiTemplate, structs)
+}
+
+const piiTemplate = `
+{{range .}}
+{{- $p := .}}
+// Masked returns a copy of s whose personal data is redacted for logs and support tools.
+func (s {{recv .StructName}}) Masked() {{recv .StructName}} {
+	{{- range .Fields}}
+	{{- if not .IsString}}
+	s.{{.FieldName}} = *new({{.FieldType}})
+	{{- else if eq .Kind "email"}}
+	if at := {{$p.Strings}}.LastIndex(s.{{.FieldName}}, "@"); at > 0 {
+		_, size := {{$p.UTF8}}.DecodeRuneInString(s.{{.FieldName}})
+		s.{{.FieldName}} = s.{{.FieldName}}[:size] + "***" + s.{{.FieldName}}[at:]
+	} else if s.{{.FieldName}} != "" {
+		s.{{.FieldName}} = "***"
+	}
+	{{- else if eq .Kind "phone"}}
+	if r := []rune(s.{{.FieldName}}); len(r) > 4 {
+		s.{{.FieldName}} = {{$p.Strings}}.Repeat("*", len(r)-4) + string(r[len(r)-4:])
+	} else if len(r) > 0 {
+		s.{{.FieldName}} = "***"
+	}
+	{{- else}}
+	if s.{{.FieldName}} != "" {
+		s.{{.FieldName}} = "***"
+	}
+	{{- end}}
+	{{- end}}
+	return s
+}
+
+// Anonymize replaces personal data in place: strings become their HMAC-SHA256
+// hex digest under key (so equal values stay equal) and other fields are zeroed.
+// Without the key the digests cannot be reversed by hashing guessed values, so
+// keep it secret and use the same key wherever the digests are compared.
+func (s *{{recv .StructName}}) Anonymize(key []byte) {
+	{{- range .Fields}}
+	{{- if .IsString}}
+	if s.{{.FieldName}} != "" {
+		mac := {{$p.HMAC}}.New({{$p.SHA256}}.New, key)
+		mac.Write([]byte(s.{{.FieldName}}))
+		s.{{.FieldName}} = {{$p.Hex}}.EncodeToString(mac.Sum(nil))
+	}
+	{{- else}}
+	s.{{.FieldName}} = *new({{.FieldType}})
+	{{- end}}
+	{{- end}}
+}
+{{end}}
+`
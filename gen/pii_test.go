@@ -0,0 +1,73 @@
+package gen
+
+import (
+	"strings"
+	"testing"
+)
+
+// Maskedは複数バイトの文字を途中で切らず、Anonymizeは鍵ごとに違うハッシュにする
+func TestPIIMaskRunesAndKeyedAnonymize(t *testing.T) {
+	dir, _ := generateModule(t, map[string]string{
+		"m/model.go": `package m
+
+//gen:pii
+type User struct {
+	Email string ` + "`pii:\"email\"`" + `
+	Phone string ` + "`pii:\"phone\"`" + `
+	Age   int    ` + "`pii:\"secret\"`" + `
+}
+`,
+		"m/model_test.go": `package m
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestMasked(t *testing.T) {
+	u := User{Email: "éric@example.com", Phone: "０９０１２３４５６７８", Age: 30}
+	m := u.Masked()
+	if m.Email != "é***@example.com" || m.Phone != "*******５６７８" || m.Age != 0 {
+		t.Errorf("Masked() = %+v", m)
+	}
+	if !utf8.ValidString(m.Email) || !utf8.ValidString(m.Phone) {
+		t.Errorf("Masked() splits a character: %q %q", m.Email, m.Phone)
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	a, b, c := User{Email: "a@example.com"}, User{Email: "a@example.com"}, User{Email: "a@example.com"}
+	a.Anonymize([]byte("k1"))
+	b.Anonymize([]byte("k1"))
+	c.Anonymize([]byte("k2"))
+	if a.Email != b.Email || a.Email == c.Email || a.Email == "a@example.com" {
+		t.Errorf("Anonymize() = %q, %q, %q", a.Email, b.Email, c.Email)
+	}
+}
+`,
+	})
+	goTest(t, dir, "./...")
+}
+
+// pii:"secret"のtime.Time、その別名、それらへのポインタは、MaskedでもAnonymizeでもゼロ値にする
+func TestPIIFieldKinds(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		want  string
+	}{
+		{"time", "At time.Time", "s.At = *new(time.Time)"},
+		{"alias", "At Stamp", "s.At = *new(time.Time)"},
+		{"pointer", "At *time.Time", "s.At = *new(*time.Time)"},
+		{"alias pointer", "At *Stamp", "s.At = *new(*Stamp)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, generated := generateModule(t, map[string]string{"m/model.go": fieldModel("//gen:pii", tt.field+" `pii:\"secret\"`")})
+			src := generated["m/model_setters.go"]
+			if n := strings.Count(src, tt.want); n != 2 {
+				t.Errorf("generated code contains %q %d times, want 2 (Masked and Anonymize):\n%s", tt.want, n, src)
+			}
+		})
+	}
+}
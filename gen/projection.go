@@ -0,0 +1,135 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// projectionDroppedTags 射影に引き継がないタグのキー。元の構造体のコード生成やリクエストの読み込みに使うもので、
+// 読み取り用の構造体に残すとgen:"required"などが射影を使う側の生成やバインドに効いてしまう
+var projectionDroppedTags = append([]string{"gen", "inject"}, binderSources...)
+
+// projection //gen:projection Summary=ID,Nameで生成する、一部のフィールドだけを持つ読み取り用の構造体
+type projection struct {
+	StructName string
+	TypeName   string // ExampleSummary
+	MethodName string // ToSummary
+	Fields     []*projectedField
+}
+
+type projectedField struct {
+	FieldName string
+	FieldType string
+	Tag       string // projectionDroppedTagsを除いた元のフィールドのタグ（引用符つき）。なければ空
+}
+
+// newProjections Name=Field,...の引数ごとに射影を作る
+func newProjections(r *renderer, target *directiveTarget) ([]*projection, error) {
+	structName := target.s.name()
+	structType := target.s.structType()
+	if len(target.d.args) == 0 {
+		return nil, fmt.Errorf("%s: //gen:projection requires Name=Field,... such as Summary=ID,Name", structName)
+	}
+	var projections []*projection
+	for _, arg := range target.d.args {
+		name := exportedName(arg.key)
+		if !token.IsIdentifier(name) || arg.value == "" {
+			return nil, fmt.Errorf("%s: //gen:projection %s must be Name=Field,...", structName, arg.key)
+		}
+		p := &projection{
+			StructName: structName,
+			TypeName:   exportedName(structName) + name,
+			MethodName: "To" + name,
+		}
+		if !ast.IsExported(structName) {
+			p.TypeName = unexportedName(p.TypeName)
+		}
+		p.TypeName = r.ident(p.TypeName)
+		for _, fieldName := range strings.Split(arg.value, ",") {
+			field := findField(structType, fieldName)
+			if field == nil {
+				return nil, fmt.Errorf("%s: //gen:projection %s refers to unknown field %s", structName, name, fieldName)
+			}
+			f := &projectedField{FieldName: fieldName, FieldType: r.typeString(field.Type)}
+			if tag := withoutTagKeys(string(structTag(field)), projectionDroppedTags...); tag != "" {
+				f.Tag = quoteStructTag(tag)
+			}
+			p.Fields = append(p.Fields, f)
+		}
+		projections = append(projections, p)
+	}
+	return projections, nil
+}
+
+// withoutTagKeys 構造体タグからkeysのキーを除く。reflect.StructTagと同じくkey:"value"を空白で区切って読み、
+// 読めなくなったところから後ろは捨てる
+func withoutTagKeys(tag string, keys ...string) string {
+	var kept []string
+	for {
+		tag = strings.TrimLeft(tag, " ")
+		key, rest, ok := strings.Cut(tag, ":")
+		if !ok || key == "" || strings.ContainsAny(key, " \"") {
+			break
+		}
+		value, err := strconv.QuotedPrefix(rest)
+		if err != nil || value[0] != '"' {
+			break
+		}
+		if !containsTargetField(key, keys...) {
+			kept = append(kept, key+":"+value)
+		}
+		tag = rest[len(value):]
+	}
+	return strings.Join(kept, " ")
+}
+
+// quoteStructTag 構造体タグをソースに書ける文字列リテラルにする。バッククォートを含まなければバッククォートで囲む
+func quoteStructTag(tag string) string {
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
+
+// renderProjection //gen:projectionのついた構造体に、射影の構造体と変換するToXメソッドを生成する
+func renderProjection(r *renderer, targets []*directiveTarget) error {
+	var all []*projection
+	seen := make(map[string]string)
+	for _, target := range targets {
+		projections, err := newProjections(r, target)
+		if err != nil {
+			return err
+		}
+		for _, p := range projections {
+			if other, ok := seen[p.TypeName]; ok {
+				return fmt.Errorf("%s: //gen:projection %s is also generated for %s", p.StructName, p.TypeName, other)
+			}
+			seen[p.TypeName] = p.StructName
+		}
+		all = append(all, projections...)
+	}
+	return r.execute("projection", projectionTemplate, all)
+}
+
+const projectionTemplate = `
+{{range .}}
+// {{.TypeName}} is a read-only projection of {{.StructName}} created by {{.MethodName}}.
+type {{.TypeName}} struct {
+	{{- range .Fields}}
+	{{.FieldName}} {{.FieldType}}{{if .Tag}} {{.Tag}}{{end}}
+	{{- end}}
+}
+
+// {{.MethodName}} copies the fields of {{.TypeName}} from s.
+func (s *{{.StructName}}) {{.MethodName}}() {{.TypeName}} {
+	return {{.TypeName}}{
+		{{- range .Fields}}
+		{{.FieldName}}: s.{{.FieldName}},
+		{{- end}}
+	}
+}
+{{end}}
+`
@@ -0,0 +1,66 @@
+package gen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithoutTagKeys(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{`json:"id" gen:"required" db:"id"`, `json:"id" db:"id"`},
+		{`path:"id" query:"q"`, ""},
+		{`json:"a \"b\"" gen:"flags=Read,Write"`, `json:"a \"b\""`},
+		{`json:"id"  broken`, `json:"id"`},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := withoutTagKeys(tt.tag, projectionDroppedTags...); got != tt.want {
+			t.Errorf("withoutTagKeys(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+// 射影には元の構造体の生成やリクエストの読み込みに使うタグを引き継がない
+func TestProjectionDropsGeneratorTags(t *testing.T) {
+	_, generated := generateModule(t, map[string]string{
+		"m/model.go": "package m\n\n//gen:projection Summary=ID,Name,Note\ntype Model struct {\n" +
+			"\tID   string `json:\"id\" path:\"id\" gen:\"required\"`\n" +
+			"\tName string `query:\"name\"`\n" +
+			"\tNote string \"json:\\\"note\\\" db:\\\"`note`\\\"\"\n" +
+			"}\n",
+	})
+	src := generated["m/model_setters.go"]
+	for _, want := range []string{"ID   string `json:\"id\"`\n", "Name string\n", "Note string \"json:\\\"note\\\" db:\\\"`note`\\\"\"\n"} {
+		if !strings.Contains(src, want) {
+			t.Errorf("projection does not contain %q:\n%s", want, src)
+		}
+	}
+}
+
+// time.Time、その別名、それらへのポインタのフィールドは、型を変えずに射影へコピーする
+func TestProjectionFieldKinds(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		want  string
+	}{
+		{"time", "At time.Time", "\tAt time.Time\n"},
+		{"alias", "At Stamp", "\tAt time.Time\n"},
+		{"pointer", "At *time.Time", "\tAt *time.Time\n"},
+		{"alias pointer", "At *Stamp", "\tAt *Stamp\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, generated := generateModule(t, map[string]string{"m/model.go": fieldModel("//gen:projection Summary=At", tt.field)})
+			src := generated["m/model_setters.go"]
+			for _, want := range []string{tt.want, "At: s.At,"} {
+				if !strings.Contains(src, want) {
+					t.Errorf("projection does not contain %q:\n%s", want, src)
+				}
+			}
+		})
+	}
+}
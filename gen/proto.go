@@ -0,0 +1,679 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// .protoファイルからドメインの構造体と、protoc-gen-goの型との変換を生成する。
+// 構文はproto3のメッセージ、enum、mapとネストしたメッセージだけを読み、サービスなどは読み飛ばす
+
+const (
+	timestamppbPath = "google.golang.org/protobuf/types/known/timestamppb"
+	durationpbPath  = "google.golang.org/protobuf/types/known/durationpb"
+)
+
+// protoScalarTypes スカラー型とGoの型
+var protoScalarTypes = map[string]string{
+	"double": "float64", "float": "float32",
+	"int32": "int32", "int64": "int64", "uint32": "uint32", "uint64": "uint64",
+	"sint32": "int32", "sint64": "int64", "fixed32": "uint32", "fixed64": "uint64",
+	"sfixed32": "int32", "sfixed64": "int64",
+	"bool": "bool", "string": "string", "bytes": "[]byte",
+}
+
+// protoInitialisms ドメインの構造体のフィールド名で大文字にする単語
+var protoInitialisms = map[string]bool{"id": true, "url": true, "uri": true, "api": true, "http": true, "uuid": true, "json": true, "ip": true}
+
+type protoFile struct {
+	pkg       string
+	goPackage string
+	messages  []*protoMessage
+	byName    map[string]*protoMessage // key: パッケージを除いた名前（User.Address）
+	enums     map[string]string        // key: パッケージを除いた名前, value: Goの型名（User_Status）
+}
+
+type protoMessage struct {
+	name   string // User.Address
+	nested bool
+	fields []*protoField
+}
+
+type protoField struct {
+	name     string
+	typ      string // mapなら値の型
+	mapKey   string
+	repeated bool
+	optional bool
+	line     int
+}
+
+// goName protoc-gen-goが生成するメッセージの型名（User_Address）
+func (m *protoMessage) goName() string {
+	parts := strings.Split(m.name, ".")
+	for i, p := range parts {
+		parts[i] = protoGoCamelCase(p)
+	}
+	return strings.Join(parts, "_")
+}
+
+// domainName ドメインの構造体の名前（UserAddress）
+func (m *protoMessage) domainName() string {
+	return strings.ReplaceAll(m.goName(), "_", "")
+}
+
+// protoGoCamelCase protoc-gen-goと同じ規則でフィールド名などをGoの名前にする
+func protoGoCamelCase(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '.' && i+1 < len(s) && isASCIILower(s[i+1]):
+		case c == '.':
+			b = append(b, '_')
+		case c == '_' && (i == 0 || s[i-1] == '.'):
+			b = append(b, 'X')
+		case c == '_' && i+1 < len(s) && isASCIILower(s[i+1]):
+		case '0' <= c && c <= '9':
+			b = append(b, c)
+		default:
+			if isASCIILower(c) {
+				c -= 'a' - 'A'
+			}
+			b = append(b, c)
+			for ; i+1 < len(s) && isASCIILower(s[i+1]); i++ {
+				b = append(b, s[i+1])
+			}
+		}
+	}
+	return string(b)
+}
+
+func isASCIILower(c byte) bool {
+	return 'a' <= c && c <= 'z'
+}
+
+// protoDomainFieldName ドメインの構造体のフィールド名。user_idはUserIDのようにGoの略語の書き方にする
+func protoDomainFieldName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		if protoInitialisms[strings.ToLower(part)] {
+			b.WriteString(strings.ToUpper(part))
+			continue
+		}
+		b.WriteString(protoGoCamelCase(part))
+	}
+	return b.String()
+}
+
+// protoTokenizer .protoファイルを識別子、文字列、記号に分ける
+type protoTokenizer struct {
+	src  string
+	pos  int
+	line int
+}
+
+// next 次の字句。終わりなら空を返す
+func (t *protoTokenizer) next() string {
+	for t.pos < len(t.src) {
+		c := t.src[t.pos]
+		switch {
+		case c == '\n':
+			t.line++
+			t.pos++
+		case unicode.IsSpace(rune(c)):
+			t.pos++
+		case strings.HasPrefix(t.src[t.pos:], "//"):
+			for t.pos < len(t.src) && t.src[t.pos] != '\n' {
+				t.pos++
+			}
+		case strings.HasPrefix(t.src[t.pos:], "/*"):
+			end := strings.Index(t.src[t.pos+2:], "*/")
+			if end < 0 {
+				end = len(t.src) - t.pos - 2
+			}
+			t.line += strings.Count(t.src[t.pos:t.pos+2+end], "\n")
+			t.pos = min(t.pos+2+end+2, len(t.src))
+		case c == '"' || c == '\'':
+			start := t.pos
+			for t.pos++; t.pos < len(t.src) && t.src[t.pos] != c; t.pos++ {
+				if t.src[t.pos] == '\\' {
+					t.pos++
+				}
+			}
+			t.pos = min(t.pos+1, len(t.src))
+			return t.src[start:t.pos]
+		case c == '_' || c == '.' || c >= 0x80 || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) || c == '-' || c == '+':
+			start := t.pos
+			for t.pos < len(t.src) {
+				c := t.src[t.pos]
+				if c != '_' && c != '.' && c != '-' && c != '+' && !unicode.IsLetter(rune(c)) && !unicode.IsDigit(rune(c)) {
+					break
+				}
+				t.pos++
+			}
+			return t.src[start:t.pos]
+		default:
+			t.pos++
+			return string(c)
+		}
+	}
+	return ""
+}
+
+// protoParser 字句を読みながら宣言を集める
+type protoParser struct {
+	t    *protoTokenizer
+	path string
+	file *protoFile
+}
+
+func (p *protoParser) next() string {
+	return p.t.next()
+}
+
+func (p *protoParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", p.path, p.t.line, fmt.Sprintf(format, args...))
+}
+
+func (p *protoParser) expect(want string) error {
+	if tok := p.next(); tok != want {
+		return p.errorf("expected %q, got %q", want, tok)
+	}
+	return nil
+}
+
+// skipStatement ;か、{}で囲まれたブロックの終わりまで読み飛ばす
+func (p *protoParser) skipStatement() error {
+	depth := 0
+	for {
+		switch tok := p.next(); tok {
+		case "":
+			return p.errorf("unexpected end of file")
+		case ";":
+			if depth == 0 {
+				return nil
+			}
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+// parseProto .protoファイルのメッセージとenumを読む
+func parseProto(path, src string) (*protoFile, error) {
+	p := &protoParser{t: &protoTokenizer{src: src, line: 1}, path: path, file: &protoFile{
+		byName: make(map[string]*protoMessage),
+		enums:  make(map[string]string),
+	}}
+	for {
+		switch tok := p.next(); tok {
+		case "":
+			return p.file, nil
+		case ";":
+		case "syntax", "edition":
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			if v := p.next(); tok == "edition" || strings.Trim(v, `"'`) != "proto3" {
+				return nil, p.errorf("only proto3 is supported")
+			}
+			if err := p.expect(";"); err != nil {
+				return nil, err
+			}
+		case "package":
+			p.file.pkg = p.next()
+			if err := p.expect(";"); err != nil {
+				return nil, err
+			}
+		case "option":
+			if p.next() != "go_package" {
+				if err := p.skipStatement(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			p.file.goPackage = strings.Trim(p.next(), `"'`)
+			if err := p.expect(";"); err != nil {
+				return nil, err
+			}
+		case "message":
+			if err := p.parseMessage(""); err != nil {
+				return nil, err
+			}
+		case "enum":
+			if err := p.parseEnum(""); err != nil {
+				return nil, err
+			}
+		default:
+			// import、service、extendなどはメッセージの型に関係しない
+			if err := p.skipStatement(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (p *protoParser) parseEnum(scope string) error {
+	name := qualifyProtoName(scope, p.next())
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = protoGoCamelCase(part)
+	}
+	p.file.enums[name] = strings.Join(parts, "_")
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	// 値はenumの型だけで扱うので読まない
+	for depth := 1; depth > 0; {
+		switch p.next() {
+		case "":
+			return p.errorf("unexpected end of file in enum %s", name)
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+	}
+	return nil
+}
+
+func qualifyProtoName(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+func (p *protoParser) parseMessage(scope string) error {
+	m := &protoMessage{name: qualifyProtoName(scope, p.next()), nested: scope != ""}
+	p.file.messages = append(p.file.messages, m)
+	p.file.byName[m.name] = m
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for {
+		line := p.t.line
+		switch tok := p.next(); tok {
+		case "":
+			return p.errorf("unexpected end of file in message %s", m.name)
+		case "}":
+			return nil
+		case ";":
+		case "message":
+			if err := p.parseMessage(m.name); err != nil {
+				return err
+			}
+		case "enum":
+			if err := p.parseEnum(m.name); err != nil {
+				return err
+			}
+		case "option", "reserved", "extensions":
+			if err := p.skipStatement(); err != nil {
+				return err
+			}
+		case "oneof":
+			return p.errorf("%s: oneof is not supported", m.name)
+		case "map":
+			f := &protoField{line: line}
+			if err := p.expect("<"); err != nil {
+				return err
+			}
+			f.mapKey = p.next()
+			if err := p.expect(","); err != nil {
+				return err
+			}
+			f.typ = p.next()
+			if err := p.expect(">"); err != nil {
+				return err
+			}
+			if err := p.parseFieldRest(f); err != nil {
+				return err
+			}
+			m.fields = append(m.fields, f)
+		default:
+			f := &protoField{line: line}
+			switch tok {
+			case "repeated":
+				f.repeated = true
+				tok = p.next()
+			case "optional":
+				f.optional = true
+				tok = p.next()
+			case "required", "group":
+				return p.errorf("%s: %s is not supported in proto3", m.name, tok)
+			}
+			f.typ = tok
+			if err := p.parseFieldRest(f); err != nil {
+				return err
+			}
+			m.fields = append(m.fields, f)
+		}
+	}
+}
+
+// parseFieldRest 型の後の「name = 1 [options];」
+func (p *protoParser) parseFieldRest(f *protoField) error {
+	f.name = p.next()
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	p.next() // フィールド番号
+	tok := p.next()
+	if tok == "[" {
+		for tok != "]" && tok != "" {
+			tok = p.next()
+		}
+		tok = p.next()
+	}
+	if tok != ";" {
+		return p.errorf("expected \";\" after field %s, got %q", f.name, tok)
+	}
+	return nil
+}
+
+// protoTypeKind フィールドの型の種類
+type protoTypeKind int
+
+const (
+	protoScalar protoTypeKind = iota
+	protoEnum
+	protoMessageKind
+	protoTimestamp
+	protoDuration
+)
+
+// protoType 解決したフィールドの型
+type protoType struct {
+	kind    protoTypeKind
+	scalar  string        // Goの型（protoScalar）
+	enum    string        // Goの型名（protoEnum）
+	message *protoMessage // protoMessageKind
+}
+
+// resolveType メッセージscopeの中で参照された型の名前を解決する
+func (f *protoFile) resolveType(scope, name string) (*protoType, bool) {
+	if goType, ok := protoScalarTypes[name]; ok {
+		return &protoType{kind: protoScalar, scalar: goType}, true
+	}
+	name = strings.TrimPrefix(name, ".")
+	switch name {
+	case "google.protobuf.Timestamp":
+		return &protoType{kind: protoTimestamp}, true
+	case "google.protobuf.Duration":
+		return &protoType{kind: protoDuration}, true
+	}
+	if f.pkg != "" {
+		name = strings.TrimPrefix(name, f.pkg+".")
+	}
+	// 内側のメッセージから順に探す
+	for {
+		candidate := qualifyProtoName(scope, name)
+		if m, ok := f.byName[candidate]; ok {
+			return &protoType{kind: protoMessageKind, message: m}, true
+		}
+		if e, ok := f.enums[candidate]; ok {
+			return &protoType{kind: protoEnum, enum: e}, true
+		}
+		if scope == "" {
+			return nil, false
+		}
+		if i := strings.LastIndex(scope, "."); i >= 0 {
+			scope = scope[:i]
+		} else {
+			scope = ""
+		}
+	}
+}
+
+// protoConverter メッセージとドメインの構造体の変換
+type protoConverter struct {
+	DomainName string
+	ProtoType  string // userpb.User
+	FuncName   string // UserFromProto
+	Direct     []*protoAssign
+	ToProto    []string // 直接代入できないフィールドの、sからmへの変換
+	FromProto  []string
+	// Added メッセージになく、足したフィールド（CreatedAt、UpdatedAt）
+	Added []string
+}
+
+type protoAssign struct {
+	Proto  string
+	Domain string
+}
+
+// protoNames 生成するコードからパッケージを参照する名前
+type protoNames struct {
+	pb, timestamppb, durationpb string
+	used                        map[string]bool // key: import path
+}
+
+// domainType ドメインの構造体のフィールドの型
+func (n *protoNames) domainType(t *protoType) string {
+	switch t.kind {
+	case protoEnum:
+		return n.pb + "." + t.enum
+	case protoMessageKind:
+		return "*" + t.message.domainName()
+	case protoTimestamp:
+		return "time.Time"
+	case protoDuration:
+		return "time.Duration"
+	}
+	return t.scalar
+}
+
+// protoGoType protoc-gen-goの型
+func (n *protoNames) protoGoType(t *protoType) string {
+	switch t.kind {
+	case protoEnum:
+		return n.pb + "." + t.enum
+	case protoMessageKind:
+		return "*" + n.pb + "." + t.message.goName()
+	case protoTimestamp:
+		n.used[timestamppbPath] = true
+		return "*" + n.timestamppb + ".Timestamp"
+	case protoDuration:
+		n.used[durationpbPath] = true
+		return "*" + n.durationpb + ".Duration"
+	}
+	return t.scalar
+}
+
+// convert 要素vをドメインからprotoへ（toProto）、またはその逆へ変換する式
+func (n *protoNames) convert(t *protoType, v string, toProto bool) string {
+	switch {
+	case t.kind == protoMessageKind && toProto:
+		return v + ".ToProto()"
+	case t.kind == protoMessageKind:
+		return t.message.domainName() + "FromProto(" + v + ")"
+	case t.kind == protoTimestamp && toProto:
+		n.used[timestamppbPath] = true
+		return n.timestamppb + ".New(" + v + ")"
+	case t.kind == protoTimestamp:
+		return v + ".AsTime()"
+	case t.kind == protoDuration && toProto:
+		n.used[durationpbPath] = true
+		return n.durationpb + ".New(" + v + ")"
+	case t.kind == protoDuration:
+		return v + ".AsDuration()"
+	}
+	return v
+}
+
+// addProtoStructs スキーマのprotoのメッセージごとに構造体を加え、変換のコードと、それが使うimport pathを返す
+func (doc *schemaDocument) addProtoStructs(schemaPath, dir string, src []byte) ([]byte, []string, error) {
+	protoPath := filepath.Join(filepath.Dir(schemaPath), doc.Proto)
+	file, err := parseProto(protoPath, string(src))
+	if err != nil {
+		return nil, nil, err
+	}
+	if file.goPackage == "" {
+		return nil, nil, fmt.Errorf("%s: option go_package is required to convert to the generated types", protoPath)
+	}
+	pbPath, pbName, ok := strings.Cut(file.goPackage, ";")
+	if ok && pbName != "" {
+		// go_packageで指定された名前は、protocで生成する前でも分かる
+		if err := importNames.setOverride(pbPath + "=" + pbName); err != nil {
+			return nil, nil, err
+		}
+	}
+	names := importNames.resolve(dir, []string{pbPath, timestamppbPath, durationpbPath})
+	n := &protoNames{pb: names[pbPath], timestamppb: names[timestamppbPath], durationpb: names[durationpbPath], used: make(map[string]bool)}
+	directives := doc.Directives
+	if directives == nil {
+		directives = []string{"setters"}
+	}
+	stamped := make(map[string]bool)
+	if doc.Timestamps != nil {
+		for _, name := range *doc.Timestamps {
+			if _, ok := file.byName[name]; !ok {
+				return nil, nil, fmt.Errorf("%s: timestamps: unknown message %s", schemaPath, name)
+			}
+			stamped[name] = true
+		}
+	} else {
+		for _, m := range file.messages {
+			stamped[m.name] = !m.nested
+		}
+	}
+	var converters []*protoConverter
+	for _, m := range file.messages {
+		s := &schemaStruct{
+			Name:       m.domainName(),
+			Doc:        fmt.Sprintf("%s is the domain model of the protobuf message %s.", m.domainName(), qualifyProtoName(file.pkg, m.name)),
+			Directives: directives,
+		}
+		c := &protoConverter{DomainName: s.Name, ProtoType: n.pb + "." + m.goName(), FuncName: s.Name + "FromProto"}
+		hasField := make(map[string]bool)
+		for _, f := range m.fields {
+			t, ok := file.resolveType(m.name, f.typ)
+			if !ok {
+				return nil, nil, fmt.Errorf("%s:%d: type %s of %s.%s is not declared in this file", protoPath, f.line, f.typ, m.name, f.name)
+			}
+			domainName, protoName := protoDomainFieldName(f.name), protoGoCamelCase(f.name)
+			hasField[domainName] = true
+			field := &schemaField{Name: domainName}
+			direct := t.kind == protoScalar || t.kind == protoEnum
+			switch {
+			case f.mapKey != "":
+				key, ok := protoScalarTypes[f.mapKey]
+				if !ok || key == "[]byte" || key == "float64" || key == "float32" {
+					return nil, nil, fmt.Errorf("%s:%d: invalid map key type %s", protoPath, f.line, f.mapKey)
+				}
+				field.Type = "map[" + key + "]" + n.domainType(t)
+				if !direct {
+					c.ToProto = append(c.ToProto, fmt.Sprintf("if s.%[1]s != nil {\nm.%[2]s = make(map[%[3]s]%[4]s, len(s.%[1]s))\nfor k, v := range s.%[1]s {\nm.%[2]s[k] = %[5]s\n}\n}",
+						domainName, protoName, key, n.protoGoType(t), n.convert(t, "v", true)))
+					c.FromProto = append(c.FromProto, fmt.Sprintf("if m.%[2]s != nil {\ns.%[1]s = make(map[%[3]s]%[4]s, len(m.%[2]s))\nfor k, v := range m.%[2]s {\ns.%[1]s[k] = %[5]s\n}\n}",
+						domainName, protoName, key, n.domainType(t), n.convert(t, "v", false)))
+				}
+			case f.repeated:
+				field.Type = "[]" + n.domainType(t)
+				if !direct {
+					c.ToProto = append(c.ToProto, fmt.Sprintf("if s.%[1]s != nil {\nm.%[2]s = make([]%[3]s, len(s.%[1]s))\nfor i, v := range s.%[1]s {\nm.%[2]s[i] = %[4]s\n}\n}",
+						domainName, protoName, n.protoGoType(t), n.convert(t, "v", true)))
+					c.FromProto = append(c.FromProto, fmt.Sprintf("if m.%[2]s != nil {\ns.%[1]s = make([]%[3]s, len(m.%[2]s))\nfor i, v := range m.%[2]s {\ns.%[1]s[i] = %[4]s\n}\n}",
+						domainName, protoName, n.domainType(t), n.convert(t, "v", false)))
+				}
+			default:
+				field.Type = n.domainType(t)
+				if f.optional && direct {
+					field.Type = "*" + field.Type
+				}
+				switch t.kind {
+				case protoMessageKind:
+					c.ToProto = append(c.ToProto, fmt.Sprintf("m.%s = %s", protoName, n.convert(t, "s."+domainName, true)))
+					c.FromProto = append(c.FromProto, fmt.Sprintf("s.%s = %s", domainName, n.convert(t, "m."+protoName, false)))
+				case protoTimestamp, protoDuration:
+					// ゼロ値はメッセージでは設定しないフィールドにする
+					zero := "!s." + domainName + ".IsZero()"
+					if t.kind == protoDuration {
+						zero = "s." + domainName + " != 0"
+					}
+					c.ToProto = append(c.ToProto, fmt.Sprintf("if %s {\nm.%s = %s\n}", zero, protoName, n.convert(t, "s."+domainName, true)))
+					c.FromProto = append(c.FromProto, fmt.Sprintf("if m.%s != nil {\ns.%s = %s\n}", protoName, domainName, n.convert(t, "m."+protoName, false)))
+				}
+			}
+			if direct {
+				c.Direct = append(c.Direct, &protoAssign{Proto: protoName, Domain: domainName})
+			}
+			s.Fields = append(s.Fields, field)
+		}
+		// メッセージになければCreatedAtとUpdatedAtを足す。変換では扱わない
+		if stamped[m.name] {
+			for _, name := range targetFields {
+				if !hasField[name] {
+					s.Fields = append(s.Fields, &schemaField{Name: name, Type: "time.Time"})
+					c.Added = append(c.Added, name)
+				}
+			}
+		}
+		doc.Structs = append(doc.Structs, s)
+		converters = append(converters, c)
+	}
+	var buf bytes.Buffer
+	if err := template.Must(template.New("proto").Parse(protoConverterTemplate)).Execute(&buf, converters); err != nil {
+		return nil, nil, err
+	}
+	imports := []string{pbPath}
+	for _, p := range []string{timestamppbPath, durationpbPath} {
+		if n.used[p] {
+			imports = append(imports, p)
+		}
+	}
+	return buf.Bytes(), imports, nil
+}
+
+const protoConverterTemplate = `
+{{range .}}
+// ToProto converts s to the protobuf message.
+{{- if .Added}} {{range $i, $f := .Added}}{{if $i}} and {{end}}{{$f}}{{end}} {{if eq (len .Added) 1}}is{{else}}are{{end}} not in the message and dropped.{{end}}
+func (s *{{.DomainName}}) ToProto() *{{.ProtoType}} {
+	if s == nil {
+		return nil
+	}
+	m := &{{.ProtoType}}{
+	{{- range .Direct}}
+		{{.Proto}}: s.{{.Domain}},
+	{{- end}}
+	}
+	{{- range .ToProto}}
+	{{.}}
+	{{- end}}
+	return m
+}
+
+// {{.FuncName}} converts the protobuf message m to {{.DomainName}}.
+func {{.FuncName}}(m *{{.ProtoType}}) *{{.DomainName}} {
+	if m == nil {
+		return nil
+	}
+	s := &{{.DomainName}}{
+	{{- range .Direct}}
+		{{.Domain}}: m.{{.Proto}},
+	{{- end}}
+	}
+	{{- range .FromProto}}
+	{{.}}
+	{{- end}}
+	return s
+}
+{{- end}}
+`
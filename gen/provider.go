@@ -0,0 +1,110 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"strconv"
+)
+
+// providerImports //gen:providerのkindごとのDIコンテナのパッケージ
+var providerImports = map[string]string{
+	"wire": "github.com/google/wire",
+	"fx":   "go.uber.org/fx",
+}
+
+// provider inject:""タグのついたフィールドを引数にとるコンストラクタと、wire/fxへの登録
+type provider struct {
+	StructName string
+	FuncName   string // ProvideExample
+	VarName    string // ExampleSet（wire）かExampleModule（fx）
+	Kind       string
+	Pkg        string // wire/fxを参照している名前
+	Params     []*constructorParam
+}
+
+// newProvider 構造体の依存（inject:""のフィールド）からproviderを作る
+func newProvider(r *renderer, target *directiveTarget) (*provider, error) {
+	structName := target.s.name()
+	kind, _ := target.d.arg("kind")
+	if kind == "" {
+		kind = "wire"
+	}
+	importPath, ok := providerImports[kind]
+	if !ok {
+		return nil, fmt.Errorf("%s: //gen:provider kind must be wire or fx, got %q", structName, kind)
+	}
+	p := &provider{
+		StructName: structName,
+		FuncName:   "Provide" + exportedName(structName),
+		Kind:       kind,
+		Pkg:        r.importName(importPath),
+	}
+	if kind == "wire" {
+		p.VarName = exportedName(structName) + "Set"
+	} else {
+		p.VarName = exportedName(structName) + "Module"
+	}
+	if !ast.IsExported(structName) {
+		p.FuncName = unexportedName(p.FuncName)
+		p.VarName = unexportedName(p.VarName)
+	}
+	p.FuncName, p.VarName = r.ident(p.FuncName), r.ident(p.VarName)
+	for _, field := range target.s.structType().Fields.List {
+		if !hasInjectTag(field) {
+			continue
+		}
+		if len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: inject:\"\" is not supported on embedded fields", structName)
+		}
+		for _, name := range field.Names {
+			p.Params = append(p.Params, &constructorParam{
+				Name:      paramName(r, name.Name),
+				FieldName: name.Name,
+				FieldType: r.typeString(field.Type),
+			})
+		}
+	}
+	return p, nil
+}
+
+func hasInjectTag(field *ast.Field) bool {
+	if field.Tag == nil {
+		return false
+	}
+	raw, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return false
+	}
+	_, ok := reflect.StructTag(raw).Lookup("inject")
+	return ok
+}
+
+func renderProvider(r *renderer, targets []*directiveTarget) error {
+	providers := make([]*provider, 0, len(targets))
+	for _, target := range targets {
+		p, err := newProvider(r, target)
+		if err != nil {
+			return err
+		}
+		providers = append(providers, p)
+	}
+	return r.execute("provider", providerTemplate, providers)
+}
+
+const providerTemplate = `
+{{range .}}
+func {{.FuncName}}({{range $i, $p := .Params}}{{if $i}}, {{end}}{{.Name}} {{.FieldType}}{{end}}) *{{.StructName}} {
+	return &{{.StructName}}{
+		{{- range .Params}}
+		{{.FieldName}}: {{.Name}},
+		{{- end}}
+	}
+}
+{{if eq .Kind "wire"}}
+var {{.VarName}} = {{.Pkg}}.NewSet({{.FuncName}})
+{{- else}}
+var {{.VarName}} = {{.Pkg}}.Provide({{.FuncName}})
+{{- end}}
+{{end}}
+`
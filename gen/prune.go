@@ -0,0 +1,48 @@
+package gen
+
+import (
+	"os"
+)
+
+// orphanedFiles 対象のディレクトリにある、このツールが以前生成したのに今回は生成しなかったファイル。
+// 構造体のディレクティブを消したりソースを消したりすると残るので、-pruneで削除する
+func orphanedFiles(roots []string, recursive bool, generated []*generatedFile, removed []string) ([]string, error) {
+	keep := make(map[string]bool, len(generated)+len(removed))
+	for _, g := range generated {
+		key, err := outputPathKey(g.path)
+		if err != nil {
+			return nil, err
+		}
+		keep[key] = true
+	}
+	// -package-fileで消すファイルは別に扱う
+	for _, path := range removed {
+		key, err := outputPathKey(path)
+		if err != nil {
+			return nil, err
+		}
+		keep[key] = true
+	}
+	var orphaned []string
+	for _, root := range roots {
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			continue
+		}
+		files, err := listGoFiles(root, recursive)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range files {
+			key, err := outputPathKey(path)
+			if err != nil {
+				return nil, err
+			}
+			if keep[key] || !isGeneratedFile(path) {
+				continue
+			}
+			keep[key] = true // -output-dirが対象のディレクトリの中にあれば2回見つかる
+			orphaned = append(orphaned, path)
+		}
+	}
+	return orphaned, nil
+}
@@ -0,0 +1,133 @@
+package gen
+
+import (
+	"strings"
+)
+
+// contextSetter //gen:setters ctxで、再計算するフィールドのSetXに加えて生成するSetXContext。
+// ctxをcomputeTotalContext(ctx)に渡し、打ち切られたら元の値に戻してエラーを返す
+type contextSetter struct {
+	StructName string
+	MethodName string // SetPriceContext
+	FieldName  string
+	FieldType  string
+	Context    string
+	Hooks      []*contextHook
+	Touch      string   // //gen:setters touchで、代入の後にUpdatedAtに入れる時刻の式
+	Restore    []string // 失敗したときに元に戻すフィールド（代入するフィールドと構造体の全ての非正規化したフィールド）
+}
+
+// contextRecompute recomputeTotal()のctxを受け取る版。計算は利用者が書くcomputeTotalContext(ctx)に任せる
+type contextRecompute struct {
+	StructName string
+	FieldName  string
+	MethodName string
+	Context    string
+	Hooks      []*contextHook
+}
+
+// contextHook 代入の後に実行する文。再計算はctxを渡してエラーを確認する
+type contextHook struct {
+	Recompute string // recomputeTotal()ならTotal
+	Stmt      string
+}
+
+func contextHooks(hooks []string) []*contextHook {
+	out := make([]*contextHook, 0, len(hooks))
+	for _, h := range hooks {
+		if name, ok := strings.CutPrefix(h, "s.recompute"); ok && strings.HasSuffix(name, "()") {
+			out = append(out, &contextHook{Recompute: strings.TrimSuffix(name, "()")})
+			continue
+		}
+		out = append(out, &contextHook{Stmt: h})
+	}
+	return out
+}
+
+// hasRecomputeHook 再計算を呼ぶ文があるか
+func hasRecomputeHook(hooks []*contextHook) bool {
+	for _, h := range hooks {
+		if h.Recompute != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// newContextRecomputes 構造体の再計算するフィールドのsetterと再計算のメソッドの、ctxを受け取る版を作る。
+// //gen:setters ctxでなければnilを返す
+func newContextRecomputes(r *renderer, target *directiveTarget, setters []*setter, recomputes []*recompute) ([]*contextSetter, []*contextRecompute) {
+	if _, ok := target.d.arg("ctx"); !ok {
+		return nil, nil
+	}
+	structName := target.s.name()
+	var derived []string
+	var ctxRecomputes []*contextRecompute
+	for _, rc := range recomputes {
+		if rc.StructName != structName {
+			continue
+		}
+		derived = append(derived, rc.FieldName)
+		ctxRecomputes = append(ctxRecomputes, &contextRecompute{
+			StructName: structName,
+			FieldName:  rc.FieldName,
+			MethodName: rc.MethodName,
+			Hooks:      contextHooks(rc.Hooks),
+		})
+	}
+	if len(ctxRecomputes) == 0 {
+		return nil, nil
+	}
+	context := r.importName("context")
+	for _, rc := range ctxRecomputes {
+		rc.Context = context
+	}
+	var ctxSetters []*contextSetter
+	for _, set := range setters {
+		if set.StructName != structName || set.Embedded != "" {
+			continue
+		}
+		hooks := contextHooks(set.Hooks)
+		if !hasRecomputeHook(hooks) {
+			continue
+		}
+		restore := []string{set.FieldName}
+		if set.Touch != "" {
+			restore = append(restore, "UpdatedAt")
+		}
+		for _, name := range derived {
+			if !containsTargetField(name, restore...) {
+				restore = append(restore, name)
+			}
+		}
+		ctxSetters = append(ctxSetters, &contextSetter{
+			StructName: structName,
+			MethodName: set.MethodName() + "Context",
+			FieldName:  set.FieldName,
+			FieldType:  set.FieldType,
+			Context:    context,
+			Hooks:      hooks,
+			Touch:      set.Touch,
+			Restore:    restore,
+		})
+	}
+	return ctxSetters, ctxRecomputes
+}
+
+// Fields 元に戻すフィールド（s.Price, s.Total）
+func (c *contextSetter) Fields() string {
+	fields := make([]string, len(c.Restore))
+	for i, name := range c.Restore {
+		fields[i] = "s." + name
+	}
+	return strings.Join(fields, ", ")
+}
+
+// Saved 元の値を保存しておく変数（oldPrice, oldTotal）
+func (c *contextSetter) Saved() string {
+	saved := make([]string, len(c.Restore))
+	for i, name := range c.Restore {
+		saved[i] = "old" + exportedName(name)
+	}
+	return strings.Join(saved, ", ")
+}
@@ -0,0 +1,590 @@
+package gen
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// generator //gen:<name>ディレクティブで有効になるコード生成の説明
+type generator struct {
+	name    string
+	summary string
+	doc     string
+	args    []generatorOption
+	tags    []generatorOption
+	// generic 型パラメータのある構造体（type Repo[T any] struct）にも使える
+	generic bool
+	// prepare 全てのrenderの前に呼ばれる。他のコード生成の出力に影響するもの（フックなど）を登録する
+	prepare func(r *renderer, targets []*directiveTarget) error
+	// render ディレクティブのついた構造体に対してコードを生成する
+	render func(r *renderer, targets []*directiveTarget) error
+	// after このコード生成より先にprepareとrenderを呼ぶコード生成の名前。出力や登録したフックを使う場合に指定する
+	after []string
+	// afterAll afterAllでない全てのコード生成の後に呼ぶ
+	afterAll bool
+}
+
+// generatorOption ディレクティブの引数や構造体タグの説明
+type generatorOption struct {
+	name string
+	doc  string
+}
+
+// directive ソースに書くディレクティブ
+func (g *generator) directive() string {
+	return "//gen:" + g.name
+}
+
+// generators 登録されているコード生成。登録順にhelpなどへ表示する
+var generators []*generator
+
+func registerGenerator(g *generator) {
+	generators = append(generators, g)
+}
+
+// generatorOrder afterとafterAllを満たすように並べたコード生成。
+// 順番に制約のないものは登録順のままにするので、ディレクティブを書いた順に関わらず出力は変わらない
+func generatorOrder() ([]*generator, error) {
+	index := make(map[string]int, len(generators))
+	for i, g := range generators {
+		index[g.name] = i
+	}
+	deps := make([][]int, len(generators))
+	for i, g := range generators {
+		for _, name := range g.after {
+			j, ok := index[name]
+			if !ok {
+				return nil, fmt.Errorf("%s%s runs after unknown generator %q", directivePrefix, g.name, name)
+			}
+			deps[i] = append(deps[i], j)
+		}
+		if g.afterAll {
+			for j, other := range generators {
+				if !other.afterAll {
+					deps[i] = append(deps[i], j)
+				}
+			}
+		}
+	}
+	done := make([]bool, len(generators))
+	order := make([]*generator, 0, len(generators))
+	for len(order) < len(generators) {
+		// 先に呼ぶものが全て済んだうち、最も先に登録したもの
+		next := slices.IndexFunc(generators, func(g *generator) bool {
+			i := index[g.name]
+			return !done[i] && !slices.ContainsFunc(deps[i], func(j int) bool { return !done[j] })
+		})
+		if next < 0 {
+			var cycle []string
+			for i, g := range generators {
+				if !done[i] {
+					cycle = append(cycle, directivePrefix+g.name)
+				}
+			}
+			return nil, fmt.Errorf("generators depend on each other: %s", strings.Join(cycle, ", "))
+		}
+		done[next] = true
+		order = append(order, generators[next])
+	}
+	return order, nil
+}
+
+// lookupGenerator 名前（//gen:つきでもよい）から登録されているコード生成を探す
+func lookupGenerator(name string) *generator {
+	name = strings.TrimPrefix(name, "//gen:")
+	for _, g := range generators {
+		if g.name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+func init() {
+	registerGenerator(&generator{
+		name:    strings.TrimPrefix(settersDirective, "//gen:"),
+		generic: true,
+		prepare: prepareSetters,
+		render:  renderSetters,
+		summary: "generate SetX methods for timestamp fields",
+		doc: `Generates a SetX(v T) method for each CreatedAt/UpdatedAt field of the
+annotated struct, or for every exported field with //gen:setters all. Map and slice fields additionally get AddX, RemoveX and
+XLen helpers (maps are initialized lazily). Fields promoted from an
+embedded struct of another package (e.g. gorm.Model) get setters on the
+outer struct too. A TenantID field gets
+BelongsTo(tenant) and a SetTenantID that refuses moving the struct to
+another tenant. The methods are written to <file>_setters.go next to the
+source file.`,
+		args: []generatorOption{
+			{name: "all", doc: "generate SetX for every exported field, not only CreatedAt/UpdatedAt"},
+			{name: "tenant", doc: "guard (default) refuses cross-tenant SetTenantID, allow permits it, off leaves TenantID alone"},
+			{name: "embedded", doc: "also generate setters for fields promoted from embedded structs of the same package"},
+			{name: "chain", doc: "SetX returns the receiver so calls can be chained (same as -chain for this struct)"},
+			{name: "touch", doc: "SetX of fields other than CreatedAt/UpdatedAt, and the other generated mutators (AddX/RemoveX, SetFlagX/ClearFlagX, CompareAndSetX, SetTenantID, SetX of //gen:i18n), also set UpdatedAt to time.Now(); touch=clock reads the time from a replaceable XNow variable, which AppendX, fsm transitions, Apply of //gen:patch and the CreatedAt set by constructors and builders use too"},
+			{name: "ctx", doc: "also generate SetXContext(ctx, v) error for gen:\"recompute\" inputs, calling computeTotalContext(ctx) and restoring the fields on error"},
+			{name: "unexported", doc: "generate setX (and setXContext) instead of SetX for use inside the package only; helpers like AddX stay exported"},
+		},
+		tags: []generatorOption{
+			{name: `gen:"flags=A,B"`, doc: "integer field holds bit flags: generate HasA/SetFlagA/ClearFlagA and XString()"},
+			{name: `gen:"setter"`, doc: "generate SetX for the field regardless of -fields and all; gen:\"nosetter\" never generates it"},
+			{name: `gen:"name=Touch"`, doc: "name of the generated setter instead of SetX"},
+			{name: `gen:"append"`, doc: "slice field is append-only: generate AppendX (bumping UpdatedAt) and a copying getter instead of setters"},
+			{name: `gen:"cas"`, doc: "generate CompareAndSetX(old, new T) bool; use cas=atomic on int32/int64/uint32/uint64/uintptr fields to swap with sync/atomic, which SetX and the getter then use too"},
+			{name: `gen:"recompute=Total"`, doc: "field is an input of the denormalized field Total: generate SetX calling recomputeTotal(), which assigns s.computeTotal()"},
+			{name: `gen:"encrypted"`, doc: "string or []byte field encrypted at rest: generate EncryptFields(ctx, enc) and DecryptFields(ctx, dec) calling your Encrypt/Decrypt"},
+			{name: `gen:"lazy=initX"`, doc: "generate a getter that sets the field from initX() once, guarded by the xOnce sync.Once field you declare"},
+			{name: `gen:"key"`, doc: "part of the composite key: with two or more, generate XKey, Key() and XKeyMap"},
+		},
+	})
+	registerGenerator(&generator{
+		name:    "fsm",
+		generic: true,
+		summary: "generate state transition methods for a status field",
+		doc: `Generates a method per transition that checks the current value of the
+state field, returns an error if the transition is not allowed, sets the
+new state and bumps UpdatedAt when it is a time.Time. Methods are named
+To<State> after the target state unless a name is given as Name:from->to;
+transitions sharing a name may start from several states.`,
+		args: []generatorOption{
+			{name: "field", doc: "name of the state field (required)"},
+			{name: "transitions", doc: `comma separated transitions such as "draft->published,Archive:published->archived" (required)`},
+			{name: "values", doc: "string (default) to compare with string literals, const to use the states as constant names"},
+		},
+		render: renderFSM,
+	})
+	registerGenerator(&generator{
+		name:    "derived",
+		summary: "generate cached getters for values computed from other fields",
+		doc: `Each argument Name=method(Field,...) generates a Name() getter that calls
+the method once and caches the result. The cache is dropped whenever a
+generated method changes one of the listed fields (any field when the list
+is omitted); a SetX method is generated for inputs that have no setter yet.
+The method must be declared in the same file, and the struct needs a field
+of type <struct>Derived (e.g. derived exampleDerived) that holds the cache.`,
+		args: []generatorOption{
+			{name: "Name=method(Field,...)", doc: "getter name, method computing the value and the fields it depends on"},
+		},
+		prepare: prepareDerived,
+		render:  renderDerived,
+	})
+	registerGenerator(&generator{
+		name:    "invariants",
+		generic: true,
+		summary: "check invariants() at the end of every generated mutating method",
+		doc: `Every method generated for the struct that changes a field (setters,
+collection helpers, flags, compare-and-set, state transitions) calls
+s.invariants() error as its last step. By default a violation panics so
+method signatures stay the same; with mode=error methods without a result
+return the error instead (CompareAndSetX still panics).`,
+		args: []generatorOption{
+			{name: "mode", doc: "panic (default) or error"},
+		},
+		prepare: prepareInvariants,
+	})
+	registerGenerator(&generator{
+		name:    "shared",
+		summary: "generate a copy-on-write SharedX wrapper",
+		doc: `Generates SharedX holding a *X that is never modified in place, with
+NewSharedX, View and Mutate(func(*X)) *SharedX. Mutate clones the value
+before calling the function, copying pointers, slices and maps recursively
+like //gen:deepcopy, so a SharedX can be handed to other goroutines without
+locking. Interfaces, functions and channels are still shared.`,
+		render: renderShared,
+	})
+	registerGenerator(&generator{
+		name:    "builder",
+		summary: "generate a fluent XBuilder with WithX methods and ToBuilder",
+		doc: `Generates XBuilder with NewXBuilder, a WithX(v T) *XBuilder method per
+field and Build() *X. ToBuilder() on the struct returns a builder preloaded
+with the current values, so modifying a copy is a one-liner:
+resp := req.ToBuilder().WithStatus("done").Build(). Fields of sync and
+sync/atomic types, gen:"lazy" fields and the //gen:derived cache get no WithX
+and are left zero by ToBuilder and Build, so locks are not copied and cached
+values are recomputed.`,
+		args: []generatorOption{
+			{name: "required", doc: `comma separated required fields, same as tagging them gen:"required"`},
+		},
+		tags: []generatorOption{
+			{name: `gen:"required"`, doc: "Build() returns (*X, error) and reports required fields whose WithX was not called"},
+			{name: `gen:"autoid"`, doc: "Build() fills the field from XIDs (an XIDGenerator you set) unless WithX was called"},
+		},
+		render: renderBuilder,
+	})
+	registerGenerator(&generator{
+		name:    "constructor",
+		generic: true,
+		summary: "generate NewX taking the required fields as parameters",
+		doc: `Generates NewX(...) *X whose parameters are the fields tagged
+gen:"required", in declaration order. With validate, NewX returns (*X, error)
+and rejects zero values of the required fields (time.Time is checked with
+IsZero, pointers, slices and maps against nil) and the error of invariants()
+when the struct has //gen:invariants.`,
+		args: []generatorOption{
+			{name: "required", doc: `comma separated required fields, same as tagging them gen:"required"`},
+			{name: "validate", doc: "return (*X, error) and reject zero values of required fields"},
+		},
+		tags: []generatorOption{
+			{name: `gen:"required"`, doc: "field becomes a positional parameter of NewX"},
+			{name: `gen:"autoid"`, doc: "NewX fills the field from XIDs, an XIDGenerator such as a UUIDv7, ULID or snowflake source"},
+		},
+		render: renderConstructor,
+	})
+	registerGenerator(&generator{
+		name:    "table",
+		generic: true,
+		summary: "mark a struct as a database table for the erd command",
+		doc: `Generates no code. Fields with a db:"column" tag become columns of the
+table in "gen-struct erd"; a column named id is the primary key, pointer
+fields are nullable and a field named XxxID references the table of the
+struct Xxx.`,
+		args: []generatorOption{
+			{name: "name", doc: "table name (default: snake_case of the struct name)"},
+		},
+	})
+	registerGenerator(&generator{
+		name:    "provider",
+		summary: "generate a wire provider set or fx module from inject-tagged fields",
+		doc: `Generates ProvideX(...) *X taking the fields tagged inject:"" as
+parameters, plus XSet = wire.NewSet(ProvideX) or, with kind=fx,
+XModule = fx.Provide(ProvideX).`,
+		args: []generatorOption{
+			{name: "kind", doc: "wire (default) or fx"},
+		},
+		tags: []generatorOption{
+			{name: `inject:""`, doc: "field is a dependency passed to ProvideX"},
+		},
+		render: renderProvider,
+	})
+	registerGenerator(&generator{
+		name:    "binder",
+		summary: "generate DecodeXRequest(r *http.Request) combining path, query, header and JSON body",
+		doc: `Generates DecodeXRequest(r *http.Request) (*X, error). Fields tagged
+json are decoded from the body, then fields tagged path, query or header are
+parsed from the request (strings, bools, integers, floats, time.Time in
+RFC3339 and time.Duration; []string for repeated query values). Parse
+errors and missing gen:"required" values are collected with errors.Join.`,
+		args: []generatorOption{
+			{name: "router", doc: "how path parameters are read: std (r.PathValue, default), chi or gorilla"},
+		},
+		tags: []generatorOption{
+			{name: `path:"id"`, doc: "path parameter"},
+			{name: `query:"page"`, doc: "query parameter"},
+			{name: `header:"X-Request-ID"`, doc: "request header"},
+			{name: `gen:"required"`, doc: "report an error when the value is missing"},
+		},
+		render: renderBinder,
+	})
+	registerGenerator(&generator{
+		name:    "page",
+		summary: "generate an XPage response envelope for cursor pagination",
+		doc: `Generates XPage{Items, NextCursor, Total} and NewXPage(items, limit).
+Fetch limit+1 rows in cursor order; when more than limit are passed the
+extra row is dropped and NextCursor is built from the key fields of the
+last item (CreatedAt and ID by default) as opaque base64 JSON, decoded by
+the generated UnmarshalXPageCursor. With //gen:cursor the cursor is made by
+XCursor.Marshal instead; when it signs, NewXPage also takes the key.`,
+		args: []generatorOption{
+			{name: "key", doc: "comma separated fields forming the cursor (default: CreatedAt,ID if present)"},
+		},
+		render: renderPage,
+	})
+	registerGenerator(&generator{
+		name:    "cursor",
+		summary: "generate opaque keyset pagination cursors",
+		doc: `Generates XCursor holding the key fields (CreatedAt and ID by default),
+X.Cursor(), XCursor.Marshal() and UnmarshalXCursor, encoding the cursor as
+base64 JSON. With sign the cursor carries an HMAC-SHA256 signature and both
+functions take the key. //gen:page also builds NextCursor with it.`,
+		args: []generatorOption{
+			{name: "key", doc: "comma separated fields forming the cursor (default: CreatedAt,ID if present)"},
+			{name: "sign", doc: "sign cursors with HMAC-SHA256; Marshal and UnmarshalXCursor take the key"},
+		},
+		render: renderCursor,
+	})
+	registerGenerator(&generator{
+		name:    "canonical",
+		generic: true,
+		summary: "generate CanonicalBytes() for signing payloads",
+		doc: `Generates CanonicalBytes() []byte, a deterministic JSON object of the
+selected fields: keys (json tag names when present) are sorted, time.Time
+values are written in UTC as RFC 3339 with nanoseconds and other values use
+encoding/json. Use it as the input of HMAC signing and verification.`,
+		args: []generatorOption{
+			{name: "fields", doc: "comma separated fields to include (default: exported fields without json:\"-\")"},
+		},
+		render: renderCanonical,
+	})
+	registerGenerator(&generator{
+		name:    "pii",
+		generic: true,
+		summary: "generate Masked() and Anonymize(key) for fields tagged pii",
+		doc: `Generates Masked() X returning a redacted copy (emails keep the first
+letter and domain, phone numbers the last four digits, other strings become
+***, non-string fields are zeroed) and Anonymize(key []byte) which replaces
+string fields in place with their HMAC-SHA256 hex digest under key and
+zeroes the others.`,
+		tags: []generatorOption{
+			{name: `pii:"email"`, doc: "personal data of the given kind: email, phone, name, address or secret"},
+		},
+		render: renderPII,
+	})
+	registerGenerator(&generator{
+		name:    "i18n",
+		generic: true,
+		summary: "generate Name(lang) and SetName(lang, value) for per-language fields",
+		doc: `String fields named <Name><LANG> for the languages listed in langs
+(e.g. NameEN and NameJA with langs=EN,JA) are bundled into Name(lang) string
+and SetName(lang, value string) bool. Languages match case-insensitively;
+Name falls back to the first language and SetName reports unknown ones.`,
+		args: []generatorOption{
+			{name: "langs", doc: "comma separated field suffixes, the first one is the fallback (required)"},
+		},
+		render: renderI18n,
+	})
+	registerGenerator(&generator{
+		name:    "getters",
+		generic: true,
+		summary: "generate accessor methods for unexported fields",
+		doc: `Generates a getter per unexported field: name gets Name(). With all,
+exported fields are included too and get GetName() because a method cannot
+share the field's name. prefix=Get names every getter GetX.`,
+		args: []generatorOption{
+			{name: "all", doc: "include exported fields"},
+			{name: "prefix", doc: "prefix of the getter names (default none; exported fields always get Get)"},
+		},
+		tags: []generatorOption{
+			{name: `gen:"getter"`, doc: "generate the getter even for an exported field without all; gen:\"nogetter\" never generates it"},
+		},
+		render: renderGetters,
+	})
+	registerGenerator(&generator{
+		name:    "mixin",
+		generic: true,
+		summary: "generate reusable types to embed, such as Timestamps",
+		doc: `//gen:mixin timestamps generates a Timestamps struct with CreatedAt and
+UpdatedAt (time.Time), SetCreatedAt, SetUpdatedAt and Touch(now). Embed it
+in other structs; generators such as fsm, page, cursor and canonical treat
+its fields as fields of the embedding struct. When several files of a
+package ask for the same mixin it is generated once, in the first file by
+name.`,
+		args: []generatorOption{
+			{name: "timestamps", doc: "generate the Timestamps struct"},
+		},
+		render: renderMixin,
+	})
+	registerGenerator(&generator{
+		name:    "options",
+		generic: true,
+		summary: "generate a functional options constructor NewX(opts ...XOption)",
+		doc: `Generates type XOption func(*X), NewX(opts ...XOption) *X and a
+WithField(v T) XOption function per field. Use prefix when several structs
+in a package have fields of the same name (prefix=User gives WithUserName).
+Cannot be combined with //gen:constructor, which also generates NewX.`,
+		args: []generatorOption{
+			{name: "fields", doc: "comma separated fields that get an option (default: all fields)"},
+			{name: "prefix", doc: "inserted after With in the option function names"},
+		},
+		render: renderOptions,
+	})
+	registerGenerator(&generator{
+		name:    "errors",
+		summary: "generate sentinel errors and typed errors carrying the key of the struct",
+		doc: `//gen:errors NotFound,Conflict generates, per kind, a sentinel
+ErrXNotFound and a type XNotFoundError holding the key fields of X. The
+type's Is method matches the sentinel, so callers can test with errors.Is
+and read the key with errors.As. The key defaults to the ID field when
+there is one.`,
+		args: []generatorOption{
+			{name: "Kind,...", doc: "comma separated error kinds such as NotFound,Conflict (required)"},
+			{name: "key", doc: "comma separated fields carried by the errors (default: ID if present)"},
+		},
+		render: renderErrors,
+	})
+	registerGenerator(&generator{
+		name:    "wrappers",
+		summary: "generate OptionalX (value + ok) and XResult (value + error) types",
+		doc: `Generates OptionalX with SomeX, NoneX, Get, IsPresent, OrElse and Map,
+and XResult with NewXResult(v, err), Get, Err, OrElse and Map, so optional
+values and fallible results of X are explicit without repeating the same
+wrapper code per model. Both are generated unless the kinds are given.`,
+		args: []generatorOption{
+			{name: "optional", doc: "generate OptionalX"},
+			{name: "result", doc: "generate XResult"},
+		},
+		render: renderWrappers,
+	})
+	registerGenerator(&generator{
+		name:    "visitor",
+		summary: "generate VisitFields and a typed XFieldVisitor interface",
+		doc: `Generates VisitFields(f func(name string, value any) error) error, which
+passes each field to f in declaration order, and Accept(v XFieldVisitor)
+error, where XFieldVisitor has a VisitField(v T) error method per field.
+Exported fields are visited unless fields selects them.`,
+		args: []generatorOption{
+			{name: "fields", doc: "comma separated fields to visit (default: exported fields)"},
+		},
+		render: renderVisitor,
+	})
+	registerGenerator(&generator{
+		name:    "projection",
+		summary: "generate a struct with some of the fields and a ToX converter",
+		doc: `Each Name=Field,... argument generates a struct named after the struct
+and Name (Summary on Example generates ExampleSummary) holding the listed
+fields with their tags, and a ToName() method copying them from the struct.
+The gen, inject, path, query and header tags only configure the source
+struct and are dropped.`,
+		args: []generatorOption{
+			{name: "Name=Field,...", doc: "projection name and the comma separated fields it keeps"},
+		},
+		render: renderProjection,
+	})
+	registerGenerator(&generator{
+		name:    "stringer",
+		generic: true,
+		summary: "generate String() listing the exported fields",
+		doc: `Generates String() string printing the exported fields in declaration
+order as Example{ID: 1, Name: "a"}. Fields tagged gen:"redact" print as
+[REDACTED] so secrets do not leak into logs.`,
+		tags: []generatorOption{
+			{name: `gen:"redact"`, doc: "hide the value in String()"},
+		},
+		render: renderStringer,
+	})
+	registerGenerator(&generator{
+		name:    "deepcopy",
+		summary: "generate DeepCopy() *X sharing no pointers, slices or maps",
+		doc: `Generates DeepCopy() *X using the type-checked field types: pointers,
+slices and maps are copied recursively, types with a DeepCopy() *T method
+(including other structs marked //gen:deepcopy) are copied with it, and
+structs of other packages are copied by value. Interfaces, functions and
+channels are shared.`,
+		render: renderDeepCopy,
+	})
+	registerGenerator(&generator{
+		name:    "equal",
+		summary: "generate Equal(other *X) bool and optionally Hash() uint64",
+		doc: `Generates Equal(other *X) bool comparing the fields using their
+type-checked types: time.Time and types with an Equal method use it,
+pointers compare the values they point to, slices and maps are compared
+element by element (slices.Equal, maps.Equal) and function fields are
+ignored. With hash, also generates Hash() uint64 writing the fields in
+declaration order to FNV-1a, so values reported equal hash the same.`,
+		args: []generatorOption{
+			{name: "hash", doc: "also generate Hash() uint64"},
+		},
+		render: renderEqual,
+	})
+	registerGenerator(&generator{
+		name:    "idtime",
+		summary: "generate CreatedAtFromID() for ULID and KSUID identifiers",
+		doc: `Generates CreatedAtFromID() time.Time returning the time encoded in an
+identifier of type github.com/oklog/ulid(/v2).ULID or
+github.com/segmentio/ksuid.KSUID. When CreatedAt is a time.Time, also
+generates ValidateCreatedAtID() error, which reports a CreatedAt that does
+not match the identifier at its precision (milliseconds for ULID, seconds
+for KSUID).`,
+		args: []generatorOption{
+			{name: "field", doc: "identifier field (default: ID)"},
+		},
+		render: renderIDTime,
+	})
+	registerGenerator(&generator{
+		name:    "marshal",
+		summary: "generate MarshalJSON/UnmarshalJSON honoring json tags and time formats",
+		doc: `Generates MarshalJSON() ([]byte, error) and UnmarshalJSON([]byte) error that
+honor the json tag name, "-", omitempty and omitzero like encoding/json.
+Unlike encoding/json, omitempty also omits a zero time.Time, and the format
+of a time.Time field can be chosen per field with a gen tag. Fields without a
+json tag use the field name, or its snake_case or camelCase form with case.
+With yaml, also generates MarshalYAML() (any, error) and
+UnmarshalYAML(*yaml.Node) error for gopkg.in/yaml.v3 using the same keys.`,
+		args: []generatorOption{
+			{name: "yaml", doc: "also generate MarshalYAML/UnmarshalYAML for gopkg.in/yaml.v3"},
+			{name: "case", doc: "key of fields without a json tag: snake or camel (default: the field name)"},
+		},
+		tags: []generatorOption{
+			{name: `gen:"time=unix"`, doc: "encode a time.Time field as rfc3339 (default), unix seconds or unixmilli milliseconds"},
+		},
+		render: renderMarshal,
+	})
+	registerGenerator(&generator{
+		name:    "sqlmap",
+		summary: "generate Columns/Values/ScanRow for database/sql from db tags",
+		doc: `Generates Columns() []string, Values() []any and ScanRow(*sql.Rows) error
+for the fields with a db:"column" tag, in field order, so that the column
+list of SELECT and INSERT statements stays in sync with the struct. Fields
+without a db tag or tagged db:"-" are skipped.`,
+		tags: []generatorOption{
+			{name: `db:"column"`, doc: "column name of the field"},
+		},
+		render: renderSQLMap,
+	})
+	registerGenerator(&generator{
+		name:    "patch",
+		summary: "generate an XPatch struct of pointer fields with Apply and ChangedFields",
+		doc: `Generates ExamplePatch with a pointer to each exported field except
+CreatedAt and UpdatedAt (or the fields=A,B given), keeping the json name with
+omitempty, plus ChangedFields() []string and Apply(*Example) copying only the
+non-nil fields. Apply updates UpdatedAt when any field changes (from the XNow
+variable with //gen:setters touch=clock) and runs the field hooks and
+invariants checks of the generated setters, so PATCH handlers can decode the
+request into the patch and apply it to the loaded model. Fields that only
+generated methods may change are never patched: ID and gen:"autoid", TenantID,
+gen:"append", gen:"cas=atomic" and the //gen:fsm state field.`,
+		args: []generatorOption{
+			{name: "fields=A,B", doc: "fields of the patch (default: exported fields except CreatedAt, UpdatedAt and the guarded fields)"},
+		},
+		render: renderPatch,
+	})
+	registerGenerator(&generator{
+		name:    "register",
+		summary: "list the struct in the registry package written with -registry",
+		doc: `Marks the struct for the registry that -registry=DIR (or registry in the
+config file) writes to DIR/zz_generated_registry.go, collecting the marked
+structs of all packages under -dir. The registry maps the name (name=... or
+<package>.<Type>) to an Entry with the reflect.Type, the exported fields and
+their JSON keys, New() any and Decode([]byte) (any, error), and provides
+Lookup(name), Entries(), NameOf(v) and Decode(name, data), so that plugins
+such as event types are dispatched by name without a hand-written switch.
+Nothing is generated next to the struct itself.`,
+		args: []generatorOption{
+			{name: "name", doc: "name in the registry (default: <package>.<Type>)"},
+		},
+		render: renderRegister,
+	})
+	registerGenerator(&generator{
+		name:    "custom",
+		generic: true,
+		summary: "generate code from a user-provided text/template",
+		doc: `//gen:custom audit runs the template audit.tmpl from a directory given
+with -template (or templates in the config file). The template receives the
+[]*gen.Struct of the structs that use it: Name, TypeParams, TypeArgs, Fields
+(Name, Type, Tag, Embedded, Doc), Directives, Imports, and Args with the
+remaining directive arguments (//gen:custom audit level=info). Call
+{{importName "log"}} to import a package and {{ident "Name"}} to apply
+-prefix. The output is formatted with the rest of the generated file.`,
+		args: []generatorOption{
+			{name: "name", doc: "name of the template (<name>.tmpl)"},
+			{name: "key=value", doc: "passed to the template as .Args"},
+		},
+		render: renderCustom,
+	})
+	// 他のコード生成が生成したメソッドを集めるので、最後に呼ぶ
+	registerGenerator(&generator{
+		name:     "interface",
+		afterAll: true,
+		summary:  "generate an interface of the generated setters and getters for mocking",
+		doc: `//gen:interface ExampleAccessor generates an interface named
+ExampleAccessor (default: the struct name followed by Accessor) with the
+signatures of the exported methods that //gen:setters and //gen:getters
+generate for the struct, and asserts that *Example implements it. Use it to
+mock model accessors in tests without keeping the interface in sync by hand.`,
+		args: []generatorOption{
+			{name: "Name", doc: "name of the interface"},
+			{name: "methods", doc: "also include the exported methods written by hand"},
+			{name: "all", doc: "include the exported methods of all generators, not only setters and getters"},
+		},
+		render: renderInterface,
+	})
+}
@@ -0,0 +1,318 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// directiveTarget ディレクティブと、それがついている構造体
+type directiveTarget struct {
+	s *targetStruct
+	d *directive
+}
+
+// renderer 1ファイル分の生成コードを組み立てる。
+// 各generatorは本文をbodyに書き、必要なimportはimportNameで登録する
+type renderer struct {
+	t       *targetStructs
+	version int
+	fields  []string // setterを生成するフィールド名
+	// key: ソースで参照している名前（別名があれば別名）
+	importsMap map[string]*usedImport
+	// key: 構造体名.フィールド名（構造体名.*は全フィールド）, value: 生成するメソッドがフィールドを変更した後に実行する文
+	hooks map[string][]string
+	// key: 構造体名, value: //gen:invariantsのmode（panicかerror）
+	invariants map[string]string
+	// key: 構造体名。gen:"autoid"の生成器を宣言済みか
+	autoIDs map[string]bool
+	body    bytes.Buffer
+	test    *renderer // _test.goに出力するコード。testFileで作る
+	example *renderer // _example_test.goに出力するコード。exampleFileで作る
+	// outputs コード生成ごとに分けたファイルの本文（key: 接尾辞、元のファイルは空）。currentが今書いているファイル
+	outputs map[string]*splitOutput
+	current string
+	// methods 生成したメソッド。//gen:interfaceがあるときだけ記録する
+	methods []*generatedMethod
+}
+
+func newRenderer(t *targetStructs, fields []string, version int) (*renderer, error) {
+	importsMap := make(map[string]*usedImport, len(t.imports))
+	paths := make([]string, 0, len(t.imports))
+	for _, imp := range t.imports {
+		paths = append(paths, imp.path)
+	}
+	names := importNames.resolveFS(t.fsys, t.path, paths)
+	for _, imp := range t.imports {
+		// ブランクimportとドットimportは型の修飾子にならない
+		if imp.alias == "_" || imp.alias == "." {
+			continue
+		}
+		name, alias := names[imp.path], ""
+		if imp.alias != "" && imp.alias != name {
+			name, alias = imp.alias, imp.alias
+		}
+		if other, ok := importsMap[name]; ok && other.pkg != imp.path {
+			return nil, fmt.Errorf("%s: imports %q and %q are both referred to as %q; add an import alias or -import-name", filepath.Join(t.path, t.filename), other.pkg, imp.path, name)
+		}
+		importsMap[name] = &usedImport{pkg: imp.path, alias: alias}
+	}
+	// 埋め込んだTimestampsのフィールドはtime.Timeとして扱うので、ソースでimportしていなくても参照できるようにしておく
+	for _, s := range t.structs {
+		if !embedsTimestamps(s.structType()) {
+			continue
+		}
+		if imp, ok := importsMap["time"]; !ok {
+			importsMap["time"] = &usedImport{pkg: "time"}
+		} else if imp.pkg != "time" {
+			return nil, fmt.Errorf("%s: %q is imported as time, which hides package time used by the embedded %s", filepath.Join(t.path, t.filename), imp.pkg, timestampsMixin)
+		}
+		break
+	}
+	return &renderer{
+		t:          t,
+		version:    version,
+		fields:     fields,
+		importsMap: importsMap,
+		hooks:      make(map[string][]string),
+		invariants: make(map[string]string),
+		autoIDs:    make(map[string]bool),
+	}, nil
+}
+
+// importName 生成コードからimport pathのパッケージを参照するときの名前を返し、importに加える。
+// ソースでimportしていればその名前を使い、なければ名前がぶつからないよう必要に応じて別名をつける
+func (r *renderer) importName(importPath string) string {
+	for name, imp := range r.importsMap {
+		if imp.pkg == importPath {
+			imp.used = true
+			return name
+		}
+	}
+	base := importNames.resolveFS(r.t.fsys, r.t.path, []string{importPath})[importPath]
+	name, alias := base, ""
+	for i := 2; r.importsMap[name] != nil; i++ {
+		name = base + strconv.Itoa(i)
+		alias = name
+	}
+	r.importsMap[name] = &usedImport{pkg: importPath, alias: alias, used: true}
+	return name
+}
+
+// ident 生成するトップレベルの型や関数の名前に、設定ファイルのprefixをつける。
+// 手で書いたコードと名前がぶつからないようにするためで、エクスポートするかどうかは元の名前に合わせる
+func (r *renderer) ident(name string) string {
+	if r.t.prefix == "" {
+		return name
+	}
+	if ast.IsExported(name) {
+		return exportedName(r.t.prefix) + name
+	}
+	return unexportedName(r.t.prefix) + exportedName(name)
+}
+
+// testFile 生成するテストを組み立てるrenderer。importはテストのファイルで別に管理する
+func (r *renderer) testFile() *renderer {
+	if r.test == nil {
+		r.test = r.fileRenderer()
+	}
+	return r.test
+}
+
+// exampleFile 生成するgodocのExampleを組み立てるrenderer。_example_test.goに出力する
+func (r *renderer) exampleFile() *renderer {
+	if r.example == nil {
+		r.example = r.fileRenderer()
+	}
+	return r.example
+}
+
+// fileRenderer 同じ構造体について別のファイルへ出力するrenderer。フックなどは共有し、importは別に管理する
+func (r *renderer) fileRenderer() *renderer {
+	return &renderer{
+		t:          r.t,
+		version:    r.version,
+		fields:     r.fields,
+		importsMap: make(map[string]*usedImport),
+		hooks:      r.hooks,
+		invariants: r.invariants,
+	}
+}
+
+// addHook 生成するメソッドが構造体のフィールドを変更した後に実行する文を登録する。
+// fieldNameが*の場合はどのフィールドの変更でも実行する
+func (r *renderer) addHook(structName, fieldName, stmt string) {
+	key := structName + "." + fieldName
+	if !containsTargetField(stmt, r.hooks[key]...) {
+		r.hooks[key] = append(r.hooks[key], stmt)
+	}
+}
+
+// fieldHooks フィールドを変更したメソッドの最後に実行する文
+func (r *renderer) fieldHooks(structName string, fieldNames ...string) []string {
+	var stmts []string
+	for _, fieldName := range append(fieldNames, "*") {
+		for _, stmt := range r.hooks[structName+"."+fieldName] {
+			if !containsTargetField(stmt, stmts...) {
+				stmts = append(stmts, stmt)
+			}
+		}
+	}
+	return stmts
+}
+
+// execute テンプレートを実行して本文に追加する
+func (r *renderer) execute(name, text string, data any) error {
+	tmpl, err := template.New(name).Funcs(r.funcs()).Parse(text)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(&r.body, data)
+}
+
+// funcs 生成するメソッドの最後で不変条件を確認するためのテンプレート関数と、型パラメータを扱うテンプレート関数
+func (r *renderer) funcs() template.FuncMap {
+	const (
+		returnErr  = "\n\tif err := s.invariants(); err != nil {\n\t\treturn err\n\t}"
+		panicOnErr = "\n\tif err := s.invariants(); err != nil {\n\t\tpanic(err)\n\t}"
+	)
+	return template.FuncMap{
+		// errorResult 戻り値のないメソッドがerrorを返すようにする
+		"errorResult": func(structName string) string {
+			if r.invariants[structName] == "error" {
+				return " error"
+			}
+			return ""
+		},
+		// earlyReturn 戻り値のないメソッドの途中で返る
+		"earlyReturn": func(structName string) string {
+			if r.invariants[structName] == "error" {
+				return "return nil"
+			}
+			return "return"
+		},
+		// finish 戻り値のないメソッドの最後
+		"finish": func(structName string) string {
+			switch r.invariants[structName] {
+			case "error":
+				return returnErr + "\n\treturn nil"
+			case "panic":
+				return panicOnErr
+			}
+			return ""
+		},
+		// check 元からerrorを返すメソッドの最後
+		"check": func(structName string) string {
+			switch r.invariants[structName] {
+			case "error":
+				return returnErr
+			case "panic":
+				return panicOnErr
+			}
+			return ""
+		},
+		// recv レシーバや戻り値で構造体を参照するときの型（Repo[T]）
+		"recv": func(structName string) string {
+			if s := r.t.lookup(structName); s != nil {
+				return structName + s.typeArgs()
+			}
+			return structName
+		},
+		// typeParams 構造体を返す関数の型パラメータ（[T any]）。制約で参照するパッケージもimportする
+		"typeParams": func(structName string) string {
+			s := r.t.lookup(structName)
+			if s == nil || s.spec.TypeParams == nil {
+				return ""
+			}
+			markUsedImports(s.spec.TypeParams, r.importsMap)
+			return s.typeParams()
+		},
+		// checkPanic errorを返せないメソッドの最後
+		"checkPanic": func(structName string) string {
+			if r.invariants[structName] != "" {
+				return panicOnErr
+			}
+			return ""
+		},
+	}
+}
+
+type headerData struct {
+	Version     int
+	ToolVersion string
+	PackageName string
+	Imports     []templateImport
+	Checksum    string
+	sourceHeader
+}
+
+// sourceHeader 生成ファイルのヘッダーに書く、生成元のソースファイルの情報
+type sourceHeader struct {
+	Source          string // ソースのファイル名。まとめた場合はカンマ区切り
+	BuildConstraint string // ソースのビルド制約の//go:buildの行。なければ空
+}
+
+// isStdImport 最初の要素にドットを含まないimport pathは標準ライブラリとみなす
+func isStdImport(importPath string) bool {
+	first, _, _ := strings.Cut(importPath, "/")
+	return !strings.Contains(first, ".")
+}
+
+// source ヘッダーとimportをつけて整形したコードを返す
+func (r *renderer) source() ([]byte, error) {
+	imports := make([]templateImport, 0, len(r.importsMap))
+	for _, imp := range r.importsMap {
+		if imp.used {
+			imports = append(imports, templateImport{Alias: imp.alias, Path: imp.pkg})
+		}
+	}
+	header := sourceHeader{Source: r.t.filename}
+	// 別のプラットフォーム向けの構造体のsetterは、そのプラットフォームでだけビルドする
+	if r.t.file != nil {
+		header.BuildConstraint = goBuildLine(buildConstraint(r.t.file, r.t.filename))
+	}
+	return generatedSource(r.version, r.t.packageName, imports, r.body.Bytes(), header)
+}
+
+// generatedSource ヘッダーとimportを本文につけて整形する
+func generatedSource(version int, packageName string, imports []templateImport, body []byte, header sourceHeader) ([]byte, error) {
+	// goimportsと同じく標準ライブラリとそれ以外を空行で分ける
+	sort.Slice(imports, func(i, j int) bool {
+		if si, sj := isStdImport(imports[i].Path), isStdImport(imports[j].Path); si != sj {
+			return si
+		}
+		return imports[i].Path < imports[j].Path
+	})
+	for i := 1; i < len(imports); i++ {
+		imports[i].NewGroup = isStdImport(imports[i-1].Path) && !isStdImport(imports[i].Path)
+	}
+	tmpl, err := template.New("header").Parse(headerTemplate)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, &headerData{
+		Version:      version,
+		ToolVersion:  toolVersion(),
+		PackageName:  packageName,
+		Imports:      imports,
+		Checksum:     checksumPlaceholder,
+		sourceHeader: header,
+	})
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(body)
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	// 整形した後の内容のハッシュを記録する
+	return withChecksum(src), nil
+}
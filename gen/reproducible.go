@@ -0,0 +1,23 @@
+package gen
+
+import "bytes"
+
+var reproducible = commandLine.Bool("reproducible", false, "omit the tool version from headers and normalize line endings so that the output is byte-identical on every machine")
+
+// makeReproducible 生成したファイルから、ビルドした環境によって変わる内容を除き、ハッシュを計算し直す。
+// ツールのバージョン（疑似バージョンのコミット日時や+dirty）の行を除き、改行をLFにそろえ、最後を改行で終える。
+// ヘッダーのソースはファイル名だけで、ファイルやimportの順は実行ごとに変わらないので、それ以外は同じ内容になる
+func makeReproducible(generated []*generatedFile) {
+	for _, g := range generated {
+		var buf bytes.Buffer
+		for _, line := range bytes.SplitAfter(bytes.ReplaceAll(g.src, []byte("\r\n"), []byte("\n")), []byte("\n")) {
+			if !bytes.HasPrefix(line, []byte(toolVersionPrefix)) {
+				buf.Write(line)
+			}
+		}
+		if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+		g.src = withChecksum(buf.Bytes())
+	}
+}
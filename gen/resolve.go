@@ -0,0 +1,255 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// typeResolver 構文だけでは型の分からないフィールドを、go/packagesで読んだ型情報で解決する。
+// ドットimportした型（Time）や型エイリアス（type Stamp = time.Time）は、
+// そのまま文字列にすると生成コードのimportが足りなかったり、time.Timeと認識できなかったりする
+type typeResolver struct {
+	mu   sync.Mutex                  // pkgsを守る。パッケージを読んでいる間は持たない
+	pkgs map[string]*resolvedPackage // key: パッケージのディレクトリ
+}
+
+type resolvedPackage struct {
+	// mu 同じディレクトリを並行して読まないよう、読んで確かめる間は持つ。別のディレクトリは並行して読める
+	mu    sync.Mutex
+	types *types.Package
+	// fingerprint 読んだときのディレクトリの.goファイルの名前、サイズ、更新日時。serveで変わっていれば読み直す
+	fingerprint string
+}
+
+var resolvedTypes = &typeResolver{pkgs: make(map[string]*resolvedPackage)}
+
+// load ディレクトリのパッケージを型検査する。結果はディレクトリの.goファイルが変わるまでキャッシュする
+func (tr *typeResolver) load(dir, packageName string) (*types.Package, error) {
+	tr.mu.Lock()
+	cached, ok := tr.pkgs[dir]
+	if !ok {
+		cached = &resolvedPackage{}
+		tr.pkgs[dir] = cached
+	}
+	tr.mu.Unlock()
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+	fingerprint, err := dirFingerprint(dir)
+	if err != nil {
+		return nil, err
+	}
+	if cached.types != nil && cached.fingerprint == fingerprint {
+		return cached.types, nil
+	}
+	cfg := &packages.Config{Mode: loadMode, Dir: dir}
+	loaded, err := packages.Load(cfg, ".")
+	if err != nil {
+		return nil, err
+	}
+	var pkg *types.Package
+	for _, p := range loaded {
+		// 生成済みのファイルが古くて型エラーになっていても、構造体のフィールドの型は分かる
+		if p.Types != nil && p.Name == packageName {
+			pkg = p.Types
+		}
+	}
+	if pkg == nil {
+		return nil, fmt.Errorf("cannot load package %s in %s", packageName, dir)
+	}
+	cached.types, cached.fingerprint = pkg, fingerprint
+	return pkg, nil
+}
+
+// dirFingerprint ディレクトリの.goファイルの名前、サイズ、更新日時をつなげた文字列
+func dirFingerprint(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String(), nil
+}
+
+// filesFingerprint ファイルのサイズと更新日時をつなげた文字列。読めないファイルは削除されたものとして書く
+func filesFingerprint(files []string) string {
+	var b strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			fmt.Fprintf(&b, "%s -\n", file)
+			continue
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
+
+// packageAliases パッケージのディレクトリで宣言されている型エイリアスの名前。生成されたファイルは読まない
+func packageAliases(fsys fs.FS, dir, packageName string) (map[string]bool, error) {
+	sources, err := packageSources(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	aliases := make(map[string]bool)
+	for _, source := range sources {
+		file, err := parser.ParseFile(token.NewFileSet(), source.path, source.src, parser.SkipObjectResolution)
+		if err != nil || file.Name.Name != packageName || ast.IsGenerated(file) {
+			continue
+		}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				if spec := spec.(*ast.TypeSpec); spec.Assign.IsValid() {
+					aliases[spec.Name.Name] = true
+				}
+			}
+		}
+	}
+	return aliases, nil
+}
+
+// unresolvedIdents 型の式のうち、パッケージ名で修飾されていない識別子
+func unresolvedIdents(expr ast.Expr) []string {
+	var idents []string
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			return false
+		case *ast.Ident:
+			idents = append(idents, n.Name)
+		}
+		return true
+	})
+	return idents
+}
+
+// resolveFieldTypes ドットimportした型や型エイリアスを使っているフィールドの型を、
+// 型情報からパッケージ名で修飾した型（time.Time）に書き換える。必要なimportはt.importsに加える。
+// 該当するフィールドがなければパッケージは読まない
+func (t *targetStructs) resolveFieldTypes() error {
+	dotImport := false
+	for _, imp := range t.imports {
+		if imp.alias == "." {
+			dotImport = true
+		}
+	}
+	aliases, err := packageAliases(t.fsys, t.path, t.packageName)
+	if err != nil {
+		return err
+	}
+	needsTypes := func(expr ast.Expr) bool {
+		for _, name := range unresolvedIdents(expr) {
+			if aliases[name] || dotImport && types.Universe.Lookup(name) == nil {
+				return true
+			}
+		}
+		return false
+	}
+	var pkg *types.Package
+	for _, s := range t.structs {
+		structType := s.structType()
+		if structType == nil {
+			continue
+		}
+		for _, field := range structType.Fields.List {
+			if len(field.Names) == 0 || !needsTypes(field.Type) {
+				continue
+			}
+			if pkg == nil {
+				if pkg, err = t.loadTypes(); err != nil {
+					return err
+				}
+			}
+			// ドットimportでなくパッケージ内で宣言された型であれば、そのままでよい
+			if !dotImportedOrAlias(pkg, field.Type, aliases) {
+				continue
+			}
+			typ, err := t.qualifiedFieldType(pkg, s.name(), field.Names[0].Name)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", s.name(), field.Names[0].Name, err)
+			}
+			if typ != nil {
+				field.Type = typ
+			}
+		}
+	}
+	return nil
+}
+
+// dotImportedOrAlias 型の式にパッケージのスコープにない識別子（ドットimport）か型エイリアスが含まれるか
+func dotImportedOrAlias(pkg *types.Package, expr ast.Expr, aliases map[string]bool) bool {
+	for _, name := range unresolvedIdents(expr) {
+		if aliases[name] {
+			return true
+		}
+		if pkg.Scope().Lookup(name) == nil && types.Universe.Lookup(name) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// qualifiedFieldType 型情報からフィールドの型の式を作る。型エイリアスは元の型にする。型が分からなければnil
+func (t *targetStructs) qualifiedFieldType(pkg *types.Package, structName, fieldName string) (ast.Expr, error) {
+	obj, ok := pkg.Scope().Lookup(structName).(*types.TypeName)
+	if !ok {
+		return nil, nil
+	}
+	st, ok := obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		return nil, nil
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		if f.Name() != fieldName {
+			continue
+		}
+		typ := types.Unalias(f.Type())
+		if typ == types.Typ[types.Invalid] {
+			return nil, nil
+		}
+		return parser.ParseExpr(types.TypeString(typ, func(p *types.Package) string {
+			if p == pkg {
+				return ""
+			}
+			return t.importFor(p.Path())
+		}))
+	}
+	return nil, nil
+}
+
+// importFor import pathのパッケージを参照する名前。ドットimportしかしていなければimportを加える
+func (t *targetStructs) importFor(importPath string) string {
+	for _, imp := range t.imports {
+		if imp.path == importPath && imp.alias != "." && imp.alias != "_" {
+			if imp.alias != "" {
+				return imp.alias
+			}
+			return importNames.resolveFS(t.fsys, t.path, []string{importPath})[importPath]
+		}
+	}
+	t.imports = append(t.imports, sourceImport{path: importPath})
+	return importNames.resolveFS(t.fsys, t.path, []string{importPath})[importPath]
+}
@@ -0,0 +1,137 @@
+package gen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// テンプレートの制限はフラグでだけ変えられる。設定ファイルで緩められると、共有する設定に書かれた
+// テンプレートが全員の生成を止められてしまう
+var (
+	templateTimeout   = commandLine.Duration("template-timeout", 10*time.Second, "abort a //gen:custom or template set template that runs longer than this")
+	templateMaxOutput = commandLine.Int("template-max-output", 4<<20, "abort a //gen:custom or template set template that writes more than this many `bytes`")
+)
+
+// errTemplateStopped 時間切れで打ち切ったテンプレートの書き込みや関数の呼び出しに返す
+var errTemplateStopped = errors.New("template execution was stopped")
+
+// templateGuard 実行中のテンプレートの出力をためて大きさを制限し、打ち切った後はrendererに触らせない
+type templateGuard struct {
+	mu      sync.Mutex
+	r       *renderer
+	buf     bytes.Buffer
+	max     int
+	err     error // 出力が大きすぎて打ち切った理由
+	stopped bool
+}
+
+func (g *templateGuard) Write(p []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stopped {
+		return 0, errTemplateStopped
+	}
+	if g.buf.Len()+len(p) > g.max {
+		g.err = fmt.Errorf("template wrote more than %d bytes (raise -template-max-output if this is expected)", g.max)
+		return 0, g.err
+	}
+	return g.buf.Write(p)
+}
+
+// funcs テンプレートから呼べる関数。importNameとidentだけで、ファイルやコマンドには触れない。
+// データの関数を呼べるcallも使わせない
+func (g *templateGuard) funcs() template.FuncMap {
+	funcs := templateSetFuncs(g.r)
+	return template.FuncMap{
+		"importName": g.guarded(funcs["importName"].(func(string) string)),
+		"ident":      g.guarded(funcs["ident"].(func(string) string)),
+		"call": func(any, ...any) (any, error) {
+			return nil, errors.New("call is not allowed in templates")
+		},
+	}
+}
+
+func (g *templateGuard) guarded(fn func(string) string) func(string) (string, error) {
+	return func(s string) (string, error) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.stopped {
+			return "", errTemplateStopped
+		}
+		return fn(s), nil
+	}
+}
+
+// timedOutTemplates 時間切れになったテンプレート（key: templateKey）。
+// 止められずに裏で回り続けている実行を、serve、watch、lspで生成するたびに増やさないよう、同じテンプレートは二度と実行しない
+var timedOutTemplates struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+// templateKey テンプレートの名前と解析した内容から作るキー。生成のたびに読み直しても、内容が同じなら同じになる
+func templateKey(tmpl *template.Template) string {
+	h := sha256.New()
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00", t.Name(), t.Tree.Root.String())
+	}
+	return tmpl.Name() + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// executeTemplate 利用者のテンプレートを-template-timeoutと-template-max-outputの範囲で実行し、出力をwに加える。
+// text/templateの実行は途中で止められないので、時間切れになったら結果を待たずにエラーを返す。
+// 出力も関数の呼び出しもしないループはプロセスが終わるまで裏で回り続けるので、そのテンプレートは変更されるまで実行しない
+func executeTemplate(w *bytes.Buffer, tmpl *template.Template, r *renderer, data any) error {
+	key := templateKey(tmpl)
+	timedOutTemplates.mu.Lock()
+	timedOut := timedOutTemplates.keys[key]
+	timedOutTemplates.mu.Unlock()
+	if timedOut {
+		return fmt.Errorf("template timed out earlier in this process and is not run again until it changes")
+	}
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return err
+	}
+	g := &templateGuard{r: r, max: *templateMaxOutput}
+	clone.Funcs(g.funcs())
+	done := make(chan error, 1)
+	go func() {
+		done <- clone.Execute(g, data)
+	}()
+	timer := time.NewTimer(*templateTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.err != nil {
+			return g.err
+		}
+		if err != nil {
+			return err
+		}
+		w.Write(g.buf.Bytes())
+		return nil
+	case <-timer.C:
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		g.stopped = true
+		timedOutTemplates.mu.Lock()
+		if timedOutTemplates.keys == nil {
+			timedOutTemplates.keys = make(map[string]bool)
+		}
+		timedOutTemplates.keys[key] = true
+		timedOutTemplates.mu.Unlock()
+		return fmt.Errorf("template did not finish within %s (raise -template-timeout if this is expected)", *templateTimeout)
+	}
+}
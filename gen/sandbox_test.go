@@ -0,0 +1,63 @@
+package gen
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+// 利用者のテンプレートは出力の大きさと時間を制限して実行し、callは使わせない。時間切れになったテンプレートは二度と実行しない
+func TestExecuteTemplate(t *testing.T) {
+	timeout, maxOutput := *templateTimeout, *templateMaxOutput
+	*templateTimeout, *templateMaxOutput = 100*time.Millisecond, 1<<10
+	t.Cleanup(func() { *templateTimeout, *templateMaxOutput = timeout, maxOutput })
+	structs := []*Struct{{Name: "Model", Fields: []*Field{
+		{Name: "At", Type: "time.Time"},
+		{Name: "Alias", Type: "Stamp"},
+		{Name: "Ptr", Type: "*time.Time"},
+	}}}
+	// 時間切れの記録はプロセスに残るので、-countで繰り返しても別のテンプレートになるようにする
+	name := "sandbox" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	tests := []struct {
+		name    string
+		text    string
+		data    any
+		want    string
+		wantErr string
+	}{
+		{"fields", `{{range .}}{{range .Fields}}// {{.Name}} {{.Type}} {{importName "time"}} {{ident .Name}}` + "\n{{end}}{{end}}", structs, "// At time.Time time At\n// Alias Stamp time Alias\n// Ptr *time.Time time Ptr\n", ""},
+		{"too large", `{{range .}}{{range .Fields}}{{printf "%1000s" .Type}}{{end}}{{end}}`, structs, "", "wrote more than 1024 bytes"},
+		{"call", `{{range .}}{{call .Name}}{{end}}`, structs, "", "call is not allowed"},
+		{"timeout", `{{range .}}{{end}}`, make(chan int), "", "did not finish within"},
+		{"timed out earlier", `{{range .}}{{end}}`, structs, "", "timed out earlier"},
+	}
+	for _, tt := range tests {
+		tmpl, err := template.New(name).Funcs(templateSetFuncs(nil)).Parse(tt.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := newRenderer(&targetStructs{packageName: "m", path: ".", filename: "model.go"}, nil, outputVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		err = executeTemplate(&buf, tmpl, r, tt.data)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: executeTemplate() error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			if buf.Len() > 0 {
+				t.Errorf("%s: executeTemplate() writes the output of a failed template:\n%s", tt.name, buf.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: executeTemplate() error = %v", tt.name, err)
+		} else if buf.String() != tt.want {
+			t.Errorf("%s: executeTemplate() = %q, want %q", tt.name, buf.String(), tt.want)
+		}
+	}
+}
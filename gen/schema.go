@@ -0,0 +1,58 @@
+package gen
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// directiveSchema エディタのプラグインなどに渡すディレクティブの説明
+type directiveSchema struct {
+	Name      string         `json:"name"`
+	Directive string         `json:"directive"`
+	Summary   string         `json:"summary"`
+	Doc       string         `json:"doc"`
+	Args      []optionSchema `json:"args"`
+	Tags      []optionSchema `json:"tags"`
+}
+
+type optionSchema struct {
+	Name string `json:"name"`
+	Doc  string `json:"doc"`
+}
+
+type schema struct {
+	ToolVersion   string            `json:"toolVersion"`
+	OutputVersion int               `json:"outputVersion"`
+	Directives    []directiveSchema `json:"directives"`
+}
+
+// runSchema 登録されているディレクティブの一覧をJSONで出力する
+func runSchema(args []string) error {
+	s := schema{
+		ToolVersion:   toolVersion(),
+		OutputVersion: outputVersion,
+		Directives:    make([]directiveSchema, 0, len(generators)),
+	}
+	for _, g := range generators {
+		s.Directives = append(s.Directives, directiveSchema{
+			Name:      g.name,
+			Directive: g.directive(),
+			Summary:   g.summary,
+			Doc:       g.doc,
+			Args:      optionSchemas(g.args),
+			Tags:      optionSchemas(g.tags),
+		})
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+func optionSchemas(options []generatorOption) []optionSchema {
+	schemas := make([]optionSchema, 0, len(options))
+	for _, o := range options {
+		schemas = append(schemas, optionSchema{Name: o.name, Doc: o.doc})
+	}
+	return schemas
+}
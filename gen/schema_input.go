@@ -0,0 +1,255 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// schemaDocument -schemaで読む、構造体の定義を書いたYAMLかJSONのファイル
+//
+//	package: models
+//	imports: [github.com/google/uuid]
+//	structs:
+//	  - name: User
+//	    doc: User is a registered account.
+//	    directives: [setters, "builder required=Name"]
+//	    fields:
+//	      - {name: ID, type: uuid.UUID, tags: {json: id, db: id}}
+//	      - {name: Name, type: string, tags: {json: name}}
+//	      - {name: CreatedAt, type: time.Time}
+type schemaDocument struct {
+	Package string `yaml:"package"`
+	// Imports フィールドの型が参照するパッケージのimport path。timeは書かなくてよい
+	Imports []string        `yaml:"imports,omitempty"`
+	Structs []*schemaStruct `yaml:"structs"`
+
+	// Proto メッセージごとに構造体とprotoc-gen-goの型との変換を生成する.protoファイル（スキーマのファイルからの相対パス）
+	Proto string `yaml:"proto,omitempty"`
+	// OpenAPI components/schemasのオブジェクトごとに構造体を生成するOpenAPIの仕様（スキーマのファイルからの相対パス）
+	OpenAPI string `yaml:"openapi,omitempty"`
+	// Directives protoのメッセージやOpenAPIのスキーマの構造体につけるディレクティブ。省略するとsetters
+	Directives []string `yaml:"directives,omitempty"`
+	// Timestamps CreatedAtとUpdatedAtがなければ足すメッセージやスキーマ。省略するとネストしていない全てのもの
+	Timestamps *[]string `yaml:"timestamps,omitempty"`
+}
+
+type schemaStruct struct {
+	Name string `yaml:"name"`
+	Doc  string `yaml:"doc,omitempty"`
+	// Directives //gen:を除いたディレクティブ（setters、builder required=Nameなど）
+	Directives []string       `yaml:"directives,omitempty"`
+	Fields     []*schemaField `yaml:"fields"`
+}
+
+type schemaField struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	Doc  string `yaml:"doc,omitempty"`
+	// Tags タグのキーと値（json: id）。キーの順に並べる
+	Tags map[string]string `yaml:"tags,omitempty"`
+}
+
+// schemaOutputPath スキーマから生成する構造体のファイル。user.schema.yamlならuser.go
+func schemaOutputPath(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	name = strings.TrimSuffix(name, ".schema")
+	return filepath.Join(filepath.Dir(path), name+".go")
+}
+
+// checkSchemaPath -schemaに指定できるファイルか
+func checkSchemaPath(path string) error {
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml", ".json":
+	default:
+		return fmt.Errorf("-schema: %s must be a .yaml, .yml or .json file", path)
+	}
+	if strings.HasSuffix(schemaOutputPath(path), "_test.go") {
+		return fmt.Errorf("-schema: %s would generate a test file", path)
+	}
+	return nil
+}
+
+// generateSchemaSource スキーマのファイルから構造体を宣言するGoのソースを生成する。
+// ディレクティブもそのまま書くので、Goで書いた構造体と同じようにメソッドを生成できる
+func generateSchemaSource(path string, version int) (*generatedFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// JSONはYAMLとして読める
+	var doc schemaDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if !token.IsIdentifier(doc.Package) {
+		return nil, fmt.Errorf("%s: package must be a package name, got %q", path, doc.Package)
+	}
+	outputPath := schemaOutputPath(path)
+	dir := filepath.Dir(outputPath)
+	var converters []byte
+	var converterImports []string
+	if doc.Proto != "" && doc.OpenAPI != "" {
+		return nil, fmt.Errorf("%s: proto and openapi cannot be used together", path)
+	}
+	if doc.OpenAPI != "" {
+		src, err := os.ReadFile(filepath.Join(filepath.Dir(path), doc.OpenAPI))
+		if err != nil {
+			return nil, err
+		}
+		if err := doc.addOpenAPIStructs(path, src); err != nil {
+			return nil, err
+		}
+	}
+	if doc.Proto != "" {
+		src, err := os.ReadFile(filepath.Join(filepath.Dir(path), doc.Proto))
+		if err != nil {
+			return nil, err
+		}
+		if converters, converterImports, err = doc.addProtoStructs(path, dir, src); err != nil {
+			return nil, err
+		}
+	}
+	if len(doc.Structs) == 0 {
+		return nil, fmt.Errorf("%s: no structs", path)
+	}
+	paths := slices.Clone(doc.Imports)
+	for _, p := range converterImports {
+		if !slices.Contains(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+	if !slices.Contains(paths, "time") {
+		paths = append(paths, "time")
+	}
+	names := importNames.resolve(dir, paths)
+	byName := make(map[string]string, len(paths)) // key: 参照する名前, value: import path
+	for _, p := range paths {
+		byName[names[p]] = p
+	}
+	used := make(map[string]bool)
+	var body bytes.Buffer
+	seen := make(map[string]bool)
+	for _, s := range doc.Structs {
+		if !token.IsIdentifier(s.Name) {
+			return nil, fmt.Errorf("%s: invalid struct name %q", path, s.Name)
+		}
+		if seen[s.Name] {
+			return nil, fmt.Errorf("%s: struct %s is defined twice", path, s.Name)
+		}
+		seen[s.Name] = true
+		body.WriteString("\n")
+		writeSchemaComment(&body, "", s.Doc)
+		for _, d := range s.Directives {
+			if _, err := parseDirective(directivePrefix + d); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", path, s.Name, err)
+			}
+			fmt.Fprintf(&body, "%s%s\n", directivePrefix, d)
+		}
+		fmt.Fprintf(&body, "type %s struct {\n", s.Name)
+		fieldNames := make(map[string]bool)
+		for _, f := range s.Fields {
+			if !token.IsIdentifier(f.Name) || fieldNames[f.Name] {
+				return nil, fmt.Errorf("%s: %s: invalid or duplicate field name %q", path, s.Name, f.Name)
+			}
+			fieldNames[f.Name] = true
+			expr, err := parser.ParseExpr(f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s.%s: invalid type %q", path, s.Name, f.Name, f.Type)
+			}
+			var qualifierErr error
+			ast.Inspect(expr, func(n ast.Node) bool {
+				sel, ok := n.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				if x, ok := sel.X.(*ast.Ident); ok {
+					if _, ok := byName[x.Name]; !ok {
+						qualifierErr = fmt.Errorf("%s: %s.%s: package %s is not in imports", path, s.Name, f.Name, x.Name)
+					}
+					used[x.Name] = true
+				}
+				return false
+			})
+			if qualifierErr != nil {
+				return nil, qualifierErr
+			}
+			writeSchemaComment(&body, "\t", f.Doc)
+			fmt.Fprintf(&body, "\t%s %s%s\n", f.Name, f.Type, schemaTag(f.Tags))
+		}
+		body.WriteString("}\n")
+	}
+	body.Write(converters)
+	for _, p := range converterImports {
+		used[names[p]] = true
+	}
+	var imports []templateImport
+	for _, p := range paths {
+		if name := names[p]; used[name] {
+			imports = append(imports, templateImport{Path: p})
+		}
+	}
+	src, err := generatedSource(version, doc.Package, imports, body.Bytes(), sourceHeader{Source: filepath.Base(path)})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &generatedFile{source: path, path: outputPath, src: src}, nil
+}
+
+// schemaTag タグのキーの順に並べたstructタグ。なければ空
+func schemaTag(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + ":" + strconv.Quote(tags[key])
+	}
+	tag := strings.Join(parts, " ")
+	if strings.Contains(tag, "`") {
+		return " " + strconv.Quote(tag)
+	}
+	return " `" + tag + "`"
+}
+
+func writeSchemaComment(buf *bytes.Buffer, indent, doc string) {
+	if doc == "" {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimRight(doc, "\n"), "\n") {
+		fmt.Fprintf(buf, "%s// %s\n", indent, line)
+	}
+}
+
+// generateFromSchemas スキーマのファイルごとに構造体のファイルを生成し、そのディレクティブのメソッドも生成する。
+// 構造体のファイルはまだ書き込んでいないので、生成した内容から読む
+func generateFromSchemas(paths []string, opts *generateOptions, out *outputCoordinator) []*generatedFile {
+	var generated []*generatedFile
+	for _, path := range paths {
+		g, err := generateSchemaSource(path, opts.versionFor(schemaOutputPath(path)))
+		if err != nil {
+			l := out.fileLog(path)
+			l.Error(err)
+			l.flush()
+			continue
+		}
+		generated = append(generated, g)
+		generated = append(generated, generateFromSource(g.path, g.src, opts, out)...)
+	}
+	return generated
+}
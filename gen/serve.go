@@ -0,0 +1,249 @@
+package gen
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// generateServer serveで常駐し、ビルドツールやエディタ拡張からのHTTPの要求で生成する。
+// 型検査したパッケージはファイルが変わるまでキャッシュしたまま次の要求で使う
+type generateServer struct {
+	// root 要求で指定できるパスの範囲
+	root string
+	// version -compatで指定した出力形式。0なら設定ファイルか、以前生成したファイルに記録した形式に従う
+	version int
+	// mu 同じファイルを並行して書かないよう、要求を1つずつ処理する
+	mu sync.Mutex
+	// loopback ループバックのアドレスで待ち受けているか。そうならHostもループバックのものだけを受け付ける
+	loopback bool
+}
+
+// serveRequest POST /generateの本文
+type serveRequest struct {
+	Path string `json:"path"`
+}
+
+type serveGenerateResponse struct {
+	Written   []string `json:"written"`
+	Unchanged int      `json:"unchanged"`
+	Failures  int      `json:"failures"`
+	Log       []string `json:"log"`
+}
+
+type serveStatusResponse struct {
+	UpToDate  bool     `json:"upToDate"`
+	OutOfDate []string `json:"outOfDate"`
+	Failures  int      `json:"failures"`
+	Log       []string `json:"log"`
+}
+
+type serveStruct struct {
+	File       string   `json:"file"`
+	Line       int      `json:"line"`
+	Name       string   `json:"name"`
+	Directives []string `json:"directives"`
+}
+
+// runServe ローカルのHTTPで生成を受け付ける
+//
+//	GET  /health              ツールのバージョン
+//	GET  /structs?path=DIR    ディレクティブのついた構造体の一覧
+//	GET  /status?path=DIR     生成したファイルが古くなっていないか（-checkと同じ）
+//	POST /generate {"path"}   生成して書き込む（Content-Type: application/jsonのみ）
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:7878", "address to listen on")
+	root := flags.String("root", ".", "only accept paths under this directory")
+	compat := flags.String("compat", "", "output version to emit (e.g. v1 or latest); by default regenerated files keep the version recorded in their header")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	s := &generateServer{}
+	if *compat != "" {
+		version, err := parseOutputVersion(*compat)
+		if err != nil {
+			return err
+		}
+		s.version = version
+	}
+	var err error
+	if s.root, err = filepath.Abs(*root); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	if host, _, err := net.SplitHostPort(listener.Addr().String()); err == nil {
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			s.loopback = true
+		} else {
+			log.Printf("warning: listening on %s; anyone who can reach it can write generated files under %s", listener.Addr(), s.root)
+		}
+	}
+	log.Printf("serving %s on http://%s", s.root, listener.Addr())
+	return http.Serve(listener, s.handler())
+}
+
+func (s *generateServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		writeServeJSON(w, http.StatusOK, map[string]string{"version": toolVersion()})
+	})
+	mux.HandleFunc("GET /structs", s.handleStructs)
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("POST /generate", s.handleGenerate)
+	return s.checkHost(mux)
+}
+
+// checkHost ループバックで待ち受けているとき、Hostがループバックでない要求を拒否する。
+// DNS rebindingで外部のWebページのドメインを127.0.0.1に向け、ブラウザから要求させるのを防ぐ
+func (s *generateServer) checkHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.loopback && !isLoopbackHost(r.Host) {
+			writeServeError(w, http.StatusForbidden, fmt.Errorf("host %q is not a loopback address", r.Host))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isLoopbackHost Hostヘッダー（ポートはあってもなくてもよい）がlocalhostかループバックのIPアドレスか
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *generateServer) handleStructs(w http.ResponseWriter, r *http.Request) {
+	path, err := s.resolvePath(r.URL.Query().Get("path"))
+	if err != nil {
+		writeServeError(w, http.StatusForbidden, err)
+		return
+	}
+	files, _, err := treeSourceFiles(path)
+	if err != nil {
+		writeServeError(w, http.StatusBadRequest, err)
+		return
+	}
+	structs := []serveStruct{}
+	for _, file := range files {
+		if isGeneratedFile(file) {
+			continue
+		}
+		targets, err := searchTargetStructs(file)
+		if targets == nil {
+			writeServeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		for _, t := range targets.structs {
+			st := serveStruct{File: file, Line: targets.fileSet.Position(t.spec.Pos()).Line, Name: t.name(), Directives: []string{}}
+			for _, d := range t.directives {
+				st.Directives = append(st.Directives, d.String())
+			}
+			structs = append(structs, st)
+		}
+	}
+	writeServeJSON(w, http.StatusOK, map[string]any{"structs": structs})
+}
+
+func (s *generateServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	path, err := s.resolvePath(r.URL.Query().Get("path"))
+	if err != nil {
+		writeServeError(w, http.StatusForbidden, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, err := generateTree(path, s.version)
+	if err != nil {
+		writeServeError(w, http.StatusBadRequest, err)
+		return
+	}
+	diffs, err := checkOutOfDate(g.generated, g.stale)
+	if err != nil {
+		writeServeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	resp := serveStatusResponse{OutOfDate: []string{}, Failures: g.out.failures, Log: logLines(g.logs)}
+	for _, d := range diffs {
+		resp.OutOfDate = append(resp.OutOfDate, d.path)
+	}
+	resp.UpToDate = len(diffs) == 0 && g.out.failures == 0
+	writeServeJSON(w, http.StatusOK, resp)
+}
+
+func (s *generateServer) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	// text/plainなどのフォームで送れる形式は、ブラウザが他のサイトからでもCORSの確認なしに送ってしまう
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		writeServeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("Content-Type must be application/json"))
+		return
+	}
+	var req serveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeServeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	path, err := s.resolvePath(req.Path)
+	if err != nil {
+		writeServeError(w, http.StatusForbidden, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, err := generateTree(path, s.version)
+	if err != nil {
+		writeServeError(w, http.StatusBadRequest, err)
+		return
+	}
+	resp := serveGenerateResponse{}
+	var errs []error
+	resp.Written, resp.Unchanged, errs = g.write()
+	resp.Failures = g.out.failures + len(errs)
+	resp.Log = logLines(g.logs)
+	for _, err := range errs {
+		resp.Log = append(resp.Log, err.Error())
+	}
+	writeServeJSON(w, http.StatusOK, resp)
+}
+
+// resolvePath 要求のパス（省略すると-root）を絶対パスにし、-rootの外ならエラーにする
+func (s *generateServer) resolvePath(path string) (string, error) {
+	if path == "" {
+		return s.root, nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.root, path)
+	}
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil || rel != "." && !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%s is outside %s", path, s.root)
+	}
+	return path, nil
+}
+
+func writeServeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+func writeServeError(w http.ResponseWriter, status int, err error) {
+	writeServeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,61 @@
+package gen
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveはループバックのHostとapplication/jsonの生成の要求だけを受け付け、-rootの外のパスは拒否する
+func TestServeHandler(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":     "module example.com/m\n\ngo 1.23\n",
+		"m/model.go": fieldModel("//gen:setters all", "At time.Time\n\tAlias Stamp\n\tPtr *time.Time"),
+	})
+	handler := (&generateServer{root: dir, loopback: true}).handler()
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		host        string
+		contentType string
+		body        string
+		wantStatus  int
+		want        string
+	}{
+		{"health", "GET", "/health", "localhost:8080", "", "", http.StatusOK, `"version"`},
+		{"foreign host", "GET", "/health", "attacker.example", "", "", http.StatusForbidden, "not a loopback address"},
+		{"structs", "GET", "/structs?path=m", "127.0.0.1", "", "", http.StatusOK, `"name":"Model"`},
+		{"structs outside root", "GET", "/structs?path=..", "127.0.0.1", "", "", http.StatusForbidden, "is outside"},
+		{"status before generate", "GET", "/status", "[::1]:8080", "", "", http.StatusOK, `"upToDate":false`},
+		{"form post", "POST", "/generate", "localhost", "text/plain", `{"path":"m"}`, http.StatusUnsupportedMediaType, "Content-Type must be application/json"},
+		{"generate outside root", "POST", "/generate", "localhost", "application/json", `{"path":"../other"}`, http.StatusForbidden, "is outside"},
+		{"generate", "POST", "/generate", "localhost", "application/json; charset=utf-8", `{"path":"m"}`, http.StatusOK, "model_setters.go"},
+		{"status after generate", "GET", "/status", "localhost", "", "", http.StatusOK, `"upToDate":true`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Host = tt.host
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%s: %s %s = %d %s, want %d containing %q", tt.name, tt.method, tt.target, rec.Code, rec.Body.String(), tt.wantStatus, tt.want)
+		}
+	}
+	src, err := os.ReadFile(filepath.Join(dir, "m", "model_setters.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"SetAt(v time.Time)", "SetAlias(v time.Time)", "SetPtr(v *time.Time)"} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated setters do not contain %q:\n%s", want, src)
+		}
+	}
+}
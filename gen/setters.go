@@ -0,0 +1,883 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"unicode"
+	"unicode/utf8"
+)
+
+// prepareSetters gen:"recompute=Total"のついたフィールドを変更したらrecomputeTotal()を呼ぶようにする
+func prepareSetters(r *renderer, targets []*directiveTarget) error {
+	for _, target := range targets {
+		structName := target.s.name()
+		for _, field := range target.s.structType().Fields.List {
+			for _, derived := range parseGenTag(field).list("recompute") {
+				if !hasField(target.s.structType(), derived) {
+					return fmt.Errorf("%s: gen:\"recompute\" refers to unknown field %s", structName, derived)
+				}
+				for _, name := range field.Names {
+					r.addHook(structName, name.Name, "s.recompute"+exportedName(derived)+"()")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// renderSetters //gen:settersのついた構造体のsetterなどを生成する
+func renderSetters(r *renderer, targets []*directiveTarget) error {
+	var setters []*setter
+	var collections []*collectionHelper
+	var flagFields []*flagField
+	var compareAndSets []*compareAndSet
+	var recomputes []*recompute
+	var encrypted []*encryptedStruct
+	var keys []*compositeKey
+	var lazies []*lazyField
+	var tenants []*tenantGuard
+	var ensures []*ensureCreatedAt
+	var clocks []*touchClock
+	var contextSetters []*contextSetter
+	var contextRecomputes []*contextRecompute
+	for _, target := range targets {
+		structType := target.s.structType()
+		structName := target.s.name()
+		// v4からはTenantIDのフィールドを認識し、テナントの付け替えを防ぐ
+		var tenant *tenantGuard
+		if r.version >= 4 {
+			t, err := newTenantGuard(r, target)
+			if err != nil {
+				return err
+			}
+			if t != nil {
+				tenant = t
+				tenants = append(tenants, t)
+			}
+		}
+		e, err := newEncryptedStruct(r, target.s)
+		if err != nil {
+			return err
+		}
+		if e != nil {
+			encrypted = append(encrypted, e)
+		}
+		k, err := newCompositeKey(r, target.s)
+		if err != nil {
+			return err
+		}
+		if k != nil {
+			keys = append(keys, k)
+		}
+		// v6からはCreatedAtがゼロのときだけ設定するEnsureCreatedAtを生成する
+		if e := newEnsureCreatedAt(r, target.s); e != nil {
+			r.importsMap[e.Time].used = true
+			ensures = append(ensures, e)
+		}
+		// UpdatedAtがtime.Timeであれば追記のたびに更新する
+		touch := timeFieldQualifier(structType, "UpdatedAt", r.importsMap)
+		for _, field := range structType.Fields.List {
+			tag := parseGenTag(field)
+			for _, name := range field.Names {
+				fieldName := name.Name
+				// 遅延初期化するフィールドは、初期化するgetterだけを生成する
+				if tag.has("lazy") {
+					l, err := newLazyField(r, target.s, field, fieldName, tag["lazy"])
+					if err != nil {
+						return err
+					}
+					lazies = append(lazies, l)
+					continue
+				}
+				// 追記専用のsliceはAppendXとコピーを返すgetterだけを生成し、置き換えはさせない
+				if tag.has("append") {
+					c := newCollectionHelper(structName, fieldName, field.Type)
+					if c == nil || c.IsMap {
+						return fmt.Errorf("%s.%s: gen:\"append\" is only supported on slice fields", structName, fieldName)
+					}
+					c.AppendOnly = true
+					c.Hooks = r.fieldHooks(structName, fieldName)
+					if touch != "" {
+						c.Touch = touchNow(r, target.s, touch)
+						c.Hooks = r.fieldHooks(structName, fieldName, "UpdatedAt")
+					}
+					markUsedImports(field.Type, r.importsMap)
+					collections = append(collections, c)
+					continue
+				}
+				if names := tag.list("flags"); names != nil {
+					f, err := newFlagField(structName, fieldName, field.Type, names)
+					if err != nil {
+						return err
+					}
+					f.Hooks = r.fieldHooks(structName, fieldName)
+					flagFields = append(flagFields, f)
+				}
+				if tag.has("cas") {
+					c, err := newCompareAndSet(r, structName, fieldName, field.Type, tag["cas"])
+					if err != nil {
+						return err
+					}
+					c.Hooks = r.fieldHooks(structName, fieldName)
+					markUsedImports(field.Type, r.importsMap)
+					compareAndSets = append(compareAndSets, c)
+				}
+				// v3からはmap, sliceのフィールドに要素を操作するメソッドも生成する
+				// 暗号化するフィールドは要素単位で操作させない
+				if r.version >= 3 && !tag.has("encrypted") {
+					if c := newCollectionHelper(structName, fieldName, field.Type); c != nil {
+						c.Hooks = r.fieldHooks(structName, fieldName)
+						markUsedImports(field.Type, r.importsMap)
+						collections = append(collections, c)
+					}
+				}
+				// 非正規化したフィールドの元になるフィールドは、再計算させるためにsetterを生成する
+				recomputed := tag.list("recompute")
+				for _, derived := range recomputed {
+					if !containsRecompute(recomputes, structName, derived) {
+						recomputes = append(recomputes, &recompute{
+							StructName: structName,
+							FieldName:  derived,
+							MethodName: exportedName(derived),
+							Hooks:      r.fieldHooks(structName, derived),
+						})
+					}
+				}
+				if !r.isSetterField(target.s, fieldName) && recomputed == nil {
+					continue
+				}
+				// TenantIDのsetterはtenantGuardで生成する
+				if tenant != nil && fieldName == tenantField {
+					continue
+				}
+				// setterメソッドの生成
+				set := &setter{
+					StructName: structName,
+					FieldName:  fieldName,
+					FieldType:  r.typeString(field.Type),
+					Hooks:      r.fieldHooks(structName, fieldName),
+				}
+				set.Atomic, set.AtomicType = atomicAccess(r, field)
+				if name := tag["name"]; name != "" {
+					if !token.IsIdentifier(name) || hasField(structType, name) {
+						return fmt.Errorf("%s.%s: gen:\"name=%s\" is not a valid method name", structName, fieldName, name)
+					}
+					set.Name = name
+				}
+				setters = append(setters, set)
+			}
+		}
+		// v5からは埋め込んだ他のパッケージの構造体から昇格したフィールドのsetterも生成する
+		if r.version >= 5 {
+			promoted, err := embeddedSetters(r, target.s)
+			if err != nil {
+				return err
+			}
+			setters = append(setters, promoted...)
+		}
+		// //gen:setters unexportedなら、パッケージの中だけで使うsetXにしてエクスポートするAPIを増やさない
+		if _, ok := target.d.arg("unexported"); ok {
+			for _, set := range setters {
+				if set.StructName == structName {
+					set.Unexported = true
+				}
+			}
+		}
+		clock, now, err := touchSetters(r, target, setters)
+		if err != nil {
+			return err
+		}
+		if clock != nil {
+			clocks = append(clocks, clock)
+		}
+		// 要素やフラグを変更するメソッド、TenantIDのsetterもSetXと同じくUpdatedAtを更新する
+		if now != "" {
+			for _, c := range collections {
+				if c.StructName == structName {
+					c.Touch = now
+					c.Hooks = r.fieldHooks(structName, c.FieldName, "UpdatedAt")
+				}
+			}
+			for _, f := range flagFields {
+				if f.StructName == structName {
+					f.Touch = now
+					f.Hooks = r.fieldHooks(structName, f.FieldName, "UpdatedAt")
+				}
+			}
+			for _, c := range compareAndSets {
+				if c.StructName == structName {
+					c.Touch = now
+					c.Hooks = r.fieldHooks(structName, c.FieldName, "UpdatedAt")
+				}
+			}
+			if tenant != nil {
+				tenant.Touch = now
+				tenant.Hooks = r.fieldHooks(structName, tenantField, "UpdatedAt")
+			}
+		}
+		cs, cr := newContextRecomputes(r, target, setters, recomputes)
+		contextSetters = append(contextSetters, cs...)
+		contextRecomputes = append(contextRecomputes, cr...)
+	}
+	if len(setters) == 0 && len(collections) == 0 && len(flagFields) == 0 && len(compareAndSets) == 0 && len(recomputes) == 0 && len(encrypted) == 0 && len(keys) == 0 && len(lazies) == 0 && len(tenants) == 0 && len(ensures) == 0 {
+		return nil
+	}
+	if err := markChainSetters(r, setters); err != nil {
+		return err
+	}
+	if r.t.examples {
+		if err := renderSetterExamples(r, setters, ensures); err != nil {
+			return err
+		}
+	}
+	return r.execute("setters", settersTemplate, &settersData{
+		Setters:           setters,
+		Collections:       collections,
+		FlagFields:        flagFields,
+		CompareAndSets:    compareAndSets,
+		Recomputes:        recomputes,
+		ContextSetters:    contextSetters,
+		ContextRecomputes: contextRecomputes,
+		Clocks:            clocks,
+		Encrypted:         encrypted,
+		Keys:              keys,
+		Lazies:            lazies,
+		Tenants:           tenants,
+		Ensures:           ensures,
+	})
+}
+
+// isSetterField SetXを生成するフィールドか。//gen:setters allか-fields=*ならエクスポートされた全てのフィールドが対象になる
+func (r *renderer) isSetterField(s *targetStruct, fieldName string) bool {
+	tag := genTag{}
+	if field := findField(s.structType(), fieldName); field != nil {
+		tag = parseGenTag(field)
+	}
+	return setterFieldSelected(tag, fieldName, r.fields, s.directive("setters"))
+}
+
+// setterFieldSelected フィールドのgen:"..."タグ、-fieldsか設定ファイルのfields、//gen:setters（なければnil）から
+// SetXを生成するフィールドか決める。statsやusagesも生成と同じ結果になるようにこれを使う
+func setterFieldSelected(tag genTag, fieldName string, fields []string, d *directive) bool {
+	if selected, ok := tag.selects("setter"); ok {
+		return selected
+	}
+	if containsTargetField(fieldName, fields...) {
+		return true
+	}
+	if containsTargetField("*", fields...) && ast.IsExported(fieldName) {
+		return true
+	}
+	if d == nil {
+		return false
+	}
+	_, all := d.arg("all")
+	return all && ast.IsExported(fieldName)
+}
+
+// chainSetters 構造体のSetXがレシーバを返すか。-chainか//gen:setters chainで有効にする。
+// //gen:invariants mode=errorのSetXはerrorを返すのでつなげられない
+func chainSetters(r *renderer, s *targetStruct) (bool, error) {
+	chain := r.t.chain
+	if d := s.directive("setters"); d != nil {
+		if _, ok := d.arg("chain"); ok {
+			chain = true
+		}
+	}
+	if chain && r.invariants[s.name()] == "error" {
+		return false, fmt.Errorf("%s: chained setters cannot return the error of //gen:invariants mode=error", s.name())
+	}
+	return chain, nil
+}
+
+// markChainSetters レシーバを返す構造体のsetterにChainを設定する
+func markChainSetters(r *renderer, setters []*setter) error {
+	for _, set := range setters {
+		s := r.t.lookup(set.StructName)
+		if s == nil {
+			continue
+		}
+		chain, err := chainSetters(r, s)
+		if err != nil {
+			return err
+		}
+		set.Chain = chain
+	}
+	return nil
+}
+
+type settersData struct {
+	Setters        []*setter
+	Collections    []*collectionHelper
+	FlagFields     []*flagField
+	CompareAndSets []*compareAndSet
+	Recomputes     []*recompute
+	// //gen:setters ctxで生成する、ctxを受け取る再計算
+	ContextSetters    []*contextSetter
+	ContextRecomputes []*contextRecompute
+	Clocks            []*touchClock // //gen:setters touch=clockで宣言する時刻の関数
+	Encrypted         []*encryptedStruct
+	Keys              []*compositeKey
+	Lazies            []*lazyField
+	Tenants           []*tenantGuard
+	Ensures           []*ensureCreatedAt
+}
+
+// ensureCreatedAt 更新時に作成日時を上書きしないよう、ゼロのときだけ設定するEnsureCreatedAt
+type ensureCreatedAt struct {
+	StructName string
+	Time       string // timeパッケージを参照している名前
+	Hooks      []string
+}
+
+// newEnsureCreatedAt //gen:settersのついた構造体のCreatedAtがtime.Timeであれば（v6以降）ensureCreatedAtを返す
+func newEnsureCreatedAt(r *renderer, s *targetStruct) *ensureCreatedAt {
+	if r.version < 6 || s.directive("setters") == nil {
+		return nil
+	}
+	qualifier := timeFieldQualifier(s.structType(), "CreatedAt", r.importsMap)
+	if qualifier == "" {
+		return nil
+	}
+	// gen:"nosetter"のCreatedAtは変更させない
+	if selected, ok := parseGenTag(findField(s.structType(), "CreatedAt")).selects("setter"); ok && !selected {
+		return nil
+	}
+	return &ensureCreatedAt{
+		StructName: s.name(),
+		Time:       qualifier,
+		Hooks:      r.fieldHooks(s.name(), "CreatedAt"),
+	}
+}
+
+type setter struct {
+	StructName   string
+	FieldName    string
+	Name         string // gen:"name=Touch"で変えたメソッド名。空ならSetX
+	FieldType    string
+	Chain        bool     // レシーバを返してs.SetA(a).SetB(b)のようにつなげられるようにする
+	Embedded     string   // 埋め込んだ構造体から昇格したフィールドの場合、埋め込んだフィールドの名前
+	EmbeddedType string   // ポインタで埋め込んでいる場合の型。nilなら代入の前に作る
+	Hooks        []string // 代入の後に実行する文
+	Touch        string   // //gen:setters touchで、代入の後にUpdatedAtに入れる時刻の式
+	Unexported   bool     // //gen:setters unexportedで、SetXの代わりにsetXを生成する
+	Atomic       string   // gen:"cas=atomic"の場合にsync/atomicを参照している名前
+	AtomicType   string   // StoreInt64などの関数名の型の部分
+}
+
+// MethodName 生成するsetterの名前
+func (s *setter) MethodName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	if s.Unexported {
+		return "set" + s.FieldName
+	}
+	return "Set" + s.FieldName
+}
+
+// recompute gen:"recompute=Total"で指定された非正規化したフィールドを再計算するメソッド。
+// 計算自体は利用者が書くcomputeTotal()に任せる
+type recompute struct {
+	StructName string
+	FieldName  string
+	MethodName string
+	Hooks      []string // 再計算した後に実行する文
+}
+
+func containsRecompute(recomputes []*recompute, structName, fieldName string) bool {
+	for _, r := range recomputes {
+		if r.StructName == structName && r.FieldName == fieldName {
+			return true
+		}
+	}
+	return false
+}
+
+// collectionHelper map, sliceのフィールドの要素を操作するメソッド
+type collectionHelper struct {
+	StructName string
+	FieldName  string
+	MethodName string // メソッド名に使う先頭を大文字にしたフィールド名
+	IsMap      bool
+	ElemType   string   // sliceの要素の型
+	KeyType    string   // mapのキーの型
+	ValueType  string   // mapの値の型
+	AppendOnly bool     // gen:"append"のついた追記専用のslice
+	Touch      string   // 要素を変更したときにUpdatedAtに入れる時刻の式。更新しなければ空
+	Hooks      []string // 要素を変更した後に実行する文
+}
+
+// newCollectionHelper フィールドがmapかsliceであればcollectionHelperを返す
+func newCollectionHelper(structName, fieldName string, expr ast.Expr) *collectionHelper {
+	switch expr := expr.(type) {
+	case *ast.ArrayType:
+		// 固定長の配列は要素を追加・削除できない
+		if expr.Len != nil {
+			return nil
+		}
+		return &collectionHelper{
+			StructName: structName,
+			FieldName:  fieldName,
+			MethodName: exportedName(fieldName),
+			ElemType:   getFiledTypeString(expr.Elt),
+		}
+	case *ast.MapType:
+		return &collectionHelper{
+			StructName: structName,
+			FieldName:  fieldName,
+			MethodName: exportedName(fieldName),
+			IsMap:      true,
+			KeyType:    getFiledTypeString(expr.Key),
+			ValueType:  getFiledTypeString(expr.Value),
+		}
+	}
+	return nil
+}
+
+// GetterName 追記専用のsliceのgetterの名前。エクスポートされたフィールドは同名のメソッドを定義できないのでGetをつける
+func (c *collectionHelper) GetterName() string {
+	if c.MethodName == c.FieldName {
+		return "Get" + c.MethodName
+	}
+	return c.MethodName
+}
+
+// exportedName 先頭を大文字にした名前
+func exportedName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+// timeFieldQualifier フィールドがtime.Timeであればtimeパッケージを参照している名前を返す
+func timeFieldQualifier(structType *ast.StructType, fieldName string, importsMap map[string]*usedImport) string {
+	field := findField(structType, fieldName)
+	if field == nil {
+		return ""
+	}
+	sel, ok := field.Type.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Time" {
+		return ""
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	if imp, ok := importsMap[ident.Name]; ok && imp.pkg == "time" {
+		return ident.Name
+	}
+	return ""
+}
+
+// markUsedImports 型の中でパッケージ名で修飾されている部分のimportを使用済みにする
+func markUsedImports(expr ast.Node, importsMap map[string]*usedImport) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); ok {
+			if imp, ok := importsMap[ident.Name]; ok {
+				imp.used = true
+			}
+		}
+		return true
+	})
+}
+
+const settersTemplate = `
+{{range .Setters}}
+func (s *{{recv .StructName}}) {{.MethodName}}(v {{.FieldType}}){{if .Chain}} *{{recv .StructName}}{{else}}{{errorResult .StructName}}{{end}} {
+	{{- if .EmbeddedType}}
+	if s.{{.Embedded}} == nil {
+		s.{{.Embedded}} = new({{.EmbeddedType}})
+	}
+	{{- end}}
+	{{- if .Atomic}}
+	{{.Atomic}}.Store{{.AtomicType}}(&s.{{.FieldName}}, v)
+	{{- else}}
+	s.{{if .Embedded}}{{.Embedded}}.{{end}}{{.FieldName}} = v
+	{{- end}}
+	{{- if .Touch}}
+	s.UpdatedAt = {{.Touch}}
+	{{- end}}
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+	{{- finish .StructName}}
+	{{- if .Chain}}
+	return s
+	{{- end}}
+}
+{{end}}
+
+{{range .Collections}}
+{{- if .AppendOnly}}
+func (s *{{recv .StructName}}) Append{{.MethodName}}(items ...{{.ElemType}}){{errorResult .StructName}} {
+	s.{{.FieldName}} = append(s.{{.FieldName}}, items...)
+	{{- if .Touch}}
+	s.UpdatedAt = {{.Touch}}
+	{{- end}}
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+	{{- finish .StructName}}
+}
+
+func (s *{{recv .StructName}}) {{.GetterName}}() []{{.ElemType}} {
+	if s == nil || s.{{.FieldName}} == nil {
+		return nil
+	}
+	return append([]{{.ElemType}}(nil), s.{{.FieldName}}...)
+}
+{{- else if .IsMap}}
+func (s *{{recv .StructName}}) Add{{.MethodName}}(key {{.KeyType}}, value {{.ValueType}}){{errorResult .StructName}} {
+	if s.{{.FieldName}} == nil {
+		s.{{.FieldName}} = make(map[{{.KeyType}}]{{.ValueType}})
+	}
+	s.{{.FieldName}}[key] = value
+	{{- if .Touch}}
+	s.UpdatedAt = {{.Touch}}
+	{{- end}}
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+	{{- finish .StructName}}
+}
+
+func (s *{{recv .StructName}}) Remove{{.MethodName}}(key {{.KeyType}}){{errorResult .StructName}} {
+	delete(s.{{.FieldName}}, key)
+	{{- if .Touch}}
+	s.UpdatedAt = {{.Touch}}
+	{{- end}}
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+	{{- finish .StructName}}
+}
+{{- else}}
+func (s *{{recv .StructName}}) Add{{.MethodName}}(item {{.ElemType}}){{errorResult .StructName}} {
+	s.{{.FieldName}} = append(s.{{.FieldName}}, item)
+	{{- if .Touch}}
+	s.UpdatedAt = {{.Touch}}
+	{{- end}}
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+	{{- finish .StructName}}
+}
+
+func (s *{{recv .StructName}}) Remove{{.MethodName}}(i int){{errorResult .StructName}} {
+	if i < 0 || i >= len(s.{{.FieldName}}) {
+		{{earlyReturn .StructName}}
+	}
+	s.{{.FieldName}} = append(s.{{.FieldName}}[:i], s.{{.FieldName}}[i+1:]...)
+	{{- if .Touch}}
+	s.UpdatedAt = {{.Touch}}
+	{{- end}}
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+	{{- finish .StructName}}
+}
+{{- end}}
+
+func (s *{{recv .StructName}}) {{.MethodName}}Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.{{.FieldName}})
+}
+{{end}}
+
+{{range .FlagFields}}
+{{- $f := .}}
+{{- range .Flags}}
+func (s *{{recv $f.StructName}}) Has{{.Name}}() bool {
+	return s.{{$f.FieldName}}&(1<<{{.Bit}}) != 0
+}
+
+func (s *{{recv $f.StructName}}) SetFlag{{.Name}}(){{errorResult $f.StructName}} {
+	s.{{$f.FieldName}} |= 1 << {{.Bit}}
+	{{- if $f.Touch}}
+	s.UpdatedAt = {{$f.Touch}}
+	{{- end}}
+	{{- range $f.Hooks}}
+	{{.}}
+	{{- end}}
+	{{- finish $f.StructName}}
+}
+
+func (s *{{recv $f.StructName}}) ClearFlag{{.Name}}(){{errorResult $f.StructName}} {
+	s.{{$f.FieldName}} &^= 1 << {{.Bit}}
+	{{- if $f.Touch}}
+	s.UpdatedAt = {{$f.Touch}}
+	{{- end}}
+	{{- range $f.Hooks}}
+	{{.}}
+	{{- end}}
+	{{- finish $f.StructName}}
+}
+{{end}}
+func (s *{{recv .StructName}}) {{.MethodName}}String() string {
+	str := ""
+	{{- range .Flags}}
+	if s.{{$f.FieldName}}&(1<<{{.Bit}}) != 0 {
+		str += "|{{.Name}}"
+	}
+	{{- end}}
+	if str == "" {
+		return ""
+	}
+	return str[1:]
+}
+{{end}}
+{{range .CompareAndSets}}
+func (s *{{recv .StructName}}) CompareAndSet{{.MethodName}}(old, new {{.FieldType}}) bool {
+	{{- if .Atomic}}
+	{{- if or .Touch .Hooks (checkPanic .StructName)}}
+	if !{{.Atomic}}.CompareAndSwap{{.AtomicType}}(&s.{{.FieldName}}, old, new) {
+		return false
+	}
+	{{- if .Touch}}
+	s.UpdatedAt = {{.Touch}}
+	{{- end}}
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+	{{- checkPanic .StructName}}
+	return true
+	{{- else}}
+	return {{.Atomic}}.CompareAndSwap{{.AtomicType}}(&s.{{.FieldName}}, old, new)
+	{{- end}}
+	{{- else}}
+	if s.{{.FieldName}} != old {
+		return false
+	}
+	s.{{.FieldName}} = new
+	{{- if .Touch}}
+	s.UpdatedAt = {{.Touch}}
+	{{- end}}
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+	{{- checkPanic .StructName}}
+	return true
+	{{- end}}
+}
+{{end}}
+{{range .Recomputes}}
+func (s *{{recv .StructName}}) recompute{{.MethodName}}() {
+	s.{{.FieldName}} = s.compute{{.MethodName}}()
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+}
+{{end}}
+{{range .Clocks}}
+// {{.Var}} returns the time the setters of {{.StructName}} store in UpdatedAt.
+// Replace it in tests to get a fixed UpdatedAt.
+var {{.Var}} = {{.Time}}.Now
+{{end}}
+{{range .ContextSetters}}
+{{- $c := .}}
+// {{.MethodName}} sets {{.FieldName}} and recomputes the derived fields with ctx.
+// When ctx is done or a recomputation fails, the previous values are restored and the error is returned.
+func (s *{{recv .StructName}}) {{.MethodName}}(ctx {{.Context}}.Context, v {{.FieldType}}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	{{.Saved}} := {{.Fields}}
+	s.{{.FieldName}} = v
+	{{- if .Touch}}
+	s.UpdatedAt = {{.Touch}}
+	{{- end}}
+	{{- range .Hooks}}
+	{{- if .Recompute}}
+	if err := s.recompute{{.Recompute}}Context(ctx); err != nil {
+		{{$c.Fields}} = {{$c.Saved}}
+		return err
+	}
+	{{- else}}
+	{{.Stmt}}
+	{{- end}}
+	{{- end}}
+	{{- check .StructName}}
+	return nil
+}
+{{end}}
+{{range .ContextRecomputes}}
+func (s *{{recv .StructName}}) recompute{{.MethodName}}Context(ctx {{.Context}}.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	v, err := s.compute{{.MethodName}}Context(ctx)
+	if err != nil {
+		return err
+	}
+	s.{{.FieldName}} = v
+	{{- range .Hooks}}
+	{{- if .Recompute}}
+	if err := s.recompute{{.Recompute}}Context(ctx); err != nil {
+		return err
+	}
+	{{- else}}
+	{{.Stmt}}
+	{{- end}}
+	{{- end}}
+	return nil
+}
+{{end}}
+{{range .Encrypted}}
+{{- $e := .}}
+// EncryptFields replaces the fields tagged gen:"encrypted" with their ciphertext.
+// String fields hold the ciphertext base64 encoded.
+func (s *{{recv .StructName}}) EncryptFields(ctx {{.Context}}.Context, enc interface {
+	Encrypt(ctx {{.Context}}.Context, plaintext []byte) ([]byte, error)
+}) error {
+	{{- range .Fields}}
+	{{- if .IsString}}
+	if ciphertext, err := enc.Encrypt(ctx, []byte(s.{{.FieldName}})); err != nil {
+		return {{$e.Fmt}}.Errorf("encrypt {{.FieldName}}: %w", err)
+	} else {
+		s.{{.FieldName}} = {{$e.Base64}}.StdEncoding.EncodeToString(ciphertext)
+	}
+	{{- else}}
+	if ciphertext, err := enc.Encrypt(ctx, s.{{.FieldName}}); err != nil {
+		return {{$e.Fmt}}.Errorf("encrypt {{.FieldName}}: %w", err)
+	} else {
+		s.{{.FieldName}} = ciphertext
+	}
+	{{- end}}
+	{{- end}}
+	return nil
+}
+
+// DecryptFields reverses EncryptFields.
+func (s *{{recv .StructName}}) DecryptFields(ctx {{.Context}}.Context, dec interface {
+	Decrypt(ctx {{.Context}}.Context, ciphertext []byte) ([]byte, error)
+}) error {
+	{{- range .Fields}}
+	{{- if .IsString}}
+	if ciphertext, err := {{$e.Base64}}.StdEncoding.DecodeString(s.{{.FieldName}}); err != nil {
+		return {{$e.Fmt}}.Errorf("decrypt {{.FieldName}}: %w", err)
+	} else if plaintext, err := dec.Decrypt(ctx, ciphertext); err != nil {
+		return {{$e.Fmt}}.Errorf("decrypt {{.FieldName}}: %w", err)
+	} else {
+		s.{{.FieldName}} = string(plaintext)
+	}
+	{{- else}}
+	if plaintext, err := dec.Decrypt(ctx, s.{{.FieldName}}); err != nil {
+		return {{$e.Fmt}}.Errorf("decrypt {{.FieldName}}: %w", err)
+	} else {
+		s.{{.FieldName}} = plaintext
+	}
+	{{- end}}
+	{{- end}}
+	return nil
+}
+{{end}}
+{{range .Keys}}
+// {{.KeyName}} is the composite key of {{.StructName}}, made of the fields tagged gen:"key".
+type {{.KeyName}} struct {
+	{{- range .Fields}}
+	{{.FieldName}} {{.FieldType}}
+	{{- end}}
+}
+
+// Key returns the composite key of s.
+func (s *{{.StructName}}) Key() {{.KeyName}} {
+	return {{.KeyName}}{
+		{{- range .Fields}}
+		{{.FieldName}}: s.{{.FieldName}},
+		{{- end}}
+	}
+}
+
+// {{.MapName}} indexes {{.StructName}} values by their composite key.
+type {{.MapName}} map[{{.KeyName}}]*{{.StructName}}
+
+// {{.NewMap}} returns a map holding items. Later items replace earlier ones with the same key.
+func {{.NewMap}}(items ...*{{.StructName}}) {{.MapName}} {
+	m := make({{.MapName}}, len(items))
+	for _, v := range items {
+		m.Put(v)
+	}
+	return m
+}
+
+// Put stores v under its key.
+func (m {{.MapName}}) Put(v *{{.StructName}}) {
+	m[v.Key()] = v
+}
+
+// Get returns the value stored under key.
+func (m {{.MapName}}) Get(key {{.KeyName}}) (*{{.StructName}}, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+// Delete removes the value stored under key.
+func (m {{.MapName}}) Delete(key {{.KeyName}}) {
+	delete(m, key)
+}
+{{end}}
+{{range .Lazies}}
+// {{.MethodName}} returns {{.FieldName}}, calling {{.Initializer}} on the first call only.
+// It is safe for concurrent use.
+func (s *{{recv .StructName}}) {{.MethodName}}() {{.FieldType}} {
+	s.{{.Once}}.Do(func() {
+		s.{{.FieldName}} = s.{{.Initializer}}()
+	})
+	return s.{{.FieldName}}
+}
+{{end}}
+{{range .Ensures}}
+// EnsureCreatedAt sets CreatedAt only when it is still zero, so saving an
+// existing {{.StructName}} again does not overwrite its creation time.
+func (s *{{recv .StructName}}) EnsureCreatedAt(t {{.Time}}.Time){{errorResult .StructName}} {
+	if !s.CreatedAt.IsZero() {
+		{{earlyReturn .StructName}}
+	}
+	s.CreatedAt = t
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+	{{- finish .StructName}}
+}
+{{end}}
+{{range .Tenants}}
+func (s *{{recv .StructName}}) BelongsTo(tenant {{.FieldType}}) bool {
+	return s.TenantID == tenant
+}
+{{if .Guard}}
+// SetTenantID sets the tenant of a new {{.StructName}}. Moving it to another tenant is refused.
+func (s *{{recv .StructName}}) SetTenantID(v {{.FieldType}}) error {
+	if s.TenantID != *new({{.FieldType}}) && s.TenantID != v {
+		return {{.Fmt}}.Errorf("{{.StructName}}: cannot move from tenant %v to %v", s.TenantID, v)
+	}
+	s.TenantID = v
+	{{- if .Touch}}
+	s.UpdatedAt = {{.Touch}}
+	{{- end}}
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+	{{- check .StructName}}
+	return nil
+}
+{{- else}}
+func (s *{{recv .StructName}}) SetTenantID(v {{.FieldType}}){{errorResult .StructName}} {
+	s.TenantID = v
+	{{- if .Touch}}
+	s.UpdatedAt = {{.Touch}}
+	{{- end}}
+	{{- range .Hooks}}
+	{{.}}
+	{{- end}}
+	{{- finish .StructName}}
+}
+{{- end}}
+{{end}}
+`
@@ -0,0 +1,74 @@
+package gen
+
+import "go/ast"
+
+// sharedWrapper //gen:sharedで生成するコピーオンライトのラッパー
+type sharedWrapper struct {
+	StructName string
+	TypeName   string   // SharedExampleのようなラッパーの型名
+	NewName    string   // コンストラクタの名前
+	Stmts      []string // c := *vの後に、共有してはいけない値を複製する文
+}
+
+// renderShared 構造体を共有するためのSharedXと、変更前に複製するMutateを生成する
+func renderShared(r *renderer, targets []*directiveTarget) error {
+	pkg, err := r.t.loadTypes()
+	if err != nil {
+		return err
+	}
+	// 1段だけのコピーでは、ポインタの先やネストしたmap, sliceを書き換えると共有している値まで変わる
+	c := newDeepCopier(r, pkg)
+	var wrappers []*sharedWrapper
+	for _, target := range targets {
+		structName := target.s.name()
+		w := &sharedWrapper{StructName: structName, TypeName: "Shared" + structName, NewName: "NewShared" + structName}
+		if !ast.IsExported(structName) {
+			w.TypeName = "shared" + exportedName(structName)
+			w.NewName = "newShared" + exportedName(structName)
+		}
+		w.TypeName, w.NewName = r.ident(w.TypeName), r.ident(w.NewName)
+		if w.Stmts, err = c.structCopyStmts(structName, "c", "v"); err != nil {
+			return err
+		}
+		wrappers = append(wrappers, w)
+	}
+	return r.execute("shared", sharedTemplate, wrappers)
+}
+
+const sharedTemplate = `
+{{range .}}
+// {{.TypeName}} holds a {{.StructName}} that is never modified in place, so it can be
+// shared between goroutines without locking.
+type {{.TypeName}} struct {
+	v *{{.StructName}}
+}
+
+// {{.NewName}} copies v so that later changes to v are not visible.
+func {{.NewName}}(v *{{.StructName}}) *{{.TypeName}} {
+	return &{{.TypeName}}{v: v.cloneShared()}
+}
+
+// View returns the shared value. It must not be modified; use Mutate instead.
+func (s *{{.TypeName}}) View() *{{.StructName}} {
+	return s.v
+}
+
+// Mutate applies f to a copy and returns it as a new {{.TypeName}}. The receiver is left unchanged.
+func (s *{{.TypeName}}) Mutate(f func(*{{.StructName}})) *{{.TypeName}} {
+	v := s.v.cloneShared()
+	f(v)
+	return &{{.TypeName}}{v: v}
+}
+
+func (v *{{.StructName}}) cloneShared() *{{.StructName}} {
+	if v == nil {
+		return &{{.StructName}}{}
+	}
+	c := *v
+	{{- range .Stmts}}
+	{{.}}
+	{{- end}}
+	return &c
+}
+{{end}}
+`
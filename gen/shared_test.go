@@ -0,0 +1,79 @@
+package gen
+
+import (
+	"strings"
+	"testing"
+)
+
+// Mutateで複製した値を書き換えても、ポインタの先やネストしたmap, sliceを共有している元の値は変わらない
+func TestSharedMutateCopiesDeeply(t *testing.T) {
+	dir, _ := generateModule(t, map[string]string{
+		"m/model.go": `package m
+
+type Item struct {
+	Tags []string
+}
+
+//gen:shared
+type Model struct {
+	Count  *int
+	Items  []*Item
+	Groups map[string][]string
+	Inner  Item
+}
+`,
+		"m/model_test.go": `package m
+
+import "testing"
+
+func TestMutate(t *testing.T) {
+	n := 1
+	s := NewSharedModel(&Model{
+		Count:  &n,
+		Items:  []*Item{{Tags: []string{"a"}}},
+		Groups: map[string][]string{"g": {"a"}},
+		Inner:  Item{Tags: []string{"a"}},
+	})
+	s.Mutate(func(m *Model) {
+		*m.Count = 2
+		m.Items[0].Tags[0] = "b"
+		m.Groups["g"][0] = "b"
+		m.Inner.Tags[0] = "b"
+	})
+	v := s.View()
+	if *v.Count != 1 || v.Items[0].Tags[0] != "a" || v.Groups["g"][0] != "a" || v.Inner.Tags[0] != "a" {
+		t.Errorf("Mutate changed the shared value: %d %v %v %v", *v.Count, v.Items[0].Tags, v.Groups, v.Inner.Tags)
+	}
+}
+`,
+	})
+	goTest(t, dir, "./...")
+}
+
+// time.Timeとその別名はcloneSharedで値のまま複製し、それらへのポインタは指す先を複製する
+func TestSharedFieldKinds(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		want  []string
+	}{
+		{"time", "At time.Time", []string{"c := *v\n\treturn &c"}},
+		{"alias", "At Stamp", []string{"c := *v\n\treturn &c"}},
+		{"pointer", "At *time.Time", []string{"p1 := new(time.Time)", "*p1 = *v.At", "c.At = p1"}},
+		{"alias pointer", "At *Stamp", []string{"p1 := new(Stamp)", "*p1 = *v.At", "c.At = p1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, generated := generateModule(t, map[string]string{"m/model.go": fieldModel("//gen:shared", tt.field)})
+			src := generated["m/model_setters.go"]
+			if strings.Contains(src, ".loc") || strings.Contains(src, ".wall") {
+				t.Errorf("cloneShared expands the fields of time.Time:\n%s", src)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(src, want) {
+					t.Errorf("cloneShared does not contain %q:\n%s", want, src)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// modelSnapshotVersion スナップショットのファイルの形式。形を変えたら上げる
+const modelSnapshotVersion = 1
+
+// modelSnapshot snapshotで記録する、ディレクティブのついた全ての構造体の形
+type modelSnapshot struct {
+	Version int           `json:"version"`
+	Structs []structShape `json:"structs"`
+}
+
+type structShape struct {
+	// Package -dirからのパッケージのディレクトリ（/区切り）
+	Package    string       `json:"package"`
+	Name       string       `json:"name"`
+	TypeParams string       `json:"typeParams,omitempty"`
+	Directives []string     `json:"directives"`
+	Fields     []fieldShape `json:"fields"`
+}
+
+type fieldShape struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Tag      string `json:"tag,omitempty"`
+	Embedded bool   `json:"embedded,omitempty"`
+}
+
+// runSnapshot ディレクティブのついた構造体の形をファイルに記録する
+func runSnapshot(args []string) error {
+	flags := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	dir := flags.String("dir", ".", "directory to analyze")
+	out := flags.String("out", "gen-struct.lock.json", "file to write the snapshot to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	snapshot, err := takeModelSnapshot(*dir)
+	if err != nil {
+		return err
+	}
+	// ディレクティブの->などを読めるまま記録する
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(snapshot); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "recorded %d structs in %s\n", len(snapshot.Structs), *out)
+	return nil
+}
+
+// runChangelog 2つのスナップショット（-toを省略すると今のソース）の違いを変更点の一覧にする
+func runChangelog(args []string) error {
+	flags := flag.NewFlagSet("changelog", flag.ExitOnError)
+	from := flags.String("from", "gen-struct.lock.json", "snapshot of the previous version")
+	to := flags.String("to", "", "snapshot of the new version; defaults to the structs in -dir")
+	dir := flags.String("dir", ".", "directory to analyze when -to is not given")
+	format := flags.String("format", "markdown", "output format (markdown, text)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != "markdown" && *format != "text" {
+		return fmt.Errorf("changelog: unsupported format %q", *format)
+	}
+	previous, err := readModelSnapshot(*from)
+	if err != nil {
+		return err
+	}
+	var current *modelSnapshot
+	if *to != "" {
+		current, err = readModelSnapshot(*to)
+	} else {
+		current, err = takeModelSnapshot(*dir)
+	}
+	if err != nil {
+		return err
+	}
+	writeChangelog(os.Stdout, *format, diffModelSnapshots(previous, current))
+	return nil
+}
+
+func takeModelSnapshot(dir string) (*modelSnapshot, error) {
+	files, err := listGoFiles(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &modelSnapshot{Version: modelSnapshotVersion, Structs: []structShape{}}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") || isGeneratedFile(file) {
+			continue
+		}
+		targets, err := searchTargetStructs(file)
+		if err != nil {
+			return nil, err
+		}
+		pkg, err := filepath.Rel(dir, filepath.Dir(file))
+		if err != nil {
+			return nil, err
+		}
+		imports := targets.namedImports()
+		for _, s := range targets.structs {
+			st := newStruct(targets, s, imports)
+			shape := structShape{Package: filepath.ToSlash(pkg), Name: st.Name, TypeParams: st.TypeParams, Directives: []string{}, Fields: []fieldShape{}}
+			for _, d := range s.directives {
+				shape.Directives = append(shape.Directives, d.String())
+			}
+			for _, f := range st.Fields {
+				shape.Fields = append(shape.Fields, fieldShape{Name: f.Name, Type: f.Type, Tag: string(f.Tag), Embedded: f.Embedded})
+			}
+			snapshot.Structs = append(snapshot.Structs, shape)
+		}
+	}
+	sort.Slice(snapshot.Structs, func(i, j int) bool {
+		a, b := snapshot.Structs[i], snapshot.Structs[j]
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return a.Name < b.Name
+	})
+	return snapshot, nil
+}
+
+func readModelSnapshot(path string) (*modelSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot modelSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if snapshot.Version != modelSnapshotVersion {
+		return nil, fmt.Errorf("%s: unsupported snapshot version %d (want %d); record it again with snapshot", path, snapshot.Version, modelSnapshotVersion)
+	}
+	return &snapshot, nil
+}
+
+// structChange 構造体ごとの変更点
+type structChange struct {
+	Package string
+	Name    string
+	// Kind added, removed, changed
+	Kind    string
+	Changes []string
+}
+
+// diffModelSnapshots 前回から今回への変更を、パッケージ、構造体の名前の順に返す
+func diffModelSnapshots(previous, current *modelSnapshot) []*structChange {
+	key := func(s structShape) string { return s.Package + "\x00" + s.Name }
+	prevByKey := make(map[string]structShape, len(previous.Structs))
+	for _, s := range previous.Structs {
+		prevByKey[key(s)] = s
+	}
+	var changes []*structChange
+	for _, s := range current.Structs {
+		prev, ok := prevByKey[key(s)]
+		delete(prevByKey, key(s))
+		if !ok {
+			c := &structChange{Package: s.Package, Name: s.Name, Kind: "added"}
+			for _, f := range s.Fields {
+				c.Changes = append(c.Changes, "field "+fieldSummary(f))
+			}
+			changes = append(changes, c)
+			continue
+		}
+		if c := diffStructShapes(prev, s); len(c.Changes) > 0 {
+			changes = append(changes, c)
+		}
+	}
+	for _, s := range prevByKey {
+		changes = append(changes, &structChange{Package: s.Package, Name: s.Name, Kind: "removed"})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Package != changes[j].Package {
+			return changes[i].Package < changes[j].Package
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+func diffStructShapes(prev, cur structShape) *structChange {
+	c := &structChange{Package: cur.Package, Name: cur.Name, Kind: "changed"}
+	if prev.TypeParams != cur.TypeParams {
+		c.Changes = append(c.Changes, fmt.Sprintf("type parameters %s → %s", orNone(prev.TypeParams), orNone(cur.TypeParams)))
+	}
+	prevFields := make(map[string]fieldShape, len(prev.Fields))
+	for _, f := range prev.Fields {
+		prevFields[f.Name] = f
+	}
+	for _, f := range cur.Fields {
+		old, ok := prevFields[f.Name]
+		delete(prevFields, f.Name)
+		switch {
+		case !ok:
+			c.Changes = append(c.Changes, "added field "+fieldSummary(f))
+		case old.Type != f.Type:
+			c.Changes = append(c.Changes, fmt.Sprintf("field %s: type %s → %s", f.Name, old.Type, f.Type))
+		}
+		if ok && old.Tag != f.Tag {
+			c.Changes = append(c.Changes, fmt.Sprintf("field %s: tag %s → %s", f.Name, orNone(old.Tag), orNone(f.Tag)))
+		}
+		if ok && old.Embedded != f.Embedded {
+			c.Changes = append(c.Changes, fmt.Sprintf("field %s: embedded %t → %t", f.Name, old.Embedded, f.Embedded))
+		}
+	}
+	// 削除したフィールドは前回の宣言の順に並べる
+	for _, f := range prev.Fields {
+		if _, ok := prevFields[f.Name]; ok {
+			c.Changes = append(c.Changes, "removed field "+f.Name)
+		}
+	}
+	for _, d := range cur.Directives {
+		if !slices.Contains(prev.Directives, d) {
+			c.Changes = append(c.Changes, "added "+directivePrefix+d)
+		}
+	}
+	for _, d := range prev.Directives {
+		if !slices.Contains(cur.Directives, d) {
+			c.Changes = append(c.Changes, "removed "+directivePrefix+d)
+		}
+	}
+	return c
+}
+
+func fieldSummary(f fieldShape) string {
+	s := f.Name + " " + f.Type
+	if f.Embedded {
+		s = f.Type + " (embedded)"
+	}
+	if f.Tag != "" {
+		s += " `" + f.Tag + "`"
+	}
+	return s
+}
+
+// qualifiedStructName パッケージのディレクトリをつけた構造体の名前。-dirのパッケージなら名前だけ
+func qualifiedStructName(pkg, name string) string {
+	if pkg == "." {
+		return name
+	}
+	return pkg + "." + name
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+// writeChangelog 変更点をリリースノートやレビューに貼れる形で書く
+func writeChangelog(w io.Writer, format string, changes []*structChange) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No model changes.")
+		return
+	}
+	if format == "text" {
+		for _, c := range changes {
+			fmt.Fprintf(w, "%s %s\n", c.Kind, qualifiedStructName(c.Package, c.Name))
+			for _, change := range c.Changes {
+				fmt.Fprintf(w, "\t%s\n", change)
+			}
+		}
+		return
+	}
+	fmt.Fprintln(w, "# Model changes")
+	pkg := ""
+	for i, c := range changes {
+		if i == 0 || c.Package != pkg {
+			pkg = c.Package
+			fmt.Fprintf(w, "\n## `%s`\n", pkg)
+		}
+		fmt.Fprintf(w, "\n### %s (%s)\n", c.Name, c.Kind)
+		if len(c.Changes) > 0 {
+			fmt.Fprintln(w)
+		}
+		for _, change := range c.Changes {
+			fmt.Fprintf(w, "- %s\n", change)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// generatorOutputs コード生成ごとの出力先の接尾辞（key: コード生成の名前）。
+// splitなら全てのコード生成を_builderのように名前の接尾辞のファイルに分け、設定ファイルのoutputsでそれを上書きする。
+// 接尾辞がsuffixと同じか、どちらにもないコード生成は今までどおり1つのファイルにまとめる
+func generatorOutputs(split bool, outputs map[string]string, suffix string) (map[string]string, error) {
+	suffixes := make(map[string]string)
+	if split {
+		for _, g := range generators {
+			suffixes[g.name] = "_" + g.name
+		}
+		// setterは今までどおりのファイルに出力する
+		suffixes[strings.TrimPrefix(settersDirective, "//gen:")] = suffix
+	}
+	for name, s := range outputs {
+		if s == "" || strings.ContainsAny(s, `/\`) || strings.HasSuffix(s, "_test") {
+			return nil, fmt.Errorf("invalid output suffix %q for generator %s", s, name)
+		}
+		suffixes[name] = s
+	}
+	for name, s := range suffixes {
+		if s == suffix {
+			delete(suffixes, name)
+		}
+	}
+	return suffixes, nil
+}
+
+// splitOutput コード生成の出力を分けたファイルの、組み立て中の本文と使ったimport
+type splitOutput struct {
+	body []byte
+	used map[string]bool // key: importsMapの名前
+}
+
+// switchOutput 以降のコード生成の本文とimportを、接尾辞suffixのファイルのものに切り替える。
+// フックや不変条件などは共有するので、分けたファイルどうしのメソッドも同じように呼び合える
+func (r *renderer) switchOutput(suffix string) {
+	if suffix == r.current {
+		return
+	}
+	if r.outputs == nil {
+		r.outputs = make(map[string]*splitOutput)
+	}
+	used := make(map[string]bool)
+	for name, imp := range r.importsMap {
+		if imp.used {
+			used[name] = true
+		}
+	}
+	r.outputs[r.current] = &splitOutput{body: bytes.Clone(r.body.Bytes()), used: used}
+	r.body.Reset()
+	next := r.outputs[suffix]
+	if next != nil {
+		r.body.Write(next.body)
+	}
+	for name, imp := range r.importsMap {
+		imp.used = next != nil && next.used[name]
+	}
+	r.current = suffix
+}
+
+// splitSources 分けたファイルそれぞれのソース。最後は元のファイルの本文に戻す
+func (r *renderer) splitSources() ([]*generatedFile, error) {
+	if len(r.outputs) == 0 {
+		return nil, nil
+	}
+	r.switchOutput("")
+	suffixes := make([]string, 0, len(r.outputs))
+	for suffix := range r.outputs {
+		if suffix != "" {
+			suffixes = append(suffixes, suffix)
+		}
+	}
+	sort.Strings(suffixes)
+	var files []*generatedFile
+	for _, suffix := range suffixes {
+		r.switchOutput(suffix)
+		if r.body.Len() == 0 {
+			continue
+		}
+		src, err := r.source()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, &generatedFile{path: r.t.outputPathWithSuffix(suffix), src: src})
+	}
+	r.switchOutput("")
+	return files, nil
+}
+
+// outputPathWithSuffix 接尾辞suffixで分けたファイルの出力先
+func (t *targetStructs) outputPathWithSuffix(suffix string) string {
+	return filepath.Join(filepath.Dir(t.outputPath()), strings.TrimSuffix(t.filename, ".go")+suffix+".go")
+}
@@ -0,0 +1,72 @@
+package gen
+
+import "fmt"
+
+// sqlMap //gen:sqlmapで生成する、db:"column"タグのカラムとフィールドの対応
+type sqlMap struct {
+	StructName string
+	Columns    []*sqlColumn
+	SQL        string
+}
+
+type sqlColumn struct {
+	Name      string
+	FieldName string
+}
+
+func newSQLMap(r *renderer, target *directiveTarget) (*sqlMap, error) {
+	structName := target.s.name()
+	m := &sqlMap{StructName: structName}
+	seen := make(map[string]string) // key: カラム名, value: フィールド名
+	for _, field := range target.s.structType().Fields.List {
+		name, ok := dbColumnName(field)
+		if !ok {
+			continue
+		}
+		// db:"id"をa, bのようにまとめて宣言したフィールドにつけると、カラム名が重なる
+		for _, fieldName := range field.Names {
+			if other, ok := seen[name]; ok {
+				return nil, fmt.Errorf("%s: //gen:sqlmap column %s is used by both %s and %s", structName, name, other, fieldName.Name)
+			}
+			seen[name] = fieldName.Name
+			m.Columns = append(m.Columns, &sqlColumn{Name: name, FieldName: fieldName.Name})
+		}
+	}
+	if len(m.Columns) == 0 {
+		return nil, fmt.Errorf("%s: //gen:sqlmap requires fields with a db:\"column\" tag", structName)
+	}
+	m.SQL = r.importName("database/sql")
+	return m, nil
+}
+
+// renderSQLMap db:"column"タグからColumns、Values、ScanRowを生成する
+func renderSQLMap(r *renderer, targets []*directiveTarget) error {
+	all := make([]*sqlMap, 0, len(targets))
+	for _, target := range targets {
+		m, err := newSQLMap(r, target)
+		if err != nil {
+			return err
+		}
+		all = append(all, m)
+	}
+	return r.execute("sqlmap", sqlMapTemplate, all)
+}
+
+const sqlMapTemplate = `
+{{range .}}
+// Columns returns the columns of {{.StructName}} in the order of Values and ScanRow.
+func (s *{{.StructName}}) Columns() []string {
+	return []string{ {{- range $i, $c := .Columns}}{{if $i}}, {{end}}{{printf "%q" $c.Name}}{{end -}} }
+}
+
+// Values returns the field values in the order of Columns, for INSERT and UPDATE arguments.
+func (s *{{.StructName}}) Values() []any {
+	return []any{ {{- range $i, $c := .Columns}}{{if $i}}, {{end}}s.{{$c.FieldName}}{{end -}} }
+}
+
+// ScanRow scans the current row of rows, selected in the order of Columns, into s.
+func (s *{{.StructName}}) ScanRow(rows *{{.SQL}}.Rows) error {
+	return rows.Scan({{range $i, $c := .Columns}}{{if $i}}, {{end}}&s.{{$c.FieldName}}{{end}})
+}
+{{- end}}
+`
@@ -0,0 +1,123 @@
+package gen
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"os"
+	"text/tabwriter"
+)
+
+// fieldStats フィールドごとの直接代入とsetter呼び出しの件数
+type fieldStats struct {
+	structName  string
+	fieldName   string
+	assigns     int
+	setterCalls int
+}
+
+// runStats setterの対象フィールドについて直接代入とsetter呼び出しの件数を集計する
+func runStats(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	dir := flags.String("dir", ".", "directory to analyze")
+	fields := flags.String("fields", "", "comma separated fields that get SetX, as with generate (default: the fields of .gogenstruct.yaml)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	resolver, err := newSetterFieldResolver(*dir, *fields)
+	if err != nil {
+		return err
+	}
+	pkgs, err := loadPackages(*dir)
+	if err != nil {
+		return err
+	}
+
+	var stats []*fieldStats
+	byField := make(map[*types.Var]*fieldStats)
+	bySetter := make(map[*types.Func]*fieldStats)
+	for _, pkg := range pkgs {
+		setterFields, err := resolver.setterFields(pkg)
+		if err != nil {
+			return err
+		}
+		for _, s := range findAnnotatedStructs(pkg, settersDirective) {
+			for _, field := range s.structFields() {
+				if !s.isSetterField(field, setterFields) {
+					continue
+				}
+				fs := &fieldStats{
+					structName: pkg.Name + "." + s.obj.Name(),
+					fieldName:  field.Name(),
+				}
+				stats = append(stats, fs)
+				byField[field] = fs
+				if setter := s.method(s.setterName(field)); setter != nil {
+					bySetter[setter] = fs
+				}
+			}
+		}
+	}
+
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Syntax {
+			// 生成されたsetter自体の代入は数えない
+			if ast.IsGenerated(file) {
+				continue
+			}
+			ast.Inspect(file, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.FuncDecl:
+					// setter本体の代入は数えない
+					if fn, ok := pkg.TypesInfo.Defs[n.Name].(*types.Func); ok {
+						if _, ok := bySetter[fn]; ok {
+							return false
+						}
+					}
+				case *ast.AssignStmt:
+					for _, lhs := range n.Lhs {
+						if fs, ok := byField[selectedField(pkg.TypesInfo, lhs)]; ok {
+							fs.assigns++
+						}
+					}
+				case *ast.IncDecStmt:
+					if fs, ok := byField[selectedField(pkg.TypesInfo, n.X)]; ok {
+						fs.assigns++
+					}
+				case *ast.CallExpr:
+					sel, ok := n.Fun.(*ast.SelectorExpr)
+					if !ok {
+						return true
+					}
+					fn, ok := pkg.TypesInfo.Uses[sel.Sel].(*types.Func)
+					if !ok {
+						return true
+					}
+					if fs, ok := bySetter[fn.Origin()]; ok {
+						fs.setterCalls++
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STRUCT\tFIELD\tASSIGNMENTS\tSETTER CALLS\tMIGRATED")
+	var totalAssigns, totalCalls int
+	for _, fs := range stats {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", fs.structName, fs.fieldName, fs.assigns, fs.setterCalls, migratedRate(fs.assigns, fs.setterCalls))
+		totalAssigns += fs.assigns
+		totalCalls += fs.setterCalls
+	}
+	fmt.Fprintf(w, "TOTAL\t\t%d\t%d\t%s\n", totalAssigns, totalCalls, migratedRate(totalAssigns, totalCalls))
+	return w.Flush()
+}
+
+func migratedRate(assigns, setterCalls int) string {
+	if assigns+setterCalls == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(setterCalls)*100/float64(assigns+setterCalls))
+}
@@ -0,0 +1,74 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// stringer //gen:stringerで生成するString()
+type stringer struct {
+	StructName string
+	Format     string   // Example{ID: %v, Name: %q, Password: [REDACTED]}
+	Args       []string // Formatに渡すフィールド
+	Fmt        string
+}
+
+// newStringer エクスポートされたフィールドを宣言の順に並べる。gen:"redact"のフィールドは値を出さない
+func newStringer(r *renderer, target *directiveTarget) (*stringer, error) {
+	structName := target.s.name()
+	s := &stringer{StructName: structName}
+	var parts []string
+	for _, field := range target.s.structType().Fields.List {
+		redact := parseGenTag(field).has("redact")
+		for _, name := range field.Names {
+			if !ast.IsExported(name.Name) {
+				if redact {
+					return nil, fmt.Errorf("%s: gen:\"redact\" on unexported field %s has no effect on //gen:stringer", structName, name.Name)
+				}
+				continue
+			}
+			if redact {
+				parts = append(parts, name.Name+": [REDACTED]")
+				continue
+			}
+			verb := "%v"
+			if getFiledTypeString(field.Type) == "string" {
+				verb = "%q"
+			}
+			parts = append(parts, name.Name+": "+verb)
+			s.Args = append(s.Args, "s."+name.Name)
+		}
+	}
+	s.Format = structName + "{" + strings.Join(parts, ", ") + "}"
+	if len(s.Args) > 0 {
+		s.Fmt = r.importName("fmt")
+	}
+	return s, nil
+}
+
+// renderStringer //gen:stringerのついた構造体に、ログに出すためのString()を生成する
+func renderStringer(r *renderer, targets []*directiveTarget) error {
+	stringers := make([]*stringer, 0, len(targets))
+	for _, target := range targets {
+		s, err := newStringer(r, target)
+		if err != nil {
+			return err
+		}
+		stringers = append(stringers, s)
+	}
+	return r.execute("stringer", stringerTemplate, stringers)
+}
+
+const stringerTemplate = `
+{{range .}}
+// String returns the exported fields of s for logging. Fields tagged gen:"redact" are hidden.
+func (s {{recv .StructName}}) String() string {
+	{{- if .Args}}
+	return {{.Fmt}}.Sprintf("{{.Format}}"{{range .Args}}, {{.}}{{end}})
+	{{- else}}
+	return "{{.Format}}"
+	{{- end}}
+}
+{{end}}
+`
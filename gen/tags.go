@@ -0,0 +1,87 @@
+package gen
+
+import (
+	"go/ast"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// genTag フィールドのgen:"..."タグのオプション。gen:"append"のようにカンマ区切りで指定する。
+// flags=Read,Write,Adminのようにリストを値にとるオプションは、次のkey=valueか値を持たないオプションまでを値とする
+type genTag map[string]string
+
+// genTagListOptions 値がカンマ区切りのリストになるオプション
+var genTagListOptions = []string{"flags", "recompute"}
+
+// genTagBoolOptions 値を持たないオプション。リストの値の続きと区別するのに使う
+var genTagBoolOptions = []string{"append", "cas", "required", "encrypted", "setter", "getter", "nosetter", "nogetter", "redact", "key", "autoid"}
+
+// parseGenTag フィールドのタグからgenのオプションを読む。タグがなければ空のgenTagを返す
+func parseGenTag(field *ast.Field) genTag {
+	if field.Tag == nil {
+		return genTag{}
+	}
+	raw, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return genTag{}
+	}
+	return parseStructTag(raw)
+}
+
+// parseStructTag `gen:"..." json:"..."`のような構造体タグからgenのオプションを読む
+func parseStructTag(raw string) genTag {
+	tag := genTag{}
+	value, ok := reflect.StructTag(raw).Lookup("gen")
+	if !ok || value == "" {
+		return tag
+	}
+	options := strings.Split(value, ",")
+	for i := 0; i < len(options); i++ {
+		key, v, _ := strings.Cut(strings.TrimSpace(options[i]), "=")
+		if containsTargetField(key, genTagListOptions...) {
+			for i+1 < len(options) && !strings.Contains(options[i+1], "=") && !containsTargetField(strings.TrimSpace(options[i+1]), genTagBoolOptions...) {
+				i++
+				v += "," + strings.TrimSpace(options[i])
+			}
+		}
+		tag[key] = v
+	}
+	return tag
+}
+
+// list リストを値にとるオプションの値を返す
+func (t genTag) list(option string) []string {
+	v, ok := t[option]
+	if !ok || v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+func (t genTag) has(option string) bool {
+	_, ok := t[option]
+	return ok
+}
+
+// selects gen:"setter"やgen:"nosetter"でフィールドを選んでいれば、その結果とtrueを返す
+func (t genTag) selects(kind string) (selected, ok bool) {
+	if t.has("no" + kind) {
+		return false, true
+	}
+	if t.has(kind) {
+		return true, true
+	}
+	return false, false
+}
+
+// setterName SetXの名前。gen:"name=Touch"で変えられる。unexportedならsetX
+func (t genTag) setterName(fieldName string, unexported bool) string {
+	if name := t["name"]; name != "" {
+		return name
+	}
+	if unexported {
+		return "set" + fieldName
+	}
+	return "Set" + fieldName
+}
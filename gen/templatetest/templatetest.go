@@ -0,0 +1,151 @@
+// Package templatetest は //gen:custom や gen.RegisterTemplateSet のテンプレートを
+// 普通のGoのテストとして確かめるためのヘルパー。
+//
+//	func TestAudit(t *testing.T) {
+//		structs := templatetest.Parse(t, `
+//	//gen:custom audit
+//	type User struct {
+//		ID   string `+"`json:\"id\"`"+`
+//		Name string
+//	}`)
+//		got := templatetest.RenderFile(t, "templates/audit.tmpl", structs)
+//		templatetest.Contains(t, got, "func (s *User) AuditFields() []string")
+//		templatetest.Golden(t, got, "testdata/audit.golden")
+//	}
+//
+// 期待するファイルは環境変数 GEN_STRUCT_UPDATE_GOLDEN=1 でテストを実行すると書き直す。
+package templatetest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kosuke-taniguchi/go-gen-struct/gen"
+)
+
+// PackageName Parseでpackage句を省略したときと、Renderで出力するファイルのパッケージ名
+const PackageName = "fixture"
+
+// UpdateGoldenEnv 値が1ならGoldenは期待するファイルを書き直す
+const UpdateGoldenEnv = "GEN_STRUCT_UPDATE_GOLDEN"
+
+// Parse srcに書いた構造体の宣言から、テンプレートに渡すgen.Structを作る。
+// ディレクティブ（//gen:custom auditなど）のついた構造体だけを宣言の順に返す。
+// package句がなければfixtureパッケージとして読み、importも書ける。
+// テンプレートの引数（//gen:custom audit level=2のlevel=2）はArgsに入らないので、必要ならテストで設定する
+func Parse(t testing.TB, src string) []*gen.Struct {
+	t.Helper()
+	if !hasPackageClause(src) {
+		src = "package " + PackageName + "\n\n" + src
+	}
+	p, err := gen.ParseFile(PackageName+".go", []byte(src))
+	if err != nil {
+		t.Fatalf("templatetest: parse fixture: %v", err)
+	}
+	for _, w := range p.Warnings {
+		t.Errorf("templatetest: %s", w)
+	}
+	if len(p.Structs) == 0 {
+		t.Fatalf("templatetest: fixture has no structs with //gen: directives")
+	}
+	return p.Structs
+}
+
+// hasPackageClause コメントと空行を除いた最初の行がpackage句か
+func hasPackageClause(src string) bool {
+	for _, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		return strings.HasPrefix(line, "package ")
+	}
+	return false
+}
+
+// Render テンプレートをstructsについて実行し、importをつけてgofmtで整形したソースを返す。
+// 実行や整形に失敗したらテストを失敗させる
+func Render(t testing.TB, text string, structs []*gen.Struct) string {
+	t.Helper()
+	src, err := gen.RenderTemplate(PackageName, text, structs)
+	if err != nil {
+		t.Fatalf("templatetest: render: %v", err)
+	}
+	return string(src)
+}
+
+// RenderFile テンプレートのファイル（-templateのディレクトリに置く.tmpl）をRenderする
+func RenderFile(t testing.TB, path string, structs []*gen.Struct) string {
+	t.Helper()
+	text, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("templatetest: %v", err)
+	}
+	return Render(t, string(text), structs)
+}
+
+// Contains gotがwantを全て含むか確かめる
+func Contains(t testing.TB, got string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(got, w) {
+			t.Errorf("templatetest: output does not contain %q\n%s", w, got)
+		}
+	}
+}
+
+// NotContains gotがwantをどれも含まないか確かめる
+func NotContains(t testing.TB, got string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if strings.Contains(got, w) {
+			t.Errorf("templatetest: output contains %q\n%s", w, got)
+		}
+	}
+}
+
+// Golden gotが期待するファイルpathの内容と同じか確かめる。
+// GEN_STRUCT_UPDATE_GOLDEN=1ならpathをgotで書き直す
+func Golden(t testing.TB, got, path string) {
+	t.Helper()
+	if os.Getenv(UpdateGoldenEnv) == "1" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("templatetest: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("templatetest: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("templatetest: %v (run with %s=1 to create it)", err, UpdateGoldenEnv)
+	}
+	if !bytes.Equal(want, []byte(got)) {
+		t.Errorf("templatetest: output differs from %s (run with %s=1 to update)\n%s", path, UpdateGoldenEnv, lineDiff(string(want), got))
+	}
+}
+
+// lineDiff 最初に違う行の前後を、期待する内容（-）と出力（+）で示す
+func lineDiff(want, got string) string {
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	i := 0
+	for i < len(wantLines) && i < len(gotLines) && wantLines[i] == gotLines[i] {
+		i++
+	}
+	start := max(i-2, 0)
+	var b strings.Builder
+	for j := start; j < i; j++ {
+		b.WriteString("  " + wantLines[j] + "\n")
+	}
+	for j := i; j < min(i+3, len(wantLines)); j++ {
+		b.WriteString("- " + wantLines[j] + "\n")
+	}
+	for j := i; j < min(i+3, len(gotLines)); j++ {
+		b.WriteString("+ " + gotLines[j] + "\n")
+	}
+	return b.String()
+}
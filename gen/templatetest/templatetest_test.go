@@ -0,0 +1,109 @@
+package templatetest_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kosuke-taniguchi/go-gen-struct/gen/templatetest"
+)
+
+const fixture = `
+import "time"
+
+//gen:custom audit
+type User struct {
+	ID        string ` + "`json:\"id\"`" + `
+	Name      string
+	CreatedAt time.Time
+}
+
+type Ignored struct {
+	A int
+}
+
+//gen:custom audit
+type Team struct {
+	Members []User
+}
+`
+
+func TestParse(t *testing.T) {
+	structs := templatetest.Parse(t, fixture)
+	var names []string
+	for _, s := range structs {
+		names = append(names, s.Name)
+	}
+	if got, want := strings.Join(names, ","), "User,Team"; got != want {
+		t.Fatalf("structs = %s, want %s", got, want)
+	}
+	user := structs[0]
+	if len(user.Fields) != 3 {
+		t.Fatalf("User has %d fields, want 3", len(user.Fields))
+	}
+	if f := user.Fields[0]; f.Name != "ID" || f.Type != "string" || f.Tag != `json:"id"` {
+		t.Errorf("User.Fields[0] = %+v", f)
+	}
+	if f := user.Fields[2]; f.Type != "time.Time" {
+		t.Errorf("User.CreatedAt type = %s, want time.Time", f.Type)
+	}
+}
+
+func TestRender(t *testing.T) {
+	structs := templatetest.Parse(t, fixture)
+	got := templatetest.RenderFile(t, filepath.Join("testdata", "audit.tmpl"), structs)
+	templatetest.Contains(t, got,
+		"package "+templatetest.PackageName,
+		`"errors"`,
+		`return []string{"ID", "Name", "CreatedAt"}`,
+		"func (s *Team) AuditFields() []string",
+	)
+	templatetest.NotContains(t, got, "Ignored")
+}
+
+func TestGolden(t *testing.T) {
+	structs := templatetest.Parse(t, fixture)
+	got := templatetest.RenderFile(t, filepath.Join("testdata", "audit.tmpl"), structs)
+	templatetest.Golden(t, got, filepath.Join("testdata", "audit.golden"))
+}
+
+// recorder 失敗を記録するだけのtesting.TB。ヘルパーがテストを失敗させるかを確かめる
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestGoldenMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "want.golden")
+	if err := os.WriteFile(path, []byte("package fixture\n\nfunc A() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{TB: t}
+	templatetest.Golden(r, "package fixture\n\nfunc B() {}\n", path)
+	if len(r.errors) != 1 {
+		t.Fatalf("Golden reported %d errors, want 1", len(r.errors))
+	}
+	for _, want := range []string{"- func A() {}", "+ func B() {}", templatetest.UpdateGoldenEnv} {
+		if !strings.Contains(r.errors[0], want) {
+			t.Errorf("error does not contain %q:\n%s", want, r.errors[0])
+		}
+	}
+
+	t.Setenv(templatetest.UpdateGoldenEnv, "1")
+	templatetest.Golden(t, "package fixture\n\nfunc B() {}\n", path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "package fixture\n\nfunc B() {}\n" {
+		t.Errorf("Golden did not update %s:\n%s", path, data)
+	}
+}
@@ -0,0 +1,49 @@
+package gen
+
+import "fmt"
+
+// tenantField マルチテナントの構造体でテナントを表すフィールド名
+const tenantField = "TenantID"
+
+// tenantModes //gen:setters tenant=...で選べるTenantIDの扱い
+//
+//	guard: 別のテナントへの付け替えをエラーにするSetTenantIDを生成する（デフォルト）
+//	allow: 付け替えを許すSetTenantIDを生成する
+//	off:   TenantIDを特別扱いしない
+var tenantModes = []string{"guard", "allow", "off"}
+
+// tenantGuard TenantIDを持つ構造体のBelongsToとSetTenantID
+type tenantGuard struct {
+	StructName string
+	FieldType  string
+	Guard      bool
+	Fmt        string
+	Hooks      []string
+	Touch      string // //gen:setters touchで、SetTenantIDがUpdatedAtに入れる時刻の式
+}
+
+// newTenantGuard 構造体にTenantIDがあればtenantGuardを返す
+func newTenantGuard(r *renderer, target *directiveTarget) (*tenantGuard, error) {
+	structName := target.s.name()
+	mode, _ := target.d.arg("tenant")
+	if mode == "" {
+		mode = "guard"
+	}
+	if !containsTargetField(mode, tenantModes...) {
+		return nil, fmt.Errorf("%s: //gen:setters tenant must be one of %v, got %q", structName, tenantModes, mode)
+	}
+	field := findField(target.s.structType(), tenantField)
+	if field == nil || mode == "off" {
+		return nil, nil
+	}
+	t := &tenantGuard{
+		StructName: structName,
+		FieldType:  r.typeString(field.Type),
+		Guard:      mode == "guard",
+		Hooks:      r.fieldHooks(structName, tenantField),
+	}
+	if t.Guard {
+		t.Fmt = r.importName("fmt")
+	}
+	return t, nil
+}
@@ -0,0 +1,86 @@
+package gen
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// timestampsOptions timestampsサブコマンドのオプション
+type timestampsOptions struct {
+	// autotouch //gen:setters touchを書いていない構造体も、他のフィールドのSetXでUpdatedAtを更新する
+	autotouch bool
+	// clock autotouchで時刻をtime.Nowでなく差し替えられる<構造体名>Nowから取る（touch=clock）
+	clock bool
+}
+
+// runTimestamps 汎用のディレクティブが増える前と同じく、//gen:settersのCreatedAt/UpdatedAtのSetXだけを生成する。
+// -autotouch、-clock以外のフラグ（-fields、-dir、-checkなど）は引数なしで実行したときと同じ
+func runTimestamps(args []string) error {
+	flags := flag.NewFlagSet("timestamps", flag.ExitOnError)
+	autotouch := flags.Bool("autotouch", false, "SetX of other fields also sets UpdatedAt, as if every //gen:setters had touch")
+	clock := flags.Bool("clock", false, "with -autotouch, read the time from a replaceable <Struct>Now variable (touch=clock)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s timestamps [-autotouch] [-clock] [-fields=CreatedAt,UpdatedAt] [flags]\n\n", programName())
+		fmt.Fprintln(flags.Output(), "Generates only the setters of //gen:setters structs and ignores other directives.")
+		fmt.Fprintln(flags.Output(), "Other flags are the same as running without a subcommand.")
+		flags.PrintDefaults()
+	}
+	var rest []string
+	for _, arg := range args {
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && (flags.Lookup(name) != nil || name == "h" || name == "help") {
+			if err := flags.Parse([]string{arg}); err != nil {
+				return err
+			}
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	if *clock && !*autotouch {
+		return fmt.Errorf("timestamps: -clock requires -autotouch")
+	}
+	runGenerate(rest, &timestampsOptions{autotouch: *autotouch, clock: *clock})
+	return nil
+}
+
+// apply //gen:setters以外のコード生成を無効にし、-autotouchならUpdatedAtのある構造体にtouchを補う。
+// 無効にしたディレクティブについての警告を返す
+func (o *timestampsOptions) apply(t *targetStructs) []*diagnostic {
+	if o == nil {
+		return nil
+	}
+	if t.disabled == nil {
+		t.disabled = make(map[string]string)
+	}
+	for _, g := range generators {
+		if _, ok := t.disabled[g.name]; !ok && g.name != "setters" {
+			t.disabled[g.name] = ""
+		}
+	}
+	var skipped []*diagnostic
+	for _, s := range t.structs {
+		for _, d := range s.directives {
+			if d.name != "setters" {
+				skipped = append(skipped, newDiagnostic(diagTimestampsOnly, t.fileSet.Position(s.spec.Pos()), directivePrefix+d.name, s.name(), settersDirective))
+			}
+		}
+	}
+	if !o.autotouch {
+		return skipped
+	}
+	mode := ""
+	if o.clock {
+		mode = "clock"
+	}
+	for _, s := range t.structs {
+		d := s.directive("setters")
+		if d == nil || !hasField(s.structType(), "UpdatedAt") && !embedsTimestamps(s.structType()) {
+			continue
+		}
+		if _, ok := d.arg("touch"); !ok {
+			d.args = append(d.args, directiveArg{key: "touch", value: mode})
+		}
+	}
+	return skipped
+}
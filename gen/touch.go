@@ -0,0 +1,96 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// touchClock //gen:setters touch=clockで宣言する、SetXがUpdatedAtに入れる時刻を返す関数の変数
+type touchClock struct {
+	StructName string
+	Var        string // ExampleNow
+	Time       string
+}
+
+// touchSetters //gen:setters touchの構造体で、CreatedAtとUpdatedAt以外のフィールドのSetXがUpdatedAtも更新するようにする。
+// touch=clockなら時刻は差し替えられる変数から取り、テストでUpdatedAtを固定できるようにする。
+// SetX以外のフィールドを変更するメソッドにも使えるよう、UpdatedAtに入れる時刻の式も返す。touchでなければ空
+func touchSetters(r *renderer, target *directiveTarget, setters []*setter) (*touchClock, string, error) {
+	mode, ok := target.d.arg("touch")
+	if !ok {
+		return nil, "", nil
+	}
+	structName := target.s.name()
+	if mode != "" && mode != "clock" {
+		return nil, "", fmt.Errorf("%s: //gen:setters touch must be touch or touch=clock, got %q", structName, mode)
+	}
+	if !hasUpdatedAtTime(r, target.s, setters) {
+		return nil, "", fmt.Errorf("%s: //gen:setters touch requires an UpdatedAt field of type time.Time", structName)
+	}
+	timeName := r.importName("time")
+	now := timeName + ".Now()"
+	var clock *touchClock
+	if mode == "clock" {
+		clock = &touchClock{StructName: structName, Var: touchClockVar(r, structName), Time: timeName}
+		now = clock.Var + "()"
+	}
+	for _, set := range setters {
+		if set.StructName != structName || containsTargetField(set.FieldName, targetFields...) {
+			continue
+		}
+		set.Touch = now
+		set.Hooks = r.fieldHooks(structName, set.FieldName, "UpdatedAt")
+	}
+	return clock, now, nil
+}
+
+// setterTouch //gen:setters touchの構造体で、他のディレクティブが生成するフィールドを変更するメソッドがUpdatedAtに入れる時刻の式。
+// touchでないか、//gen:settersを無効にしていれば空
+func setterTouch(r *renderer, s *targetStruct) string {
+	name := strings.TrimPrefix(settersDirective, "//gen:")
+	if _, disabled := r.t.disabled[name]; disabled || s.directive(name) == nil {
+		return ""
+	}
+	if _, ok := s.directive(name).arg("touch"); !ok {
+		return ""
+	}
+	return touchNow(r, s, r.importName("time"))
+}
+
+// touchClockVar //gen:setters touch=clockで宣言する変数の名前
+func touchClockVar(r *renderer, structName string) string {
+	name := exportedName(structName) + "Now"
+	if !ast.IsExported(structName) {
+		name = unexportedName(name)
+	}
+	return r.ident(name)
+}
+
+// touchNow sのメソッドがUpdatedAtやCreatedAtに入れる時刻の式。timeNameはtimeパッケージを参照している名前。
+// //gen:setters touch=clockの構造体なら、SetXと同じ変数から時刻を取るので、timeパッケージは使わない
+func touchNow(r *renderer, s *targetStruct, timeName string) string {
+	// 無効にした//gen:settersは変数を宣言しない
+	name := strings.TrimPrefix(settersDirective, "//gen:")
+	if _, disabled := r.t.disabled[name]; !disabled && s.directive(name) != nil {
+		if mode, _ := s.directive(name).arg("touch"); mode == "clock" {
+			return touchClockVar(r, s.name()) + "()"
+		}
+	}
+	r.importsMap[timeName].used = true
+	return timeName + ".Now()"
+}
+
+// hasUpdatedAtTime UpdatedAtがtime.Timeのフィールドか、埋め込んだ構造体から昇格したtime.Timeのフィールドか
+func hasUpdatedAtTime(r *renderer, s *targetStruct, setters []*setter) bool {
+	structType := s.structType()
+	if timeFieldQualifier(structType, "UpdatedAt", r.importsMap) != "" || embedsTimestamps(structType) {
+		return true
+	}
+	for _, set := range setters {
+		if set.StructName == s.name() && set.Embedded != "" && set.FieldName == "UpdatedAt" && strings.HasSuffix(set.FieldType, ".Time") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package gen
+
+import "testing"
+
+// //gen:setters touchでは、SetXだけでなくフィールドを変更する生成したメソッドがすべてUpdatedAtを更新する
+func TestSettersTouchAllMutators(t *testing.T) {
+	dir, _ := generateModule(t, map[string]string{
+		"m/model.go": `package m
+
+import "time"
+
+//gen:setters touch=clock all
+//gen:i18n langs=EN,JA
+type Model struct {
+	TenantID  string
+	Name      string
+	Tags      []string
+	Attrs     map[string]string
+	Flags     uint8    ` + "`gen:\"flags=Active\"`" + `
+	Version   int64    ` + "`gen:\"cas\"`" + `
+	Hits      int64    ` + "`gen:\"cas=atomic\"`" + `
+	Log       []string ` + "`gen:\"append\"`" + `
+	TitleEN   string
+	TitleJA   string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+`,
+		"m/model_touch_test.go": `package m
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTouch(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ModelNow = func() time.Time { return now }
+	mutators := map[string]func(*Model){
+		"SetName":             func(m *Model) { m.SetName("a") },
+		"AddTags":             func(m *Model) { m.AddTags("a") },
+		"RemoveTags":          func(m *Model) { m.AddTags("a"); m.UpdatedAt = time.Time{}; m.RemoveTags(0) },
+		"AddAttrs":            func(m *Model) { m.AddAttrs("k", "v") },
+		"RemoveAttrs":         func(m *Model) { m.RemoveAttrs("k") },
+		"AppendLog":           func(m *Model) { m.AppendLog("a") },
+		"SetFlagActive":       func(m *Model) { m.SetFlagActive() },
+		"ClearFlagActive":     func(m *Model) { m.ClearFlagActive() },
+		"CompareAndSetVersion": func(m *Model) { m.CompareAndSetVersion(0, 1) },
+		"CompareAndSetHits":   func(m *Model) { m.CompareAndSetHits(0, 1) },
+		"SetTenantID":         func(m *Model) { m.SetTenantID("t") },
+		"SetTitle":            func(m *Model) { m.SetTitle("ja", "a") },
+	}
+	for name, mutate := range mutators {
+		var m Model
+		mutate(&m)
+		if !m.UpdatedAt.Equal(now) {
+			t.Errorf("%s: UpdatedAt = %v, want %v", name, m.UpdatedAt, now)
+		}
+	}
+	var m Model
+	m.SetCreatedAt(now)
+	if !m.UpdatedAt.IsZero() {
+		t.Errorf("SetCreatedAt set UpdatedAt to %v", m.UpdatedAt)
+	}
+}
+`,
+	})
+	goTest(t, dir, "./...")
+}
@@ -0,0 +1,259 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// typeString 型の式をGoのソースの形で返す。型として書けない式はエラーにする
+func typeString(expr ast.Expr) (string, error) {
+	var b strings.Builder
+	if err := writeType(&b, expr); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// getFiledTypeString フィールドの型をGoのソースの形で返す。
+// 対象の構造体のフィールドは解析したときにcheckFieldTypesで確認しているので、ここでは失敗しない
+func getFiledTypeString(expr ast.Expr) string {
+	s, err := typeString(expr)
+	if err != nil {
+		return types.ExprString(expr)
+	}
+	return s
+}
+
+// typeString 型の文字列を返し、型の中で参照しているパッケージをimportに加える
+func (r *renderer) typeString(expr ast.Expr) string {
+	markUsedImports(expr, r.importsMap)
+	return getFiledTypeString(expr)
+}
+
+// checkFieldTypes 構造体のフィールドの型を全て文字列にできるか確認する
+func checkFieldTypes(structType *ast.StructType) error {
+	for _, field := range structType.Fields.List {
+		if _, err := typeString(field.Type); err != nil {
+			name := embeddedTypeName(field.Type)
+			if len(field.Names) > 0 {
+				name = field.Names[0].Name
+			}
+			return fmt.Errorf("field %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func writeType(b *strings.Builder, expr ast.Expr) error {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		b.WriteString(expr.Name)
+	case *ast.SelectorExpr:
+		// 修飾子はパッケージの名前だけ
+		x, ok := expr.X.(*ast.Ident)
+		if !ok {
+			return fmt.Errorf("unsupported qualified type %s", types.ExprString(expr))
+		}
+		b.WriteString(x.Name + "." + expr.Sel.Name)
+	case *ast.StarExpr:
+		b.WriteString("*")
+		return writeType(b, expr.X)
+	case *ast.ParenExpr:
+		b.WriteString("(")
+		if err := writeType(b, expr.X); err != nil {
+			return err
+		}
+		b.WriteString(")")
+	case *ast.ArrayType:
+		b.WriteString("[")
+		if expr.Len != nil {
+			if _, ok := expr.Len.(*ast.Ellipsis); ok {
+				return fmt.Errorf("array length [...] is only allowed in composite literals")
+			}
+			// 長さは定数式なのでそのまま書く
+			b.WriteString(types.ExprString(expr.Len))
+		}
+		b.WriteString("]")
+		return writeType(b, expr.Elt)
+	case *ast.MapType:
+		b.WriteString("map[")
+		if err := writeType(b, expr.Key); err != nil {
+			return err
+		}
+		b.WriteString("]")
+		return writeType(b, expr.Value)
+	case *ast.ChanType:
+		switch expr.Dir {
+		case ast.SEND:
+			b.WriteString("chan<- ")
+		case ast.RECV:
+			b.WriteString("<-chan ")
+		default:
+			b.WriteString("chan ")
+			// chan <-chan Tはchan<- (chan T)と読まれるので括弧をつける
+			if value, ok := expr.Value.(*ast.ChanType); ok && value.Dir == ast.RECV {
+				b.WriteString("(")
+				if err := writeType(b, value); err != nil {
+					return err
+				}
+				b.WriteString(")")
+				return nil
+			}
+		}
+		return writeType(b, expr.Value)
+	case *ast.FuncType:
+		if expr.TypeParams != nil {
+			return fmt.Errorf("function types cannot have type parameters")
+		}
+		b.WriteString("func")
+		return writeSignature(b, expr)
+	case *ast.InterfaceType:
+		if len(expr.Methods.List) == 0 {
+			b.WriteString("interface{}")
+			return nil
+		}
+		b.WriteString("interface{ ")
+		for i, method := range expr.Methods.List {
+			if i > 0 {
+				b.WriteString("; ")
+			}
+			if len(method.Names) == 0 {
+				// 埋め込んだインターフェースか型の制約（~int | string）
+				if err := writeType(b, method.Type); err != nil {
+					return err
+				}
+				continue
+			}
+			fn, ok := method.Type.(*ast.FuncType)
+			if !ok {
+				return fmt.Errorf("interface method %s has no signature", method.Names[0].Name)
+			}
+			b.WriteString(method.Names[0].Name)
+			if err := writeSignature(b, fn); err != nil {
+				return err
+			}
+		}
+		b.WriteString(" }")
+	case *ast.StructType:
+		if len(expr.Fields.List) == 0 {
+			b.WriteString("struct{}")
+			return nil
+		}
+		b.WriteString("struct{ ")
+		for i, field := range expr.Fields.List {
+			if i > 0 {
+				b.WriteString("; ")
+			}
+			if err := writeField(b, field); err != nil {
+				return err
+			}
+			// タグが違うと別の型になるので残す
+			if field.Tag != nil {
+				b.WriteString(" " + field.Tag.Value)
+			}
+		}
+		b.WriteString(" }")
+	case *ast.Ellipsis:
+		b.WriteString("...")
+		return writeType(b, expr.Elt)
+	case *ast.IndexExpr:
+		if err := writeType(b, expr.X); err != nil {
+			return err
+		}
+		b.WriteString("[")
+		if err := writeType(b, expr.Index); err != nil {
+			return err
+		}
+		b.WriteString("]")
+	case *ast.IndexListExpr:
+		if err := writeType(b, expr.X); err != nil {
+			return err
+		}
+		b.WriteString("[")
+		for i, index := range expr.Indices {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			if err := writeType(b, index); err != nil {
+				return err
+			}
+		}
+		b.WriteString("]")
+	case *ast.UnaryExpr:
+		if expr.Op != token.TILDE {
+			return fmt.Errorf("unsupported type expression %s", types.ExprString(expr))
+		}
+		b.WriteString("~")
+		return writeType(b, expr.X)
+	case *ast.BinaryExpr:
+		if expr.Op != token.OR {
+			return fmt.Errorf("unsupported type expression %s", types.ExprString(expr))
+		}
+		if err := writeType(b, expr.X); err != nil {
+			return err
+		}
+		b.WriteString(" | ")
+		return writeType(b, expr.Y)
+	case *ast.BadExpr:
+		return fmt.Errorf("invalid type expression")
+	case nil:
+		return fmt.Errorf("missing type")
+	default:
+		return fmt.Errorf("unsupported type expression %s", types.ExprString(expr))
+	}
+	return nil
+}
+
+// writeSignature 関数型のfuncより後（引数と戻り値）を書く
+func writeSignature(b *strings.Builder, fn *ast.FuncType) error {
+	b.WriteString("(")
+	if err := writeFieldList(b, fn.Params); err != nil {
+		return err
+	}
+	b.WriteString(")")
+	if fn.Results == nil || len(fn.Results.List) == 0 {
+		return nil
+	}
+	b.WriteString(" ")
+	if len(fn.Results.List) == 1 && len(fn.Results.List[0].Names) == 0 {
+		return writeType(b, fn.Results.List[0].Type)
+	}
+	b.WriteString("(")
+	if err := writeFieldList(b, fn.Results); err != nil {
+		return err
+	}
+	b.WriteString(")")
+	return nil
+}
+
+func writeFieldList(b *strings.Builder, list *ast.FieldList) error {
+	if list == nil {
+		return nil
+	}
+	for i, field := range list.List {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if err := writeField(b, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeField 引数や構造体のフィールドを名前つき（a, b int）か型だけで書く
+func writeField(b *strings.Builder, field *ast.Field) error {
+	for i, name := range field.Names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name.Name)
+	}
+	if len(field.Names) > 0 {
+		b.WriteString(" ")
+	}
+	return writeType(b, field.Type)
+}
@@ -0,0 +1,134 @@
+package gen
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+// usage 対象の構造体を生成・変更している箇所
+type usage struct {
+	pos  token.Position
+	kind string
+	expr string
+}
+
+// runUsages -typeで指定した構造体を生成・変更している箇所を一覧にする
+func runUsages(args []string) error {
+	flags := flag.NewFlagSet("usages", flag.ExitOnError)
+	dir := flags.String("dir", ".", "directory to analyze")
+	typeName := flags.String("type", "", "annotated struct name (Name or pkg.Name)")
+	fieldsFlag := flags.String("fields", "", "comma separated fields that get SetX, as with generate (default: the fields of .gogenstruct.yaml)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *typeName == "" {
+		return errors.New("usages: -type is required")
+	}
+	resolver, err := newSetterFieldResolver(*dir, *fieldsFlag)
+	if err != nil {
+		return err
+	}
+	pkgs, err := loadPackages(*dir)
+	if err != nil {
+		return err
+	}
+
+	targets := make(map[*types.TypeName]bool)
+	fields := make(map[*types.Var]bool)
+	// setters 生成と同じ設定で決めたSetX。名前がSetで始まるだけの手で書いたメソッドは数えない
+	setters := make(map[*types.Func]bool)
+	for _, pkg := range pkgs {
+		setterFields, err := resolver.setterFields(pkg)
+		if err != nil {
+			return err
+		}
+		for _, s := range findAnnotatedStructs(pkg, settersDirective) {
+			if s.obj.Name() != *typeName && pkg.Name+"."+s.obj.Name() != *typeName {
+				continue
+			}
+			targets[s.obj] = true
+			for _, field := range s.structFields() {
+				fields[field] = true
+				if !s.isSetterField(field, setterFields) {
+					continue
+				}
+				if setter := s.method(s.setterName(field)); setter != nil {
+					setters[setter] = true
+				}
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("usages: annotated struct %q not found", *typeName)
+	}
+
+	var usages []*usage
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Syntax {
+			if ast.IsGenerated(file) {
+				continue
+			}
+			add := func(node ast.Node, kind string) {
+				usages = append(usages, &usage{
+					pos:  pkg.Fset.Position(node.Pos()),
+					kind: kind,
+					expr: types.ExprString(node.(ast.Expr)),
+				})
+			}
+			ast.Inspect(file, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.CompositeLit:
+					if targets[namedObject(pkg.TypesInfo.TypeOf(n))] {
+						add(n, "construct")
+					}
+				case *ast.AssignStmt:
+					for _, lhs := range n.Lhs {
+						if fields[selectedField(pkg.TypesInfo, lhs)] {
+							add(lhs, "assign")
+						}
+					}
+				case *ast.IncDecStmt:
+					if fields[selectedField(pkg.TypesInfo, n.X)] {
+						add(n.X, "assign")
+					}
+				case *ast.CallExpr:
+					switch fun := ast.Unparen(n.Fun).(type) {
+					case *ast.Ident:
+						// new(T)
+						if _, ok := pkg.TypesInfo.Uses[fun].(*types.Builtin); ok && fun.Name == "new" && len(n.Args) == 1 {
+							if targets[namedObject(pkg.TypesInfo.TypeOf(n.Args[0]))] {
+								add(n, "construct")
+							}
+						}
+					case *ast.SelectorExpr:
+						if fn, ok := pkg.TypesInfo.Uses[fun.Sel].(*types.Func); ok && setters[fn.Origin()] {
+							add(n, "setter")
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, u := range usages {
+		filename := u.pos.Filename
+		if rel, err := filepath.Rel(cwd, filename); err == nil {
+			filename = rel
+		}
+		fmt.Fprintf(w, "%s:%d:%d\t%s\t%s\n", filename, u.pos.Line, u.pos.Column, u.kind, u.expr)
+	}
+	return w.Flush()
+}
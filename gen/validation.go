@@ -0,0 +1,289 @@
+package gen
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// validationRule validate:"..."タグの境界値を持つルール（min=1など）
+type validationRule struct {
+	name  string
+	value float64
+}
+
+// validatedField validate:"..."タグのついたフィールド
+type validatedField struct {
+	name  string
+	typ   string
+	kind  string // int, uint, float, string, slice
+	rules []validationRule
+}
+
+// boundaryRules 境界値のテストケースを作れるルール
+var boundaryRules = []string{"required", "min", "max", "gte", "lte", "gt", "lt", "len"}
+
+// parseValidateTag フィールドのvalidate:"..."タグから境界値を持つルールを読む。扱えない型のフィールドならnil
+func parseValidateTag(field *ast.Field) *validatedField {
+	if field.Tag == nil {
+		return nil
+	}
+	raw, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return nil
+	}
+	value, ok := reflect.StructTag(raw).Lookup("validate")
+	if !ok {
+		return nil
+	}
+	f := &validatedField{kind: validatedKind(field.Type)}
+	if f.kind == "" {
+		return nil
+	}
+	for _, rule := range strings.Split(value, ",") {
+		key, v, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if !containsTargetField(key, boundaryRules...) {
+			continue
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if key != "required" && err != nil {
+			continue
+		}
+		f.rules = append(f.rules, validationRule{name: key, value: n})
+	}
+	if len(f.rules) == 0 {
+		return nil
+	}
+	f.typ = getFiledTypeString(field.Type)
+	return f
+}
+
+// validatedKind 境界値を作れる型の種類。数値はその値、stringとsliceは長さを境界にする
+func validatedKind(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		switch expr.Name {
+		case "int", "int8", "int16", "int32", "int64":
+			return "int"
+		case "uint", "uint8", "uint16", "uint32", "uint64":
+			return "uint"
+		case "float32", "float64":
+			return "float"
+		case "string":
+			return "string"
+		}
+	case *ast.ArrayType:
+		if expr.Len == nil {
+			return "slice"
+		}
+	}
+	return ""
+}
+
+// validationCase フィールドに境界値を入れたときに、検証がエラーになるべきか
+type validationCase struct {
+	Name    string
+	Field   string
+	Value   string
+	WantErr bool
+}
+
+// validationTest 構造体の検証の境界値をテーブル駆動で確かめるテストの雛形
+type validationTest struct {
+	StructName string
+	TestName   string
+	Method     string // 検証するメソッド。//gen:invariantsならinvariants、それ以外はValidate
+	Valid      []validationCase
+	Cases      []validationCase
+	Testing    string
+}
+
+// literal フィールドにnを入れる式。stringとsliceは長さnの値にする
+func (f *validatedField) literal(tr *renderer, n float64) string {
+	switch f.kind {
+	case "string":
+		return tr.importName("strings") + `.Repeat("a", ` + strconv.Itoa(int(n)) + ")"
+	case "slice":
+		return "make(" + f.typ + ", " + strconv.Itoa(int(n)) + ")"
+	}
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
+
+// validValue 全てのルールを満たす値。下限に寄せ、下限がなければ0（requiredなら1）にする
+func (f *validatedField) validValue() float64 {
+	var v float64
+	for _, rule := range f.rules {
+		switch rule.name {
+		case "required":
+			v = max(v, 1)
+		case "min", "gte", "len":
+			v = max(v, rule.value)
+		case "gt":
+			v = max(v, rule.value+1)
+		}
+	}
+	for _, rule := range f.rules {
+		switch rule.name {
+		case "max", "lte":
+			v = min(v, rule.value)
+		case "lt":
+			v = min(v, rule.value-1)
+		}
+	}
+	return v
+}
+
+// cases ルールごとに境界の内側と外側の値を作る（min=1なら0でエラー、1で成功）
+func (f *validatedField) cases(tr *renderer) []validationCase {
+	var cases []validationCase
+	add := func(label string, n float64, wantErr bool) {
+		if n < 0 && f.kind != "int" && f.kind != "float" {
+			return
+		}
+		cases = append(cases, validationCase{Name: f.name + " " + label, Field: f.name, Value: f.literal(tr, n), WantErr: wantErr})
+	}
+	for _, rule := range f.rules {
+		n := rule.value
+		switch rule.name {
+		case "required":
+			add("zero", 0, true)
+		case "min", "gte":
+			add(rule.name+"-1", n-1, true)
+			add(rule.name, n, false)
+		case "max", "lte":
+			add(rule.name, n, false)
+			add(rule.name+"+1", n+1, true)
+		case "gt":
+			add(rule.name, n, true)
+			add(rule.name+"+1", n+1, false)
+		case "lt":
+			add(rule.name+"-1", n-1, false)
+			add(rule.name, n, true)
+		case "len":
+			add("len-1", n-1, true)
+			add("len", n, false)
+			add("len+1", n+1, true)
+		}
+	}
+	return cases
+}
+
+// validationMethod 検証するメソッドの名前。//gen:invariantsのinvariants()か、パッケージで宣言されたValidate()
+func validationMethod(r *renderer, s *targetStruct) (string, error) {
+	if s.directive("invariants") != nil {
+		return "invariants", nil
+	}
+	ok, err := declaresMethod(r.t.fsys, r.t.path, r.t.packageName, s.name(), "Validate")
+	if err != nil || !ok {
+		return "", err
+	}
+	return "Validate", nil
+}
+
+// declaresMethod パッケージのディレクトリで型にメソッドが宣言されているか。生成されたファイルも含めて探す
+func declaresMethod(fsys fs.FS, dir, packageName, typeName, method string) (bool, error) {
+	sources, err := packageSources(fsys, dir)
+	if err != nil {
+		return false, err
+	}
+	for _, source := range sources {
+		file, err := parser.ParseFile(token.NewFileSet(), source.path, source.src, parser.SkipObjectResolution)
+		if err != nil || file.Name.Name != packageName {
+			continue
+		}
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if ok && fn.Recv != nil && fn.Name.Name == method && receiverTypeName(fn) == typeName {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// renderValidationTests validate:"..."タグのついた構造体に、境界値の検証のテストの雛形を生成する。
+// 検証するメソッドがない構造体は対象外
+func renderValidationTests(r *renderer) error {
+	var tests []*validationTest
+	for _, s := range r.t.structs {
+		if s.structType() == nil || s.spec.TypeParams != nil {
+			continue
+		}
+		var fields []*validatedField
+		for _, field := range s.structType().Fields.List {
+			for _, name := range field.Names {
+				if f := parseValidateTag(field); f != nil {
+					f.name = name.Name
+					fields = append(fields, f)
+				}
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		method, err := validationMethod(r, s)
+		if err != nil {
+			return err
+		}
+		if method == "" {
+			continue
+		}
+		tr := r.testFile()
+		test := &validationTest{
+			StructName: s.name(),
+			TestName:   "Test" + exportedName(s.name()) + "Validation",
+			Method:     method,
+			Testing:    tr.importName("testing"),
+		}
+		for _, f := range fields {
+			shareTypeImports(r, tr, f.typ)
+			test.Valid = append(test.Valid, validationCase{Field: f.name, Value: f.literal(tr, f.validValue())})
+			test.Cases = append(test.Cases, f.cases(tr)...)
+		}
+		tests = append(tests, test)
+	}
+	if len(tests) == 0 {
+		return nil
+	}
+	return r.testFile().execute("validation_test", validationTestTemplate, tests)
+}
+
+const validationTestTemplate = `
+{{range .}}
+{{- $v := .}}
+// {{.TestName}} checks the boundaries of the validate tags of {{.StructName}}.
+// valid() must return a {{.StructName}} that passes {{.Method}}(); fill in the other fields as needed.
+func {{.TestName}}(t *{{.Testing}}.T) {
+	valid := func() *{{.StructName}} {
+		return &{{.StructName}}{
+			{{- range .Valid}}
+			{{.Field}}: {{.Value}},
+			{{- end}}
+		}
+	}
+	tests := []struct {
+		name    string
+		modify  func(s *{{.StructName}})
+		wantErr bool
+	}{
+		{"valid", func(s *{{.StructName}}) {}, false},
+		{{- range .Cases}}
+		{"{{.Name}}", func(s *{{$v.StructName}}) { s.{{.Field}} = {{.Value}} }, {{.WantErr}}},
+		{{- end}}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *{{.Testing}}.T) {
+			s := valid()
+			tt.modify(s)
+			if err := s.{{.Method}}(); (err != nil) != tt.wantErr {
+				t.Errorf("{{.Method}}() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+{{end}}
+`
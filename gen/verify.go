@@ -0,0 +1,530 @@
+package gen
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// verifyDrift スキーマと構造体の食い違い
+type verifyDrift struct {
+	// Kind missing_struct, missing_field, extra_field, type_mismatch, nullable_mismatch
+	Kind   string `json:"kind"`
+	Struct string `json:"struct"`
+	Field  string `json:"field,omitempty"`
+	// Schema スキーマから生成する型
+	Schema string `json:"schema,omitempty"`
+	// Go 構造体に書いた型
+	Go      string `json:"go,omitempty"`
+	Pos     string `json:"pos"`
+	Message string `json:"message"`
+}
+
+// verifySource 比べるスキーマから作った構造体と、フィールドを対応づけるタグ（空ならフィールド名）
+type verifySource struct {
+	path     string
+	structs  []*schemaStruct
+	matchTag string
+	// tables DDLのとき、構造体の名前からテーブル名
+	tables map[string]string
+}
+
+// verifyStruct 比べる対象の、ディレクティブのついた構造体
+type verifyStruct struct {
+	t *targetStructs
+	s *targetStruct
+	// imports key: ソースで参照している名前, value: 既定の名前
+	imports map[string]string
+}
+
+// runVerify ディレクティブのついた構造体をOpenAPI、.proto、DDLのスキーマと比べ、食い違いを報告する
+func runVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	against := flags.String("against", "", "schema to compare with: OpenAPI (.yaml, .yml, .json), protobuf (.proto) or DDL (.sql)")
+	dir := flags.String("dir", ".", "directory of the structs")
+	format := flags.String("format", "text", "output format (text, json)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *against == "" {
+		return fmt.Errorf("verify: -against is required")
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("verify: unsupported format %q", *format)
+	}
+	source, err := loadVerifySource(*against, *dir)
+	if err != nil {
+		return err
+	}
+	structs, err := loadVerifyStructs(*dir)
+	if err != nil {
+		return err
+	}
+	drifts := verifyStructs(source, structs)
+	if err := writeVerifyDrifts(os.Stdout, *format, drifts); err != nil {
+		return err
+	}
+	if len(drifts) > 0 {
+		return fmt.Errorf("verify: %d differences from %s", len(drifts), *against)
+	}
+	return nil
+}
+
+// loadVerifySource スキーマを-schemaと同じ変換で構造体にする。足したCreatedAtとUpdatedAtは比べない
+func loadVerifySource(path, dir string) (*verifySource, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc := &schemaDocument{Package: "verify", Timestamps: &[]string{}}
+	source := &verifySource{path: path}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml", ".json":
+		doc.OpenAPI = filepath.Base(path)
+		if err := doc.addOpenAPIStructs(path, src); err != nil {
+			return nil, err
+		}
+		source.matchTag = "json"
+	case ".proto":
+		doc.Proto = filepath.Base(path)
+		if _, _, err := doc.addProtoStructs(path, dir, src); err != nil {
+			return nil, err
+		}
+	case ".sql":
+		columns, err := parseDDLColumns(string(src))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if doc, err = dbSchemaDocument(columns, "verify", nil, nil, false); err != nil {
+			return nil, err
+		}
+		source.matchTag = "db"
+		source.tables = make(map[string]string, len(doc.Structs))
+		for _, s := range doc.Structs {
+			source.tables[s.Name] = strings.TrimPrefix(s.Directives[0], "table name=")
+		}
+	default:
+		return nil, fmt.Errorf("verify: %s must be an OpenAPI (.yaml, .yml, .json), .proto or .sql file", path)
+	}
+	source.structs = doc.Structs
+	return source, nil
+}
+
+func loadVerifyStructs(dir string) ([]*verifyStruct, error) {
+	files, err := listGoFiles(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	var structs []*verifyStruct
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") || isGeneratedFile(file) {
+			continue
+		}
+		targets, err := searchTargetStructs(file)
+		if err != nil {
+			return nil, err
+		}
+		if len(targets.structs) == 0 {
+			continue
+		}
+		imports := make(map[string]string)
+		paths := make([]string, 0, len(targets.imports))
+		for _, imp := range targets.imports {
+			paths = append(paths, imp.path)
+		}
+		defaults := importNames.resolve(targets.path, paths)
+		for _, imp := range targets.namedImports() {
+			imports[imp.Name] = defaults[imp.Path]
+		}
+		for _, s := range targets.structs {
+			structs = append(structs, &verifyStruct{t: targets, s: s, imports: imports})
+		}
+	}
+	return structs, nil
+}
+
+// find スキーマの構造体に対応する構造体。DDLでは//gen:tableのテーブル名でも探す
+func (source *verifySource) find(structs []*verifyStruct, name string) *verifyStruct {
+	for _, vs := range structs {
+		if vs.s.name() == name {
+			return vs
+		}
+	}
+	table, ok := source.tables[name]
+	if !ok {
+		return nil
+	}
+	for _, vs := range structs {
+		if d := vs.s.directive("table"); d != nil {
+			if value, _ := d.arg("name"); value == table {
+				return vs
+			}
+		}
+	}
+	return nil
+}
+
+// fieldKey フィールドを対応づける名前。対象外のフィールドなら空
+func (source *verifySource) fieldKey(field *ast.Field, name string) string {
+	if !ast.IsExported(name) {
+		return ""
+	}
+	switch source.matchTag {
+	case "":
+		return name
+	case "db":
+		column, _ := dbColumnName(field)
+		return column
+	}
+	value, ok := structTag(field).Lookup(source.matchTag)
+	key, _, _ := strings.Cut(value, ",")
+	if key == "-" && !strings.Contains(value, ",") {
+		return ""
+	}
+	if !ok || key == "" {
+		return name
+	}
+	return key
+}
+
+func verifyStructs(source *verifySource, structs []*verifyStruct) []*verifyDrift {
+	var drifts []*verifyDrift
+	for _, expected := range source.structs {
+		vs := source.find(structs, expected.Name)
+		if vs == nil {
+			drifts = append(drifts, &verifyDrift{
+				Kind:    "missing_struct",
+				Struct:  expected.Name,
+				Pos:     source.path,
+				Message: fmt.Sprintf("%s is in %s but no annotated struct declares it", expected.Name, filepath.Base(source.path)),
+			})
+			continue
+		}
+		structName := vs.s.name()
+		type actualField struct {
+			name string
+			expr ast.Expr
+			pos  token.Pos
+		}
+		actual := make(map[string]*actualField)
+		var order []string
+		for _, field := range vs.s.structType().Fields.List {
+			for _, name := range field.Names {
+				if key := source.fieldKey(field, name.Name); key != "" {
+					actual[key] = &actualField{name: name.Name, expr: field.Type, pos: name.Pos()}
+					order = append(order, key)
+				}
+			}
+		}
+		matched := make(map[string]bool)
+		for _, f := range expected.Fields {
+			key := f.Name
+			if source.matchTag != "" {
+				key, _, _ = strings.Cut(f.Tags[source.matchTag], ",")
+			}
+			if key == "-" {
+				continue
+			}
+			a, ok := actual[key]
+			if !ok {
+				drifts = append(drifts, &verifyDrift{
+					Kind:    "missing_field",
+					Struct:  structName,
+					Field:   f.Name,
+					Schema:  f.Type,
+					Pos:     vs.t.fileSet.Position(vs.s.spec.Pos()).String(),
+					Message: fmt.Sprintf("%s has no field for %s (%s)", structName, key, strings.TrimPrefix(f.Type, "*")),
+				})
+				continue
+			}
+			matched[key] = true
+			expectedExpr, err := parser.ParseExpr(f.Type)
+			if err != nil {
+				continue
+			}
+			goType := getFiledTypeString(a.expr)
+			pos := vs.t.fileSet.Position(a.pos).String()
+			want, got := canonicalType(expectedExpr, nil), canonicalType(a.expr, vs.imports)
+			if want != "any" && want != got {
+				drifts = append(drifts, &verifyDrift{
+					Kind:    "type_mismatch",
+					Struct:  structName,
+					Field:   a.name,
+					Schema:  f.Type,
+					Go:      goType,
+					Pos:     pos,
+					Message: fmt.Sprintf("%s.%s is %s but %s says %s", structName, a.name, goType, filepath.Base(source.path), strings.TrimPrefix(f.Type, "*")),
+				})
+				continue
+			}
+			// NULLになるカラムをポインタでない型で読むとScanに失敗する
+			if source.matchTag == "db" && isPointerType(expectedExpr) && !isPointerType(a.expr) && !isNullableSQLType(a.expr, vs.imports) {
+				drifts = append(drifts, &verifyDrift{
+					Kind:    "nullable_mismatch",
+					Struct:  structName,
+					Field:   a.name,
+					Schema:  f.Type,
+					Go:      goType,
+					Pos:     pos,
+					Message: fmt.Sprintf("%s.%s is %s but column %s is nullable", structName, a.name, goType, key),
+				})
+			}
+		}
+		for _, key := range order {
+			a := actual[key]
+			// CreatedAtとUpdatedAtは-schemaで足すので、スキーマになくてよい
+			if matched[key] || containsTargetField(a.name, targetFields...) {
+				continue
+			}
+			name := a.name
+			if key != a.name {
+				name += " (" + key + ")"
+			}
+			drifts = append(drifts, &verifyDrift{
+				Kind:    "extra_field",
+				Struct:  structName,
+				Field:   a.name,
+				Go:      getFiledTypeString(a.expr),
+				Pos:     vs.t.fileSet.Position(a.pos).String(),
+				Message: fmt.Sprintf("%s.%s is not in %s", structName, name, filepath.Base(source.path)),
+			})
+		}
+	}
+	return drifts
+}
+
+func writeVerifyDrifts(w io.Writer, format string, drifts []*verifyDrift) error {
+	if format == "json" {
+		if drifts == nil {
+			drifts = []*verifyDrift{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(drifts)
+	}
+	for _, d := range drifts {
+		fmt.Fprintf(w, "%s: %s: %s\n", d.Pos, d.Kind, d.Message)
+	}
+	return nil
+}
+
+// canonicalType 比べるための型の文字列。ポインタは外し、整数と浮動小数点数は幅を問わず、
+// sql.NullStringなどは中の型にし、パッケージは既定の名前で参照する
+func canonicalType(expr ast.Expr, imports map[string]string) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return canonicalType(expr.X, imports)
+	case *ast.Ident:
+		switch expr.Name {
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr":
+			return "int"
+		case "float32", "float64":
+			return "float"
+		case "interface{}":
+			return "any"
+		}
+		return expr.Name
+	case *ast.SelectorExpr:
+		x, ok := expr.X.(*ast.Ident)
+		if !ok {
+			return getFiledTypeString(expr)
+		}
+		pkg := x.Name
+		if name, ok := imports[pkg]; ok {
+			pkg = name
+		}
+		if pkg == "sql" {
+			if base, ok := sqlNullTypes[expr.Sel.Name]; ok {
+				return base
+			}
+		}
+		return pkg + "." + expr.Sel.Name
+	case *ast.ArrayType:
+		if ident, ok := expr.Elt.(*ast.Ident); ok && (ident.Name == "byte" || ident.Name == "uint8") && expr.Len == nil {
+			return "[]byte"
+		}
+		length := ""
+		if expr.Len != nil {
+			length = types.ExprString(expr.Len)
+		}
+		return "[" + length + "]" + canonicalType(expr.Elt, imports)
+	case *ast.MapType:
+		return "map[" + canonicalType(expr.Key, imports) + "]" + canonicalType(expr.Value, imports)
+	case *ast.InterfaceType:
+		if len(expr.Methods.List) == 0 {
+			return "any"
+		}
+	}
+	return getFiledTypeString(expr)
+}
+
+// sqlNullTypes database/sqlのNULLを扱う型と、比べるときの型
+var sqlNullTypes = map[string]string{
+	"NullString": "string", "NullBool": "bool", "NullTime": "time.Time",
+	"NullInt16": "int", "NullInt32": "int", "NullInt64": "int", "NullByte": "int", "NullFloat64": "float",
+}
+
+func isPointerType(expr ast.Expr) bool {
+	_, ok := expr.(*ast.StarExpr)
+	return ok
+}
+
+// isNullableSQLType sql.Null[T]やsql.NullStringなど、NULLを読める型か
+func isNullableSQLType(expr ast.Expr, imports map[string]string) bool {
+	switch e := expr.(type) {
+	case *ast.IndexExpr:
+		expr = e.X
+	case *ast.ArrayType:
+		// []byteはNULLをnilとして読める
+		return e.Len == nil
+	}
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	pkg := x.Name
+	if name, ok := imports[pkg]; ok {
+		pkg = name
+	}
+	return pkg == "sql" && strings.HasPrefix(sel.Sel.Name, "Null")
+}
+
+var (
+	ddlCommentPattern = regexp.MustCompile(`(?s)--[^\n]*|/\*.*?\*/`)
+	ddlTablePattern   = regexp.MustCompile(`(?is)\bcreate\s+(?:temporary\s+|temp\s+)?table\s+(?:if\s+not\s+exists\s+)?([^\s(]+)\s*\(`)
+)
+
+// ddlConstraintWords カラムの定義で型の後に続く語。ここで型の名前が終わる
+var ddlConstraintWords = map[string]bool{
+	"not": true, "null": true, "default": true, "primary": true, "references": true, "unique": true, "check": true,
+	"constraint": true, "generated": true, "auto_increment": true, "autoincrement": true, "collate": true,
+	"comment": true, "on": true, "unsigned": true, "signed": true, "zerofill": true, "charset": true,
+}
+
+// parseDDLColumns CREATE TABLE文のカラムを読む。テーブルの制約（PRIMARY KEY (...)など）は読み飛ばす
+func parseDDLColumns(src string) ([]*dbColumn, error) {
+	src = ddlCommentPattern.ReplaceAllString(src, "")
+	var columns []*dbColumn
+	for _, m := range ddlTablePattern.FindAllStringSubmatchIndex(src, -1) {
+		table := unquoteDDLName(src[m[2]:m[3]])
+		if i := strings.LastIndex(table, "."); i >= 0 {
+			table = unquoteDDLName(table[i+1:])
+		}
+		body, ok := ddlParenBody(src[m[1]:])
+		if !ok {
+			return nil, fmt.Errorf("CREATE TABLE %s is not closed", table)
+		}
+		for _, def := range splitDDLDefinitions(body) {
+			words := strings.Fields(def)
+			if len(words) < 2 {
+				continue
+			}
+			switch strings.ToLower(words[0]) {
+			case "primary", "unique", "constraint", "foreign", "key", "index", "check", "exclude", "fulltext", "spatial":
+				continue
+			}
+			c := &dbColumn{table: table, name: unquoteDDLName(words[0]), nullable: true}
+			var typeWords []string
+			rest := words[1:]
+			// MySQLのCHARACTER SETも型の後に続く
+			for len(rest) > 0 && !ddlConstraintWords[strings.ToLower(rest[0])] &&
+				!(len(rest) > 1 && strings.EqualFold(rest[0], "character") && strings.EqualFold(rest[1], "set")) {
+				typeWords = append(typeWords, rest[0])
+				rest = rest[1:]
+			}
+			c.dataType = ddlTypeName(strings.Join(typeWords, " "))
+			lower := strings.ToLower(strings.Join(rest, " "))
+			if strings.Contains(lower, "not null") || strings.Contains(lower, "primary key") {
+				c.nullable = false
+			}
+			columns = append(columns, c)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no CREATE TABLE statements")
+	}
+	return columns, nil
+}
+
+// ddlTypeName varchar(255)やnumeric(10, 2)の括弧を外す
+func ddlTypeName(s string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range s {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// ddlParenBody 開き括弧の後から、対応する閉じ括弧までの文字列
+func ddlParenBody(s string) (string, bool) {
+	depth := 1
+	var quote rune
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth == 0 {
+				return s[:i], true
+			}
+		}
+	}
+	return "", false
+}
+
+// splitDDLDefinitions 括弧と引用符の外のカンマで分ける
+func splitDDLDefinitions(body string) []string {
+	var defs []string
+	depth, start := 0, 0
+	var quote rune
+	for i, r := range body {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			defs = append(defs, strings.TrimSpace(body[start:i]))
+			start = i + 1
+		}
+	}
+	return append(defs, strings.TrimSpace(body[start:]))
+}
+
+func unquoteDDLName(name string) string {
+	return strings.Trim(name, "\"`[]")
+}
@@ -0,0 +1,115 @@
+package gen
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+
+	"golang.org/x/mod/modfile"
+)
+
+const modulePath = "github.com/kosuke-taniguchi/go-gen-struct"
+
+// toolVersion 実行中のバイナリのモジュールバージョン。
+// go install/go runではmain module、go toolでは依存モジュールとして記録される
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(unknown)"
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != modulePath {
+			continue
+		}
+		if dep.Replace != nil {
+			return dep.Replace.Version
+		}
+		return dep.Version
+	}
+	return "(unknown)"
+}
+
+// runVersion バージョンを表示する。-checkでgo.modに固定されたバージョンと比較する
+func runVersion(args []string) error {
+	flags := flag.NewFlagSet("version", flag.ExitOnError)
+	check := flags.Bool("check", false, "compare the binary version with the version pinned in go.mod")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	current := toolVersion()
+	fmt.Println(current)
+	if !*check {
+		return nil
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	gomod, err := findGoMod(dir)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		return err
+	}
+	f, err := modfile.ParseLax(gomod, data, nil)
+	if err != nil {
+		return err
+	}
+	if f.Module != nil && f.Module.Mod.Path == modulePath {
+		return nil
+	}
+	var pinned string
+	for _, req := range f.Require {
+		if req.Mod.Path == modulePath {
+			pinned = req.Mod.Version
+		}
+	}
+	if pinned == "" {
+		log.Printf("warning: %s is not required in %s (add it with: go get -tool %s)", modulePath, gomod, modulePath)
+		return nil
+	}
+	if !isToolDirective(f) {
+		log.Printf("warning: %s is required but not declared as a tool in %s", modulePath, gomod)
+	}
+	if pinned != current {
+		log.Printf("warning: binary version %s differs from %s pinned in %s (run it with: go tool go-gen-struct)", current, pinned, gomod)
+	}
+	return nil
+}
+
+func isToolDirective(f *modfile.File) bool {
+	for _, tool := range f.Tool {
+		if tool.Path == modulePath {
+			return true
+		}
+	}
+	return false
+}
+
+// findGoMod dirから親ディレクトリへ向かってgo.modを探す
+func findGoMod(dir string) (string, error) {
+	for {
+		path := filepath.Join(dir, "go.mod")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("go.mod not found")
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,99 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// visitor //gen:visitorで生成する、フィールドを順に渡すメソッドとインターフェース
+type visitor struct {
+	StructName    string
+	InterfaceName string // ExampleFieldVisitor
+	Fields        []*visitedField
+}
+
+type visitedField struct {
+	FieldName  string
+	FieldType  string
+	MethodName string // VisitName
+}
+
+// newVisitor エクスポートされたフィールド（fields=で指定すればそのフィールド）を宣言の順に並べる
+func newVisitor(r *renderer, target *directiveTarget) (*visitor, error) {
+	structName := target.s.name()
+	structType := target.s.structType()
+	var selected []string
+	if v, ok := target.d.arg("fields"); ok {
+		selected = strings.Split(v, ",")
+		for _, name := range selected {
+			if !hasField(structType, name) {
+				return nil, fmt.Errorf("%s: //gen:visitor field %s does not exist", structName, name)
+			}
+		}
+	}
+	v := &visitor{StructName: structName, InterfaceName: exportedName(structName) + "FieldVisitor"}
+	if !ast.IsExported(structName) {
+		v.InterfaceName = unexportedName(v.InterfaceName)
+	}
+	v.InterfaceName = r.ident(v.InterfaceName)
+	for _, field := range structType.Fields.List {
+		for _, name := range field.Names {
+			if selected != nil && !containsTargetField(name.Name, selected...) || selected == nil && !ast.IsExported(name.Name) {
+				continue
+			}
+			v.Fields = append(v.Fields, &visitedField{
+				FieldName:  name.Name,
+				FieldType:  r.typeString(field.Type),
+				MethodName: "Visit" + exportedName(name.Name),
+			})
+		}
+	}
+	return v, nil
+}
+
+// renderVisitor //gen:visitorのついた構造体に、リフレクションなしでフィールドを走査するVisitFieldsとAcceptを生成する
+func renderVisitor(r *renderer, targets []*directiveTarget) error {
+	visitors := make([]*visitor, 0, len(targets))
+	for _, target := range targets {
+		v, err := newVisitor(r, target)
+		if err != nil {
+			return err
+		}
+		visitors = append(visitors, v)
+	}
+	return r.execute("visitor", visitorTemplate, visitors)
+}
+
+const visitorTemplate = `
+{{range .}}
+{{- $v := .}}
+// {{.InterfaceName}} receives every visited field of a {{.StructName}} with its static type.
+type {{.InterfaceName}} interface {
+	{{- range .Fields}}
+	{{.MethodName}}(v {{.FieldType}}) error
+	{{- end}}
+}
+
+// VisitFields calls f with the name and value of each visited field in declaration
+// order and stops at the first error.
+func (s *{{.StructName}}) VisitFields(f func(name string, value any) error) error {
+	{{- range .Fields}}
+	if err := f("{{.FieldName}}", s.{{.FieldName}}); err != nil {
+		return err
+	}
+	{{- end}}
+	return nil
+}
+
+// Accept passes each visited field to the matching method of v and stops at the first error.
+func (s *{{.StructName}}) Accept(v {{.InterfaceName}}) error {
+	{{- range .Fields}}
+	if err := v.{{.MethodName}}(s.{{.FieldName}}); err != nil {
+		return err
+	}
+	{{- end}}
+	return nil
+}
+{{end}}
+`
@@ -0,0 +1,193 @@
+package gen
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// watchStamp 変更を見分けるためのファイルの更新日時と大きさ
+type watchStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// runWatch ソースファイルと設定ファイルを定期的に調べ、変わったら生成し直して書き込む。
+// git checkoutや保存時の整形で多くのファイルが続けて変わっても、-debounceの間変更がなくなるまで待ち、
+// 1回の生成にまとめる。生成中に変わったファイルは次の回で生成する
+func runWatch(args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	dir := flags.String("dir", ".", "directory to watch and generate code for")
+	interval := flags.Duration("interval", 500*time.Millisecond, "how often to look for changed files")
+	debounce := flags.Duration("debounce", time.Second, "regenerate only after no file has changed for this long, so that bursts of changes become one pass")
+	compat := flags.String("compat", "", "output version to emit (e.g. v1 or latest); by default regenerated files keep the version recorded in their header")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *interval <= 0 || *debounce < 0 {
+		return fmt.Errorf("invalid -interval %s or -debounce %s", *interval, *debounce)
+	}
+	var version int
+	if *compat != "" {
+		var err error
+		if version, err = parseOutputVersion(*compat); err != nil {
+			return err
+		}
+	}
+	root, err := filepath.Abs(*dir)
+	if err != nil {
+		return err
+	}
+	stamps, err := watchedFiles(root)
+	if err != nil {
+		return err
+	}
+	// 起動時に一度生成し、見ている間の変更だけを待てばよい状態にする
+	log.Printf("watching %s (%d files)", root, len(stamps))
+	refreshStamps(stamps, watchRegenerate(root, version, nil))
+	pending := make(map[string]bool)
+	var lastChange time.Time
+	for range time.Tick(*interval) {
+		current, err := watchedFiles(root)
+		if err != nil {
+			log.Println(err.Error())
+			continue
+		}
+		changed := changedFiles(stamps, current)
+		stamps = current
+		if len(changed) > 0 {
+			for _, path := range changed {
+				pending[path] = true
+			}
+			lastChange = time.Now()
+			continue
+		}
+		if len(pending) == 0 || time.Since(lastChange) < *debounce {
+			continue
+		}
+		paths := make([]string, 0, len(pending))
+		for path := range pending {
+			paths = append(paths, path)
+		}
+		slices.Sort(paths)
+		clear(pending)
+		refreshStamps(stamps, watchRegenerate(root, version, paths))
+	}
+	return nil
+}
+
+// watchRegenerate rootの配下を生成して書き込み、経過を表示する。書き込んだり消したりしたファイルを返す
+func watchRegenerate(root string, version int, changed []string) []string {
+	start := time.Now()
+	if changed != nil {
+		log.Printf("%d files changed (%s); regenerating", len(changed), summarizePaths(root, changed, 5))
+	}
+	g, err := generateTree(root, version)
+	if err != nil {
+		log.Println(err.Error())
+		return nil
+	}
+	for _, line := range logLines(g.logs) {
+		log.Println(line)
+	}
+	written, unchanged, errs := g.write()
+	for _, path := range written {
+		log.Printf("wrote %s", path)
+	}
+	for _, err := range errs {
+		log.Println(err.Error())
+	}
+	log.Printf("generated %d files (%d written, %d unchanged, %d failed) in %s",
+		len(g.generated), len(written), unchanged, g.out.failures+len(errs), time.Since(start).Round(time.Millisecond))
+	return append(written, g.stale...)
+}
+
+// watchedFiles rootの配下の.goファイルと設定ファイル。goコマンドと同じく、.と_で始まるディレクトリ、vendor、testdataは見ない
+func watchedFiles(root string) (map[string]watchStamp, error) {
+	stamps := make(map[string]watchStamp)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// 調べている間に消えたファイルは次の回で消えたものとして扱う
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") && name != configFileName {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		stamps[path] = watchStamp{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	return stamps, err
+}
+
+// changedFiles previousからcurrentまでに追加、変更、削除されたファイル
+func changedFiles(previous, current map[string]watchStamp) []string {
+	var changed []string
+	for path, stamp := range current {
+		if old, ok := previous[path]; !ok || old != stamp {
+			changed = append(changed, path)
+		}
+	}
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	return changed
+}
+
+// refreshStamps 自分で書き込んだり消したりしたファイルを今の状態にし、次の生成のきっかけにしない。
+// 生成中に手で変えたソースファイルは古い状態のままにしておくので、次の回で変更として見つかる
+func refreshStamps(stamps map[string]watchStamp, paths []string) {
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			delete(stamps, path)
+			continue
+		}
+		stamps[path] = watchStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+}
+
+// summarizePaths rootからの相対パスをmax個まで並べ、残りは数だけ示す
+func summarizePaths(root string, paths []string, max int) string {
+	var names []string
+	for i, path := range paths {
+		if i == max {
+			names = append(names, fmt.Sprintf("and %d more", len(paths)-max))
+			break
+		}
+		if rel, err := filepath.Rel(root, path); err == nil {
+			path = rel
+		}
+		names = append(names, path)
+	}
+	return strings.Join(names, ", ")
+}
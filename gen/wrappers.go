@@ -0,0 +1,158 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// wrapperKinds //gen:wrappersで生成できる型
+var wrapperKinds = []string{"optional", "result"}
+
+// wrappers //gen:wrappersで生成する、構造体の値を包む型
+type wrappers struct {
+	StructName string
+	// OptionalExampleと、それを作るSomeExample, NoneExample
+	Optional string
+	Some     string
+	None     string
+	// ExampleResultと、それを作るNewExampleResult
+	Result    string
+	NewResult string
+}
+
+// newWrappers 引数の種類（省略すると両方）の名前を決める。エクスポートされていない構造体では名前もエクスポートしない
+func newWrappers(r *renderer, target *directiveTarget) (*wrappers, error) {
+	structName := target.s.name()
+	kinds := make(map[string]bool)
+	for _, arg := range target.d.args {
+		for _, kind := range strings.Split(arg.key, ",") {
+			if !containsTargetField(kind, wrapperKinds...) || arg.value != "" {
+				return nil, fmt.Errorf("%s: unknown //gen:wrappers %s (want %s)", structName, kind, strings.Join(wrapperKinds, ", "))
+			}
+			kinds[kind] = true
+		}
+	}
+	if len(kinds) == 0 {
+		for _, kind := range wrapperKinds {
+			kinds[kind] = true
+		}
+	}
+	name := exportedName(structName)
+	w := &wrappers{StructName: structName}
+	if kinds["optional"] {
+		w.Optional, w.Some, w.None = "Optional"+name, "Some"+name, "None"+name
+	}
+	if kinds["result"] {
+		w.Result, w.NewResult = name+"Result", "New"+name+"Result"
+	}
+	for _, n := range []*string{&w.Optional, &w.Some, &w.None, &w.Result, &w.NewResult} {
+		if *n == "" {
+			continue
+		}
+		if !ast.IsExported(structName) {
+			*n = unexportedName(*n)
+		}
+		*n = r.ident(*n)
+	}
+	return w, nil
+}
+
+// renderWrappers //gen:wrappersのついた構造体に、値がないことを表すOptionalXと、値かエラーを持つXResultを生成する
+func renderWrappers(r *renderer, targets []*directiveTarget) error {
+	all := make([]*wrappers, 0, len(targets))
+	for _, target := range targets {
+		w, err := newWrappers(r, target)
+		if err != nil {
+			return err
+		}
+		all = append(all, w)
+	}
+	return r.execute("wrappers", wrappersTemplate, all)
+}
+
+const wrappersTemplate = `
+{{range .}}
+{{- if .Optional}}
+// {{.Optional}} is a {{.StructName}} that may be absent.
+type {{.Optional}} struct {
+	value {{.StructName}}
+	ok    bool
+}
+
+// {{.Some}} returns an {{.Optional}} holding v.
+func {{.Some}}(v {{.StructName}}) {{.Optional}} {
+	return {{.Optional}}{value: v, ok: true}
+}
+
+// {{.None}} returns an empty {{.Optional}}.
+func {{.None}}() {{.Optional}} {
+	return {{.Optional}}{}
+}
+
+// Get returns the value and whether it is present.
+func (o {{.Optional}}) Get() ({{.StructName}}, bool) {
+	return o.value, o.ok
+}
+
+// IsPresent reports whether o holds a value.
+func (o {{.Optional}}) IsPresent() bool {
+	return o.ok
+}
+
+// OrElse returns the value, or v when o is empty.
+func (o {{.Optional}}) OrElse(v {{.StructName}}) {{.StructName}} {
+	if !o.ok {
+		return v
+	}
+	return o.value
+}
+
+// Map applies f to the value when it is present.
+func (o {{.Optional}}) Map(f func({{.StructName}}) {{.StructName}}) {{.Optional}} {
+	if !o.ok {
+		return o
+	}
+	return {{.Some}}(f(o.value))
+}
+{{end}}
+{{- if .Result}}
+// {{.Result}} is a {{.StructName}} or the error that prevented producing it.
+type {{.Result}} struct {
+	value {{.StructName}}
+	err   error
+}
+
+// {{.NewResult}} wraps the results of a function returning ({{.StructName}}, error).
+func {{.NewResult}}(v {{.StructName}}, err error) {{.Result}} {
+	return {{.Result}}{value: v, err: err}
+}
+
+// Get returns the value and the error.
+func (r {{.Result}}) Get() ({{.StructName}}, error) {
+	return r.value, r.err
+}
+
+// Err returns the error, or nil when r holds a value.
+func (r {{.Result}}) Err() error {
+	return r.err
+}
+
+// OrElse returns the value, or v when r holds an error.
+func (r {{.Result}}) OrElse(v {{.StructName}}) {{.StructName}} {
+	if r.err != nil {
+		return v
+	}
+	return r.value
+}
+
+// Map applies f to the value unless r already holds an error.
+func (r {{.Result}}) Map(f func({{.StructName}}) ({{.StructName}}, error)) {{.Result}} {
+	if r.err != nil {
+		return r
+	}
+	return {{.NewResult}}(f(r.value))
+}
+{{end}}
+{{- end}}
+`
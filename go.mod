@@ -1,3 +1,11 @@
 module github.com/kosuke-taniguchi/go-gen-struct
 
 go 1.23.4
+
+require (
+	golang.org/x/mod v0.24.0
+	golang.org/x/tools v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sync v0.12.0 // indirect
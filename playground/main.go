@@ -0,0 +1,92 @@
+//go:build js && wasm
+
+// playground はブラウザで動かすgo-gen-structのコード生成。
+// GOOS=js GOARCH=wasm でビルドし、index.htmlから読み込むと、グローバルの関数genStructを定義する。
+//
+//	genStruct(src, {fields: "*", prefix: "", chain: false, compat: ""})
+//	// => {output: "...", warnings: [...], error: ""}
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"syscall/js"
+	"testing/fstest"
+
+	"github.com/kosuke-taniguchi/go-gen-struct/gen"
+)
+
+// sourceName 入力したソースのファイル名。生成したコードのヘッダーに書く
+const sourceName = "playground.go"
+
+func main() {
+	js.Global().Set("genStruct", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) == 0 {
+			return result("", nil, "genStruct: missing source")
+		}
+		var options js.Value
+		if len(args) > 1 {
+			options = args[1]
+		}
+		output, warnings, err := generate(args[0].String(), options)
+		if err != nil {
+			return result(output, warnings, err.Error())
+		}
+		return result(output, warnings, "")
+	}))
+	// Goのプログラムが終わると登録した関数を呼べなくなる
+	select {}
+}
+
+// generate srcだけのパッケージをメモリ上のファイルシステムに置いて生成する。
+// package句がなければpackage mainとして読む
+func generate(src string, options js.Value) (string, []string, error) {
+	if _, err := parser.ParseFile(token.NewFileSet(), "", src, parser.PackageClauseOnly); err != nil {
+		src = "package main\n//line " + sourceName + ":1:1\n" + src
+	}
+	fsys := fstest.MapFS{sourceName: &fstest.MapFile{Data: []byte(src)}}
+	pkg, err := gen.ParseFS(fsys, ".")
+	if err != nil {
+		return "", nil, err
+	}
+	g := &gen.Generator{Package: pkg}
+	if fields := stringOption(options, "fields"); fields != "" {
+		g.Fields = strings.Split(fields, ",")
+	}
+	g.Prefix = stringOption(options, "prefix")
+	if options.Type() == js.TypeObject {
+		g.Chain = options.Get("chain").Truthy()
+	}
+	if compat := stringOption(options, "compat"); compat != "" {
+		if g.Version, err = strconv.Atoi(strings.TrimPrefix(compat, "v")); err != nil {
+			return "", pkg.Warnings, err
+		}
+	}
+	var out bytes.Buffer
+	if err := g.Generate(&out); err != nil {
+		return "", pkg.Warnings, err
+	}
+	return out.String(), pkg.Warnings, nil
+}
+
+func stringOption(options js.Value, name string) string {
+	if options.Type() != js.TypeObject {
+		return ""
+	}
+	v := options.Get(name)
+	if v.Type() != js.TypeString {
+		return ""
+	}
+	return v.String()
+}
+
+func result(output string, warnings []string, err string) map[string]any {
+	list := make([]any, len(warnings))
+	for i, w := range warnings {
+		list[i] = w
+	}
+	return map[string]any{"output": output, "warnings": list, "error": err}
+}